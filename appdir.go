@@ -0,0 +1,175 @@
+package main
+
+import (
+	"debug/elf"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// AppDirFile is an ELF file found in an AppDir
+type AppDirFile struct {
+	Path    string   `json:"path"` // relative to the AppDir
+	Size    int64    `json:"size"`
+	Arch    string   `json:"arch"`
+	RPath   string   `json:"rpath"`   // "none", "origin", "absolute" or "insecure"
+	Missing []string `json:"missing"` // DT_NEEDED entries that do not resolve
+}
+
+// AppDirReport summarizes the ELF files of an AppDir before it is squashed
+// into an AppImage
+type AppDirReport struct {
+	Root          string       `json:"root"`
+	Files         []AppDirFile `json:"files"`
+	Architectures []string     `json:"architectures"`
+	Mixed         bool         `json:"mixed"` // more than one architecture
+	ElfSize       int64        `json:"elf_size"`
+	PayloadSize   int64        `json:"payload_size"` // of all regular files
+}
+
+// GetAppDirReport scans the tree at root, e.g. an AppDir, for ELF files and
+// reports their size, architecture, the state of their RPATH and RUNPATH and
+// the libraries they need that do not resolve, the way the dynamic linker
+// searches for them from the AppDir. Symbolic links are not followed
+func GetAppDirReport(root string) (*AppDirReport, error) {
+	report := &AppDirReport{Root: root, Files: []AppDirFile{}, Architectures: []string{}}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		report.PayloadSize += info.Size()
+		if !isElfCandidate(path, d) {
+			return nil
+		}
+		file, err := appDirFile(root, path, info.Size())
+		if err != nil {
+			printWarning("appdir", err)
+			return nil
+		}
+		report.Files = append(report.Files, *file)
+		report.ElfSize += file.Size
+		if !slices.Contains(report.Architectures, file.Arch) {
+			report.Architectures = append(report.Architectures, file.Arch)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(report.Architectures)
+	report.Mixed = len(report.Architectures) > 1
+	return report, nil
+}
+
+// appDirFile returns what GetAppDirReport reports about an ELF file
+func appDirFile(root, path string, size int64) (*AppDirFile, error) {
+	r, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(path, r)
+	if err != nil {
+		return nil, err
+	}
+	rel, _ := filepath.Rel(root, path)
+	file := &AppDirFile{Path: rel, Size: size, Arch: elfArchitecture(f), RPath: "none", Missing: []string{}}
+
+	entries, err := elfSearchPaths(f)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		switch {
+		case entry.Insecure:
+			file.RPath = "insecure"
+		case entry.Problem == msgRpathAbsolute && file.RPath != "insecure":
+			file.RPath = "absolute"
+		case file.RPath == "none":
+			file.RPath = "origin"
+		}
+	}
+
+	if hasProg(f, elf.PT_DYNAMIC) {
+		libs, err := ResolveDependencies(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, lib := range libs {
+			// Those missing further down the tree are reported for the file
+			// in the AppDir that needs them, if it is one
+			if lib.Path == "" && lib.NeededBy == path {
+				file.Missing = append(file.Missing, lib.Name)
+			}
+		}
+	}
+	return file, nil
+}
+
+// appDirCommand implements "elfsize appdir <dir>"
+func appDirCommand(args []string) int {
+	fs := flag.NewFlagSet("appdir", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s appdir [--json] <dir>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    List the size, architecture and RPATH state of every ELF file in an\n")
+		fmt.Fprintf(os.Stderr, "    AppDir, and the libraries they need that are not found, then on stderr\n")
+		fmt.Fprintf(os.Stderr, "    the total size of the AppDir\n")
+		fmt.Fprintf(os.Stderr, "    Exits with 1 if it mixes architectures or a library is not found\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	report, err := GetAppDirReport(positional[0])
+	if err != nil {
+		PrintError("appdir", err)
+		return 1
+	}
+	status := 0
+	if report.Mixed {
+		status = 1
+	}
+	for _, file := range report.Files {
+		if len(file.Missing) > 0 {
+			status = 1
+		}
+	}
+	if *asJSON {
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+		return status
+	}
+	for _, file := range report.Files {
+		fmt.Printf("%d\t%s\t%s\t%s\n", file.Size, file.Arch, file.RPath, file.Path)
+	}
+	for _, file := range report.Files {
+		for _, lib := range file.Missing {
+			fmt.Printf("missing\t%s\t%s\n", lib, file.Path)
+		}
+	}
+	if report.Mixed {
+		printWarning("appdir", errors.New(Tr(msgAppDirMixed, strings.Join(report.Architectures, ", "))))
+	}
+	fmt.Fprintln(os.Stderr, Tr(msgAppDirTotal, len(report.Files), report.ElfSize, report.PayloadSize))
+	return status
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"debug/elf"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// appImageMagic is written by AppImage runtimes into the padding of the ELF
+// identification at offset 8, followed by the AppImage type
+const appImageMagic = "AI"
+
+// appImageType returns 1 or 2 for type-1 and type-2 AppImages, and 0 for
+// other files
+func appImageType(r io.ReaderAt) int {
+	var magic [3]byte
+	if _, err := r.ReadAt(magic[:], 8); err != nil || string(magic[:2]) != appImageMagic {
+		return 0
+	}
+	if magic[2] == 1 || magic[2] == 2 {
+		return int(magic[2])
+	}
+	return 0
+}
+
+// GetAppImageType returns 1 or 2 if a file is a type-1 or type-2 AppImage,
+// 0 if it is not an AppImage, and err
+func GetAppImageType(filepath string) (int, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	if _, err := parseElf(filepath, r); err != nil {
+		return 0, err
+	}
+	return appImageType(r), nil
+}
+
+// Payload is a filesystem image carried by an executable, such as the
+// contents of an AppImage
+type Payload struct {
+	Format   string    `json:"format"` // "iso9660" or "squashfs"
+	Offset   int64     `json:"offset"`
+	Size     int64     `json:"size"`
+	Problems []Problem `json:"-"` // size mismatches with the file
+}
+
+// AppImageMetadata is what desktop integration needs from an AppImage
+type AppImageMetadata struct {
+	DesktopName string // file name of the desktop entry
+	Desktop     []byte // contents of the desktop entry
+	Icon        []byte // contents of .DirIcon
+}
+
+// GetPayload returns the filesystem image carried by a file, or nil if
+// there is none, and err.
+// Type-1 AppImages are ISO 9660 images starting at offset 0, with the ELF
+// runtime living in the system area that ISO 9660 leaves unused. Type-2
+// AppImages append a squashfs image to the runtime, right at its ELF size.
+// Problems lists where the size recorded in the payload does not match the file
+func GetPayload(filepath string) (*Payload, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	stat, err := r.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var payload *Payload
+	if iso, err := openISO9660(r, 0); err == nil {
+		payload = &Payload{Format: "iso9660", Offset: 0, Size: iso.size}
+	} else if f, err := parseElf(filepath, r); err == nil {
+		offset, err := headerEnd(f, r)
+		if err != nil {
+			return nil, err
+		}
+		if sb, err := readSquashfsSuperblock(r, offset); err == nil {
+			payload = &Payload{Format: "squashfs", Offset: offset, Size: int64(sb.BytesUsed)}
+		}
+	}
+	if payload != nil {
+		payload.Problems = payloadProblems(payload, stat.Size())
+	}
+	return payload, nil
+}
+
+// payloadFS is what metadata extraction needs from a payload filesystem
+type payloadFS interface {
+	// rootNames lists the root directory
+	rootNames() ([]string, error)
+	// readRootFile returns the contents of a regular file in the root
+	// directory, following symbolic links, and whether there is one
+	readRootFile(name string) ([]byte, bool, error)
+	// readPath is readRootFile for a path from the root directory
+	readPath(name string) ([]byte, bool, error)
+}
+
+// openPayloadFS opens the filesystem an AppImage carries: ISO 9660 at the
+// start of type-1 AppImages, squashfs after the runtime of type-2 ones. It
+// returns nil if there is none
+func openPayloadFS(r io.ReaderAt) (payloadFS, error) {
+	if iso, err := openISO9660(r, 0); err == nil {
+		return iso, nil
+	}
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return nil, nil
+	}
+	offset, err := headerEnd(f, r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := readSquashfsSuperblock(r, offset); err != nil {
+		return nil, nil
+	}
+	return openSquashfs(r, offset)
+}
+
+// GetAppImageMetadata returns the top-level desktop entry and .DirIcon of an
+// AppImage without mounting it, and err. Squashfs payloads compressed with
+// xz or zstd need the xz or zstd program
+func GetAppImageMetadata(filepath string) (*AppImageMetadata, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	fs, err := openPayloadFS(r)
+	if err != nil {
+		return nil, err
+	}
+	if fs == nil {
+		return nil, errors.New(Tr(msgNoPayload, filepath))
+	}
+
+	names, err := fs.rootNames()
+	if err != nil {
+		return nil, err
+	}
+	meta := &AppImageMetadata{}
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".desktop") {
+			continue
+		}
+		data, ok, err := fs.readRootFile(name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			meta.DesktopName = name
+			meta.Desktop = data
+			break
+		}
+	}
+	if meta.Icon, _, err = fs.readRootFile(".DirIcon"); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// payloadCommand implements "elfsize payload <file>"
+func payloadCommand(args []string) int {
+	fs := flag.NewFlagSet("payload", flag.ContinueOnError)
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s payload <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the format, offset and size of the filesystem image an AppImage carries\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	payload, err := GetPayload(positional[0])
+	if err != nil {
+		PrintError("payload", err)
+		return 1
+	}
+	if payload == nil {
+		PrintError("payload", errors.New(Tr(msgNoPayload, positional[0])))
+		return 1
+	}
+	fmt.Printf("%s %d %d\n", payload.Format, payload.Offset, payload.Size)
+	for _, p := range payload.Problems {
+		logger.Warn(fmt.Sprintf("%s: %s [%s]", positional[0], p.Message, p.ID), "id", p.ID)
+	}
+	if len(payload.Problems) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// MountOptions returns the mount(8) arguments that loop-mount a payload
+// read-only, for example "-t squashfs -o ro,offset=193724"
+func (p *Payload) MountOptions() string {
+	return fmt.Sprintf("-t %s -o ro,offset=%d", p.Format, p.Offset)
+}
+
+// mountOptsCommand implements "elfsize mount-opts <appimage>"
+func mountOptsCommand(args []string) int {
+	fs := flag.NewFlagSet("mount-opts", flag.ContinueOnError)
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s mount-opts <appimage>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the mount options that loop-mount the filesystem image an AppImage carries\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	payload, err := GetPayload(positional[0])
+	if err != nil {
+		PrintError("mount-opts", err)
+		return 1
+	}
+	if payload == nil {
+		PrintError("mount-opts", errors.New(Tr(msgNoPayload, positional[0])))
+		return 1
+	}
+	fmt.Println(payload.MountOptions())
+	return 0
+}
+
+// appimageExtractCommand implements "elfsize appimage-extract <appimage> [-d dir]"
+func appimageExtractCommand(args []string) int {
+	fs := flag.NewFlagSet("appimage-extract", flag.ContinueOnError)
+	dir := fs.String("d", ".", "directory to write the desktop entry and .DirIcon to")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s appimage-extract <appimage> [-d dir]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Extract the desktop entry and .DirIcon of an AppImage without mounting it\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	meta, err := GetAppImageMetadata(positional[0])
+	if err != nil {
+		PrintError("appimage-extract", err)
+		return 1
+	}
+	status := 0
+	if meta.Desktop != nil {
+		out := filepath.Join(*dir, filepath.Base(meta.DesktopName))
+		if err := os.WriteFile(out, meta.Desktop, 0644); err != nil {
+			PrintError("appimage-extract", err)
+			return 1
+		}
+		fmt.Println(out)
+		for _, finding := range ValidateDesktopEntry(meta.Desktop) {
+			logger.Warn(fmt.Sprintf("%s: %s: %s [%s]", meta.DesktopName, finding.Severity, finding.Message, finding.ID), "id", finding.ID)
+		}
+	} else {
+		PrintError("appimage-extract", errors.New(Tr(msgNoDesktopEntry, positional[0])))
+		status = 1
+	}
+	if meta.Icon != nil {
+		out := filepath.Join(*dir, ".DirIcon")
+		if err := os.WriteFile(out, meta.Icon, 0644); err != nil {
+			PrintError("appimage-extract", err)
+			return 1
+		}
+		fmt.Println(out)
+	}
+	return status
+}
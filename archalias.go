@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ArchitectureAliases overrides the names GetElfArchitecture returns, for
+// vendor architectures or for distributions that name things differently
+var ArchitectureAliases = map[elf.Machine]string{}
+
+// LoadArchitectureAliases adds the aliases from a file to ArchitectureAliases,
+// and returns err. The file maps machines, given by EM_* name or by number,
+// to names, either as a JSON object:
+//
+//	{"EM_ARM": "armv7l", "0x9080": "vendorcpu"}
+//
+// or, for files ending in .toml, as lines of the form
+//
+//	EM_ARM = "armv7l"
+func LoadArchitectureAliases(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	aliases := map[string]string{}
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		aliases, err = parseFlatTOML(data)
+	} else {
+		err = json.Unmarshal(data, &aliases)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for key, name := range aliases {
+		machine, err := parseMachine(key)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		ArchitectureAliases[machine] = name
+	}
+	return nil
+}
+
+// parseMachine accepts an EM_* constant name or a number
+func parseMachine(key string) (elf.Machine, error) {
+	if v, err := strconv.ParseUint(key, 0, 16); err == nil {
+		return elf.Machine(v), nil
+	}
+	name := strings.ToUpper(key)
+	if !strings.HasPrefix(name, "EM_") {
+		name = "EM_" + name
+	}
+	for m := 0; m <= 0xffff; m++ {
+		if elf.Machine(m).String() == name {
+			return elf.Machine(m), nil
+		}
+	}
+	return 0, errors.New(Tr(msgUnknownMachine, key))
+}
+
+// parseFlatTOML reads the key = "value" pairs of a TOML document without
+// nested structures, which is all an alias table needs. Table headers are
+// ignored so that the pairs may be grouped
+func parseFlatTOML(data []byte) (map[string]string, error) {
+	values := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "[") {
+			continue
+		}
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("%s: %s", Tr(msgAtLine, n), Tr(msgExpectedTOMLPair))
+		}
+		key := strings.Trim(strings.TrimSpace(line[:eq]), `"'`)
+		value, err := strconv.Unquote(strings.TrimSpace(line[eq+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", Tr(msgAtLine, n), Tr(msgTOMLUnquoted))
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
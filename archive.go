@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// arMagic starts an ar archive such as a static library
+const arMagic = "!<arch>\n"
+
+// ArchiveMember is a file in an ar archive
+type ArchiveMember struct {
+	Name       string `json:"name"`
+	Offset     int64  `json:"offset"`      // of the member data
+	StoredSize int64  `json:"stored_size"` // as recorded in the member header
+	ElfSize    int64  `json:"elf_size"`    // computed from the ELF header, 0 if not ELF
+	Arch       string `json:"arch"`
+}
+
+// isArchive reports whether r starts with the ar magic
+func isArchive(r io.ReaderAt) bool {
+	var magic [len(arMagic)]byte
+	_, err := r.ReadAt(magic[:], 0)
+	return err == nil && string(magic[:]) == arMagic
+}
+
+// GetArchiveMembers returns the members of an ar archive in both the GNU
+// and the BSD format, without the symbol and long name tables, and err
+func GetArchiveMembers(filepath string) ([]ArchiveMember, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	stat, err := r.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return archiveMembers(r, stat.Size())
+}
+
+// archiveMembers does the work of GetArchiveMembers on an opened file
+func archiveMembers(r io.ReaderAt, fileSize int64) ([]ArchiveMember, error) {
+	if !isArchive(r) {
+		return nil, errors.New(Tr(msgNotArchive))
+	}
+	var members []ArchiveMember
+	var longNames []byte
+	for off := int64(len(arMagic)); off+60 <= fileSize; {
+		var hdr [60]byte
+		if _, err := r.ReadAt(hdr[:], off); err != nil {
+			return nil, err
+		}
+		size, err := strconv.ParseInt(strings.TrimSpace(string(hdr[48:58])), 10, 64)
+		if err != nil || string(hdr[58:60]) != "`\n" || size < 0 || off+60+size > fileSize {
+			return nil, errors.New(Tr(msgBadArchive, off))
+		}
+		data := off + 60
+		next := data + size + size%2
+		name := strings.TrimRight(string(hdr[:16]), " ")
+
+		switch {
+		case name == "/" || name == "/SYM64/" || strings.HasPrefix(name, "__.SYMDEF"):
+			off = next
+			continue
+		case name == "//":
+			longNames = make([]byte, size)
+			if _, err := r.ReadAt(longNames, data); err != nil {
+				return nil, err
+			}
+			off = next
+			continue
+		case strings.HasPrefix(name, "#1/"):
+			// BSD: the name precedes the data
+			n, err := strconv.ParseInt(name[3:], 10, 64)
+			if err != nil || n > size {
+				return nil, errors.New(Tr(msgBadArchive, off))
+			}
+			buf := make([]byte, n)
+			if _, err := r.ReadAt(buf, data); err != nil {
+				return nil, err
+			}
+			name = string(bytes.TrimRight(buf, "\x00"))
+			data += n
+			size -= n
+			if strings.HasPrefix(name, "__.SYMDEF") {
+				off = next
+				continue
+			}
+		case len(name) > 1 && name[0] == '/':
+			// GNU: an offset into the long name table
+			i, err := strconv.Atoi(name[1:])
+			if err != nil || i >= len(longNames) {
+				return nil, errors.New(Tr(msgBadArchive, off))
+			}
+			name, _, _ = strings.Cut(string(longNames[i:]), "/\n")
+		default:
+			name = strings.TrimSuffix(name, "/")
+		}
+
+		m := ArchiveMember{Name: name, Offset: data, StoredSize: size}
+		sr := io.NewSectionReader(r, data, size)
+		if f, err := elf.NewFile(sr); err == nil {
+			if m.ElfSize, err = headerEnd(f, sr); err != nil {
+				return nil, err
+			}
+			m.Arch = elfArchitecture(f)
+		}
+		members = append(members, m)
+		off = next
+	}
+	return members, nil
+}
+
+// arCommand implements "elfsize ar <archive>"
+func arCommand(args []string) int {
+	fs := flag.NewFlagSet("ar", flag.ContinueOnError)
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s ar <archive>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the name, stored size, computed ELF size and architecture of every member of a static library\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	members, err := GetArchiveMembers(positional[0])
+	if err != nil {
+		PrintError("ar", err)
+		return 1
+	}
+	for _, m := range members {
+		fmt.Printf("%s\t%d\t%d\t%s\n", m.Name, m.StoredSize, m.ElfSize, m.Arch)
+	}
+	return 0
+}
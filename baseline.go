@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+	"sort"
+)
+
+// Baseline is a set of previously accepted findings. Checks consult it to
+// report only findings that are new since the baseline was recorded, so that
+// they can be adopted on existing trees without fixing everything at once
+type Baseline map[string]bool
+
+// baselineFile is the on-disk format of a Baseline
+type baselineFile struct {
+	Version  int      `json:"version"`
+	Findings []string `json:"findings"`
+}
+
+// findingKey identifies a finding in a baseline. It deliberately leaves out
+// line numbers and offsets, which shift whenever unrelated things change
+func findingKey(path string, check string, message string) string {
+	return path + "\t" + check + "\t" + message
+}
+
+// LoadBaseline reads a baseline written by WriteBaseline, and err
+func LoadBaseline(path string) (Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file baselineFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	baseline := Baseline{}
+	for _, key := range file.Findings {
+		baseline[key] = true
+	}
+	return baseline, nil
+}
+
+// WriteBaseline records the given finding keys in a baseline file, and returns err
+func WriteBaseline(path string, keys []string) error {
+	file := baselineFile{Version: 1, Findings: append([]string{}, keys...)}
+	sort.Strings(file.Findings)
+	file.Findings = slices.Compact(file.Findings)
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Contains reports whether a finding is already in the baseline.
+// A nil Baseline contains nothing
+func (b Baseline) Contains(key string) bool {
+	return b[key]
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// elfFixture returns the test binary, skipping the test where it is not ELF
+func elfFixture(t *testing.T) string {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	if _, err := GetHardening(exe); err != nil {
+		t.Skipf("test binary is not ELF: %v", err)
+	}
+	return exe
+}
+
+// truncatedCopy writes the first half of the file at path to a new file in
+// dir, whose segments and section headers then end past the end of the file
+func truncatedCopy(t *testing.T, path, dir, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, name)
+	if err := os.WriteFile(out, data[:len(data)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestLintBaseline(t *testing.T) {
+	dir := t.TempDir()
+	exe := elfFixture(t)
+	broken := truncatedCopy(t, exe, dir, "broken")
+	other := truncatedCopy(t, exe, dir, "other")
+	baseline := filepath.Join(dir, "baseline.json")
+
+	if status := lintCommand([]string{broken}); status != 1 {
+		t.Fatalf("lint without baseline: status %d, want 1", status)
+	}
+	if status := lintCommand([]string{"--write-baseline", baseline, broken}); status != 0 {
+		t.Fatalf("lint --write-baseline: status %d, want 0", status)
+	}
+	if status := lintCommand([]string{"--baseline", baseline, broken}); status != 0 {
+		t.Errorf("lint --baseline with the findings recorded: status %d, want 0", status)
+	}
+	if status := lintCommand([]string{"--baseline", baseline, other}); status != 1 {
+		t.Errorf("lint --baseline for another file: status %d, want 1", status)
+	}
+}
+
+func TestChecksecBaseline(t *testing.T) {
+	dir := t.TempDir()
+	exe := elfFixture(t)
+	h, err := GetHardening(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Findings()) == 0 {
+		t.Skip("test binary has all mitigations")
+	}
+	empty := filepath.Join(dir, "empty.json")
+	if err := WriteBaseline(empty, nil); err != nil {
+		t.Fatal(err)
+	}
+	baseline := filepath.Join(dir, "baseline.json")
+
+	if status := checksecCommand([]string{exe}); status != 0 {
+		t.Fatalf("checksec without baseline: status %d, want 0", status)
+	}
+	if status := checksecCommand([]string{"--baseline", empty, exe}); status != 1 {
+		t.Errorf("checksec --baseline with no findings recorded: status %d, want 1", status)
+	}
+	if status := checksecCommand([]string{"--write-baseline", baseline, exe}); status != 0 {
+		t.Fatalf("checksec --write-baseline: status %d, want 0", status)
+	}
+	if status := checksecCommand([]string{"--baseline", baseline, exe}); status != 0 {
+		t.Errorf("checksec --baseline with the findings recorded: status %d, want 0", status)
+	}
+	loaded, err := LoadBaseline(baseline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range h.Findings() {
+		if !loaded.Contains(findingKey(exe, "checksec", code)) {
+			t.Errorf("baseline lacks %s", code)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// batchCommand runs every command line in the file at path, or stdin if path
+// is "-", as if elfsize had been invoked with it. Empty lines and lines
+// starting with # are skipped. State such as the architecture aliases and the
+// library search path is loaded once and shared by all commands. The exit
+// status is the highest one returned by any command
+func batchCommand(path string) int {
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			PrintError("batch", err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+
+	status := 0
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, 1<<20)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		args, err := splitCommandLine(line)
+		if err != nil {
+			PrintError(Tr(msgBatchLine, path, lineNo), err)
+			status = max(status, 2)
+			continue
+		}
+		// Stdout is shared, so the output of one command must be complete
+		// before the next one starts; all commands write synchronously
+		status = max(status, run(args))
+	}
+	if err := scanner.Err(); err != nil {
+		PrintError("batch", err)
+		return max(status, 1)
+	}
+	return status
+}
+
+// splitCommandLine splits a line into arguments at unquoted white space.
+// Single quotes preserve everything up to the next single quote, double
+// quotes and backslashes work as in a POSIX shell, minus expansions
+func splitCommandLine(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		case c == '\'':
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New(Tr(msgUnterminatedQuote))
+			}
+			current.WriteString(line[i+1 : i+1+end])
+			i += end + 1
+			inArg = true
+		case c == '"':
+			i++
+			for ; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+1 < len(line) && strings.IndexByte("\"\\$`", line[i+1]) >= 0 {
+					i++
+				}
+				current.WriteByte(line[i])
+			}
+			if i >= len(line) {
+				return nil, errors.New(Tr(msgUnterminatedQuote))
+			}
+			inArg = true
+		case c == '\\' && i+1 < len(line):
+			i++
+			current.WriteByte(line[i])
+			inArg = true
+		default:
+			current.WriteByte(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// blake3Vectors are from the test vectors of the BLAKE3 reference
+// implementation, whose input is the byte sequence 0, 1, ..., 250, 0, 1, ...
+var blake3Vectors = []struct {
+	length int
+	sum    string
+}{
+	{0, "af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262"},
+	{1, "2d3adedff11b61f14c886e35afa036736dcd87a74d27b5c1510225d0f592e213"},
+	{1023, "10108970eeda3eb932baac1428c7a2163b0e924c9a9e25b35bba72b28f70bd11"},
+	{1024, "42214739f095a406f3fc83deb889744ac00df831c10daa55189b5d121c855af7"},
+	{1025, "d00278ae47eb27b34faecf67b4fe263f82d5412916c1ffd97c8cb7fb814b8444"},
+	{2048, "e776b6028c7cd22a4d0ba182a8bf62205d2ef576467e838ed6f2529b85fba24a"},
+	{102400, "bc3e3d41a1146b069abffad3c0d44860cf664390afce4d9661f7902e7943e085"},
+}
+
+func TestBlake3(t *testing.T) {
+	for _, v := range blake3Vectors {
+		input := make([]byte, v.length)
+		for i := range input {
+			input[i] = byte(i % 251)
+		}
+		h := newBlake3()
+		h.Write(input)
+		if got := hex.EncodeToString(h.Sum(nil)); got != v.sum {
+			t.Errorf("BLAKE3 of %d bytes: %s, want %s", v.length, got, v.sum)
+		}
+
+		// Writes of any size, and Sum in between, give the same digest
+		h.Reset()
+		for i := 0; i < len(input); i += 100 {
+			h.Write(input[i:min(i+100, len(input))])
+			h.Sum(nil)
+		}
+		if got := hex.EncodeToString(h.Sum(nil)); got != v.sum {
+			t.Errorf("BLAKE3 of %d bytes written in pieces: %s, want %s", v.length, got, v.sum)
+		}
+	}
+}
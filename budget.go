@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Budget limits the sizes of the ELF files whose path, relative to the
+// directory that is checked, matches Glob. -1 means not limited
+type Budget struct {
+	Glob    string `json:"glob"`
+	Elf     int64  `json:"elf"`     // of the ELF image
+	Overlay int64  `json:"overlay"` // of what is appended to it
+}
+
+// BudgetViolation is a file over one of its budgets
+type BudgetViolation struct {
+	Path  string `json:"path"`
+	Glob  string `json:"glob"`
+	Kind  string `json:"kind"` // "elf", "overlay" or "error"
+	Size  int64  `json:"size"`
+	Limit int64  `json:"limit"`
+	// Error is why the file could not be checked, for the Kind "error"
+	Error string `json:"error,omitempty"`
+}
+
+// LoadBudgets reads budgets from a file, and returns err. The file is YAML
+// that maps globs to the limits of the files they match, in bytes, with an
+// optional K, M or G suffix:
+//
+//	usr/bin/*:
+//	  elf: 2M
+//	  overlay: 0
+//	"usr/lib/**/*.so*": 10M
+//
+// A plain size limits the ELF image. "**" matches any number of
+// directories. Only this subset of YAML is understood
+func LoadBudgets(path string) ([]Budget, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	budgets, err := parseBudgets(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return budgets, nil
+}
+
+// parseBudgets parses the YAML subset LoadBudgets describes
+func parseBudgets(data []byte) ([]Budget, error) {
+	var budgets []Budget
+	var current *Budget
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		text := scanner.Text()
+		line := strings.TrimSpace(text)
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+		if i := strings.Index(line, " #"); i >= 0 && !strings.ContainsAny(line[:i], `"'`) {
+			line = strings.TrimSpace(line[:i])
+		}
+		key, value, ok := splitYAMLPair(line)
+		if !ok {
+			return nil, fmt.Errorf("%s: %s", Tr(msgAtLine, n), Tr(msgExpectedYAMLPair))
+		}
+		if text[0] != ' ' && text[0] != '\t' {
+			if _, err := path.Match(key, ""); err != nil {
+				return nil, fmt.Errorf("%s: %w", Tr(msgAtLine, n), err)
+			}
+			budgets = append(budgets, Budget{Glob: key, Elf: -1, Overlay: -1})
+			current = &budgets[len(budgets)-1]
+			if value != "" {
+				size, err := parseByteSize(value)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", Tr(msgAtLine, n), err)
+				}
+				current.Elf = size
+			}
+			continue
+		}
+		if current == nil {
+			return nil, fmt.Errorf("%s: %s", Tr(msgAtLine, n), Tr(msgLimitOutsideGlob))
+		}
+		size, err := parseByteSize(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", Tr(msgAtLine, n), err)
+		}
+		switch key {
+		case "elf":
+			current.Elf = size
+		case "overlay":
+			current.Overlay = size
+		default:
+			return nil, fmt.Errorf("%s: %s", Tr(msgAtLine, n), Tr(msgUnknownBudgetLimit, key))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, b := range budgets {
+		if b.Elf < 0 && b.Overlay < 0 {
+			return nil, errors.New(Tr(msgNoBudgetLimit, b.Glob))
+		}
+	}
+	return budgets, nil
+}
+
+// splitYAMLPair splits a "key: value" line, unquoting the key
+func splitYAMLPair(line string) (key, value string, ok bool) {
+	if strings.HasPrefix(line, `"`) || strings.HasPrefix(line, "'") {
+		end := strings.IndexByte(line[1:], line[0]) + 1
+		if end == 0 || !strings.HasPrefix(line[end+1:], ":") {
+			return "", "", false
+		}
+		key = line[1:end]
+		if line[0] == '"' {
+			unquoted, err := strconv.Unquote(line[:end+1])
+			if err != nil {
+				return "", "", false
+			}
+			key = unquoted
+		}
+		line = line[end+1:]
+	} else {
+		colon := strings.Index(line, ":")
+		if colon <= 0 {
+			return "", "", false
+		}
+		key, line = strings.TrimSpace(line[:colon]), line[colon:]
+	}
+	return key, strings.TrimSpace(line[1:]), true
+}
+
+// parseByteSize parses a number of bytes with an optional K, M or G suffix
+func parseByteSize(s string) (int64, error) {
+	text, scale := strings.Trim(s, `"'`), int64(1)
+	if text != "" {
+		if i := strings.IndexByte("KMG", text[len(text)-1]); i >= 0 {
+			text, scale = text[:len(text)-1], 1<<(10*(i+1))
+		}
+	}
+	n, err := strconv.ParseInt(text, 0, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/scale {
+		return 0, errors.New(Tr(msgInvalidSize, s))
+	}
+	return n * scale, nil
+}
+
+// matchGlob reports whether a slash-separated path matches a glob in which
+// "**" matches any number of path components
+func matchGlob(pattern, name string) bool {
+	return matchGlobParts(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobParts(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchGlobParts(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// CheckBudgets checks the ELF files in the tree at root against budgets
+// and returns the violations, and how many files a budget applied to.
+// Files that a budget applies to but that cannot be parsed are violations
+// too, so that a broken file never passes. Symbolic links are not followed
+func CheckBudgets(root string, budgets []Budget) ([]BudgetViolation, int, error) {
+	violations := []BudgetViolation{}
+	checked := 0
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || !isElfCandidate(path, d) {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		rel = filepath.ToSlash(rel)
+		var info *ElfInfo
+		for _, b := range budgets {
+			if !matchGlob(b.Glob, rel) {
+				continue
+			}
+			if info == nil {
+				if info, err = Stat(path); err != nil {
+					printWarning("budget", err)
+					violations = append(violations, BudgetViolation{rel, b.Glob, "error", 0, 0, err.Error()})
+					checked++
+					return nil
+				}
+				checked++
+			}
+			if b.Elf >= 0 && info.Size > b.Elf {
+				violations = append(violations, BudgetViolation{rel, b.Glob, "elf", info.Size, b.Elf, ""})
+			}
+			if b.Overlay >= 0 && info.Overlay > b.Overlay {
+				violations = append(violations, BudgetViolation{rel, b.Glob, "overlay", info.Overlay, b.Overlay, ""})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return violations, checked, nil
+}
+
+// budgetCommand implements "elfsize budget --config <file> <dir>"
+func budgetCommand(args []string) int {
+	fs := flag.NewFlagSet("budget", flag.ContinueOnError)
+	config := fs.String("config", "", "YAML file mapping globs to size limits")
+	asJSON := fs.Bool("json", false, "print the violations as JSON")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse symbolic links and anything that is not a regular file")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s budget --config <budgets.yaml> [--json] <dir>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Check the ELF image and overlay sizes of the ELF files in a tree\n")
+		fmt.Fprintf(os.Stderr, "    against the limits set for their paths, such as\n")
+		fmt.Fprintf(os.Stderr, "        usr/bin/*:\n")
+		fmt.Fprintf(os.Stderr, "          elf: 2M\n")
+		fmt.Fprintf(os.Stderr, "          overlay: 0\n")
+		fmt.Fprintf(os.Stderr, "        \"usr/lib/**/*.so*\": 10M\n")
+		fmt.Fprintf(os.Stderr, "    and list those over a limit\n")
+		fmt.Fprintf(os.Stderr, "    Exits with 1 if a limit is exceeded or a file it applies to cannot be read\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 || *config == "" {
+		fs.Usage()
+		return 2
+	}
+
+	budgets, err := LoadBudgets(*config)
+	if err != nil {
+		PrintError("budget", err)
+		return 2
+	}
+	violations, checked, err := CheckBudgets(positional[0], budgets)
+	if err != nil {
+		PrintError("budget", err)
+		return 1
+	}
+	status := 0
+	if len(violations) > 0 {
+		status = 1
+	}
+	if *asJSON {
+		out, _ := json.MarshalIndent(violations, "", "  ")
+		fmt.Println(string(out))
+		return status
+	}
+	for _, v := range violations {
+		if v.Kind == "error" {
+			// The reason has been printed as a warning
+			fmt.Printf("%s\t%s\t-\t-\t%s\n", v.Path, v.Kind, v.Glob)
+			continue
+		}
+		fmt.Printf("%s\t%s\t%d\t%d\t%s\n", v.Path, v.Kind, v.Size, v.Limit, v.Glob)
+	}
+	if len(violations) > 0 {
+		printWarning("budget", errors.New(Tr(msgBudgetExceeded, len(violations), checked)))
+	} else {
+		fmt.Fprintln(os.Stderr, Tr(msgBudgetOK, checked))
+	}
+	return status
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Cache stores the results of expensive analyses so that identical binaries
+// are not analyzed again, keyed by what was analyzed (usually a build-id)
+type Cache interface {
+	// Get returns the data stored for key, or nil if there is none
+	Get(key string) ([]byte, error)
+	// Put stores data for key
+	Put(key string, data []byte) error
+}
+
+// HTTPCache is a Cache on a plain HTTP server, where results are fetched with
+// GET and stored with PUT at BaseURL/<key>. Any WebDAV-enabled web server or
+// build cache server accepting PUT will do, so a CI fleet can share results
+type HTTPCache struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// NewHTTPCache returns an HTTPCache for baseURL with a conservative timeout,
+// so that an unreachable cache slows analyses down only a little
+func NewHTTPCache(baseURL string) *HTTPCache {
+	return &HTTPCache{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Get implements Cache
+func (c *HTTPCache) Get(key string) ([]byte, error) {
+	return c.GetContext(context.Background(), key)
+}
+
+// GetContext is Get, canceling the request when ctx is done
+func (c *HTTPCache) GetContext(ctx context.Context, key string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/"+key, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(resp.Body)
+	case http.StatusNotFound:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("GET %s/%s: %s", c.BaseURL, key, resp.Status)
+}
+
+// Put implements Cache
+func (c *HTTPCache) Put(key string, data []byte) error {
+	return c.PutContext(context.Background(), key, data)
+}
+
+// PutContext is Put, canceling the request when ctx is done
+func (c *HTTPCache) PutContext(ctx context.Context, key string, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.BaseURL+"/"+key, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("PUT %s/%s: %s", c.BaseURL, key, resp.Status)
+	}
+	return nil
+}
+
+// ContextCache is a Cache whose requests can be canceled, such as HTTPCache.
+// Scans with a context use these methods when the Cache has them
+type ContextCache interface {
+	Cache
+	GetContext(ctx context.Context, key string) ([]byte, error)
+	PutContext(ctx context.Context, key string, data []byte) error
+}
+
+// DirCache is a Cache in a local directory, with one file per key, for
+// results that only this machine can reuse, such as those keyed by inode
+type DirCache struct {
+	Dir string
+}
+
+// path returns the file holding key; keys may contain slashes
+func (c DirCache) path(key string) string {
+	return filepath.Join(c.Dir, filepath.FromSlash(key))
+}
+
+// Get implements Cache
+func (c DirCache) Get(key string) ([]byte, error) {
+	data, err := os.ReadFile(c.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// Put implements Cache
+func (c DirCache) Put(key string, data []byte) error {
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+// isCacheURL reports whether a cache location is an HTTP cache rather than
+// a directory
+func isCacheURL(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+// fileCacheKey builds the key for the result of an analysis of a file that
+// is valid as long as the file is not modified: the device, inode, size and
+// modification time, or the absolute path where the system has no inodes
+func fileCacheKey(analysis, path string, info os.FileInfo) string {
+	return fmt.Sprintf("%s/%s-%d-%d", analysis, fileIdentity(path, info), info.Size(), info.ModTime().UnixNano())
+}
+
+// cacheKey builds the key for the result of an analysis of the binary with
+// the given build-id. Anything else the result depends on, such as the
+// library search path for dependency resolution, goes into context
+func cacheKey(analysis string, buildID string, context ...string) string {
+	key := analysis + "/" + buildID
+	if len(context) > 0 {
+		sum := sha256.Sum256([]byte(strings.Join(context, "\x00")))
+		key += "-" + hex.EncodeToString(sum[:8])
+	}
+	return key
+}
+
+// cachedAnalysis fills result from the cache if it holds key, and otherwise
+// runs compute, which fills result, and stores it. Cache failures are
+// reported but never fail the analysis itself. A nil cache or an empty key
+// just runs compute
+func cachedAnalysis(ctx context.Context, cache Cache, key string, result interface{}, compute func() error) error {
+	return validatedAnalysis(ctx, cache, key, result, nil, compute)
+}
+
+// validatedAnalysis is cachedAnalysis for results that may be out of date
+// although their key is not, such as those naming other files: a result,
+// cached or computed, is only used from the cache or stored in it if valid
+// reports that it still holds for this machine. A nil valid accepts all
+func validatedAnalysis(ctx context.Context, cache Cache, key string, result interface{}, valid func() bool, compute func() error) error {
+	if cache == nil || key == "" {
+		return compute()
+	}
+	get, put := cache.Get, cache.Put
+	if c, ok := cache.(ContextCache); ok {
+		get = func(key string) ([]byte, error) { return c.GetContext(ctx, key) }
+		put = func(key string, data []byte) error { return c.PutContext(ctx, key, data) }
+	}
+	data, err := get(key)
+	if err != nil {
+		printWarning("cache", err)
+	}
+	if data != nil {
+		if err := json.Unmarshal(data, result); err != nil {
+			printWarning("cache", errors.New(Tr(msgCacheMalformed, key)))
+		} else if valid == nil || valid() {
+			logMessage(LogDebug, msgCacheHit, key)
+			return nil
+		} else {
+			logMessage(LogDebug, msgCacheStale, key)
+		}
+	}
+
+	if err := compute(); err != nil {
+		return err
+	}
+	if valid != nil && !valid() {
+		return nil
+	}
+	if data, err = json.Marshal(result); err == nil {
+		err = put(key, data)
+	}
+	printWarning("cache", err)
+	return nil
+}
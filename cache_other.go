@@ -0,0 +1,16 @@
+//go:build !unix
+
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// fileIdentity has no inode to go on and uses the absolute path instead
+func fileIdentity(path string, info os.FileInfo) string {
+	abs, _ := filepath.Abs(path)
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(abs)))
+}
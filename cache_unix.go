@@ -0,0 +1,20 @@
+//go:build unix
+
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// fileIdentity returns the device and inode of a file
+func fileIdentity(path string, info os.FileInfo) string {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return fmt.Sprintf("%d-%d", uint64(st.Dev), uint64(st.Ino))
+	}
+	abs, _ := filepath.Abs(path)
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(abs)))
+}
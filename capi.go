@@ -0,0 +1,69 @@
+//go:build cshared
+
+// The C API of libelfsize, built with
+//
+//	go build -tags cshared -buildmode=c-shared -o libelfsize.so
+//
+// See elfsize.h for the documented declarations
+
+package main
+
+/*
+#include <stdlib.h>
+#include <string.h>
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"unsafe"
+)
+
+//export elfsize_calculate
+func elfsize_calculate(path *C.char) C.longlong {
+	size, err := CalculateElfSizeWith(C.GoString(path), HeaderEnd)
+	if err != nil {
+		return -1
+	}
+	return C.longlong(size)
+}
+
+//export elfsize_arch
+func elfsize_arch(path *C.char) *C.char {
+	arch, err := GetElfArchitecture(C.GoString(path))
+	if err != nil {
+		return nil
+	}
+	return C.CString(arch)
+}
+
+//export elfsize_stat
+func elfsize_stat(path *C.char) *C.char {
+	info, err := Stat(C.GoString(path))
+	if err != nil {
+		return nil
+	}
+	out, err := json.Marshal(info)
+	if err != nil {
+		return nil
+	}
+	return C.CString(string(out))
+}
+
+//export elfsize_section_data
+func elfsize_section_data(path, name *C.char, data **C.uchar, length *C.size_t) C.int {
+	contents, err := GetSectionData(C.GoString(path), C.GoString(name))
+	if err != nil {
+		return -1
+	}
+	buf := C.malloc(C.size_t(max(len(contents), 1)))
+	C.memcpy(buf, unsafe.Pointer(unsafe.SliceData(append(contents, 0))), C.size_t(len(contents)))
+	*data = (*C.uchar)(buf)
+	*length = C.size_t(len(contents))
+	return 0
+}
+
+//export elfsize_free
+func elfsize_free(p unsafe.Pointer) {
+	C.free(p)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// carveChunk is how much of a blob CarveElfImages searches at a time
+const carveChunk = 1 << 20
+
+// CarveElfImages finds the ELF images embedded anywhere in a file, such as
+// a firmware image or memory dump. Candidates at every ELF magic must parse
+// and fit into the file; images nested in an image already found are not
+// reported separately
+func CarveElfImages(filepath string) ([]ElfImage, error) {
+	return CarveElfImagesContext(context.Background(), filepath)
+}
+
+// CarveElfImagesContext is CarveElfImages, returning the images found so far
+// and ctx.Err() when ctx is done
+func CarveElfImagesContext(ctx context.Context, filepath string) ([]ElfImage, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	stat, err := r.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return carveElfImages(ctx, r, stat.Size())
+}
+
+// carveElfImages does the work of CarveElfImages on an opened file
+func carveElfImages(ctx context.Context, r io.ReaderAt, fileSize int64) ([]ElfImage, error) {
+	var images []ElfImage
+	buf := make([]byte, carveChunk+len(elf.ELFMAG)-1)
+	for pos := int64(0); pos < fileSize; {
+		if err := ctx.Err(); err != nil {
+			return images, err
+		}
+		n, err := r.ReadAt(buf, pos)
+		if err != nil && err != io.EOF {
+			return images, err
+		}
+		i := bytes.Index(buf[:n], []byte(elf.ELFMAG))
+		if i < 0 {
+			if n < len(buf) {
+				break
+			}
+			pos += carveChunk
+			continue
+		}
+		off := pos + int64(i)
+		if image, ok := carveElfImage(r, off, fileSize); ok {
+			images = append(images, image)
+			pos = off + image.Size
+		} else {
+			pos = off + 1
+		}
+	}
+	return images, nil
+}
+
+// carveElfImage validates the candidate image at off
+func carveElfImage(r io.ReaderAt, off, fileSize int64) (ElfImage, bool) {
+	sr := io.NewSectionReader(r, off, fileSize-off)
+	f, err := elf.NewFile(sr)
+	if err != nil || (len(f.Progs) == 0 && len(f.Sections) == 0) {
+		return ElfImage{}, false
+	}
+	size, err := maxEnd(f, sr)
+	if err != nil || size <= 0 || size > fileSize-off {
+		return ElfImage{}, false
+	}
+	return ElfImage{Offset: off, Size: size, Arch: elfArchitecture(f)}, true
+}
+
+// carveCommand implements "elfsize carve <blob> [-d dir]"
+func carveCommand(args []string) int {
+	fs := flag.NewFlagSet("carve", flag.ContinueOnError)
+	dir := fs.String("d", "", "also write every image to <offset>.elf in this directory")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s carve <blob> [-d dir]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the offset, size and architecture of every ELF image embedded in a file\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	images, err := CarveElfImages(positional[0])
+	if err != nil {
+		PrintError("carve", err)
+		return 1
+	}
+	if *dir != "" && len(images) > 0 {
+		in, err := openFile(positional[0])
+		if err != nil {
+			PrintError("carve", err)
+			return 1
+		}
+		defer in.Close()
+		for _, image := range images {
+			out := filepath.Join(*dir, fmt.Sprintf("%d.elf", image.Offset))
+			if err := extractRange(out, in, image.Offset, image.Size); err != nil {
+				PrintError("carve", err)
+				return 1
+			}
+		}
+	}
+	for _, image := range images {
+		fmt.Printf("%d\t%d\t%s\n", image.Offset, image.Size, image.Arch)
+	}
+	return 0
+}
+
+// extractRange copies size bytes at off in r to a new executable file
+func extractRange(path string, r io.ReaderAt, off, size int64) error {
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, io.NewSectionReader(r, off, size)); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
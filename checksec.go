@@ -0,0 +1,229 @@
+package main
+
+import (
+	"debug/elf"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// RELRO levels reported by checksec
+const (
+	RelroNone    = "none"
+	RelroPartial = "partial" // PT_GNU_RELRO, but the GOT is still writable
+	RelroFull    = "full"    // PT_GNU_RELRO with immediate binding
+)
+
+// Hardening lists the exploit mitigations an ELF file was built with
+type Hardening struct {
+	Path      string   `json:"path"`
+	RELRO     string   `json:"relro"`
+	PIE       bool     `json:"pie"`
+	NX        bool     `json:"nx"` // the stack is not executable
+	Canary    bool     `json:"canary"`
+	Fortify   bool     `json:"fortify"`
+	Fortified []string `json:"fortified"` // the _chk functions used
+	TextRel   bool     `json:"textrel"`
+}
+
+// GetHardening returns the Hardening of an ELF file
+func GetHardening(filepath string) (*Hardening, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return nil, err
+	}
+	h, err := elfHardening(f)
+	if err != nil {
+		return nil, err
+	}
+	h.Path = filepath
+	return h, nil
+}
+
+// elfHardening does the work of GetHardening
+func elfHardening(f *elf.File) (*Hardening, error) {
+	h := &Hardening{RELRO: RelroNone, Fortified: []string{}}
+	typ := elfType(f)
+	h.PIE = typ == TypePIE || typ == TypeShared
+
+	// Without PT_GNU_STACK the kernel makes the stack executable
+	for _, p := range f.Progs {
+		switch p.Type {
+		case elf.PT_GNU_STACK:
+			h.NX = p.Flags&elf.PF_X == 0
+		case elf.PT_GNU_RELRO:
+			h.RELRO = RelroPartial
+		}
+	}
+
+	flags, err := dynValue(f, elf.DT_FLAGS)
+	if err != nil {
+		return nil, err
+	}
+	flags1, err := dynValue(f, elf.DT_FLAGS_1)
+	if err != nil {
+		return nil, err
+	}
+	bindNow, err := f.DynValue(elf.DT_BIND_NOW)
+	if err != nil {
+		return nil, err
+	}
+	if h.RELRO == RelroPartial && (len(bindNow) > 0 || flags&uint64(elf.DF_BIND_NOW) != 0 || flags1&uint64(elf.DF_1_NOW) != 0) {
+		h.RELRO = RelroFull
+	}
+	if h.TextRel, err = elfTextRel(f); err != nil {
+		return nil, err
+	}
+
+	fortified := map[string]bool{}
+	for _, name := range symbolNames(f) {
+		switch {
+		case name == "__stack_chk_fail" || name == "__stack_chk_guard" || name == "__intel_security_cookie":
+			h.Canary = true
+		case strings.HasPrefix(name, "__") && strings.HasSuffix(name, "_chk") && name != "__stack_chk_fail":
+			fortified[name] = true
+		}
+	}
+	for name := range fortified {
+		h.Fortified = append(h.Fortified, name)
+	}
+	sort.Strings(h.Fortified)
+	h.Fortify = len(h.Fortified) > 0
+	return h, nil
+}
+
+// Findings returns codes for the mitigations h lacks, for baselines. Like
+// the codes of lint they do not change between releases or languages
+func (h *Hardening) Findings() []string {
+	var codes []string
+	switch h.RELRO {
+	case RelroNone:
+		codes = append(codes, "no-relro")
+	case RelroPartial:
+		codes = append(codes, "partial-relro")
+	}
+	if !h.PIE {
+		codes = append(codes, "no-pie")
+	}
+	if !h.NX {
+		codes = append(codes, "exec-stack")
+	}
+	if !h.Canary {
+		codes = append(codes, "no-canary")
+	}
+	if !h.Fortify {
+		codes = append(codes, "no-fortify")
+	}
+	if h.TextRel {
+		codes = append(codes, "textrel")
+	}
+	return codes
+}
+
+// dynValue returns the first value of a dynamic entry, or 0
+func dynValue(f *elf.File, tag elf.DynTag) (uint64, error) {
+	values, err := f.DynValue(tag)
+	if err != nil || len(values) == 0 {
+		return 0, err
+	}
+	return values[0], nil
+}
+
+// symbolNames returns the names in the dynamic and the static symbol table,
+// without symbol versions
+func symbolNames(f *elf.File) []string {
+	var names []string
+	dynamic, _ := f.DynamicSymbols()
+	static, _ := f.Symbols()
+	for _, symbols := range [][]elf.Symbol{dynamic, static} {
+		for _, s := range symbols {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
+
+// checksecCommand implements "elfsize checksec [--json] [--baseline file] [--write-baseline file] <file>..."
+func checksecCommand(args []string) int {
+	fs := flag.NewFlagSet("checksec", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the reports as a JSON array")
+	baselinePath := fs.String("baseline", "", "exit with 1 if a mitigation is missing that this baseline file does not list")
+	writeBaseline := fs.String("write-baseline", "", "record the missing mitigations in this baseline file")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s checksec [--json] [--baseline file] [--write-baseline file] <file>...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Report RELRO, PIE, NX, stack canaries, FORTIFY_SOURCE and text relocations.\n")
+		fmt.Fprintf(os.Stderr, "    With --baseline, missing mitigations that are not in the baseline are\n")
+		fmt.Fprintf(os.Stderr, "    reported as no-relro, partial-relro, no-pie, exec-stack, no-canary,\n")
+		fmt.Fprintf(os.Stderr, "    no-fortify or textrel on stderr and make the exit status 1\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) < 1 {
+		fs.Usage()
+		return 2
+	}
+
+	var baseline Baseline
+	if *baselinePath != "" {
+		if baseline, err = LoadBaseline(*baselinePath); err != nil {
+			PrintError("checksec", err)
+			return 1
+		}
+	}
+
+	status := 0
+	var keys, unknown []string
+	reports := []*Hardening{}
+	for _, path := range positional {
+		h, err := GetHardening(path)
+		if err != nil {
+			PrintError("checksec", err)
+			status = 1
+			continue
+		}
+		for _, code := range h.Findings() {
+			key := findingKey(path, "checksec", code)
+			keys = append(keys, key)
+			if *baselinePath != "" && !baseline.Contains(key) {
+				unknown = append(unknown, Tr(msgNotInBaseline, path, code))
+			}
+		}
+		if *asJSON {
+			reports = append(reports, h)
+			continue
+		}
+		fmt.Printf("%s: relro=%s pie=%t nx=%t canary=%t fortify=%t textrel=%t\n",
+			h.Path, h.RELRO, h.PIE, h.NX, h.Canary, h.Fortify, h.TextRel)
+	}
+	if *asJSON {
+		out, _ := json.MarshalIndent(reports, "", "  ")
+		fmt.Println(string(out))
+	}
+
+	if *writeBaseline != "" {
+		if err := WriteBaseline(*writeBaseline, keys); err != nil {
+			PrintError("checksec", err)
+			return 1
+		}
+		// Recording a baseline accepts whatever was found
+		return status
+	}
+	for _, finding := range unknown {
+		printWarning("checksec", errors.New(finding))
+		status = 1
+	}
+	return status
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// commandNames returns the subcommands and the commands run handles itself,
+// sorted
+func commandNames() []string {
+	names := []string{"completion", "help", "size"}
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// commandFlags returns the flags of a command, as "--name" or "-o" for
+// single letters, by running it with -h and reading its usage text, so that
+// they never go out of sync with the flag sets of the commands
+func commandFlags(cmd func([]string) int) ([]string, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	usage := make(chan []string)
+	go func() {
+		var flags []string
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			// PrintDefaults starts each flag with two spaces and a dash
+			line, ok := strings.CutPrefix(scanner.Text(), "  -")
+			if !ok || line == "" || line[0] == ' ' {
+				continue
+			}
+			name, _, _ := strings.Cut(line, " ")
+			if len(name) > 1 {
+				name = "-" + name
+			}
+			flags = append(flags, "-"+name)
+		}
+		io.Copy(io.Discard, r)
+		usage <- flags
+	}()
+	stderr := os.Stderr
+	os.Stderr = w
+	cmd([]string{"-h"})
+	os.Stderr = stderr
+	w.Close()
+	flags := <-usage
+	r.Close()
+	return flags, nil
+}
+
+// completionCommand implements "elfsize completion bash|zsh|fish"
+func completionCommand(args []string) int {
+	fs := flag.NewFlagSet("completion", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s completion bash|zsh|fish\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print a script that completes the subcommands and flags of elfsize\n")
+		fmt.Fprintf(os.Stderr, "    and the regular files it reads, e.g. for bash\n")
+		fmt.Fprintf(os.Stderr, "        source <(elfsize completion bash)\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+	write := map[string]func(io.Writer, []string, map[string][]string){
+		"bash": writeBashCompletion,
+		"zsh":  writeZshCompletion,
+		"fish": writeFishCompletion,
+	}[positional[0]]
+	if write == nil {
+		fs.Usage()
+		return 2
+	}
+
+	names := commandNames()
+	flags := map[string][]string{}
+	for _, name := range names {
+		cmd := subcommands[name]
+		switch name {
+		case "size":
+			cmd = sizeCommand
+		case "help", "completion":
+			continue
+		}
+		if flags[name], err = commandFlags(cmd); err != nil {
+			PrintError("completion", err)
+			return 1
+		}
+	}
+	w := bufio.NewWriter(os.Stdout)
+	write(w, names, flags)
+	if err := w.Flush(); err != nil {
+		PrintError("completion", err)
+		return 1
+	}
+	return 0
+}
+
+// writeBashCompletion writes a completion script for bash
+func writeBashCompletion(w io.Writer, names []string, flags map[string][]string) {
+	fmt.Fprintf(w, "# bash completion for elfsize, from \"elfsize completion bash\"\n")
+	fmt.Fprintf(w, "_elfsize() {\n")
+	fmt.Fprintf(w, "    local cur=${COMP_WORDS[COMP_CWORD]} cmd=size flags f\n")
+	fmt.Fprintf(w, "    [[ $COMP_CWORD -gt 1 ]] && cmd=${COMP_WORDS[1]}\n")
+	fmt.Fprintf(w, "    case $cmd in\n")
+	for _, name := range names {
+		if name != "size" {
+			fmt.Fprintf(w, "    %s) flags=%q ;;\n", name, strings.Join(flags[name], " "))
+		}
+	}
+	fmt.Fprintf(w, "    *) flags=%q ;;\n", strings.Join(flags["size"], " "))
+	fmt.Fprintf(w, "    esac\n")
+	fmt.Fprintf(w, "    COMPREPLY=()\n")
+	fmt.Fprintf(w, "    if [[ $cur == -* ]]; then\n")
+	fmt.Fprintf(w, "        COMPREPLY=($(compgen -W \"$flags\" -- \"$cur\"))\n")
+	fmt.Fprintf(w, "        return\n")
+	fmt.Fprintf(w, "    fi\n")
+	fmt.Fprintf(w, "    if [[ $COMP_CWORD -eq 1 ]]; then\n")
+	fmt.Fprintf(w, "        COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(names, " "))
+	fmt.Fprintf(w, "    elif [[ $cmd == help || $cmd == completion ]]; then\n")
+	fmt.Fprintf(w, "        [[ $COMP_CWORD -eq 2 ]] && COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(names, " ")+" bash zsh fish")
+	fmt.Fprintf(w, "        return\n")
+	fmt.Fprintf(w, "    fi\n")
+	fmt.Fprintf(w, "    # Regular files, and directories to get to them\n")
+	fmt.Fprintf(w, "    while IFS= read -r f; do\n")
+	fmt.Fprintf(w, "        [[ -f $f || -d $f ]] && COMPREPLY+=(\"$f\")\n")
+	fmt.Fprintf(w, "    done < <(compgen -f -- \"$cur\")\n")
+	fmt.Fprintf(w, "}\n")
+	fmt.Fprintf(w, "complete -o filenames -F _elfsize elfsize\n")
+}
+
+// writeZshCompletion writes a completion script for zsh, which works both
+// from $fpath and sourced
+func writeZshCompletion(w io.Writer, names []string, flags map[string][]string) {
+	fmt.Fprintf(w, "#compdef elfsize\n")
+	fmt.Fprintf(w, "# zsh completion for elfsize, from \"elfsize completion zsh\"\n")
+	fmt.Fprintf(w, "_elfsize() {\n")
+	fmt.Fprintf(w, "    local cmd=size\n")
+	fmt.Fprintf(w, "    local -a flags\n")
+	fmt.Fprintf(w, "    (( CURRENT > 2 )) && cmd=$words[2]\n")
+	fmt.Fprintf(w, "    case $cmd in\n")
+	for _, name := range names {
+		if name != "size" {
+			fmt.Fprintf(w, "    %s) flags=(%s) ;;\n", name, strings.Join(flags[name], " "))
+		}
+	}
+	fmt.Fprintf(w, "    *) flags=(%s) ;;\n", strings.Join(flags["size"], " "))
+	fmt.Fprintf(w, "    esac\n")
+	fmt.Fprintf(w, "    if [[ $PREFIX == -* ]]; then\n")
+	fmt.Fprintf(w, "        compadd -- $flags\n")
+	fmt.Fprintf(w, "        return\n")
+	fmt.Fprintf(w, "    fi\n")
+	fmt.Fprintf(w, "    if (( CURRENT == 2 )); then\n")
+	fmt.Fprintf(w, "        compadd -- %s\n", strings.Join(names, " "))
+	fmt.Fprintf(w, "    elif [[ $cmd == help || $cmd == completion ]]; then\n")
+	fmt.Fprintf(w, "        (( CURRENT == 3 )) && compadd -- %s\n", strings.Join(names, " ")+" bash zsh fish")
+	fmt.Fprintf(w, "        return\n")
+	fmt.Fprintf(w, "    fi\n")
+	fmt.Fprintf(w, "    # Regular files; _files still offers directories to get to them\n")
+	fmt.Fprintf(w, "    _files -g '*(-.)'\n")
+	fmt.Fprintf(w, "}\n")
+	fmt.Fprintf(w, "if [[ $funcstack[1] == _elfsize ]]; then\n")
+	fmt.Fprintf(w, "    _elfsize \"$@\"\n")
+	fmt.Fprintf(w, "else\n")
+	fmt.Fprintf(w, "    compdef _elfsize elfsize\n")
+	fmt.Fprintf(w, "fi\n")
+}
+
+// writeFishCompletion writes a completion script for fish
+func writeFishCompletion(w io.Writer, names []string, flags map[string][]string) {
+	fmt.Fprintf(w, "# fish completion for elfsize, from \"elfsize completion fish\"\n")
+	fmt.Fprintf(w, "function __elfsize_files\n")
+	fmt.Fprintf(w, "    # Regular files, and directories to get to them\n")
+	fmt.Fprintf(w, "    for f in (commandline -ct)*\n")
+	fmt.Fprintf(w, "        if test -d \"$f\"\n")
+	fmt.Fprintf(w, "            echo $f/\n")
+	fmt.Fprintf(w, "        else if test -f \"$f\"\n")
+	fmt.Fprintf(w, "            echo $f\n")
+	fmt.Fprintf(w, "        end\n")
+	fmt.Fprintf(w, "    end\n")
+	fmt.Fprintf(w, "end\n")
+	fmt.Fprintf(w, "complete -c elfsize -f\n")
+	fmt.Fprintf(w, "complete -c elfsize -n __fish_use_subcommand -a %q\n", strings.Join(names, " "))
+	fmt.Fprintf(w, "complete -c elfsize -n \"__fish_seen_subcommand_from help completion\" -a %q\n", strings.Join(names, " ")+" bash zsh fish")
+	fmt.Fprintf(w, "complete -c elfsize -n \"not __fish_seen_subcommand_from help completion\" -a \"(__elfsize_files)\"\n")
+	var others []string
+	for _, name := range names {
+		if name != "size" {
+			others = append(others, name)
+		}
+	}
+	for _, name := range names {
+		condition := "__fish_seen_subcommand_from " + name
+		if name == "size" {
+			condition = "not __fish_seen_subcommand_from " + strings.Join(others, " ")
+		}
+		for _, f := range flags[name] {
+			option := "-l " + strings.TrimPrefix(f, "--")
+			if !strings.HasPrefix(f, "--") {
+				option = "-s " + strings.TrimPrefix(f, "-")
+			}
+			fmt.Fprintf(w, "complete -c elfsize -n %q %s\n", condition, option)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"io"
+)
+
+// copyChunk is how much of a file is copied or hashed between checks of
+// whether the context was canceled
+const copyChunk = 16 << 20
+
+// copyContext copies n bytes from src to dst like io.CopyN, in chunks so
+// that it can stop and count progress between them. dst and src are handed
+// to io.CopyN as they are, so that it can still take the fast paths of
+// *os.File
+func copyContext(ctx context.Context, dst io.Writer, src io.Reader, n int64, p *progress) (int64, error) {
+	var written int64
+	for written < n {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		copied, err := io.CopyN(dst, src, min(n-written, copyChunk))
+		written += copied
+		p.add(copied)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
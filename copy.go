@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// CopyRegion selects the part of a file that CopyElfRegion copies
+type CopyRegion int
+
+const (
+	// RegionElf is the ELF image from offset 0 up to the computed ELF size
+	RegionElf CopyRegion = iota
+	// RegionPayload is everything appended after the ELF image
+	RegionPayload
+)
+
+// sparseBlockSize is the granularity at which all-zero blocks are turned into holes
+const sparseBlockSize = 64 * 1024
+
+// CopyElfRegion copies either the ELF image or the appended payload of src into dst
+// and returns the number of bytes copied, and error.
+// The plain copy lets the kernel use copy_file_range where available, which clones
+// extents on filesystems that support it. With sparse set, all-zero blocks are
+// skipped instead of written so that dst ends up with holes
+func CopyElfRegion(src string, dst string, region CopyRegion, sparse bool) (int64, error) {
+	return CopyElfRegionContext(context.Background(), src, dst, region, sparse)
+}
+
+// CopyElfRegionContext is CopyElfRegion, stopping with ctx.Err() when ctx is
+// done. A regular file at dst is only replaced once the copy is complete,
+// and dst may not be src
+func CopyElfRegionContext(ctx context.Context, src string, dst string, region CopyRegion, sparse bool) (int64, error) {
+	in, err := openFile(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	elfsize := calculateElfSize(in)
+	if elfsize == 0 {
+		return 0, errors.New(Tr(msgNoElfSize, src))
+	}
+	if elfsize > info.Size() {
+		return 0, withKind(ErrTruncated, errors.New(Tr(msgTruncated, src, elfsize, info.Size())))
+	}
+
+	var offset, length int64
+	switch region {
+	case RegionElf:
+		offset, length = 0, elfsize
+	case RegionPayload:
+		offset, length = elfsize, info.Size()-appendedSignatureSize(in, elfsize, info.Size())-elfsize
+	default:
+		return 0, errors.New(Tr(msgUnknownCopyRegion, region))
+	}
+
+	out, commit, err := createOutput(in, src, dst, info.Mode().Perm())
+	if err != nil {
+		return 0, err
+	}
+	defer commit(false)
+
+	if _, err = in.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	var n int64
+	p := startProgress(ctx, length)
+	if sparse {
+		n, err = copySparse(ctx, out, in, length, p)
+	} else {
+		// Hand the kernel the *os.File itself so that it can take the fast path
+		n, err = copyContext(ctx, out, in.File, length, p)
+		stats.bytesRead.Add(n)
+	}
+	if err != nil {
+		return n, err
+	}
+	return n, commit(true)
+}
+
+// createOutput creates the file CopyElfRegionContext writes to. A regular
+// file at dst is replaced only by commit(true): the data goes to a temporary
+// file next to it that is renamed over it, so that dst is left as it was if
+// the copy fails. Other files, such as devices, are written to directly.
+// commit(false) discards the output, and does nothing after commit(true).
+// dst may not be the file in is opened from
+func createOutput(in *inputFile, src, dst string, perm os.FileMode) (*os.File, func(bool) error, error) {
+	stat, err := os.Stat(dst)
+	if err == nil {
+		if self, err := in.File.Stat(); err == nil && os.SameFile(self, stat) {
+			return nil, nil, errors.New(Tr(msgSameFile, src, dst))
+		}
+	}
+	if err == nil && !stat.Mode().IsRegular() {
+		out, err := os.OpenFile(dst, os.O_WRONLY|os.O_TRUNC, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		done := false
+		return out, func(bool) error {
+			if done {
+				return nil
+			}
+			done = true
+			return out.Close()
+		}, nil
+	}
+
+	out, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp*")
+	if err != nil {
+		return nil, nil, err
+	}
+	done := false
+	return out, func(keep bool) error {
+		if done {
+			return nil
+		}
+		done = true
+		if !keep {
+			out.Close()
+			return os.Remove(out.Name())
+		}
+		err := out.Chmod(perm)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(out.Name(), dst)
+		}
+		if err != nil {
+			os.Remove(out.Name())
+		}
+		return err
+	}, nil
+}
+
+// copySparse copies length bytes from r to w, seeking over blocks that contain
+// only zeroes. The file is truncated to its final length at the end so that a
+// trailing hole is still accounted for
+func copySparse(ctx context.Context, w *os.File, r io.Reader, length int64, p *progress) (int64, error) {
+	buf := make([]byte, sparseBlockSize)
+	zero := make([]byte, sparseBlockSize)
+	var n int64
+	for n < length {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		chunk := buf
+		if remaining := length - n; remaining < int64(len(chunk)) {
+			chunk = chunk[:remaining]
+		}
+		read, err := io.ReadFull(r, chunk)
+		if err != nil {
+			return n, err
+		}
+		if bytes.Equal(chunk[:read], zero[:read]) {
+			_, err = w.Seek(int64(read), io.SeekCurrent)
+		} else {
+			_, err = w.Write(chunk[:read])
+		}
+		if err != nil {
+			return n, err
+		}
+		n += int64(read)
+		p.add(int64(read))
+	}
+	return n, w.Truncate(n)
+}
+
+// copyCommand implements "elfsize copy SRC DST --elf-only|--payload-only"
+func copyCommand(args []string) int {
+	fs := flag.NewFlagSet("copy", flag.ContinueOnError)
+	elfOnly := fs.Bool("elf-only", false, "copy only the ELF image")
+	payloadOnly := fs.Bool("payload-only", false, "copy only the data appended after the ELF image")
+	sparse := fs.Bool("sparse", false, "create holes for all-zero blocks in the destination")
+	showProgress := fs.Bool("progress", false, "draw a progress bar on stderr")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s copy <source> <destination> --elf-only|--payload-only [--sparse] [--progress]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Copy just the ELF image or just the appended payload of a file\n")
+		fs.PrintDefaults()
+	}
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 2 || *elfOnly == *payloadOnly {
+		fs.Usage()
+		return 2
+	}
+
+	region := RegionElf
+	if *payloadOnly {
+		region = RegionPayload
+	}
+	ctx, bar := progressContext(*showProgress, positional[1])
+	_, err = CopyElfRegionContext(ctx, positional[0], positional[1], region, *sparse)
+	bar.finish()
+	if err != nil {
+		PrintError("copy", err)
+		return 1
+	}
+	return 0
+}
+
+// extractCommand implements "elfsize extract [--overlay] <file> -o <output>"
+func extractCommand(args []string) int {
+	fs := flag.NewFlagSet("extract", flag.ContinueOnError)
+	output := fs.String("o", "", "write the extracted bytes to this file")
+	overlay := fs.Bool("overlay", false, "extract the data appended after the ELF image instead of the image")
+	sparse := fs.Bool("sparse", false, "create holes for all-zero blocks in the output")
+	showProgress := fs.Bool("progress", false, "draw a progress bar on stderr")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s extract [--overlay] [--sparse] [--progress] <file> -o <output>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Write the ELF image of a file, e.g. the runtime of an AppImage, or\n")
+		fmt.Fprintf(os.Stderr, "    the overlay appended to it to another file\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 || *output == "" {
+		fs.Usage()
+		return 2
+	}
+
+	region := RegionElf
+	if *overlay {
+		region = RegionPayload
+	}
+	ctx, bar := progressContext(*showProgress, *output)
+	_, err = CopyElfRegionContext(ctx, positional[0], *output, region, *sparse)
+	bar.finish()
+	if err != nil {
+		PrintError("extract", err)
+		return 1
+	}
+	return 0
+}
+
+// ExtractSection writes the contents of a section of an ELF file to dst,
+// like objcopy -O binary --only-section does, and returns the number of bytes
+// written. The section is looked up and decompressed like in GetSectionData,
+// but streamed rather than read into memory. A dst of "-" is standard output
+func ExtractSection(filepath string, name string, dst string) (int64, error) {
+	return ExtractSectionContext(context.Background(), filepath, name, dst)
+}
+
+// ExtractSectionContext is ExtractSection, stopping with ctx.Err() when ctx
+// is done. dst is left incomplete then
+func ExtractSectionContext(ctx context.Context, filepath string, name string, dst string) (int64, error) {
+	r, size, err := GetSectionReader(filepath, name)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	out := os.Stdout
+	if dst != "-" {
+		if out, err = os.Create(dst); err != nil {
+			return 0, err
+		}
+	}
+	n, err := copyContext(ctx, out, r, size, startProgress(ctx, size))
+	if err == io.EOF {
+		err = errors.New(Tr(msgShortSection, name))
+	}
+	if dst != "-" {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return n, err
+}
+
+// extractSectionCommand implements "elfsize extract-section <file> <section> -o <output>"
+func extractSectionCommand(args []string) int {
+	fs := flag.NewFlagSet("extract-section", flag.ContinueOnError)
+	output := fs.String("o", "", "write the section to this file, - for standard output")
+	showProgress := fs.Bool("progress", false, "draw a progress bar on stderr")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s extract-section [--progress] <file> <section> -o <output>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Write the contents of a section, e.g. .icon or .upd_info, to another file\n")
+		fmt.Fprintf(os.Stderr, "    like objcopy -O binary --only-section does. Compressed sections are\n")
+		fmt.Fprintf(os.Stderr, "    decompressed, and the section may also be given as a glob pattern\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 2 || *output == "" {
+		fs.Usage()
+		return 2
+	}
+
+	ctx, bar := progressContext(*showProgress && *output != "-", *output)
+	_, err = ExtractSectionContext(ctx, positional[0], positional[1], *output)
+	bar.finish()
+	if err != nil {
+		PrintError("extract-section", err)
+		return 1
+	}
+	return 0
+}
+
+// ZeroOverlay overwrites the data appended after the ELF image of a file
+// with zeroes in place, keeping the length of the file, so that offsets
+// stay valid and signatures over the ELF image still verify. A signature
+// block appended after the overlay is kept. It returns the number of bytes
+// zeroed, and err
+func ZeroOverlay(filepath string) (int64, error) {
+	f, err := openFileForUpdate(filepath)
+	if err != nil {
+		return 0, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return 0, err
+	}
+	size := calculateElfSize(f)
+	if size == 0 {
+		f.Close()
+		return 0, errors.New(Tr(msgNoElfSize, filepath))
+	}
+	end := stat.Size() - appendedSignatureSize(f, size, stat.Size())
+	zero := make([]byte, sparseBlockSize)
+	for off := size; off < end; off += int64(len(zero)) {
+		if _, err := f.WriteAt(zero[:min(int64(len(zero)), end-off)], off); err != nil {
+			f.Close()
+			return off - size, err
+		}
+	}
+	return max(end-size, 0), f.Close()
+}
+
+// overlayCommand implements "elfsize overlay [--zero] <file>"
+func overlayCommand(args []string) int {
+	fs := flag.NewFlagSet("overlay", flag.ContinueOnError)
+	zero := fs.Bool("zero", false, "overwrite the overlay with zeroes in place, keeping the file length")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s overlay [--zero] <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the offset and size of the data appended after the ELF image,\n")
+		fmt.Fprintf(os.Stderr, "    and exit with 1 if there is none\n")
+		fmt.Fprintf(os.Stderr, "    With --zero, overwrite that data with zeroes first, to sanitize a\n")
+		fmt.Fprintf(os.Stderr, "    binary before sharing it without moving anything in it\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	if *zero {
+		if _, err := ZeroOverlay(positional[0]); err != nil {
+			PrintError("overlay", err)
+			return 1
+		}
+	}
+	f, err := openFile(positional[0])
+	if err != nil {
+		PrintError("overlay", err)
+		return 1
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		PrintError("overlay", err)
+		return 1
+	}
+	size := calculateElfSize(f)
+	if size == 0 {
+		PrintError("overlay", errors.New(Tr(msgNoElfSize, positional[0])))
+		return 1
+	}
+	end := stat.Size() - appendedSignatureSize(f, size, stat.Size())
+	fmt.Printf("%d\t%d\n", size, max(end-size, 0))
+	if end <= size {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"syscall"
+)
+
+// Note types of core dumps, the same for Linux and FreeBSD
+const (
+	ntPrstatus = 1          // NT_PRSTATUS, one per thread
+	ntPrpsinfo = 3          // NT_PRPSINFO, the process
+	ntAuxv     = 6          // NT_AUXV, the auxiliary vector
+	ntFile     = 0x46494c45 // NT_FILE, the mapped files (Linux)
+)
+
+// Auxiliary vector entries
+const (
+	atEntry  = 9  // AT_ENTRY, the entry point of the executable
+	atExecfn = 31 // AT_EXECFN, points to the path the process was executed as
+)
+
+// coreFile is a mapping of a file listed in the NT_FILE note
+type coreFile struct {
+	start, end uint64
+	name       string
+}
+
+// CoreSegment is a memory mapping saved in a core dump
+type CoreSegment struct {
+	Vaddr    uint64 `json:"vaddr"`
+	FileSize uint64 `json:"file_size"` // bytes saved in the core dump
+	MemSize  uint64 `json:"mem_size"`  // bytes mapped in the process
+	File     string `json:"file,omitempty"`
+}
+
+// CoreInfo describes a core dump
+type CoreInfo struct {
+	Path       string        `json:"path"`
+	Size       int64         `json:"size"`
+	FileSize   int64         `json:"file_size"`
+	Arch       string        `json:"arch"`
+	OSABI      string        `json:"osabi"`
+	Executable string        `json:"executable"` // path the process was executed as, or its name if unknown
+	Command    string        `json:"command"`    // the start of its command line
+	PID        int           `json:"pid"`
+	Signal     int           `json:"signal"`
+	SignalName string        `json:"signal_name"`
+	Threads    int           `json:"threads"`
+	Segments   []CoreSegment `json:"segments"`
+}
+
+// isCore reports whether r is an ELF core dump
+func isCore(r io.ReaderAt) bool {
+	var hdr [18]byte
+	if _, err := r.ReadAt(hdr[:], 0); err != nil || string(hdr[:4]) != elf.ELFMAG {
+		return false
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if elf.Data(hdr[elf.EI_DATA]) == elf.ELFDATA2MSB {
+		order = binary.BigEndian
+	}
+	return elf.Type(order.Uint16(hdr[16:])) == elf.ET_CORE
+}
+
+// coreSize returns the size of a core dump, which has no section headers
+// for the classic definition to go by, from the end of its segments
+func coreSize(r io.ReaderAt) (int64, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return 0, err
+	}
+	return segmentEnd(f, r)
+}
+
+// GetCoreInfo returns the CoreInfo of a core dump
+func GetCoreInfo(filepath string) (*CoreInfo, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return newCoreInfo(filepath, r)
+}
+
+// newCoreInfo collects the CoreInfo of an opened core dump
+func newCoreInfo(path string, r *inputFile) (*CoreInfo, error) {
+	f, err := parseElf(path, r)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := r.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size, err := segmentEnd(f, r)
+	if err != nil {
+		return nil, err
+	}
+	notes, err := elfNotes(f)
+	if err != nil {
+		return nil, err
+	}
+	info := &CoreInfo{
+		Path:     path,
+		Size:     size,
+		FileSize: stat.Size(),
+		Arch:     elfArchitecture(f),
+		OSABI:    osabiName(f.OSABI),
+	}
+	word := 4
+	if f.Class == elf.ELFCLASS64 {
+		word = 8
+	}
+	var files []coreFile
+	var auxv []byte
+	for _, note := range notes {
+		if note.Name != "CORE" && note.Name != "FreeBSD" {
+			continue
+		}
+		switch note.Type {
+		case ntPrstatus:
+			info.Threads++
+			// The first thread is the one that received the signal
+			if info.Threads == 1 {
+				info.Signal, info.PID = corePrstatus(note, f.ByteOrder, word)
+			}
+		case ntPrpsinfo:
+			info.Executable, info.Command = corePrpsinfo(note, word)
+		case ntAuxv:
+			auxv = note.Desc
+		case ntFile:
+			files = coreFiles(note.Desc, f.ByteOrder, word)
+		}
+	}
+	if info.Signal != 0 {
+		info.SignalName = syscall.Signal(info.Signal).String()
+	}
+	// The file mapped at the entry point has the absolute path of the
+	// executable, AT_EXECFN the one it was run as, pr_fname only its name
+	if name := mappedFile(files, auxvValue(auxv, f.ByteOrder, word, atEntry)); name != "" {
+		info.Executable = name
+	} else if name := coreString(f, auxvValue(auxv, f.ByteOrder, word, atExecfn)); name != "" {
+		info.Executable = name
+	}
+	info.Segments = []CoreSegment{}
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_LOAD {
+			info.Segments = append(info.Segments, CoreSegment{p.Vaddr, p.Filesz, p.Memsz, mappedFile(files, p.Vaddr)})
+		}
+	}
+	return info, nil
+}
+
+// corePrstatus returns the signal and process id from an NT_PRSTATUS note
+func corePrstatus(note elfNote, order binary.ByteOrder, word int) (signal, pid int) {
+	// Linux: struct elf_siginfo (3 ints), short pr_cursig, then pr_sigpend
+	// and pr_sighold (longs) before pr_pid. FreeBSD: pr_version (int),
+	// three size_ts, pr_osreldate, pr_cursig and pr_pid (ints)
+	sigOff, pidOff, sigSize := 12, 16+2*word, 2
+	if note.Name == "FreeBSD" {
+		sigOff, sigSize = 4*word+4, 4
+		if word == 4 {
+			sigOff = 20
+		}
+		pidOff = sigOff + 4
+	}
+	if len(note.Desc) < pidOff+4 {
+		return 0, 0
+	}
+	if sigSize == 2 {
+		signal = int(order.Uint16(note.Desc[sigOff:]))
+	} else {
+		signal = int(order.Uint32(note.Desc[sigOff:]))
+	}
+	return signal, int(order.Uint32(note.Desc[pidOff:]))
+}
+
+// corePrpsinfo returns pr_fname and pr_psargs from an NT_PRPSINFO note
+func corePrpsinfo(note elfNote, word int) (name, args string) {
+	// Linux: four chars, pr_flag (long), ids (two 32-bit uids on 64-bit
+	// systems, 16-bit ones on 32-bit systems, then four pids), pr_fname[16]
+	// and pr_psargs[80]. FreeBSD: pr_version, pr_psinfosz, pr_fname[17]
+	// and pr_psargs[81]
+	nameOff, nameLen, argsLen := 40, 16, 80
+	switch {
+	case note.Name == "FreeBSD":
+		nameOff, nameLen, argsLen = 2*word, 17, 81
+	case word == 4:
+		nameOff = 28
+	}
+	desc := note.Desc
+	if len(desc) < nameOff+nameLen+argsLen {
+		return "", ""
+	}
+	args = strings.TrimRight(cString(desc[nameOff+nameLen:nameOff+nameLen+argsLen]), " ")
+	return cString(desc[nameOff : nameOff+nameLen]), args
+}
+
+// auxvValue returns the entry of type typ in an auxiliary vector, or 0
+func auxvValue(data []byte, order binary.ByteOrder, word int, typ uint64) uint64 {
+	for len(data) >= 2*word {
+		if readWord(data, order, word) == typ {
+			return readWord(data[word:], order, word)
+		}
+		data = data[2*word:]
+	}
+	return 0
+}
+
+// coreFiles returns the mappings in an NT_FILE note: a count and the page
+// size, count start, end and offset triples, then count NUL terminated names
+func coreFiles(data []byte, order binary.ByteOrder, word int) []coreFile {
+	if len(data) < 2*word {
+		return nil
+	}
+	count := readWord(data, order, word)
+	if count > uint64(len(data)/(3*word)) {
+		return nil
+	}
+	entries := data[2*word:]
+	names := bytes.Split(entries[int(count)*3*word:], []byte{0})
+	var files []coreFile
+	for i := 0; i < int(count) && i < len(names); i++ {
+		entry := entries[i*3*word:]
+		files = append(files, coreFile{readWord(entry, order, word), readWord(entry[word:], order, word), string(names[i])})
+	}
+	return files
+}
+
+// mappedFile returns the name of the file mapped at addr, or ""
+func mappedFile(files []coreFile, addr uint64) string {
+	for _, file := range files {
+		if addr >= file.start && addr < file.end {
+			return file.name
+		}
+	}
+	return ""
+}
+
+// coreString reads a NUL terminated string from the saved memory of a
+// core dump, or returns "" if the address was not saved
+func coreString(f *elf.File, addr uint64) string {
+	if addr == 0 {
+		return ""
+	}
+	for _, p := range f.Progs {
+		if p.Type != elf.PT_LOAD || addr < p.Vaddr || addr >= p.Vaddr+p.Filesz {
+			continue
+		}
+		buf := make([]byte, min(4096, p.Vaddr+p.Filesz-addr))
+		n, _ := p.ReadAt(buf, int64(addr-p.Vaddr))
+		return cString(buf[:n])
+	}
+	return ""
+}
+
+// readWord reads a 4 or 8 byte unsigned integer
+func readWord(data []byte, order binary.ByteOrder, word int) uint64 {
+	if word == 8 {
+		return order.Uint64(data)
+	}
+	return uint64(order.Uint32(data))
+}
+
+// cString returns data up to the first NUL byte
+func cString(data []byte) string {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		data = data[:i]
+	}
+	return string(data)
+}
+
+// printCoreInfo prints the text form of the info subcommand for core dumps
+func printCoreInfo(info *CoreInfo) {
+	fmt.Printf("path:        %s\n", info.Path)
+	fmt.Printf("size:        %d\n", info.Size)
+	fmt.Printf("file_size:   %d\n", info.FileSize)
+	fmt.Printf("arch:        %s\n", info.Arch)
+	fmt.Printf("osabi:       %s\n", info.OSABI)
+	fmt.Printf("executable:  %s\n", info.Executable)
+	fmt.Printf("command:     %s\n", info.Command)
+	fmt.Printf("pid:         %d\n", info.PID)
+	fmt.Printf("signal:      %d (%s)\n", info.Signal, info.SignalName)
+	fmt.Printf("threads:     %d\n", info.Threads)
+	for _, s := range info.Segments {
+		fmt.Printf("segment:     %#x %d %d %s\n", s.Vaddr, s.FileSize, s.MemSize, s.File)
+	}
+}
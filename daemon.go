@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// daemonRequest is the JSON form of a request, for paths that contain
+// newlines
+type daemonRequest struct {
+	Path string `json:"path"`
+}
+
+// daemonError is the reply for a file that cannot be processed
+type daemonError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// Serve answers requests on l until it is closed. A request is a line with
+// a path, or a JSON object {"path": "..."}; the reply is a line with the
+// JSON summary of the file, as printed by elfsize info --json, or an object
+// with the path and an error
+func Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go serveConn(conn)
+	}
+}
+
+// serveConn answers the requests on one connection
+func serveConn(conn net.Conn) {
+	defer conn.Close()
+	in := bufio.NewScanner(conn)
+	out := json.NewEncoder(conn)
+	for in.Scan() {
+		line := strings.TrimSpace(in.Text())
+		if line == "" {
+			continue
+		}
+		path := line
+		if strings.HasPrefix(line, "{") {
+			var req daemonRequest
+			if err := json.Unmarshal([]byte(line), &req); err != nil {
+				out.Encode(daemonError{Error: err.Error()})
+				continue
+			}
+			path = req.Path
+		}
+		if err := out.Encode(daemonReply(path)); err != nil {
+			return
+		}
+	}
+}
+
+// daemonReply returns the summary of a file or a daemonError
+func daemonReply(path string) any {
+	f, err := openFile(path)
+	if err != nil {
+		return daemonError{path, err.Error()}
+	}
+	defer f.Close()
+	info, err := newFileInfo(path, f)
+	if err != nil {
+		return daemonError{path, err.Error()}
+	}
+	return info
+}
+
+// daemonCommand implements "elfsize --daemon <socket>". It replaces a stale
+// socket left behind by a previous run and removes its own on SIGINT and
+// SIGTERM
+func daemonCommand(socket string) int {
+	if conn, err := net.Dial("unix", socket); err == nil {
+		conn.Close()
+		PrintError("daemon", errors.New(Tr(msgSocketInUse, socket)))
+		return 1
+	}
+	if stat, err := os.Lstat(socket); err == nil && stat.Mode()&os.ModeSocket != 0 {
+		os.Remove(socket)
+	}
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		PrintError("daemon", err)
+		return 1
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		l.Close()
+	}()
+	// Closing the listener also removes the socket file
+	if err := Serve(l); err != nil {
+		PrintError("daemon", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// debugLinkSection holds the name and CRC32 of a separate debug file
+const debugLinkSection = ".gnu_debuglink"
+
+// DebugLink is the reference of a stripped binary to the file with its
+// debug info, and what was found of that file
+type DebugLink struct {
+	Name string `json:"name"`
+	CRC  uint32 `json:"crc"`
+	// Path is where the debug file was found, empty if not looked for or
+	// not found
+	Path string `json:"path,omitempty"`
+	// Valid reports whether the file at Path has the CRC
+	Valid bool `json:"valid"`
+}
+
+// GetDebugLink returns the .gnu_debuglink of a file, or nil if it has none
+func GetDebugLink(filepath string) (*DebugLink, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return nil, err
+	}
+	return elfDebugLink(f, r)
+}
+
+// elfDebugLink decodes the .gnu_debuglink section of f: the file name, NUL
+// padded to a multiple of 4 bytes, then the CRC32 in the byte order of f
+func elfDebugLink(f *elf.File, r io.ReaderAt) (*DebugLink, error) {
+	s := f.Section(debugLinkSection)
+	if s == nil || s.Type == elf.SHT_NOBITS {
+		return nil, nil
+	}
+	data, err := readSection(r, s, false)
+	if err != nil {
+		return nil, err
+	}
+	end := bytes.IndexByte(data, 0)
+	if end <= 0 || alignUp(uint64(end+1), 4)+4 > uint64(len(data)) {
+		return nil, errors.New(Tr(msgBadDebugLink, debugLinkSection))
+	}
+	crcOff := alignUp(uint64(end+1), 4)
+	return &DebugLink{Name: string(data[:end]), CRC: f.ByteOrder.Uint32(data[crcOff:])}, nil
+}
+
+// FindDebugFile looks for the debug file a binary links to where GDB does:
+// next to the binary, in its .debug directory, and in each of debugDirs
+// under the absolute directory of the binary, e.g. /usr/lib/debug/usr/bin.
+// It returns the link with Path set to the first candidate with the right
+// CRC, or to the first one found at all if none has it. Valid tells which
+func FindDebugFile(binary string, debugDirs ...string) (*DebugLink, error) {
+	link, err := GetDebugLink(binary)
+	if err != nil || link == nil {
+		return link, err
+	}
+	dir, err := filepath.Abs(filepath.Dir(binary))
+	if err != nil {
+		return nil, err
+	}
+	candidates := []string{filepath.Join(dir, link.Name), filepath.Join(dir, ".debug", link.Name)}
+	for _, debugDir := range debugDirs {
+		candidates = append(candidates, filepath.Join(debugDir, dir, link.Name))
+	}
+	self, _ := os.Stat(binary)
+	for _, candidate := range candidates {
+		stat, err := os.Stat(candidate)
+		// A debug file named like the binary must not be the binary itself
+		if err != nil || !stat.Mode().IsRegular() || (self != nil && os.SameFile(self, stat)) {
+			continue
+		}
+		crc, err := fileCRC32(candidate)
+		if err != nil {
+			return nil, err
+		}
+		if link.Path == "" || crc == link.CRC {
+			link.Path, link.Valid = candidate, crc == link.CRC
+		}
+		if link.Valid {
+			break
+		}
+	}
+	return link, nil
+}
+
+// fileCRC32 returns the CRC32 of a file as .gnu_debuglink uses it, the
+// IEEE polynomial like zlib
+func fileCRC32(path string) (uint32, error) {
+	r, err := openFile(path)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, r); err != nil {
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
+
+// debugLinkCommand implements "elfsize debuglink [--debug-dir dir] <file>"
+func debugLinkCommand(args []string) int {
+	fs := flag.NewFlagSet("debuglink", flag.ContinueOnError)
+	var debugDirs []string
+	fs.Func("debug-dir", "also look for the debug file in this directory, e.g. /usr/lib/debug; may be repeated", func(dir string) error {
+		debugDirs = append(debugDirs, dir)
+		return nil
+	})
+	find := fs.Bool("find", false, "look for the debug file next to the file and in its .debug directory, and check its CRC")
+	asJSON := fs.Bool("json", false, "print the link as JSON")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s debuglink [--find] [--debug-dir dir]... [--json] <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the name and CRC32 of the separate debug file a binary refers to\n")
+		fmt.Fprintf(os.Stderr, "    in its .gnu_debuglink section. With --find or --debug-dir, look for\n")
+		fmt.Fprintf(os.Stderr, "    the file where GDB does and exit with 1 unless its CRC matches\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	search := *find || len(debugDirs) > 0
+	var link *DebugLink
+	if search {
+		link, err = FindDebugFile(positional[0], debugDirs...)
+	} else {
+		link, err = GetDebugLink(positional[0])
+	}
+	if err != nil {
+		PrintError("debuglink", err)
+		return 1
+	}
+	if link == nil {
+		logMessage(slog.LevelError, msgNoDebugLink, positional[0], debugLinkSection)
+		return 1
+	}
+	if *asJSON {
+		out, _ := json.MarshalIndent(link, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		fmt.Printf("name:        %s\n", link.Name)
+		fmt.Printf("crc:         %08x\n", link.CRC)
+		if search {
+			fmt.Printf("path:        %s\n", link.Path)
+			fmt.Printf("valid:       %t\n", link.Valid)
+		}
+	}
+	switch {
+	case !search:
+	case link.Path == "":
+		logMessage(slog.LevelError, msgDebugFileNotFound, link.Name)
+		return 1
+	case !link.Valid:
+		logMessage(slog.LevelError, msgDebugFileCRC, link.Path, link.CRC)
+		return 1
+	}
+	return 0
+}
+
+// debugLinkContents encodes a .gnu_debuglink section for a debug file
+func debugLinkContents(name string, crc uint32, order binary.ByteOrder) []byte {
+	data := make([]byte, alignUp(uint64(len(name)+1), 4)+4)
+	copy(data, name)
+	order.PutUint32(data[len(data)-4:], crc)
+	return data
+}
+
+// AddDebugLink makes an ELF file refer to debugFile, typically made from it
+// with objcopy --only-keep-debug, like objcopy --add-gnu-debuglink does: its
+// .gnu_debuglink section gets the base name and the CRC32 of debugFile. An
+// existing link is replaced, in place if the new one fits, which also works
+// on files with an overlay. The result is written to output, or to the file
+// itself if output is empty
+func AddDebugLink(path string, debugFile string, output string) error {
+	crc, err := fileCRC32(debugFile)
+	if err != nil {
+		return err
+	}
+	r, err := openFile(path)
+	if err != nil {
+		return err
+	}
+	f, err := parseElf(path, r)
+	if err != nil {
+		r.Close()
+		return err
+	}
+	data := debugLinkContents(filepath.Base(debugFile), crc, f.ByteOrder)
+	existing := f.Section(debugLinkSection)
+	r.Close()
+
+	switch {
+	case existing == nil:
+		return AddSection(path, debugLinkSection, data, output)
+	case output == "" && existing.Type != elf.SHT_NOBITS && uint64(len(data)) <= existing.FileSize:
+		return SetSectionData(path, debugLinkSection, data)
+	}
+	if err := RemoveSections(path, []string{debugLinkSection}, output); err != nil {
+		return err
+	}
+	if output == "" {
+		output = path
+	}
+	return AddSection(output, debugLinkSection, data, "")
+}
+
+// addDebugLinkCommand implements "elfsize add-debuglink <file> <debug file>"
+func addDebugLinkCommand(args []string) int {
+	fs := flag.NewFlagSet("add-debuglink", flag.ContinueOnError)
+	output := fs.String("o", "", "write the result to this file instead of changing the file in place")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s add-debuglink <file> <debug file> [-o output]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Make a stripped file refer to its separate debug file with a\n")
+		fmt.Fprintf(os.Stderr, "    .gnu_debuglink section, replacing any existing one\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	if err := AddDebugLink(positional[0], positional[1], *output); err != nil {
+		PrintError("add-debuglink", err)
+		return 1
+	}
+	return 0
+}
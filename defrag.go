@@ -0,0 +1,139 @@
+package main
+
+import (
+	"debug/elf"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Defragment rewrites an ELF file with the sections outside of segments
+// packed behind the loaded part without more padding than their alignment
+// needs, and with the section header table at the end. Segments cannot move
+// without relinking, so their contents stay where they are. It returns the
+// number of bytes saved. The file is rewritten to output, or in place if
+// output is empty; if dryRun is set nothing is written
+func Defragment(filepath string, output string, dryRun bool) (int64, error) {
+	img, err := loadElfImage(filepath)
+	if err != nil {
+		return 0, err
+	}
+	if err := img.checkNoOverlay(); err != nil {
+		return 0, err
+	}
+	out, err := img.pack()
+	if err != nil {
+		return 0, err
+	}
+
+	saved := int64(len(img.data)) - int64(len(out.data))
+	if dryRun {
+		return saved, nil
+	}
+	if output == "" {
+		output = filepath
+	}
+	return saved, writeFileAtomic(output, out.data, out.mode)
+}
+
+// pack returns a copy of the image with the sections outside of segments
+// packed behind the segments and the section header table at the end
+func (img *elfImage) pack() (*elfImage, error) {
+	h, err := img.header()
+	if err != nil {
+		return nil, err
+	}
+	progs, err := img.progs()
+	if err != nil {
+		return nil, err
+	}
+	sections, err := img.sections()
+	if err != nil {
+		return nil, err
+	}
+
+	fixedEnd := uint64(img.headerSize())
+	if h.Phnum > 0 {
+		fixedEnd = max(fixedEnd, h.Phoff+uint64(h.Phnum)*uint64(h.Phentsize))
+	}
+	for _, p := range progs {
+		if p.Type != elf.PT_NULL {
+			fixedEnd = max(fixedEnd, p.Off+p.Filesz)
+		}
+	}
+	inSegment := func(s sectionHeader) bool {
+		for _, p := range progs {
+			if p.Type != elf.PT_NULL && s.Off >= p.Off && s.Off+s.Size <= p.Off+p.Filesz && s.Off < p.Off+p.Filesz {
+				return true
+			}
+		}
+		return false
+	}
+
+	var movable []int
+	for i, s := range sections {
+		switch {
+		case s.Type == elf.SHT_NULL:
+		case s.Type == elf.SHT_NOBITS || inSegment(s):
+			if s.Type != elf.SHT_NOBITS {
+				fixedEnd = max(fixedEnd, s.Off+s.Size)
+			}
+		default:
+			movable = append(movable, i)
+		}
+	}
+	if fixedEnd > uint64(len(img.data)) {
+		return nil, errors.New(Tr(msgOutOfBounds, fixedEnd))
+	}
+	sort.SliceStable(movable, func(a, b int) bool {
+		return sections[movable[a]].Off < sections[movable[b]].Off
+	})
+
+	out := &elfImage{data: append([]byte(nil), img.data[:fixedEnd]...), class: img.class, order: img.order, mode: img.mode}
+	for _, i := range movable {
+		s := &sections[i]
+		if s.Off+s.Size > uint64(len(img.data)) {
+			return nil, errors.New(Tr(msgOutOfBounds, s.Off))
+		}
+		off := alignUp(uint64(len(out.data)), s.Addralign)
+		out.writeBytes(off, img.data[s.Off:s.Off+s.Size])
+		s.Off = off
+	}
+	if len(sections) > 0 {
+		if err := out.writeSections(sections, alignUp(uint64(len(out.data)), out.wordSize())); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// defragCommand implements "elfsize defrag <file>"
+func defragCommand(args []string) int {
+	fs := flag.NewFlagSet("defrag", flag.ContinueOnError)
+	output := fs.String("o", "", "write the result to this file instead of changing the file in place")
+	dryRun := fs.Bool("dry-run", false, "only report how many bytes would be saved")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s defrag <file> [-o output] [--dry-run]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Pack the sections of an ELF file without gaps and print the number of bytes saved\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	saved, err := Defragment(positional[0], *output, *dryRun)
+	if err != nil {
+		PrintError("defrag", err)
+		return 1
+	}
+	fmt.Println(saved)
+	return 0
+}
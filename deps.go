@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"debug/elf"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ResolvedLibrary is a DT_NEEDED entry together with the file it resolves to
+type ResolvedLibrary struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"` // empty if the library was not found
+	NeededBy string `json:"needed_by"`
+}
+
+// defaultLibraryDirs are searched after RPATH, LD_LIBRARY_PATH and RUNPATH,
+// together with the directories from the dynamic linker configuration
+var defaultLibraryDirs = []string{"/lib", "/usr/lib", "/lib64", "/usr/lib64", "/usr/local/lib"}
+
+// ldConfigFiles are the dynamic linker configuration files of Linux and FreeBSD
+var ldConfigFiles = []string{"/etc/ld.so.conf", "/etc/ld-elf.so.conf"}
+
+// loadedObject is an ELF file on the dependency tree
+type loadedObject struct {
+	path    string
+	machine elf.Machine
+	class   elf.Class
+	needed  []string
+	runpath []string
+	// rpath holds the expanded DT_RPATH of this object followed by those of
+	// the objects that loaded it, which is what the dynamic linker searches
+	// when the object has no DT_RUNPATH
+	rpath []string
+}
+
+// ResolveDependencies finds the shared libraries an ELF file needs,
+// recursively, the way the dynamic linker would but without executing anything.
+// Libraries are searched for in DT_RPATH (when there is no DT_RUNPATH),
+// LD_LIBRARY_PATH, DT_RUNPATH and the system library directories. Every
+// library is listed once, in breadth-first order; missing ones have an empty Path
+func ResolveDependencies(filepath string) ([]ResolvedLibrary, error) {
+	root, err := loadObject(filepath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	systemDirs := systemLibraryDirs()
+	envDirs := splitSearchPath(os.Getenv("LD_LIBRARY_PATH"))
+
+	var resolved []ResolvedLibrary
+	seen := map[string]bool{}
+	queue := []*loadedObject{root}
+	for len(queue) > 0 {
+		obj := queue[0]
+		queue = queue[1:]
+		for _, name := range obj.needed {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+
+			var dirs []string
+			if len(obj.runpath) == 0 {
+				dirs = append(dirs, obj.rpath...)
+			}
+			dirs = append(dirs, envDirs...)
+			dirs = append(dirs, obj.runpath...)
+			dirs = append(dirs, systemDirs...)
+
+			lib := ResolvedLibrary{Name: name, NeededBy: obj.path}
+			if dep := findLibrary(name, dirs, obj); dep != nil {
+				lib.Path = dep.path
+				queue = append(queue, dep)
+			}
+			resolved = append(resolved, lib)
+		}
+	}
+	return resolved, nil
+}
+
+// findLibrary returns the first library called name in dirs that is
+// compatible with the object needing it
+func findLibrary(name string, dirs []string, parent *loadedObject) *loadedObject {
+	candidates := dirs
+	if strings.Contains(name, "/") {
+		candidates = []string{""}
+	}
+	for _, dir := range candidates {
+		path := name
+		if dir != "" {
+			path = filepath.Join(dir, name)
+		}
+		dep, err := loadObject(path, parent)
+		if err != nil {
+			continue
+		}
+		// The dynamic linker skips libraries for other architectures, such as
+		// 32-bit libraries in a directory that also holds 64-bit ones
+		if dep.machine != parent.machine || dep.class != parent.class {
+			continue
+		}
+		return dep
+	}
+	return nil
+}
+
+// dynamicDeps are the entries of the dynamic section of an ELF file that
+// dependency resolution needs, as they are in the file, before the search
+// paths are expanded for where it is
+type dynamicDeps struct {
+	Machine elf.Machine
+	Class   elf.Class
+	Needed  []string
+	RPath   []string
+	RunPath []string
+}
+
+// readDynamicDeps reads the dynamicDeps of an ELF file
+func readDynamicDeps(path string) (*dynamicDeps, error) {
+	r, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(path, r)
+	if err != nil {
+		return nil, err
+	}
+
+	deps := &dynamicDeps{Machine: f.Machine, Class: f.Class}
+	if deps.Needed, err = f.ImportedLibraries(); err != nil {
+		return nil, err
+	}
+	if rpaths, err := f.DynString(elf.DT_RPATH); err == nil {
+		deps.RPath = rpaths
+	}
+	if runpaths, err := f.DynString(elf.DT_RUNPATH); err == nil {
+		deps.RunPath = runpaths
+	}
+	return deps, nil
+}
+
+// loadObject reads what dependency resolution needs from an ELF file
+func loadObject(path string, parent *loadedObject) (*loadedObject, error) {
+	deps, err := readDynamicDeps(path)
+	if err != nil {
+		return nil, err
+	}
+	return deps.object(path, parent)
+}
+
+// object returns the loadedObject of the file at path with the entries
+// deps, its search paths expanded for where it is
+func (deps *dynamicDeps) object(path string, parent *loadedObject) (*loadedObject, error) {
+	obj := &loadedObject{path: path, machine: deps.Machine, class: deps.Class, needed: deps.Needed}
+	// $ORIGIN is the directory the object is in, as an absolute path
+	origin, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	lib := "lib"
+	if deps.Class == elf.ELFCLASS64 {
+		lib = "lib64"
+	}
+	for _, rpath := range deps.RPath {
+		obj.rpath = append(obj.rpath, splitSearchPath(expandDynamicStringTokens(rpath, origin, lib))...)
+	}
+	if parent != nil {
+		obj.rpath = append(obj.rpath, parent.rpath...)
+	}
+	for _, runpath := range deps.RunPath {
+		obj.runpath = append(obj.runpath, splitSearchPath(expandDynamicStringTokens(runpath, origin, lib))...)
+	}
+	return obj, nil
+}
+
+// expandDynamicStringTokens substitutes $ORIGIN and $LIB (also in the
+// ${ORIGIN} form) in an RPATH or RUNPATH value
+func expandDynamicStringTokens(value string, origin string, lib string) string {
+	return strings.NewReplacer(
+		"${ORIGIN}", origin, "$ORIGIN", origin,
+		"${LIB}", lib, "$LIB", lib,
+	).Replace(value)
+}
+
+// splitSearchPath splits a colon-separated list of directories. As with the
+// dynamic linker, an empty entry means the current directory
+func splitSearchPath(value string) []string {
+	if value == "" {
+		return nil
+	}
+	var dirs []string
+	for _, dir := range strings.Split(value, ":") {
+		if dir == "" {
+			dir = "."
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// systemLibraryDirs returns the directories from the dynamic linker
+// configuration followed by defaultLibraryDirs
+func systemLibraryDirs() []string {
+	return slices.Clone(loadSystemLibraryDirs())
+}
+
+// loadSystemLibraryDirs reads the ld.so.conf files once per process, so that
+// batches of commands do not parse them over and over
+var loadSystemLibraryDirs = sync.OnceValue(func() []string {
+	var dirs []string
+	for _, conf := range ldConfigFiles {
+		dirs = append(dirs, readLdConfig(conf, 0)...)
+	}
+	return append(dirs, defaultLibraryDirs...)
+})
+
+// readLdConfig returns the directories listed in an ld.so.conf style file,
+// following include directives
+func readLdConfig(path string, depth int) []string {
+	if depth > 8 {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var dirs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "include "):
+			pattern := strings.TrimSpace(strings.TrimPrefix(line, "include "))
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(filepath.Dir(path), pattern)
+			}
+			matches, _ := filepath.Glob(pattern)
+			for _, match := range matches {
+				dirs = append(dirs, readLdConfig(match, depth+1)...)
+			}
+		case filepath.IsAbs(line):
+			dirs = append(dirs, line)
+		}
+	}
+	return dirs
+}
+
+// cachedLibrary is a library of a cached dependency closure with the
+// build-id it had, by which the closure is checked against the files on
+// the machine using it
+type cachedLibrary struct {
+	ResolvedLibrary
+	BuildID string `json:"build_id"`
+}
+
+// cachedClosure is the dependency closure of a binary as cached by ldd
+type cachedClosure struct {
+	Root      string          `json:"root"` // the path NeededBy is relative to
+	Libraries []cachedLibrary `json:"libraries"`
+}
+
+// valid reports whether every library of the closure was found, and is
+// still at its path with the same build-id
+func (c *cachedClosure) valid() bool {
+	for _, lib := range c.Libraries {
+		if lib.Path == "" || lib.BuildID == "" {
+			return false
+		}
+		if buildID, err := GetBuildID(lib.Path); err != nil || buildID != lib.BuildID {
+			return false
+		}
+	}
+	return true
+}
+
+// cachedDependencies is ResolveDependencies with the closure cached by the
+// build-id of the binary and the search path it was resolved with: the
+// directory of the binary, for $ORIGIN, LD_LIBRARY_PATH and the system
+// library directories. A cached closure is only used if its libraries are
+// at the same paths with the same build-ids here, so closures with missing
+// libraries or libraries without a build-id are not cached
+func cachedDependencies(ctx context.Context, cache Cache, path string) ([]ResolvedLibrary, error) {
+	buildID, err := GetBuildID(path)
+	if err != nil {
+		return nil, err
+	}
+	origin, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	key := ""
+	if buildID != "" {
+		key = cacheKey("ldd", buildID, origin, os.Getenv("LD_LIBRARY_PATH"), strings.Join(systemLibraryDirs(), ":"))
+	}
+
+	closure := &cachedClosure{}
+	err = validatedAnalysis(ctx, cache, key, closure, closure.valid, func() error {
+		libs, err := ResolveDependencies(path)
+		if err != nil {
+			return err
+		}
+		*closure = cachedClosure{Root: path}
+		for _, lib := range libs {
+			entry := cachedLibrary{ResolvedLibrary: lib}
+			if lib.Path != "" {
+				entry.BuildID, _ = GetBuildID(lib.Path)
+			}
+			closure.Libraries = append(closure.Libraries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	libs := make([]ResolvedLibrary, len(closure.Libraries))
+	for i, lib := range closure.Libraries {
+		libs[i] = lib.ResolvedLibrary
+		// The binary may have been given by another path to the same
+		// directory when the closure was cached
+		if libs[i].NeededBy == closure.Root {
+			libs[i].NeededBy = path
+		}
+	}
+	return libs, nil
+}
+
+// lddCommand implements "elfsize ldd <file>"
+func lddCommand(args []string) int {
+	fs := flag.NewFlagSet("ldd", flag.ContinueOnError)
+	cacheURL := fs.String("cache", os.Getenv("ELFSIZE_CACHE"), "URL of an HTTP cache for the resolved libraries, keyed by build-id and search path (default $ELFSIZE_CACHE)")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s ldd <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Resolve the shared libraries an ELF file needs, recursively, without running it\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	var libs []ResolvedLibrary
+	if *cacheURL != "" {
+		libs, err = cachedDependencies(context.Background(), NewHTTPCache(*cacheURL), positional[0])
+	} else {
+		libs, err = ResolveDependencies(positional[0])
+	}
+	if err != nil {
+		PrintError("ldd", err)
+		return 1
+	}
+	status := 0
+	for _, lib := range libs {
+		if lib.Path == "" {
+			fmt.Printf("\t%s => not found\n", lib.Name)
+			status = 1
+			continue
+		}
+		fmt.Printf("\t%s => %s\n", lib.Name, lib.Path)
+	}
+	return status
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// DesktopFinding is a problem found in a desktop entry
+type DesktopFinding struct {
+	Line     int       // 1-based line number, 0 if the finding is about the whole file
+	Severity string    // "error" or "warning"
+	ID       messageID // stable identifier of the kind of problem
+	Message  string    // localized description
+
+	english string // untranslated description, used for baselines
+}
+
+// desktopKeyPattern matches a key with an optional locale, e.g. Name[de_DE@euro]
+var desktopKeyPattern = regexp.MustCompile(`^([A-Za-z0-9-]+)(\[[A-Za-z_@.]+\])?$`)
+
+// desktopBooleanKeys are the keys of the Desktop Entry Specification whose
+// value must be "true" or "false"
+var desktopBooleanKeys = map[string]bool{
+	"NoDisplay":            true,
+	"Hidden":               true,
+	"DBusActivatable":      true,
+	"Terminal":             true,
+	"StartupNotify":        true,
+	"PrefersNonDefaultGPU": true,
+	"SingleMainWindow":     true,
+}
+
+// ValidateDesktopEntry checks the contents of a .desktop file against the
+// Desktop Entry Specification and the additional requirements AppImages
+// have (an Icon key naming an icon without path or extension), and returns
+// the problems found
+func ValidateDesktopEntry(data []byte) []DesktopFinding {
+	var findings []DesktopFinding
+	report := func(line int, severity string, id messageID, args ...interface{}) {
+		findings = append(findings, DesktopFinding{line, severity, id, Tr(id, args...), trIn("en", id, args...)})
+	}
+
+	keys := map[string]string{}
+	keyLines := map[string]int{}
+	group := ""
+	seenGroup := false
+	seenDesktopEntry := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "[") {
+			if !strings.HasSuffix(trimmed, "]") {
+				report(n, "error", msgDesktopBadGroup, trimmed)
+				continue
+			}
+			group = trimmed[1 : len(trimmed)-1]
+			if !seenGroup && group != "Desktop Entry" {
+				report(n, "error", msgDesktopFirstGroup, group)
+			}
+			seenGroup = true
+			seenDesktopEntry = seenDesktopEntry || group == "Desktop Entry"
+			continue
+		}
+		if !seenGroup {
+			report(n, "error", msgDesktopOutsideGroup)
+			continue
+		}
+		if group != "Desktop Entry" {
+			continue
+		}
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			report(n, "error", msgDesktopBadLine)
+			continue
+		}
+		key := strings.TrimSpace(line[:eq])
+		value := strings.TrimSpace(line[eq+1:])
+		if !desktopKeyPattern.MatchString(key) {
+			report(n, "error", msgDesktopBadKey, key)
+			continue
+		}
+		if _, dup := keys[key]; dup {
+			report(n, "error", msgDesktopDuplicateKey, key, keyLines[key])
+			continue
+		}
+		keys[key] = value
+		keyLines[key] = n
+		if desktopBooleanKeys[key] && value != "true" && value != "false" {
+			report(n, "error", msgDesktopBoolean, key, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		report(0, "error", msgDesktopRead, err)
+		return findings
+	}
+	if !seenDesktopEntry {
+		report(0, "error", msgDesktopNoEntry)
+		return findings
+	}
+
+	for _, required := range []string{"Type", "Name"} {
+		if _, ok := keys[required]; !ok {
+			report(0, "error", msgDesktopMissingKey, required)
+		}
+	}
+	switch keys["Type"] {
+	case "Application":
+		if exec, ok := keys["Exec"]; !ok {
+			report(0, "error", msgDesktopMissingExec)
+		} else {
+			for _, problem := range validateDesktopExec(exec) {
+				report(keyLines["Exec"], "error", problem.id, problem.args...)
+			}
+		}
+	case "Link":
+		if _, ok := keys["URL"]; !ok {
+			report(0, "error", msgDesktopMissingURL)
+		}
+	case "Directory", "":
+	default:
+		report(keyLines["Type"], "error", msgDesktopUnknownType, keys["Type"])
+	}
+
+	if icon, ok := keys["Icon"]; !ok {
+		report(0, "error", msgDesktopMissingIcon)
+	} else if strings.Contains(icon, "/") {
+		report(keyLines["Icon"], "warning", msgDesktopIconPath, icon)
+	} else if ext := iconExtension(icon); ext != "" {
+		report(keyLines["Icon"], "warning", msgDesktopIconExtension, ext)
+	}
+
+	if categories, ok := keys["Categories"]; ok && !strings.HasSuffix(categories, ";") {
+		report(keyLines["Categories"], "warning", msgDesktopCategories)
+	}
+	return findings
+}
+
+// iconExtension returns the image file extension of an Icon value, if any
+func iconExtension(icon string) string {
+	for _, ext := range []string{".png", ".svg", ".svgz", ".xpm"} {
+		if strings.HasSuffix(strings.ToLower(icon), ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// execProblem is a problem found by validateDesktopExec
+type execProblem struct {
+	id   messageID
+	args []interface{}
+}
+
+// validateDesktopExec checks the quoting and field codes of an Exec value
+func validateDesktopExec(exec string) []execProblem {
+	var problems []execProblem
+	if exec == "" {
+		return []execProblem{{id: msgDesktopExecEmpty}}
+	}
+	quoted := false
+	files := 0
+	for i := 0; i < len(exec); i++ {
+		c := exec[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '\\' && quoted:
+			i++
+		case c == '%':
+			if i+1 == len(exec) {
+				problems = append(problems, execProblem{id: msgDesktopExecTrailing})
+				break
+			}
+			i++
+			switch exec[i] {
+			case 'f', 'F', 'u', 'U':
+				files++
+			case 'i', 'c', 'k', '%':
+			case 'd', 'D', 'n', 'N', 'v', 'm':
+				problems = append(problems, execProblem{msgDesktopExecDeprecated, []interface{}{exec[i]}})
+			default:
+				problems = append(problems, execProblem{msgDesktopExecInvalid, []interface{}{exec[i]}})
+			}
+		}
+	}
+	if quoted {
+		problems = append(problems, execProblem{id: msgDesktopExecQuotes})
+	}
+	if files > 1 {
+		problems = append(problems, execProblem{id: msgDesktopExecFiles})
+	}
+	return problems
+}
+
+// desktopValidateCommand implements "elfsize desktop-validate <file.desktop>..."
+func desktopValidateCommand(args []string) int {
+	fs := flag.NewFlagSet("desktop-validate", flag.ContinueOnError)
+	baselinePath := fs.String("baseline", "", "only report findings that are not in this baseline file")
+	writeBaseline := fs.String("write-baseline", "", "record the current findings in this baseline file")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s desktop-validate [options] <file.desktop>...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Check desktop entries against the specification and AppImage requirements\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	var baseline Baseline
+	if *baselinePath != "" {
+		if baseline, err = LoadBaseline(*baselinePath); err != nil {
+			PrintError("desktop-validate", err)
+			return 1
+		}
+	}
+
+	status := 0
+	var keys []string
+	for _, path := range positional {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			PrintError("desktop-validate", err)
+			status = 1
+			continue
+		}
+		for _, finding := range ValidateDesktopEntry(data) {
+			key := findingKey(path, string(finding.ID), finding.english)
+			keys = append(keys, key)
+			if baseline.Contains(key) {
+				continue
+			}
+			if finding.Line > 0 {
+				fmt.Printf("%s:%d: %s: %s [%s]\n", path, finding.Line, finding.Severity, finding.Message, finding.ID)
+			} else {
+				fmt.Printf("%s: %s: %s [%s]\n", path, finding.Severity, finding.Message, finding.ID)
+			}
+			if finding.Severity == "error" {
+				status = 1
+			}
+		}
+	}
+
+	if *writeBaseline != "" {
+		if err := WriteBaseline(*writeBaseline, keys); err != nil {
+			PrintError("desktop-validate", err)
+			return 1
+		}
+		// Recording a baseline accepts whatever was found
+		return 0
+	}
+	return status
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// DesktopMetadataVersion is the version of the --desktop-metadata field
+// set, like PorcelainVersion is for --porcelain
+const DesktopMetadataVersion = 1
+
+// desktopXattrPrefix is prepended to the keys of --desktop-metadata to name
+// the extended attributes they are written to, in the user namespace
+const desktopXattrPrefix = "elfsize."
+
+// DesktopMetadata is what a file manager such as helloSystem's Filer shows
+// for an ELF file or AppImage, cheap enough to get for every file of a
+// folder: nothing is verified or decompressed beyond the top directory of
+// the payload
+type DesktopMetadata struct {
+	Size          int64
+	FileSize      int64
+	ModTime       int64  // seconds since the epoch, to tell stale attributes
+	PayloadFormat string // "squashfs" or "iso9660", empty if none
+	PayloadSize   int64
+	Arch          string
+	AppImage      int    // 1 or 2, 0 if not an AppImage
+	Icon          string // where the icon is, a section name or .DirIcon, empty if none
+	IconFormat    string // "png" or "svg"
+	Signature     string // "none", "unsigned", "signed" or "appended"
+}
+
+// GetDesktopMetadata returns the DesktopMetadata of a file. An icon that is
+// neither PNG nor SVG, or in a payload that cannot be read, counts as none.
+// Signature is "signed" if an AppImage has one embedded, which is not
+// checked, see VerifySignature; "unsigned" if it has room for one; and
+// "appended" for a signature block such as that of kernel modules
+func GetDesktopMetadata(filepath string) (*DesktopMetadata, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := r.Stat()
+	if err != nil {
+		return nil, err
+	}
+	meta := &DesktopMetadata{
+		Size:      calculateElfSize(r),
+		FileSize:  stat.Size(),
+		ModTime:   stat.ModTime().Unix(),
+		Arch:      elfArchitecture(f),
+		AppImage:  appImageType(r),
+		Signature: "none",
+	}
+
+	payload, err := GetPayload(filepath)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		meta.PayloadFormat, meta.PayloadSize = payload.Format, payload.Size
+	}
+
+	for _, name := range iconSections {
+		s := f.Section(name)
+		if s == nil || s.Type == elf.SHT_NOBITS {
+			continue
+		}
+		if data, err := s.Data(); err == nil {
+			if format := iconFormat(bytes.TrimRight(data, "\x00")); format != "" {
+				meta.Icon, meta.IconFormat = name, format
+				break
+			}
+		}
+	}
+	if meta.Icon == "" && payload != nil {
+		if appimage, err := GetAppImageMetadata(filepath); err == nil {
+			if format := iconFormat(appimage.Icon); format != "" {
+				meta.Icon, meta.IconFormat = ".DirIcon", format
+			}
+		}
+	}
+
+	if s := f.Section(signatureSection); s != nil {
+		meta.Signature = "unsigned"
+		sig, _, err := GetSignature(filepath)
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(sig)) > 0 {
+			meta.Signature = "signed"
+		}
+	} else if sig, err := appendedSignature(r, stat.Size()); err == nil && sig != nil {
+		meta.Signature = "appended"
+	}
+	return meta, nil
+}
+
+// fields returns the key=value pairs of meta in the order of
+// writeDesktopMetadata, without the version
+func (meta *DesktopMetadata) fields() []struct {
+	key   string
+	value any
+} {
+	return []struct {
+		key   string
+		value any
+	}{
+		{"size", meta.Size},
+		{"file_size", meta.FileSize},
+		{"mtime", meta.ModTime},
+		{"payload_format", meta.PayloadFormat},
+		{"payload_size", meta.PayloadSize},
+		{"arch", meta.Arch},
+		{"appimage_type", meta.AppImage},
+		{"icon", meta.Icon},
+		{"icon_format", meta.IconFormat},
+		{"signature", meta.Signature},
+	}
+}
+
+// writeDesktopMetadata writes the --desktop-metadata form of meta to w, in
+// the format of --porcelain, in this order for version 1:
+//
+//	desktop_metadata=1
+//	path=<as given>
+//	size=<bytes of the ELF image>
+//	file_size=<bytes>
+//	mtime=<seconds since the epoch>
+//	payload_format=<squashfs or iso9660, empty if none>
+//	payload_size=<bytes, 0 if none>
+//	arch=<architecture, e.g. x86_64 or aarch64>
+//	appimage_type=<0, 1 or 2>
+//	icon=<.xdg_icon, .icon or .DirIcon, empty if none>
+//	icon_format=<png or svg, empty if none>
+//	signature=<none, unsigned, signed or appended>
+func writeDesktopMetadata(w io.Writer, path string, meta *DesktopMetadata) error {
+	if _, err := fmt.Fprintf(w, "desktop_metadata=%d\npath=%s\n", DesktopMetadataVersion, porcelainEscaper.Replace(path)); err != nil {
+		return err
+	}
+	for _, f := range meta.fields() {
+		if _, err := fmt.Fprintf(w, "%s=%s\n", f.key, porcelainEscaper.Replace(fmt.Sprint(f.value))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetDesktopMetadataXattrs writes meta to extended attributes of a file in
+// the user namespace, each key of writeDesktopMetadata prefixed with
+// "elfsize.", the version included, so that a file manager can read them
+// without running elfsize. Symbolic links are followed
+func SetDesktopMetadataXattrs(filepath string, meta *DesktopMetadata) error {
+	if isImagePath(filepath) {
+		return &os.PathError{Op: "setxattr", Path: filepath, Err: errors.New(Tr(msgImageReadOnly))}
+	}
+	if err := setXattr(filepath, desktopXattrPrefix+"desktop_metadata", fmt.Sprint(DesktopMetadataVersion)); err != nil {
+		return err
+	}
+	for _, f := range meta.fields() {
+		if err := setXattr(filepath, desktopXattrPrefix+f.key, fmt.Sprint(f.value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// desktopMetadataCommand implements "elfsize --desktop-metadata [--xattr] <file>...",
+// printing the fields of each file with a blank line in between, or writing
+// them as extended attributes
+func desktopMetadataCommand(paths []string, xattr bool) int {
+	status := 0
+	printed := false
+	for _, path := range paths {
+		meta, err := GetDesktopMetadata(path)
+		if err == nil && xattr {
+			err = SetDesktopMetadataXattrs(path, meta)
+		}
+		if err != nil {
+			PrintError("elfsize", err)
+			status = 1
+			continue
+		}
+		if xattr {
+			continue
+		}
+		if printed {
+			fmt.Println()
+		}
+		printed = true
+		if err := writeDesktopMetadata(os.Stdout, path, meta); err != nil {
+			PrintError("elfsize", err)
+			return 1
+		}
+	}
+	return status
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"debug/elf"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// GetNeededLibraries returns the DT_NEEDED entries of an ELF file, that is the
+// shared libraries it is linked against, and err
+func GetNeededLibraries(filepath string) ([]string, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return nil, err
+	}
+	return f.ImportedLibraries()
+}
+
+// neededCommand implements "elfsize needed <file>"
+func neededCommand(args []string) int {
+	fs := flag.NewFlagSet("needed", flag.ContinueOnError)
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s needed <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the shared libraries an ELF file is linked against\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	libs, err := GetNeededLibraries(positional[0])
+	if err != nil {
+		PrintError("needed", err)
+		return 1
+	}
+	for _, lib := range libs {
+		fmt.Println(lib)
+	}
+	return 0
+}
+
+// SearchPathEntry is one directory of a DT_RPATH or DT_RUNPATH value
+type SearchPathEntry struct {
+	Tag      string    `json:"tag"` // "RPATH" or "RUNPATH"
+	Path     string    `json:"path"`
+	Insecure bool      `json:"insecure"` // resolved against the current directory
+	Problem  messageID `json:"problem,omitempty"`
+}
+
+// GetSearchPaths returns the directories listed in DT_RPATH and DT_RUNPATH
+// of an ELF file, flagging entries that are relative to the current
+// directory or do not travel with the file because they do not use $ORIGIN
+func GetSearchPaths(filepath string) ([]SearchPathEntry, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return nil, err
+	}
+	return elfSearchPaths(f)
+}
+
+func elfSearchPaths(f *elf.File) ([]SearchPathEntry, error) {
+	var entries []SearchPathEntry
+	for _, tag := range []elf.DynTag{elf.DT_RPATH, elf.DT_RUNPATH} {
+		values, err := f.DynString(tag)
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			for _, dir := range strings.Split(value, ":") {
+				entry := SearchPathEntry{Tag: strings.TrimPrefix(tag.String(), "DT_"), Path: dir}
+				switch {
+				case dir == "":
+					entry.Insecure, entry.Problem = true, msgRpathEmpty
+				case strings.HasPrefix(dir, "$ORIGIN") || strings.HasPrefix(dir, "${ORIGIN}"):
+				case !strings.HasPrefix(dir, "/"):
+					entry.Insecure, entry.Problem = true, msgRpathRelative
+				default:
+					entry.Problem = msgRpathAbsolute
+				}
+				entries = append(entries, entry)
+			}
+		}
+	}
+	return entries, nil
+}
+
+// rpathCommand implements "elfsize rpath <file>"
+func rpathCommand(args []string) int {
+	fs := flag.NewFlagSet("rpath", flag.ContinueOnError)
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s rpath <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    List the RPATH and RUNPATH entries of an ELF file and flag problematic ones\n")
+		fmt.Fprintf(os.Stderr, "    Exits with 1 if an entry is relative to the current directory\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	entries, err := GetSearchPaths(positional[0])
+	if err != nil {
+		PrintError("rpath", err)
+		return 1
+	}
+	status := 0
+	for _, entry := range entries {
+		switch {
+		case entry.Insecure:
+			fmt.Printf("%s\t%s\tinsecure: %s [%s]\n", entry.Tag, entry.Path, Tr(entry.Problem), entry.Problem)
+			status = 1
+		case entry.Problem != "":
+			fmt.Printf("%s\t%s\twarning: %s [%s]\n", entry.Tag, entry.Path, Tr(entry.Problem), entry.Problem)
+		default:
+			fmt.Printf("%s\t%s\n", entry.Tag, entry.Path)
+		}
+	}
+	return status
+}
+
+// GetSoname returns the DT_SONAME of a shared library, or "" if it has none
+func GetSoname(filepath string) (string, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return "", err
+	}
+	return elfSoname(f)
+}
+
+// elfSoname returns the DT_SONAME of f, or "" if it has none
+func elfSoname(f *elf.File) (string, error) {
+	names, err := f.DynString(elf.DT_SONAME)
+	if err != nil || len(names) == 0 {
+		return "", err
+	}
+	return names[0], nil
+}
+
+// SetSoname sets the DT_SONAME of a shared library, adding the entry if there
+// is none. The file is rewritten to output, or in place if output is empty
+func SetSoname(filepath string, soname string, output string) error {
+	img, err := loadElfImage(filepath)
+	if err != nil {
+		return err
+	}
+	if err := img.checkNoOverlay(); err != nil {
+		return err
+	}
+	if err := img.setDynamicString(elf.DT_SONAME, elf.DT_NULL, soname); err != nil {
+		return err
+	}
+	if output == "" {
+		output = filepath
+	}
+	return writeFileAtomic(output, img.data, img.mode)
+}
+
+// setSonameCommand implements "elfsize set-soname <file> <soname>"
+func setSonameCommand(args []string) int {
+	fs := flag.NewFlagSet("set-soname", flag.ContinueOnError)
+	output := fs.String("o", "", "write the result to this file instead of changing the file in place")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s set-soname <file> <soname> [-o output]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Set the SONAME of a shared library, e.g. 'libfoo.so.1'\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	if err := SetSoname(positional[0], positional[1], *output); err != nil {
+		PrintError("set-soname", err)
+		return 1
+	}
+	return 0
+}
+
+// SetRunPath sets DT_RUNPATH of an ELF file, turning an existing DT_RPATH
+// into DT_RUNPATH, or sets DT_RPATH with forceRPATH; like patchelf --set-rpath.
+// The file is rewritten to output, or in place if output is empty
+func SetRunPath(filepath string, runpath string, forceRPATH bool, output string) error {
+	img, err := loadElfImage(filepath)
+	if err != nil {
+		return err
+	}
+	if err := img.checkNoOverlay(); err != nil {
+		return err
+	}
+	tag, replaces := elf.DT_RUNPATH, elf.DT_RPATH
+	if forceRPATH {
+		tag, replaces = elf.DT_RPATH, elf.DT_RUNPATH
+	}
+	if err := img.setDynamicString(tag, replaces, runpath); err != nil {
+		return err
+	}
+	if output == "" {
+		output = filepath
+	}
+	return writeFileAtomic(output, img.data, img.mode)
+}
+
+// setRpathCommand implements "elfsize set-rpath <file> <runpath>"
+func setRpathCommand(args []string) int {
+	fs := flag.NewFlagSet("set-rpath", flag.ContinueOnError)
+	forceRPATH := fs.Bool("force-rpath", false, "set DT_RPATH instead of DT_RUNPATH")
+	output := fs.String("o", "", "write the result to this file instead of changing the file in place")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s set-rpath <file> <runpath> [--force-rpath] [-o output]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Set the RUNPATH of an ELF file, e.g. '$ORIGIN/../lib'\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	if err := SetRunPath(positional[0], positional[1], *forceRPATH, *output); err != nil {
+		PrintError("set-rpath", err)
+		return 1
+	}
+	return 0
+}
+
+// DynamicEntry is an entry of the dynamic section with its value decoded:
+// the string of DT_NEEDED, DT_SONAME and the like, the flags of DT_FLAGS
+// and DT_FLAGS_1, sizes, counts and addresses
+type DynamicEntry struct {
+	Tag   elf.DynTag
+	Value uint64
+	Text  string
+}
+
+// dynamicStringTags are the tags whose values are offsets into DT_STRTAB
+var dynamicStringTags = map[elf.DynTag]bool{
+	elf.DT_NEEDED: true, elf.DT_SONAME: true, elf.DT_RPATH: true, elf.DT_RUNPATH: true,
+	elf.DT_AUXILIARY: true, elf.DT_FILTER: true, elf.DT_CONFIG: true, elf.DT_DEPAUDIT: true, elf.DT_AUDIT: true,
+}
+
+// GetDynamicEntries returns the entries of the dynamic section of a file up
+// to DT_NULL, found through PT_DYNAMIC so that files without section headers
+// work as well. It returns nil for statically linked files
+func GetDynamicEntries(filepath string) ([]DynamicEntry, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return nil, err
+	}
+	return elfDynamicEntries(f)
+}
+
+func elfDynamicEntries(f *elf.File) ([]DynamicEntry, error) {
+	var data []byte
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_DYNAMIC {
+			data = make([]byte, p.Filesz)
+			if _, err := p.ReadAt(data, 0); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	size := 16
+	if f.Class == elf.ELFCLASS32 {
+		size = 8
+	}
+	var entries []DynamicEntry
+	var strtab, strsz uint64
+	for off := 0; off+size <= len(data); off += size {
+		var e DynamicEntry
+		if size == 16 {
+			e.Tag, e.Value = elf.DynTag(f.ByteOrder.Uint64(data[off:])), f.ByteOrder.Uint64(data[off+8:])
+		} else {
+			e.Tag, e.Value = elf.DynTag(int32(f.ByteOrder.Uint32(data[off:]))), uint64(f.ByteOrder.Uint32(data[off+4:]))
+		}
+		if e.Tag == elf.DT_NULL {
+			break
+		}
+		switch e.Tag {
+		case elf.DT_STRTAB:
+			strtab = e.Value
+		case elf.DT_STRSZ:
+			strsz = e.Value
+		}
+		entries = append(entries, e)
+	}
+
+	strs := dynamicStrings(f, strtab, strsz)
+	word := uint64(size / 2)
+	for i := range entries {
+		e := &entries[i]
+		switch {
+		case dynamicStringTags[e.Tag]:
+			if e.Value < uint64(len(strs)) {
+				e.Text = cString(strs[e.Value:])
+			}
+		case e.Tag == elf.DT_FLAGS:
+			e.Text = strings.ReplaceAll(elf.DynFlag(e.Value).String(), "+", " ")
+		case e.Tag == elf.DT_FLAGS_1:
+			e.Text = strings.ReplaceAll(elf.DynFlag1(e.Value).String(), "+", " ")
+		case e.Tag == elf.DT_PLTREL:
+			e.Text = elf.DynTag(e.Value).String()
+		case e.Tag == elf.DT_INIT_ARRAYSZ, e.Tag == elf.DT_FINI_ARRAYSZ, e.Tag == elf.DT_PREINIT_ARRAYSZ:
+			e.Text = fmt.Sprintf("%d bytes, entries: %d", e.Value, e.Value/word)
+		case strings.HasSuffix(e.Tag.String(), "SZ") || strings.HasSuffix(e.Tag.String(), "ENT"):
+			e.Text = fmt.Sprintf("%d bytes", e.Value)
+		case strings.HasSuffix(e.Tag.String(), "NUM") || strings.HasSuffix(e.Tag.String(), "COUNT"):
+			e.Text = strconv.FormatUint(e.Value, 10)
+		case e.Tag == elf.DT_BIND_NOW || e.Tag == elf.DT_TEXTREL || e.Tag == elf.DT_SYMBOLIC || e.Tag == elf.DT_DEBUG:
+			e.Text = ""
+		default:
+			e.Text = fmt.Sprintf("%#x", e.Value)
+		}
+	}
+	return entries, nil
+}
+
+// dynamicStrings returns the dynamic string table at the address strtab,
+// mapped through the PT_LOAD segments, or nil if it is not in the file
+func dynamicStrings(f *elf.File, strtab, strsz uint64) []byte {
+	for _, p := range f.Progs {
+		if p.Type != elf.PT_LOAD || strtab < p.Vaddr || strtab >= p.Vaddr+p.Filesz {
+			continue
+		}
+		size := min(strsz, p.Vaddr+p.Filesz-strtab)
+		data := make([]byte, size)
+		if _, err := p.ReadAt(data, int64(strtab-p.Vaddr)); err != nil {
+			return nil
+		}
+		return data
+	}
+	return nil
+}
+
+// dynamicCommand implements "elfsize dynamic [--json] <file>"
+func dynamicCommand(args []string) int {
+	fs := flag.NewFlagSet("dynamic", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the entries as JSON")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s dynamic [--json] <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the tags of the dynamic section with their decoded values, like\n")
+		fmt.Fprintf(os.Stderr, "    readelf -d: libraries, SONAME, RPATH, flags, sizes and addresses\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	entries, err := GetDynamicEntries(positional[0])
+	if err != nil {
+		PrintError("dynamic", err)
+		return 1
+	}
+	if entries == nil && !*asJSON {
+		PrintError("dynamic", &FileError{positional[0], errors.New(Tr(msgNoDynamic))})
+		return 1
+	}
+	if *asJSON {
+		type entryJSON struct {
+			Tag   string `json:"tag"`
+			Value uint64 `json:"value"`
+			Text  string `json:"text,omitempty"`
+		}
+		out := []entryJSON{}
+		for _, e := range entries {
+			out = append(out, entryJSON{strings.TrimPrefix(e.Tag.String(), "DT_"), e.Value, e.Text})
+		}
+		data, _ := json.MarshalIndent(out, "", "  ")
+		fmt.Println(string(data))
+		return 0
+	}
+	for _, e := range entries {
+		fmt.Printf("%s\t%s\n", strings.TrimPrefix(e.Tag.String(), "DT_"), e.Text)
+	}
+	return 0
+}
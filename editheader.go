@@ -0,0 +1,286 @@
+package main
+
+import (
+	"debug/elf"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// headerField is a field of the ELF header that edit-header can set, at
+// its offset and with its size in the 32- and 64-bit headers
+type headerField struct {
+	name           string
+	off32, off64   uint64
+	size32, size64 int
+}
+
+// headerFields are the fields of the ELF header in the order they appear
+var headerFields = []headerField{
+	{"ei_osabi", elf.EI_OSABI, elf.EI_OSABI, 1, 1},
+	{"ei_abiversion", elf.EI_ABIVERSION, elf.EI_ABIVERSION, 1, 1},
+	{"e_type", 16, 16, 2, 2},
+	{"e_machine", 18, 18, 2, 2},
+	{"e_version", 20, 20, 4, 4},
+	{"e_entry", 24, 24, 4, 8},
+	{"e_phoff", 28, 32, 4, 8},
+	{"e_shoff", 32, 40, 4, 8},
+	{"e_flags", 36, 48, 4, 4},
+	{"e_ehsize", 40, 52, 2, 2},
+	{"e_phentsize", 42, 54, 2, 2},
+	{"e_phnum", 44, 56, 2, 2},
+	{"e_shentsize", 46, 58, 2, 2},
+	{"e_shnum", 48, 60, 2, 2},
+	{"e_shstrndx", 50, 62, 2, 2},
+}
+
+// lookupHeaderField returns the header field with a name, or nil
+func lookupHeaderField(name string) *headerField {
+	for i := range headerFields {
+		if headerFields[i].name == name {
+			return &headerFields[i]
+		}
+	}
+	return nil
+}
+
+// HeaderEditOptions controls EditHeader
+type HeaderEditOptions struct {
+	Backup string // suffix of the copy of the original file, "" for none
+	Force  bool   // write the file even if the new header does not validate
+	DryRun bool   // only report what would change
+}
+
+// getField reads a header field
+func (img *elfImage) getField(field headerField) uint64 {
+	off, size := field.off32, field.size32
+	if img.class == elf.ELFCLASS64 {
+		off, size = field.off64, field.size64
+	}
+	switch size {
+	case 1:
+		return uint64(img.data[off])
+	case 2:
+		return uint64(img.order.Uint16(img.data[off:]))
+	case 4:
+		return uint64(img.order.Uint32(img.data[off:]))
+	}
+	return img.order.Uint64(img.data[off:])
+}
+
+// setField writes a header field, or fails if value does not fit in it
+func (img *elfImage) setField(field headerField, value uint64) error {
+	off, size := field.off32, field.size32
+	if img.class == elf.ELFCLASS64 {
+		off, size = field.off64, field.size64
+	}
+	if size < 8 && value >= 1<<(8*size) {
+		return errors.New(Tr(msgHeaderValueRange, value, field.name, size))
+	}
+	switch size {
+	case 1:
+		img.data[off] = byte(value)
+	case 2:
+		img.order.PutUint16(img.data[off:], uint16(value))
+	case 4:
+		img.order.PutUint32(img.data[off:], uint32(value))
+	default:
+		img.order.PutUint64(img.data[off:], value)
+	}
+	return nil
+}
+
+// parseHeaderValue parses the value for a header field: a number in
+// decimal or 0x-prefixed hex, or a name for e_type, e_machine and ei_osabi
+func parseHeaderValue(field, value string) (uint64, error) {
+	if v, err := strconv.ParseUint(value, 0, 64); err == nil {
+		return v, nil
+	}
+	switch field {
+	case "e_type":
+		name := strings.ToUpper(value)
+		if !strings.HasPrefix(name, "ET_") {
+			name = "ET_" + name
+		}
+		for t := elf.ET_NONE; t <= elf.ET_CORE; t++ {
+			if t.String() == name {
+				return uint64(t), nil
+			}
+		}
+	case "e_machine":
+		if m, err := parseMachine(value); err == nil {
+			return uint64(m), nil
+		}
+	case "ei_osabi":
+		if abi, err := parseOSABI(value); err == nil {
+			return uint64(abi), nil
+		}
+	}
+	return 0, errors.New(Tr(msgHeaderValue, value, field))
+}
+
+// validateHeader returns what is wrong with the ELF header of img: tables
+// that do not fit in the file or have the wrong entry size, and a
+// e_shstrndx that is not the index of a section
+func (img *elfImage) validateHeader() []error {
+	var problems []error
+	h, err := img.header()
+	if err != nil {
+		return []error{err}
+	}
+	size := uint64(len(img.data))
+	progSize, sectSize := uint64(32), uint64(40)
+	if img.class == elf.ELFCLASS64 {
+		progSize, sectSize = 56, 64
+	}
+	for _, table := range []struct {
+		name       string
+		off        uint64
+		num        uint16
+		entsize    uint16
+		rightSize  uint64
+		entsizeTag string
+	}{
+		{"e_phoff", h.Phoff, h.Phnum, h.Phentsize, progSize, "e_phentsize"},
+		{"e_shoff", h.Shoff, h.Shnum, h.Shentsize, sectSize, "e_shentsize"},
+	} {
+		if table.num == 0 {
+			continue
+		}
+		if uint64(table.entsize) != table.rightSize {
+			problems = append(problems, errors.New(Tr(msgHeaderEntsize, table.entsizeTag, table.entsize, table.rightSize)))
+		}
+		if end := table.off + uint64(table.num)*uint64(table.entsize); end < table.off || end > size {
+			problems = append(problems, errors.New(Tr(msgHeaderTableOutside, table.name, table.off, table.num, table.entsize, size)))
+		}
+	}
+	if h.Shstrndx != uint16(elf.SHN_UNDEF) && h.Shstrndx != uint16(elf.SHN_XINDEX) && h.Shstrndx >= h.Shnum {
+		problems = append(problems, errors.New(Tr(msgHeaderShstrndx, h.Shstrndx, h.Shnum)))
+	}
+	if ehsize := img.getField(*lookupHeaderField("e_ehsize")); ehsize != uint64(img.headerSize()) {
+		problems = append(problems, errors.New(Tr(msgHeaderEntsize, "e_ehsize", ehsize, img.headerSize())))
+	}
+	if len(problems) == 0 {
+		if _, err := img.parse(); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	return problems
+}
+
+// EditHeader sets fields of the ELF header of a file, given as
+// "field=value" such as "e_type=DYN" or "e_shoff=0x1f40", and returns the
+// changes and what is wrong with the new header. Unless opts.Force, a file
+// whose new header has problems is not written; otherwise the original is
+// first copied to the file name with opts.Backup appended, unless such a
+// copy already exists, so that it always holds the file before the first
+// edit
+func EditHeader(filepath string, set []string, opts HeaderEditOptions) ([]HeaderRepair, []error, error) {
+	img, err := loadElfImage(filepath)
+	if err != nil {
+		return nil, nil, err
+	}
+	original := append([]byte(nil), img.data...)
+
+	var changes []HeaderRepair
+	for _, assignment := range set {
+		name, value, ok := strings.Cut(assignment, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		field := lookupHeaderField(name)
+		if !ok || field == nil {
+			return nil, nil, errors.New(Tr(msgHeaderField, assignment))
+		}
+		v, err := parseHeaderValue(name, strings.TrimSpace(value))
+		if err != nil {
+			return nil, nil, err
+		}
+		old := img.getField(*field)
+		if err := img.setField(*field, v); err != nil {
+			return nil, nil, err
+		}
+		if old != v {
+			changes = append(changes, HeaderRepair{field.name, old, v})
+		}
+	}
+
+	problems := img.validateHeader()
+	if opts.DryRun || len(changes) == 0 || (len(problems) > 0 && !opts.Force) {
+		return changes, problems, nil
+	}
+	if opts.Backup != "" {
+		backup := filepath + opts.Backup
+		if _, err := os.Lstat(backup); os.IsNotExist(err) {
+			if err := writeFileAtomic(backup, original, img.mode); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return changes, problems, writeFileAtomic(filepath, img.data, img.mode)
+}
+
+// editHeaderCommand implements "elfsize edit-header <file> --set field=value..."
+func editHeaderCommand(args []string) int {
+	fs := flag.NewFlagSet("edit-header", flag.ContinueOnError)
+	var set []string
+	fs.Func("set", "set a header field, as field=value; may be repeated", func(s string) error {
+		set = append(set, s)
+		return nil
+	})
+	var opts HeaderEditOptions
+	fs.StringVar(&opts.Backup, "backup", ".bak", "suffix of the copy of the original file, empty for none")
+	fs.BoolVar(&opts.Force, "force", false, "write the file even if the new header does not validate")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "only print what would change")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s edit-header <file> --set field=value... [--backup suffix] [--force] [--dry-run]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Set fields of the ELF header, printing each change, like elfedit(1).\n")
+		fmt.Fprintf(os.Stderr, "    Fields are named as in elf(5), e.g. e_type=DYN, e_machine=EM_AARCH64,\n")
+		fmt.Fprintf(os.Stderr, "    ei_osabi=FreeBSD or e_shoff=0x1f40; numbers may be hex.\n")
+		fmt.Fprintf(os.Stderr, "    The file is not written if the program or section header table\n")
+		fmt.Fprintf(os.Stderr, "    would not fit in it, or the header otherwise not validate,\n")
+		fmt.Fprintf(os.Stderr, "    unless --force is given. The original is kept as <file>.bak,\n")
+		fmt.Fprintf(os.Stderr, "    unless that exists from an earlier edit\n")
+		fmt.Fprintf(os.Stderr, "    Fields: %s\n", strings.Join(headerFieldNames(), " "))
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 || len(set) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	changes, problems, err := EditHeader(positional[0], set, opts)
+	if err != nil {
+		PrintError("edit-header", err)
+		return 1
+	}
+	for _, c := range changes {
+		fmt.Printf("%s\t%#x\t%#x\n", c.Field, c.Old, c.New)
+	}
+	for _, problem := range problems {
+		printWarning("edit-header", &FileError{positional[0], problem})
+	}
+	if len(problems) > 0 && !opts.Force && len(changes) > 0 {
+		if opts.DryRun {
+			return 1
+		}
+		PrintError("edit-header", errors.New(Tr(msgHeaderNotWritten, positional[0])))
+		return 1
+	}
+	return 0
+}
+
+// headerFieldNames lists the fields edit-header can set
+func headerFieldNames() []string {
+	names := make([]string, len(headerFields))
+	for i, field := range headerFields {
+		names[i] = field.name
+	}
+	return names
+}
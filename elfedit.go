@@ -0,0 +1,800 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// elfImage is an ELF file loaded into memory for editing. The accessors
+// translate between the 32- and 64-bit on-disk structures and Go values,
+// so that editing code does not have to care about the class
+type elfImage struct {
+	data  []byte
+	class elf.Class
+	order binary.ByteOrder
+	mode  os.FileMode // of the file the image was loaded from
+}
+
+// progHeader is a program header independent of the ELF class
+type progHeader struct {
+	Type   elf.ProgType
+	Flags  elf.ProgFlag
+	Off    uint64
+	Vaddr  uint64
+	Paddr  uint64
+	Filesz uint64
+	Memsz  uint64
+	Align  uint64
+}
+
+// sectionHeader is a section header independent of the ELF class
+type sectionHeader struct {
+	Name      uint32
+	Type      elf.SectionType
+	Flags     elf.SectionFlag
+	Addr      uint64
+	Off       uint64
+	Size      uint64
+	Link      uint32
+	Info      uint32
+	Addralign uint64
+	Entsize   uint64
+}
+
+// elfHeader holds the fields of the ELF header that editing needs
+type elfHeader struct {
+	Type      elf.Type
+	Phoff     uint64
+	Shoff     uint64
+	Phentsize uint16
+	Phnum     uint16
+	Shentsize uint16
+	Shnum     uint16
+	Shstrndx  uint16
+}
+
+// loadElfImage reads a whole ELF file into memory
+func loadElfImage(path string) (*elfImage, error) {
+	f, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, info.Size())
+	if _, err := f.ReadAt(data, 0); err != nil {
+		return nil, err
+	}
+	img, err := newElfImage(data, info.Mode().Perm())
+	if err != nil {
+		return nil, &FileError{path, err}
+	}
+	return img, nil
+}
+
+// newElfImage wraps the contents of an ELF file
+func newElfImage(data []byte, mode os.FileMode) (*elfImage, error) {
+	if len(data) < elf.EI_NIDENT || string(data[:4]) != elf.ELFMAG {
+		return nil, withKind(ErrNotELF, errors.New(Tr(msgBadMagic, data[:min(4, len(data))])))
+	}
+	img := &elfImage{data: data, class: elf.Class(data[elf.EI_CLASS]), mode: mode}
+	switch elf.Data(data[elf.EI_DATA]) {
+	case elf.ELFDATA2LSB:
+		img.order = binary.LittleEndian
+	case elf.ELFDATA2MSB:
+		img.order = binary.BigEndian
+	default:
+		return nil, ErrUnsupportedClass
+	}
+	if img.class != elf.ELFCLASS32 && img.class != elf.ELFCLASS64 {
+		return nil, ErrUnsupportedClass
+	}
+	if len(data) < img.headerSize() {
+		return nil, withKind(ErrTruncated, errors.New(Tr(msgTruncatedHeader)))
+	}
+	return img, nil
+}
+
+// parse returns a debug/elf view of the current contents
+func (img *elfImage) parse() (*elf.File, error) {
+	return elf.NewFile(bytes.NewReader(img.data))
+}
+
+func (img *elfImage) headerSize() int {
+	if img.class == elf.ELFCLASS64 {
+		return 64
+	}
+	return 52
+}
+
+// wordSize returns the size of an address, which the section header table
+// is aligned to
+func (img *elfImage) wordSize() uint64 {
+	if img.class == elf.ELFCLASS64 {
+		return 8
+	}
+	return 4
+}
+
+// read decodes the structure v at off
+func (img *elfImage) read(off uint64, v interface{}) error {
+	size := uint64(binary.Size(v))
+	if off+size < off || off+size > uint64(len(img.data)) {
+		return errors.New(Tr(msgOutOfBounds, off))
+	}
+	return binary.Read(bytes.NewReader(img.data[off:off+size]), img.order, v)
+}
+
+// write encodes the structure v at off, growing the image if needed
+func (img *elfImage) write(off uint64, v interface{}) {
+	var buf bytes.Buffer
+	binary.Write(&buf, img.order, v)
+	img.writeBytes(off, buf.Bytes())
+}
+
+// writeBytes copies b to off, growing the image if needed
+func (img *elfImage) writeBytes(off uint64, b []byte) {
+	if end := off + uint64(len(b)); end > uint64(len(img.data)) {
+		img.data = append(img.data, make([]byte, end-uint64(len(img.data)))...)
+	}
+	copy(img.data[off:], b)
+}
+
+func (img *elfImage) header() (elfHeader, error) {
+	if img.class == elf.ELFCLASS64 {
+		var h elf.Header64
+		err := img.read(0, &h)
+		return elfHeader{elf.Type(h.Type), h.Phoff, h.Shoff, h.Phentsize, h.Phnum, h.Shentsize, h.Shnum, h.Shstrndx}, err
+	}
+	var h elf.Header32
+	err := img.read(0, &h)
+	return elfHeader{elf.Type(h.Type), uint64(h.Phoff), uint64(h.Shoff), h.Phentsize, h.Phnum, h.Shentsize, h.Shnum, h.Shstrndx}, err
+}
+
+func (img *elfImage) setHeader(eh elfHeader) error {
+	if img.class == elf.ELFCLASS64 {
+		var h elf.Header64
+		if err := img.read(0, &h); err != nil {
+			return err
+		}
+		h.Type, h.Phoff, h.Shoff = uint16(eh.Type), eh.Phoff, eh.Shoff
+		h.Phentsize, h.Phnum, h.Shentsize, h.Shnum, h.Shstrndx = eh.Phentsize, eh.Phnum, eh.Shentsize, eh.Shnum, eh.Shstrndx
+		img.write(0, &h)
+		return nil
+	}
+	var h elf.Header32
+	if err := img.read(0, &h); err != nil {
+		return err
+	}
+	h.Type, h.Phoff, h.Shoff = uint16(eh.Type), uint32(eh.Phoff), uint32(eh.Shoff)
+	h.Phentsize, h.Phnum, h.Shentsize, h.Shnum, h.Shstrndx = eh.Phentsize, eh.Phnum, eh.Shentsize, eh.Shnum, eh.Shstrndx
+	img.write(0, &h)
+	return nil
+}
+
+// progs returns all program headers
+func (img *elfImage) progs() ([]progHeader, error) {
+	h, err := img.header()
+	if err != nil {
+		return nil, err
+	}
+	progs := make([]progHeader, h.Phnum)
+	for i := range progs {
+		off := h.Phoff + uint64(i)*uint64(h.Phentsize)
+		if img.class == elf.ELFCLASS64 {
+			var p elf.Prog64
+			err = img.read(off, &p)
+			progs[i] = progHeader{elf.ProgType(p.Type), elf.ProgFlag(p.Flags), p.Off, p.Vaddr, p.Paddr, p.Filesz, p.Memsz, p.Align}
+		} else {
+			var p elf.Prog32
+			err = img.read(off, &p)
+			progs[i] = progHeader{elf.ProgType(p.Type), elf.ProgFlag(p.Flags), uint64(p.Off), uint64(p.Vaddr), uint64(p.Paddr), uint64(p.Filesz), uint64(p.Memsz), uint64(p.Align)}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return progs, nil
+}
+
+// setProgs overwrites the program header table, which must keep its size
+func (img *elfImage) setProgs(progs []progHeader) error {
+	h, err := img.header()
+	if err != nil {
+		return err
+	}
+	if len(progs) != int(h.Phnum) {
+		return errors.New(Tr(msgPhdrTableSize))
+	}
+	for i, p := range progs {
+		off := h.Phoff + uint64(i)*uint64(h.Phentsize)
+		if img.class == elf.ELFCLASS64 {
+			img.write(off, &elf.Prog64{Type: uint32(p.Type), Flags: uint32(p.Flags), Off: p.Off, Vaddr: p.Vaddr, Paddr: p.Paddr, Filesz: p.Filesz, Memsz: p.Memsz, Align: p.Align})
+		} else {
+			img.write(off, &elf.Prog32{Type: uint32(p.Type), Off: uint32(p.Off), Vaddr: uint32(p.Vaddr), Paddr: uint32(p.Paddr), Filesz: uint32(p.Filesz), Memsz: uint32(p.Memsz), Flags: uint32(p.Flags), Align: uint32(p.Align)})
+		}
+	}
+	return nil
+}
+
+// sections returns all section headers
+func (img *elfImage) sections() ([]sectionHeader, error) {
+	h, err := img.header()
+	if err != nil {
+		return nil, err
+	}
+	if h.Shoff == 0 {
+		return nil, nil
+	}
+	sections := make([]sectionHeader, h.Shnum)
+	for i := range sections {
+		if sections[i], err = img.sectionAt(h.Shoff + uint64(i)*uint64(h.Shentsize)); err != nil {
+			return nil, err
+		}
+	}
+	return sections, nil
+}
+
+// sectionAt decodes the section header at off
+func (img *elfImage) sectionAt(off uint64) (sectionHeader, error) {
+	if img.class == elf.ELFCLASS64 {
+		var s elf.Section64
+		err := img.read(off, &s)
+		return sectionHeader{s.Name, elf.SectionType(s.Type), elf.SectionFlag(s.Flags), s.Addr, s.Off, s.Size, s.Link, s.Info, s.Addralign, s.Entsize}, err
+	}
+	var s elf.Section32
+	err := img.read(off, &s)
+	return sectionHeader{s.Name, elf.SectionType(s.Type), elf.SectionFlag(s.Flags), uint64(s.Addr), uint64(s.Off), uint64(s.Size), s.Link, s.Info, uint64(s.Addralign), uint64(s.Entsize)}, err
+}
+
+// sectionEntrySize returns the size of a section header of the image's class
+func (img *elfImage) sectionEntrySize() uint64 {
+	if img.class == elf.ELFCLASS64 {
+		return uint64(binary.Size(elf.Section64{}))
+	}
+	return uint64(binary.Size(elf.Section32{}))
+}
+
+// writeSections writes a section header table at off and points the ELF
+// header at it. The number of sections may differ from before
+func (img *elfImage) writeSections(sections []sectionHeader, off uint64) error {
+	h, err := img.header()
+	if err != nil {
+		return err
+	}
+	h.Shoff, h.Shnum = off, uint16(len(sections))
+	h.Shentsize = uint16(img.sectionEntrySize())
+	for i, s := range sections {
+		at := off + uint64(i)*uint64(h.Shentsize)
+		if img.class == elf.ELFCLASS64 {
+			img.write(at, &elf.Section64{Name: s.Name, Type: uint32(s.Type), Flags: uint64(s.Flags), Addr: s.Addr, Off: s.Off, Size: s.Size, Link: s.Link, Info: s.Info, Addralign: s.Addralign, Entsize: s.Entsize})
+		} else {
+			img.write(at, &elf.Section32{Name: s.Name, Type: uint32(s.Type), Flags: uint32(s.Flags), Addr: uint32(s.Addr), Off: uint32(s.Off), Size: uint32(s.Size), Link: s.Link, Info: s.Info, Addralign: uint32(s.Addralign), Entsize: uint32(s.Entsize)})
+		}
+	}
+	return img.setHeader(h)
+}
+
+// setSections overwrites the section header table in place
+func (img *elfImage) setSections(sections []sectionHeader) error {
+	h, err := img.header()
+	if err != nil {
+		return err
+	}
+	if len(sections) != int(h.Shnum) {
+		return errors.New(Tr(msgShdrTableSize))
+	}
+	return img.writeSections(sections, h.Shoff)
+}
+
+// dynEntry is an entry of the dynamic section
+type dynEntry struct {
+	Tag elf.DynTag
+	Val uint64
+}
+
+// dynamicEntries returns the dynamic section as found through PT_DYNAMIC,
+// including DT_NULL entries up to the end of the segment, and its header index
+func (img *elfImage) dynamicEntries() ([]dynEntry, int, error) {
+	progs, err := img.progs()
+	if err != nil {
+		return nil, 0, err
+	}
+	for i, p := range progs {
+		if p.Type != elf.PT_DYNAMIC {
+			continue
+		}
+		var entries []dynEntry
+		size := img.dynEntrySize()
+		for off := p.Off; off+size <= p.Off+p.Filesz; off += size {
+			var e dynEntry
+			if img.class == elf.ELFCLASS64 {
+				var d elf.Dyn64
+				err = img.read(off, &d)
+				e = dynEntry{elf.DynTag(d.Tag), d.Val}
+			} else {
+				var d elf.Dyn32
+				err = img.read(off, &d)
+				e = dynEntry{elf.DynTag(d.Tag), uint64(d.Val)}
+			}
+			if err != nil {
+				return nil, 0, err
+			}
+			entries = append(entries, e)
+		}
+		return entries, i, nil
+	}
+	return nil, -1, errors.New(Tr(msgNoDynamic))
+}
+
+func (img *elfImage) dynEntrySize() uint64 {
+	if img.class == elf.ELFCLASS64 {
+		return 16
+	}
+	return 8
+}
+
+// encodeDynamic returns the on-disk form of dynamic entries
+func (img *elfImage) encodeDynamic(entries []dynEntry) []byte {
+	var buf bytes.Buffer
+	for _, e := range entries {
+		if img.class == elf.ELFCLASS64 {
+			binary.Write(&buf, img.order, &elf.Dyn64{Tag: int64(e.Tag), Val: e.Val})
+		} else {
+			binary.Write(&buf, img.order, &elf.Dyn32{Tag: int32(e.Tag), Val: uint32(e.Val)})
+		}
+	}
+	return buf.Bytes()
+}
+
+// vaddrToOffset maps a virtual address to a file offset through the PT_LOAD segments
+func (img *elfImage) vaddrToOffset(vaddr uint64) (uint64, error) {
+	progs, err := img.progs()
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range progs {
+		if p.Type == elf.PT_LOAD && vaddr >= p.Vaddr && vaddr < p.Vaddr+p.Filesz {
+			return p.Off + vaddr - p.Vaddr, nil
+		}
+	}
+	return 0, errors.New(Tr(msgUnmappedAddress, vaddr))
+}
+
+// sectionNames returns the names of sections from the section name table
+// at index shstrndx, or their indexes in brackets if they have none
+func (img *elfImage) sectionNames(sections []sectionHeader, shstrndx uint16) []string {
+	names := make([]string, len(sections))
+	for i, s := range sections {
+		names[i] = fmt.Sprintf("[%d]", i)
+		if int(shstrndx) >= len(sections) || sections[shstrndx].Type != elf.SHT_STRTAB {
+			continue
+		}
+		if table := sections[shstrndx]; uint64(s.Name) < table.Size {
+			if name := img.cString(table.Off + uint64(s.Name)); name != "" {
+				names[i] = name
+			}
+		}
+	}
+	return names
+}
+
+// cString returns the NUL-terminated string at off
+func (img *elfImage) cString(off uint64) string {
+	if off >= uint64(len(img.data)) {
+		return ""
+	}
+	s := img.data[off:]
+	if i := bytes.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return string(s)
+}
+
+// alignUp rounds v up to a multiple of align, which must be a power of two
+func alignUp(v uint64, align uint64) uint64 {
+	if align <= 1 {
+		return v
+	}
+	return (v + align - 1) &^ (align - 1)
+}
+
+// writeFileAtomic replaces path with data by writing a temporary file next to
+// it and renaming it into place, so that readers never see a partial file.
+// Files inside filesystem images cannot be replaced
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	if isImagePath(path) {
+		return &os.PathError{Op: "write", Path: path, Err: errors.New(Tr(msgImageReadOnly))}
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// checkNoOverlay fails for files with data appended after the ELF image.
+// Edits that grow the image would overwrite it
+func (img *elfImage) checkNoOverlay() error {
+	if size := calculateElfSize(bytes.NewReader(img.data)); size < int64(len(img.data)) {
+		return errors.New(Tr(msgHasOverlay, int64(len(img.data))-size))
+	}
+	return nil
+}
+
+// addLoadSegment appends content to the image in a new PT_LOAD segment and
+// returns its virtual address and file offset.
+// There are no spare program headers in an ELF file, so a PT_NULL header, or
+// a PT_NOTE header whose notes another PT_NOTE also covers, is repurposed.
+// Otherwise the program header table is moved into the new segment with one
+// more entry, since the kernel and the dynamic linker read notes such as the
+// ABI tag through PT_NOTE, and not through sections.
+// A segment that an earlier edit added is extended instead, as long as
+// nothing follows it but the section header table. The section header table
+// is moved behind the new data so that it still marks the end of the ELF
+// image. Callers must point section headers at whatever they placed in the
+// segment
+func (img *elfImage) addLoadSegment(content []byte, flags elf.ProgFlag) (uint64, uint64, error) {
+	progs, err := img.progs()
+	if err != nil {
+		return 0, 0, err
+	}
+	sections, err := img.sections()
+	if err != nil {
+		return 0, 0, err
+	}
+	// Never make a segment writable and executable at once
+	if i := img.trailingSegment(progs, sections); i >= 0 && (progs[i].Flags|flags)&(elf.PF_W|elf.PF_X) != elf.PF_W|elf.PF_X {
+		return img.extendSegment(progs, i, sections, content, flags)
+	}
+
+	spare := -1
+	var pageAlign, end uint64 = 0x1000, 0
+	for i, p := range progs {
+		switch p.Type {
+		case elf.PT_LOAD:
+			pageAlign = max(pageAlign, p.Align)
+			end = max(end, p.Vaddr+p.Memsz)
+		case elf.PT_NULL:
+			spare = i
+		case elf.PT_NOTE:
+			if (spare < 0 || progs[spare].Type != elf.PT_NULL) && redundantNote(progs, i) {
+				spare = i
+			}
+		}
+	}
+
+	var off, vaddr, segOff, segVaddr uint64
+	if spare >= 0 {
+		progs = append(progs[:spare], progs[spare+1:]...)
+		off = alignUp(uint64(len(img.data)), 16)
+		vaddr = alignUp(end, pageAlign) + off%pageAlign
+		segOff, segVaddr = off, vaddr
+	} else {
+		if segOff, err = img.moveProgs(progs, end, pageAlign); err != nil {
+			return 0, 0, err
+		}
+		segVaddr = segOff + firstLoadBias(progs)
+		off = alignUp(segOff+uint64(len(progs)+1)*uint64(img.progEntrySize()), 16)
+		vaddr = segVaddr + (off - segOff)
+		for i := range progs {
+			if progs[i].Type == elf.PT_PHDR {
+				size := uint64(len(progs)+1) * uint64(img.progEntrySize())
+				progs[i].Off, progs[i].Vaddr, progs[i].Paddr = segOff, segVaddr, segVaddr
+				progs[i].Filesz, progs[i].Memsz = size, size
+			}
+		}
+	}
+	img.writeBytes(off, content)
+
+	// PT_LOAD entries must stay sorted by address, and the new segment has
+	// the highest one, so it goes right after the last PT_LOAD
+	last := 0
+	for i, p := range progs {
+		if p.Type == elf.PT_LOAD {
+			last = i + 1
+		}
+	}
+	if spare < 0 {
+		// The program header table must be readable to the kernel and the
+		// dynamic linker
+		flags |= elf.PF_R
+	}
+	size := off - segOff + uint64(len(content))
+	segment := progHeader{elf.PT_LOAD, flags, segOff, segVaddr, segVaddr, size, size, pageAlign}
+	progs = append(progs[:last], append([]progHeader{segment}, progs[last:]...)...)
+	if err := img.setProgs(progs); err != nil {
+		return 0, 0, err
+	}
+
+	if len(sections) > 0 {
+		shoff := alignUp(off+uint64(len(content)), 8)
+		img.data = img.data[:min(uint64(len(img.data)), shoff)]
+		if err := img.writeSections(sections, shoff); err != nil {
+			return 0, 0, err
+		}
+	}
+	return vaddr, off, nil
+}
+
+// redundantNote reports whether the notes of the PT_NOTE header progs[i] are
+// all in another PT_NOTE, so that the header can be done without
+func redundantNote(progs []progHeader, i int) bool {
+	p := progs[i]
+	for j, q := range progs {
+		if j != i && q.Type == elf.PT_NOTE && q.Off <= p.Off && p.Off+p.Filesz <= q.Off+q.Filesz {
+			return true
+		}
+	}
+	return false
+}
+
+// firstLoadBias returns the difference between the virtual address and the
+// file offset of the PT_LOAD segment with the lowest address
+func firstLoadBias(progs []progHeader) uint64 {
+	first := -1
+	for i, p := range progs {
+		if p.Type == elf.PT_LOAD && (first < 0 || p.Vaddr < progs[first].Vaddr) {
+			first = i
+		}
+	}
+	if first < 0 {
+		return 0
+	}
+	return progs[first].Vaddr - progs[first].Off
+}
+
+// progEntrySize returns the size of a program header
+func (img *elfImage) progEntrySize() uint16 {
+	if img.class == elf.ELFCLASS64 {
+		return 56
+	}
+	return 32
+}
+
+// moveProgs points the ELF header at a program header table with room for
+// one more entry than progs at the end of the image, and returns its offset.
+// Older Linux kernels take the address of the table to be its offset plus
+// that of the first segment, so the table is placed where its offset and
+// address differ by as much, past end, the end of the highest segment.
+// setProgs writes the entries there
+func (img *elfImage) moveProgs(progs []progHeader, end, pageAlign uint64) (uint64, error) {
+	h, err := img.header()
+	if err != nil {
+		return 0, err
+	}
+	if len(progs)+1 >= 0xffff {
+		return 0, errors.New(Tr(msgNoSpareHeader))
+	}
+	bias := firstLoadBias(progs)
+	off := alignUp(uint64(len(img.data)), 16)
+	if start := alignUp(end, pageAlign) - bias; start > off {
+		off = start
+	}
+	// Unless the segments are laid out strangely, that is at most the bss
+	// of the last one away
+	if off+bias < alignUp(end, pageAlign) || off-uint64(len(img.data)) > 16<<20 {
+		return 0, errors.New(Tr(msgNoSpareHeader))
+	}
+	h.Phoff, h.Phentsize, h.Phnum = off, img.progEntrySize(), uint16(len(progs)+1)
+	return off, img.setHeader(h)
+}
+
+// trailingSegment returns the index of the PT_LOAD segment with the highest
+// address if it is also the last thing in the file but the section header
+// table and has no bss, as after addLoadSegment, or -1
+func (img *elfImage) trailingSegment(progs []progHeader, sections []sectionHeader) int {
+	last := -1
+	for i, p := range progs {
+		if p.Type == elf.PT_LOAD && (last < 0 || p.Vaddr > progs[last].Vaddr) {
+			last = i
+		}
+	}
+	if last < 0 || progs[last].Filesz != progs[last].Memsz || progs[last].Filesz == 0 {
+		return -1
+	}
+	end := progs[last].Off + progs[last].Filesz
+	for i, p := range progs {
+		if i != last && p.Filesz > 0 && p.Off+p.Filesz > end {
+			return -1
+		}
+	}
+	for _, s := range sections {
+		if s.Type != elf.SHT_NOBITS && s.Type != elf.SHT_NULL && s.Size > 0 && s.Off+s.Size > end {
+			return -1
+		}
+	}
+	if h, err := img.header(); err != nil || (h.Shnum > 0 && h.Shoff < end) {
+		return -1
+	}
+	return last
+}
+
+// extendSegment appends content to the trailing segment progs[i], making it
+// flags as well, and returns the virtual address and file offset of content
+func (img *elfImage) extendSegment(progs []progHeader, i int, sections []sectionHeader, content []byte, flags elf.ProgFlag) (uint64, uint64, error) {
+	p := &progs[i]
+	off := alignUp(p.Off+p.Filesz, 16)
+	vaddr := p.Vaddr + (off - p.Off)
+	img.data = img.data[:min(uint64(len(img.data)), off)]
+	img.writeBytes(off, content)
+	p.Filesz = off - p.Off + uint64(len(content))
+	p.Memsz = p.Filesz
+	p.Flags |= flags
+	if err := img.setProgs(progs); err != nil {
+		return 0, 0, err
+	}
+	if len(sections) > 0 {
+		shoff := alignUp(off+uint64(len(content)), 8)
+		if err := img.writeSections(sections, shoff); err != nil {
+			return 0, 0, err
+		}
+	}
+	return vaddr, off, nil
+}
+
+// setDynamicString sets the string value of the dynamic entry tag. An entry
+// tagged replaces, if there is one, is changed into tag, as when DT_RPATH
+// becomes DT_RUNPATH. Values that fit in place of the old ones are written in
+// place; otherwise the dynamic string table is copied into a new segment and
+// extended, moving the dynamic section along if it has no room for a new entry
+func (img *elfImage) setDynamicString(tag elf.DynTag, replaces elf.DynTag, value string) error {
+	entries, dynIndex, err := img.dynamicEntries()
+	if err != nil {
+		return err
+	}
+	var strtab, strsz uint64
+	found, firstNull, nulls := -1, -1, 0
+	for i, e := range entries {
+		switch {
+		case e.Tag == elf.DT_STRTAB:
+			strtab = e.Val
+		case e.Tag == elf.DT_STRSZ:
+			strsz = e.Val
+		case e.Tag == tag || (replaces != elf.DT_NULL && e.Tag == replaces):
+			if found < 0 {
+				found = i
+			}
+		case e.Tag == elf.DT_NULL:
+			if firstNull < 0 {
+				firstNull = i
+			}
+			nulls++
+		}
+	}
+	if firstNull < 0 {
+		return errors.New(Tr(msgNoDynamic))
+	}
+	strOff, err := img.vaddrToOffset(strtab)
+	if err != nil {
+		return err
+	}
+	if strOff+strsz > uint64(len(img.data)) {
+		return errors.New(Tr(msgOutOfBounds, strOff))
+	}
+
+	progs, err := img.progs()
+	if err != nil {
+		return err
+	}
+	dynProg := progs[dynIndex]
+
+	if found >= 0 {
+		old := img.cString(strOff + entries[found].Val)
+		if len(value) <= len(old) {
+			padded := make([]byte, len(old))
+			copy(padded, value)
+			img.writeBytes(strOff+entries[found].Val, padded)
+			entries[found].Tag = tag
+			img.writeBytes(dynProg.Off, img.encodeDynamic(entries))
+			return nil
+		}
+	}
+
+	// Keep the old strings so that every existing offset stays valid
+	table := append(append(append([]byte{}, img.data[strOff:strOff+strsz]...), value...), 0)
+	entry := dynEntry{tag, strsz}
+	moveDynamic := false
+	switch {
+	case found >= 0:
+		entries[found] = entry
+	case nulls >= 2:
+		// Linkers sometimes leave spare DT_NULL entries; keep one as terminator
+		entries[firstNull] = entry
+		firstNull++
+	default:
+		if img.machine() == elf.EM_MIPS {
+			// DT_MIPS_RLD_MAP_REL is relative to the dynamic section itself
+			return errors.New(Tr(msgCannotMoveDynamic))
+		}
+		entries = append(entries[:firstNull], append([]dynEntry{entry}, entries[firstNull:]...)...)
+		moveDynamic = true
+	}
+
+	content := table
+	flags := elf.PF_R
+	var dynOff uint64
+	if moveDynamic {
+		dynOff = alignUp(uint64(len(content)), img.dynEntrySize())
+		// The dynamic linker writes DT_DEBUG, so the segment must be writable
+		content = append(append(content, make([]byte, dynOff-uint64(len(content)))...), img.encodeDynamic(entries)...)
+		flags |= elf.PF_W
+	}
+	vaddr, off, err := img.addLoadSegment(content, flags)
+	if err != nil {
+		return err
+	}
+
+	for i := range entries {
+		switch entries[i].Tag {
+		case elf.DT_STRTAB:
+			entries[i].Val = vaddr
+		case elf.DT_STRSZ:
+			entries[i].Val = uint64(len(table))
+		}
+	}
+	sections, err := img.sections()
+	if err != nil {
+		return err
+	}
+	for i, s := range sections {
+		if s.Type == elf.SHT_STRTAB && s.Addr == strtab && strtab != 0 {
+			sections[i].Off, sections[i].Addr, sections[i].Size = off, vaddr, uint64(len(table))
+		}
+	}
+
+	if moveDynamic {
+		progs, err := img.progs()
+		if err != nil {
+			return err
+		}
+		for i, p := range progs {
+			if p.Type == elf.PT_DYNAMIC {
+				size := uint64(len(content)) - dynOff
+				progs[i].Off, progs[i].Vaddr, progs[i].Paddr = off+dynOff, vaddr+dynOff, vaddr+dynOff
+				progs[i].Filesz, progs[i].Memsz = size, size
+			}
+		}
+		if err := img.setProgs(progs); err != nil {
+			return err
+		}
+		for i, s := range sections {
+			if s.Type == elf.SHT_DYNAMIC {
+				sections[i].Off, sections[i].Addr = off+dynOff, vaddr+dynOff
+				sections[i].Size = uint64(len(content)) - dynOff
+			}
+		}
+		img.writeBytes(off+dynOff, img.encodeDynamic(entries))
+	} else {
+		img.writeBytes(dynProg.Off, img.encodeDynamic(entries))
+	}
+	if len(sections) > 0 {
+		return img.setSections(sections)
+	}
+	return nil
+}
+
+// machine returns e_machine
+func (img *elfImage) machine() elf.Machine {
+	return elf.Machine(img.order.Uint16(img.data[18:20]))
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"debug/elf"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// dynamicFixture copies a dynamically linked executable of the system to
+// dir, skipping the test if there is none
+func dynamicFixture(t *testing.T, dir string) string {
+	t.Helper()
+	for _, path := range []string{"/bin/true", "/usr/bin/true"} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if interp, err := GetElfInterpreter(path); err != nil || interp == "" {
+			continue
+		}
+		out := filepath.Join(dir, "true")
+		if err := os.WriteFile(out, data, 0755); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	t.Skip("no dynamically linked executable found")
+	return ""
+}
+
+// loadSegments returns the number of PT_LOAD segments of an ELF file
+func loadSegments(t *testing.T, path string) int {
+	t.Helper()
+	f, err := elf.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	n := 0
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_LOAD {
+			n++
+		}
+	}
+	return n
+}
+
+func TestGrowEditsInARow(t *testing.T) {
+	path := dynamicFixture(t, t.TempDir())
+	interp, err := GetElfInterpreter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loads := loadSegments(t, path)
+
+	// Each value is longer than anything the file has room for, and the
+	// interpreter still names the same file
+	runpaths := []string{"/opt/" + strings.Repeat("a", 200) + "/lib", "/opt/" + strings.Repeat("b", 400) + "/lib"}
+	longInterp := "/" + strings.Repeat("./", 100) + strings.TrimPrefix(interp, "/")
+	if err := SetRunPath(path, runpaths[0], false, ""); err != nil {
+		t.Fatalf("first set-rpath: %v", err)
+	}
+	if err := SetElfInterpreter(path, longInterp, ""); err != nil {
+		t.Fatalf("set-interpreter after set-rpath: %v", err)
+	}
+	if err := SetRunPath(path, runpaths[1], false, ""); err != nil {
+		t.Fatalf("second set-rpath: %v", err)
+	}
+
+	if n := loadSegments(t, path); n != loads+1 {
+		t.Errorf("%d PT_LOAD segments after the edits, want %d", n, loads+1)
+	}
+	if got, err := GetElfInterpreter(path); err != nil || got != longInterp {
+		t.Errorf("interpreter %q, %v; want %q", got, err, longInterp)
+	}
+	f, err := elf.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if got, err := f.DynString(elf.DT_RUNPATH); err != nil || len(got) != 1 || got[0] != runpaths[1] {
+		t.Errorf("DT_RUNPATH %q, %v; want %q", got, err, runpaths[1])
+	}
+	if findings, err := LintElf(path); err != nil || len(findings) > 0 {
+		t.Errorf("lint: %v, %v", findings, err)
+	}
+	if out, err := exec.Command(path).CombinedOutput(); err != nil {
+		t.Errorf("edited executable does not run: %v\n%s", err, out)
+	}
+}
+
+// segmentNotes returns the name and type of the notes of an ELF file that
+// are in PT_NOTE segments, which is where the kernel and the dynamic linker
+// read them
+func segmentNotes(t *testing.T, path string) map[string]bool {
+	t.Helper()
+	f, err := elf.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	notes := map[string]bool{}
+	for _, p := range f.Progs {
+		if p.Type != elf.PT_NOTE {
+			continue
+		}
+		data, err := io.ReadAll(p.Open())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, note := range parseNotes(data, f.ByteOrder, p.Align) {
+			notes[fmt.Sprintf("%s/%d", note.Name, note.Type)] = true
+		}
+	}
+	return notes
+}
+
+func TestEditKeepsNoteSegments(t *testing.T) {
+	path := dynamicFixture(t, t.TempDir())
+	before := segmentNotes(t, path)
+	// NT_GNU_ABI_TAG and NT_GNU_BUILD_ID
+	for _, note := range []string{"GNU/1", "GNU/3"} {
+		if !before[note] {
+			t.Skipf("%s has no %s note in a PT_NOTE segment", path, note)
+		}
+	}
+
+	if err := SetRunPath(path, "/opt/"+strings.Repeat("a", 200)+"/lib", false, ""); err != nil {
+		t.Fatalf("set-rpath: %v", err)
+	}
+	after := segmentNotes(t, path)
+	for note := range before {
+		if !after[note] {
+			t.Errorf("note %s is no longer in a PT_NOTE segment", note)
+		}
+	}
+	if out, err := exec.Command(path).CombinedOutput(); err != nil {
+		t.Errorf("edited executable does not run: %v\n%s", err, out)
+	}
+}
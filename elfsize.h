@@ -0,0 +1,38 @@
+/* C API of libelfsize, see capi.go for how to build it. Paths are NUL
+ * terminated; everything returned is allocated with malloc and released
+ * with elfsize_free. */
+
+#ifndef ELFSIZE_H
+#define ELFSIZE_H
+
+#include <stddef.h>
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+/* Returns the size of an ELF image as the end of its section header table,
+ * or -1 if the file cannot be read or is not an ELF file. */
+long long elfsize_calculate(char *path);
+
+/* Returns the architecture of an ELF file, such as "x86_64", or NULL. */
+char *elfsize_arch(char *path);
+
+/* Returns the summary of an ELF file as printed by "elfsize info --json",
+ * as a JSON object, or NULL if the file cannot be read or is not an ELF
+ * file. */
+char *elfsize_stat(char *path);
+
+/* Stores the decompressed contents of a section, given by name or glob
+ * pattern, in *data and their length in *length. Returns 0, or -1 if the
+ * file or section cannot be read. */
+int elfsize_section_data(char *path, char *name, unsigned char **data, size_t *length);
+
+/* Releases memory returned by the functions above. */
+void elfsize_free(void *p);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"debug/elf"
+	"strings"
+)
+
+// Values returned by GetElfType
+const (
+	TypeExecutable  = "exec"   // ET_EXEC, a position-dependent executable
+	TypePIE         = "pie"    // ET_DYN marked as a position-independent executable
+	TypeShared      = "shared" // ET_DYN that is a shared library
+	TypeRelocatable = "rel"    // ET_REL, an object file or kernel module
+	TypeCore        = "core"   // ET_CORE, a core dump
+)
+
+// elfType classifies an ELF file as one of the Type* values
+func elfType(f *elf.File) string {
+	switch f.Type {
+	case elf.ET_EXEC:
+		return TypeExecutable
+	case elf.ET_REL:
+		return TypeRelocatable
+	case elf.ET_CORE:
+		return TypeCore
+	case elf.ET_DYN:
+		// PIE executables and shared libraries are both ET_DYN. Current linkers
+		// mark the former with DF_1_PIE. Failing that, a SONAME says library
+		// (even for the few that are also runnable, like libc.so.6) and
+		// requesting an interpreter says executable
+		flags, err := f.DynValue(elf.DT_FLAGS_1)
+		if err == nil && len(flags) > 0 && elf.DynFlag1(flags[0])&elf.DF_1_PIE != 0 {
+			return TypePIE
+		}
+		if soname, err := f.DynString(elf.DT_SONAME); err == nil && len(soname) > 0 {
+			return TypeShared
+		}
+		for _, prog := range f.Progs {
+			if prog.Type == elf.PT_INTERP {
+				return TypePIE
+			}
+		}
+		return TypeShared
+	}
+	return strings.ToLower(strings.TrimPrefix(f.Type.String(), "ET_"))
+}
+
+// GetElfType returns what kind of ELF file a file is, one of TypeExecutable,
+// TypePIE, TypeShared, TypeRelocatable or TypeCore, and err
+func GetElfType(filepath string) (string, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return "", err
+	}
+	return elfType(f), nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// upxMagic is found in the headers UPX writes into the files it packs
+var upxMagic = []byte("UPX!")
+
+// packedEntropy is the entropy in bits per byte above which the contents of
+// a file look compressed or encrypted
+const packedEntropy = 7.2
+
+// RegionEntropy is the entropy of a section, or of a segment if the file has
+// no section headers
+type RegionEntropy struct {
+	Name    string  `json:"name"`
+	Size    uint64  `json:"size"`
+	Entropy float64 `json:"entropy"` // bits per byte, 0 to 8
+}
+
+// PackingReport tells whether an ELF file looks packed, which makes its
+// apparent size meaningless
+type PackingReport struct {
+	Regions      []RegionEntropy `json:"regions"`
+	Entropy      float64         `json:"entropy"` // of the whole ELF image
+	UPX          bool            `json:"upx"`
+	LikelyPacked bool            `json:"likely_packed"`
+	Reasons      []Problem       `json:"-"`
+}
+
+// shannonEntropy returns the entropy of data in bits per byte
+func shannonEntropy(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+	var h float64
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / float64(len(data))
+			h -= p * math.Log2(p)
+		}
+	}
+	return h
+}
+
+// AnalyzePacking computes the entropy of the sections of an ELF file and
+// looks for signs of a packer
+func AnalyzePacking(filepath string) (*PackingReport, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &PackingReport{Regions: []RegionEntropy{}}
+	for _, s := range f.Sections {
+		if s.Type == elf.SHT_NULL || s.Type == elf.SHT_NOBITS || s.Size == 0 {
+			continue
+		}
+		data, err := io.ReadAll(s.Open())
+		if err != nil {
+			return nil, err
+		}
+		report.Regions = append(report.Regions, RegionEntropy{s.Name, s.Size, shannonEntropy(data)})
+	}
+	if len(f.Sections) == 0 {
+		for i, p := range f.Progs {
+			if p.Type != elf.PT_LOAD || p.Filesz == 0 {
+				continue
+			}
+			data, err := io.ReadAll(p.Open())
+			if err != nil {
+				return nil, err
+			}
+			report.Regions = append(report.Regions, RegionEntropy{fmt.Sprintf("LOAD[%d]", i), p.Filesz, shannonEntropy(data)})
+		}
+	}
+
+	// Packers tend to drop the section header table, so the classic size
+	// would miss most of the image
+	size, err := maxEnd(f, r)
+	if err != nil {
+		return nil, err
+	}
+	image, err := io.ReadAll(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+	report.Entropy = shannonEntropy(image)
+	report.UPX = bytes.Contains(image[:min(len(image), packerHeaderSize)], upxMagic)
+	report.Reasons = packingIndicators(f, report.UPX)
+	if report.Entropy > packedEntropy {
+		report.Reasons = append(report.Reasons, newProblem(msgPackedEntropy, report.Entropy))
+	}
+	report.LikelyPacked = len(report.Reasons) > 0
+	return report, nil
+}
+
+// packerHeaderSize is how far into a file packers put their signatures
+const packerHeaderSize = 4096
+
+// looksPacked is the quick check behind ElfInfo.Packed, which avoids reading
+// the whole file for the entropy
+func looksPacked(f *elf.File, r io.ReaderAt) bool {
+	head := make([]byte, packerHeaderSize)
+	n, _ := r.ReadAt(head, 0)
+	return len(packingIndicators(f, bytes.Contains(head[:n], upxMagic))) > 0
+}
+
+// packingIndicators returns the reasons other than entropy to believe that
+// f is packed
+func packingIndicators(f *elf.File, upx bool) []Problem {
+	var reasons []Problem
+	if upx {
+		reasons = append(reasons, newProblem(msgPackedUPX))
+	}
+	loads := 0
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_LOAD {
+			loads++
+		}
+	}
+	// Linkers emit dozens of sections; packers drop them and map the
+	// compressed program with one or two segments
+	if (f.Type == elf.ET_EXEC || f.Type == elf.ET_DYN) && len(f.Sections) <= 3 && loads <= 2 {
+		reasons = append(reasons, newProblem(msgPackedLayout, len(f.Sections), loads))
+	}
+	return reasons
+}
+
+// entropyCommand implements "elfsize entropy <file>"
+func entropyCommand(args []string) int {
+	fs := flag.NewFlagSet("entropy", flag.ContinueOnError)
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s entropy <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the entropy of every section and whether the file looks packed, e.g. by UPX\n")
+		fmt.Fprintf(os.Stderr, "    Exits with 1 if the file is likely packed\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	report, err := AnalyzePacking(positional[0])
+	if err != nil {
+		PrintError("entropy", err)
+		return 1
+	}
+	for _, region := range report.Regions {
+		fmt.Printf("%.3f\t%d\t%s\n", region.Entropy, region.Size, region.Name)
+	}
+	fmt.Printf("%.3f\t%s\n", report.Entropy, positional[0])
+	for _, reason := range report.Reasons {
+		logger.Warn(fmt.Sprintf("%s: %s [%s]", positional[0], reason.Message, reason.ID), "id", reason.ID)
+	}
+	if report.LikelyPacked {
+		return 1
+	}
+	return 0
+}
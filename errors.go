@@ -0,0 +1,86 @@
+package main
+
+import (
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Errors the library functions return, wrapped in a FileError, so that
+// callers can tell them apart with errors.Is. See also ErrSectionNotFound
+var (
+	// ErrNotELF is returned for files that do not start with the ELF magic
+	ErrNotELF = errors.New(Tr(msgNotAnELF))
+	// ErrTruncated is returned for files that end before their headers do,
+	// or before the ELF image they describe
+	ErrTruncated = errors.New(Tr(msgFileTruncated))
+	// ErrUnsupportedClass is returned for ELF files that are neither 32 nor
+	// 64 bit, or of an unknown byte order
+	ErrUnsupportedClass = errors.New(Tr(msgUnsupportedClass))
+)
+
+// FileError records an error and the file it was about, like os.PathError
+// does for system calls
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// kindError makes an error match one of the sentinels above with
+// errors.Is, without changing its message
+type kindError struct {
+	kind, err error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// withKind returns err, matching kind as well
+func withKind(kind, err error) error {
+	return &kindError{kind, err}
+}
+
+// parseElf is elf.NewFile for the file at path, with the error wrapped in a
+// FileError and classified as ErrNotELF, ErrTruncated or
+// ErrUnsupportedClass where it is one of them
+func parseElf(path string, r io.ReaderAt) (*elf.File, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return nil, &FileError{path, classifyElfError(err)}
+	}
+	return f, nil
+}
+
+// classifyElfError wraps an error of debug/elf with the sentinel it stands
+// for, if any. debug/elf has no such sentinels itself, so its messages
+// are matched
+func classifyElfError(err error) error {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "bad magic number"):
+		return withKind(ErrNotELF, err)
+	case strings.Contains(msg, "unknown ELF class"), strings.Contains(msg, "unknown ELF data encoding"):
+		return withKind(ErrUnsupportedClass, err)
+	case strings.Contains(msg, "cannot read ELF identifier"):
+		return withKind(ErrTruncated, err)
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		// A bare EOF says too little on its own
+		return fmt.Errorf("%w: %w", ErrTruncated, err)
+	}
+	return err
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Filter is a condition on the ElfInfo of a file, such as
+//
+//	overlay > 1M && arch == "x86_64"
+//
+// Fields are named as in the JSON output and compared with ==, !=, <, <=,
+// > and >=; strings can also be matched against a regular expression with
+// =~. Numbers may have a K, M or G suffix. Conditions are combined with &&,
+// || and !, and grouped with parentheses; a boolean field is a condition
+// of its own
+type Filter struct {
+	expr  string
+	match func(*ElfInfo) bool
+}
+
+// Match reports whether info satisfies the filter
+func (f *Filter) Match(info *ElfInfo) bool {
+	return f.match(info)
+}
+
+// String returns the expression of the filter
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// ParseFilter parses a filter expression
+func ParseFilter(expr string) (*Filter, error) {
+	tokens, err := filterTokens(expr)
+	if err != nil {
+		return nil, errors.New(Tr(msgBadFilter, expr, err))
+	}
+	p := &filterParser{tokens: tokens}
+	match, err := p.or()
+	if err == nil && p.pos < len(p.tokens) {
+		err = p.unexpected()
+	}
+	if err != nil {
+		return nil, errors.New(Tr(msgBadFilter, expr, err))
+	}
+	return &Filter{expr, match}, nil
+}
+
+// filterToken is a token of a filter expression. kind is "field",
+// "number", "string" or the operator itself
+type filterToken struct {
+	kind, text string
+	pos        int
+	num        int64
+}
+
+// filterOperators are the operators of filter expressions, longest first
+var filterOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "<", ">", "!", "(", ")"}
+
+// filterTokens splits a filter expression into tokens
+func filterTokens(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	for pos := 0; pos < len(expr); {
+		c := expr[pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			pos++
+		case c == '"':
+			end := pos + 1
+			for end < len(expr) && expr[end] != '"' {
+				if expr[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			s, err := strconv.Unquote(expr[pos:min(end+1, len(expr))])
+			if err != nil {
+				return nil, errors.New(Tr(msgFilterString, pos+1))
+			}
+			tokens = append(tokens, filterToken{kind: "string", text: s, pos: pos})
+			pos = end + 1
+		case c >= '0' && c <= '9':
+			end := pos
+			for end < len(expr) && strings.IndexByte("0123456789abcdefxABCDEFX", expr[end]) >= 0 {
+				end++
+			}
+			text, scale := expr[pos:end], int64(1)
+			if end < len(expr) {
+				if i := strings.IndexByte("KMG", expr[end]); i >= 0 {
+					scale = 1 << (10 * (i + 1))
+					end++
+				}
+			}
+			n, err := strconv.ParseInt(text, 0, 64)
+			if err != nil {
+				return nil, errors.New(Tr(msgFilterNumber, expr[pos:end], pos+1))
+			}
+			tokens = append(tokens, filterToken{kind: "number", text: expr[pos:end], pos: pos, num: n * scale})
+			pos = end
+		case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			end := pos
+			for end < len(expr) && (expr[end] == '_' || (expr[end] >= 'a' && expr[end] <= 'z') || (expr[end] >= 'A' && expr[end] <= 'Z') || (expr[end] >= '0' && expr[end] <= '9')) {
+				end++
+			}
+			tokens = append(tokens, filterToken{kind: "field", text: expr[pos:end], pos: pos})
+			pos = end
+		default:
+			op := ""
+			for _, o := range filterOperators {
+				if strings.HasPrefix(expr[pos:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, errors.New(Tr(msgFilterUnexpected, string(c), pos+1))
+			}
+			tokens = append(tokens, filterToken{kind: op, text: op, pos: pos})
+			pos += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+// filterOperand is a field or constant in a filter expression, which gets
+// a value of kind reflect.Int64, reflect.String or reflect.Bool
+type filterOperand struct {
+	kind     reflect.Kind
+	get      func(*ElfInfo) reflect.Value
+	text     string
+	constant bool
+}
+
+// filterParser parses filter expressions by recursive descent
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+// peek returns the kind of the next token, or "" at the end
+func (p *filterParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos].kind
+	}
+	return ""
+}
+
+func (p *filterParser) unexpected() error {
+	if p.pos >= len(p.tokens) {
+		return errors.New(Tr(msgFilterEnd))
+	}
+	t := p.tokens[p.pos]
+	return errors.New(Tr(msgFilterUnexpected, t.text, t.pos+1))
+}
+
+// or parses conditions joined by ||
+func (p *filterParser) or() (func(*ElfInfo) bool, error) {
+	left, err := p.and()
+	for err == nil && p.peek() == "||" {
+		p.pos++
+		var right func(*ElfInfo) bool
+		if right, err = p.and(); err == nil {
+			l := left
+			left = func(info *ElfInfo) bool { return l(info) || right(info) }
+		}
+	}
+	return left, err
+}
+
+// and parses conditions joined by &&
+func (p *filterParser) and() (func(*ElfInfo) bool, error) {
+	left, err := p.not()
+	for err == nil && p.peek() == "&&" {
+		p.pos++
+		var right func(*ElfInfo) bool
+		if right, err = p.not(); err == nil {
+			l := left
+			left = func(info *ElfInfo) bool { return l(info) && right(info) }
+		}
+	}
+	return left, err
+}
+
+// not parses a negated, grouped or single condition
+func (p *filterParser) not() (func(*ElfInfo) bool, error) {
+	switch p.peek() {
+	case "!":
+		p.pos++
+		cond, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return func(info *ElfInfo) bool { return !cond(info) }, nil
+	case "(":
+		p.pos++
+		cond, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, p.unexpected()
+		}
+		p.pos++
+		return cond, nil
+	}
+	return p.comparison()
+}
+
+// comparison parses a comparison, or a boolean operand on its own
+func (p *filterParser) comparison() (func(*ElfInfo) bool, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	op := p.peek()
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=", "=~":
+		p.pos++
+	default:
+		if left.kind != reflect.Bool {
+			return nil, p.unexpected()
+		}
+		return func(info *ElfInfo) bool { return left.get(info).Bool() }, nil
+	}
+	right, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	if left.kind != right.kind {
+		return nil, errors.New(Tr(msgFilterTypes, left.text, right.text))
+	}
+
+	if op == "=~" {
+		if left.kind != reflect.String || !right.constant {
+			return nil, errors.New(Tr(msgFilterOperator, op, left.text))
+		}
+		re, err := regexp.Compile(right.get(nil).String())
+		if err != nil {
+			return nil, err
+		}
+		return func(info *ElfInfo) bool { return re.MatchString(left.get(info).String()) }, nil
+	}
+	var compare func(info *ElfInfo) int
+	switch left.kind {
+	case reflect.Int64:
+		compare = func(info *ElfInfo) int { return cmp.Compare(left.get(info).Int(), right.get(info).Int()) }
+	case reflect.String:
+		compare = func(info *ElfInfo) int { return strings.Compare(left.get(info).String(), right.get(info).String()) }
+	default:
+		if op != "==" && op != "!=" {
+			return nil, errors.New(Tr(msgFilterOperator, op, left.text))
+		}
+		compare = func(info *ElfInfo) int {
+			if left.get(info).Bool() == right.get(info).Bool() {
+				return 0
+			}
+			return 1
+		}
+	}
+	switch op {
+	case "==":
+		return func(info *ElfInfo) bool { return compare(info) == 0 }, nil
+	case "!=":
+		return func(info *ElfInfo) bool { return compare(info) != 0 }, nil
+	case "<":
+		return func(info *ElfInfo) bool { return compare(info) < 0 }, nil
+	case "<=":
+		return func(info *ElfInfo) bool { return compare(info) <= 0 }, nil
+	case ">":
+		return func(info *ElfInfo) bool { return compare(info) > 0 }, nil
+	}
+	return func(info *ElfInfo) bool { return compare(info) >= 0 }, nil
+}
+
+// operand parses a field name or a constant
+func (p *filterParser) operand() (filterOperand, error) {
+	if p.pos >= len(p.tokens) {
+		return filterOperand{}, p.unexpected()
+	}
+	t := p.tokens[p.pos]
+	switch t.kind {
+	case "number":
+		p.pos++
+		v := reflect.ValueOf(t.num)
+		return filterOperand{reflect.Int64, func(*ElfInfo) reflect.Value { return v }, t.text, true}, nil
+	case "string":
+		p.pos++
+		v := reflect.ValueOf(t.text)
+		return filterOperand{reflect.String, func(*ElfInfo) reflect.Value { return v }, strconv.Quote(t.text), true}, nil
+	case "field":
+		p.pos++
+		if t.text == "true" || t.text == "false" {
+			v := reflect.ValueOf(t.text == "true")
+			return filterOperand{reflect.Bool, func(*ElfInfo) reflect.Value { return v }, t.text, true}, nil
+		}
+		index, ok := filterFields()[t.text]
+		if !ok {
+			names := make([]string, 0, len(filterFields()))
+			for name := range filterFields() {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return filterOperand{}, errors.New(Tr(msgFilterField, t.text, strings.Join(names, ", ")))
+		}
+		field := reflect.TypeOf(ElfInfo{}).Field(index)
+		kind := field.Type.Kind()
+		get := func(info *ElfInfo) reflect.Value { return reflect.ValueOf(info).Elem().Field(index) }
+		if kind == reflect.Int {
+			// Widen ints so that they compare with number constants
+			kind, get = reflect.Int64, func(info *ElfInfo) reflect.Value {
+				return reflect.ValueOf(reflect.ValueOf(info).Elem().Field(index).Int())
+			}
+		}
+		return filterOperand{kind, get, t.text, false}, nil
+	}
+	return filterOperand{}, p.unexpected()
+}
+
+// filterFields maps the JSON names of the fields of ElfInfo to their index
+func filterFields() map[string]int {
+	fields := map[string]int{}
+	t := reflect.TypeOf(ElfInfo{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		switch t.Field(i).Type.Kind() {
+		case reflect.Int, reflect.Int64, reflect.String, reflect.Bool:
+			fields[name] = i
+		}
+	}
+	return fields
+}
+
+// filterFlag is a flag.Value that parses a Filter
+type filterFlag struct {
+	filter **Filter
+}
+
+func (f filterFlag) String() string {
+	if f.filter == nil || *f.filter == nil {
+		return ""
+	}
+	return (*f.filter).String()
+}
+
+func (f filterFlag) Set(expr string) error {
+	filter, err := ParseFilter(expr)
+	if err != nil {
+		return err
+	}
+	*f.filter = filter
+	return nil
+}
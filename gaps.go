@@ -0,0 +1,189 @@
+package main
+
+import (
+	"debug/elf"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Gap is a byte range inside an ELF image that neither a header table nor
+// a section covers
+type Gap struct {
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	Zero   bool   `json:"zero"`   // all bytes are zero, i.e. padding
+	Loaded bool   `json:"loaded"` // part of a PT_LOAD segment, so mapped into memory
+	After  string `json:"after"`  // what ends where the gap starts
+}
+
+// elfExtent is a range of the file covered by a part of the ELF image
+type elfExtent struct {
+	start, end uint64
+	name       string
+}
+
+// GetGaps returns the ranges of the ELF image of a file that are covered by
+// neither the ELF header, the program and section header tables nor any
+// section, or segment if the file has no sections. Most are alignment
+// padding; gaps that are not zero may hide data
+func GetGaps(filepath string) ([]Gap, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	size, err := readHeaderEnd(r)
+	if err != nil {
+		return nil, err
+	}
+	// The image is read whole, so the header must not make it larger than
+	// the file or what may be read of it
+	stat, err := r.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if size > stat.Size() {
+		return nil, withKind(ErrTruncated, errors.New(Tr(msgTruncated, filepath, size, stat.Size())))
+	}
+	if MaxBytesRead > 0 && size > MaxBytesRead {
+		return nil, &FileError{filepath, limitExceeded(msgTooMuchRead, MaxBytesRead)}
+	}
+	data := make([]byte, size)
+	if _, err := r.ReadAt(data, 0); err != nil {
+		return nil, err
+	}
+	img, err := newElfImage(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	h, err := img.header()
+	if err != nil {
+		return nil, err
+	}
+	extents := []elfExtent{{0, uint64(img.headerSize()), "ELF header"}}
+	if h.Phnum > 0 {
+		extents = append(extents, elfExtent{h.Phoff, h.Phoff + uint64(h.Phnum)*uint64(h.Phentsize), "program headers"})
+	}
+	progs, err := img.progs()
+	if err != nil {
+		return nil, err
+	}
+	if h.Shoff == 0 || h.Shnum == 0 {
+		for i, p := range progs {
+			if p.Filesz > 0 {
+				extents = append(extents, elfExtent{p.Off, p.Off + p.Filesz, fmt.Sprintf("segment %d (%s)", i, p.Type)})
+			}
+		}
+	} else {
+		extents = append(extents, elfExtent{h.Shoff, h.Shoff + uint64(h.Shnum)*uint64(h.Shentsize), "section headers"})
+		sections, err := img.sections()
+		if err != nil {
+			return nil, err
+		}
+		names := img.sectionNames(sections, h.Shstrndx)
+		for i, s := range sections {
+			if s.Type != elf.SHT_NULL && s.Type != elf.SHT_NOBITS && s.Size > 0 {
+				extents = append(extents, elfExtent{s.Off, s.Off + s.Size, names[i]})
+			}
+		}
+	}
+
+	// Of extents starting at the same offset, the longest names the gap
+	// after them
+	sort.SliceStable(extents, func(i, j int) bool {
+		if extents[i].start != extents[j].start {
+			return extents[i].start < extents[j].start
+		}
+		return extents[i].end > extents[j].end
+	})
+	gaps := []Gap{}
+	var covered uint64
+	var last string
+	extents = append(extents, elfExtent{uint64(size), uint64(size), ""})
+	for _, e := range extents {
+		if start := min(e.start, uint64(size)); start > covered {
+			loaded := false
+			for _, p := range progs {
+				loaded = loaded || (p.Type == elf.PT_LOAD && p.Off < start && p.Off+p.Filesz > covered)
+			}
+			gaps = append(gaps, Gap{int64(covered), int64(start - covered), allZero(data[covered:start]), loaded, last})
+		}
+		if e.end > covered {
+			covered, last = e.end, e.name
+		}
+	}
+	return gaps, nil
+}
+
+// allZero reports whether data consists of zero bytes only
+func allZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// gapsCommand implements "elfsize gaps [--json] <file>"
+func gapsCommand(args []string) int {
+	fs := flag.NewFlagSet("gaps", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the gaps as JSON")
+	minSize := fs.Int64("min", 1, "leave out gaps smaller than this many bytes")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s gaps [--json] [--min bytes] <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the byte ranges of the ELF image that no header table or\n")
+		fmt.Fprintf(os.Stderr, "    section covers (segments in files without sections): offset, size,\n")
+		fmt.Fprintf(os.Stderr, "    zero or data, \"loaded\" if mapped into memory, and what precedes\n")
+		fmt.Fprintf(os.Stderr, "    them, then the total on stderr. Gaps with data may hide something\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	gaps, err := GetGaps(positional[0])
+	if err != nil {
+		PrintError("gaps", err)
+		return 1
+	}
+	shown := []Gap{}
+	var total, data int64
+	for _, g := range gaps {
+		if g.Size < *minSize {
+			continue
+		}
+		shown = append(shown, g)
+		total += g.Size
+		if !g.Zero {
+			data += g.Size
+		}
+	}
+	if *asJSON {
+		out, _ := json.MarshalIndent(shown, "", "  ")
+		fmt.Println(string(out))
+		return 0
+	}
+	for _, g := range shown {
+		kind := "zero"
+		if !g.Zero {
+			kind = "data"
+		}
+		if g.Loaded {
+			kind += ",loaded"
+		}
+		fmt.Printf("%#x\t%d\t%s\t%s\n", g.Offset, g.Size, kind, g.After)
+	}
+	fmt.Fprintln(os.Stderr, Tr(msgGapsTotal, len(shown), total, data))
+	return 0
+}
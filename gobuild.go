@@ -0,0 +1,79 @@
+package main
+
+import (
+	"debug/buildinfo"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"runtime/debug"
+)
+
+// GetGoBuildInfo returns the build information the Go toolchain embeds in
+// its binaries: Go version, main module and dependencies, and build settings
+// such as the VCS revision
+func GetGoBuildInfo(filepath string) (*debug.BuildInfo, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	info, err := buildinfo.Read(r)
+	if err != nil {
+		return nil, errors.New(Tr(msgNotGoBinary, filepath))
+	}
+	return info, nil
+}
+
+// goBuildSetting returns the value of a build setting, or ""
+func goBuildSetting(info *debug.BuildInfo, key string) string {
+	for _, s := range info.Settings {
+		if s.Key == key {
+			return s.Value
+		}
+	}
+	return ""
+}
+
+// goBuildInfoCommand implements "elfsize go-buildinfo <file>"
+func goBuildInfoCommand(args []string) int {
+	fs := flag.NewFlagSet("go-buildinfo", flag.ContinueOnError)
+	showDeps := fs.Bool("deps", false, "also print the module dependencies")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s go-buildinfo [--deps] <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the Go version, module path and VCS revision of a Go binary\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	info, err := GetGoBuildInfo(positional[0])
+	if err != nil {
+		PrintError("go-buildinfo", err)
+		return 1
+	}
+	fmt.Printf("go:       %s\n", info.GoVersion)
+	fmt.Printf("path:     %s\n", info.Path)
+	fmt.Printf("module:   %s %s\n", info.Main.Path, info.Main.Version)
+	fmt.Printf("revision: %s\n", goBuildSetting(info, "vcs.revision"))
+	if modified := goBuildSetting(info, "vcs.modified"); modified != "" {
+		fmt.Printf("modified: %s\n", modified)
+	}
+	if *showDeps {
+		for _, dep := range info.Deps {
+			if dep.Replace != nil {
+				fmt.Printf("dep:      %s %s => %s %s\n", dep.Path, dep.Version, dep.Replace.Path, dep.Replace.Version)
+			} else {
+				fmt.Printf("dep:      %s %s\n", dep.Path, dep.Version)
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"debug/elf"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// HashAlgorithms are the digests accepted by the hash subcommand
+var HashAlgorithms = map[string]func() hash.Hash{
+	"blake3": newBlake3,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// newHash looks up a digest by name
+func newHash(algorithm string) (hash.Hash, error) {
+	if fn, ok := HashAlgorithms[algorithm]; ok {
+		return fn(), nil
+	}
+	names := make([]string, 0, len(HashAlgorithms))
+	for name := range HashAlgorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return nil, errors.New(Tr(msgUnknownHash, algorithm, strings.Join(names, ", ")))
+}
+
+// GetElfHash returns the digest of the ELF image of a file, bytes 0 to its
+// size, ignoring any appended data. Identical runtimes of different
+// AppImages have the same hash
+func GetElfHash(filepath, algorithm string) ([]byte, error) {
+	return GetElfHashContext(context.Background(), filepath, algorithm)
+}
+
+// GetElfHashContext is GetElfHash, stopping with ctx.Err() when ctx is done
+func GetElfHashContext(ctx context.Context, filepath, algorithm string) ([]byte, error) {
+	sum, _, err := getHashes(ctx, filepath, algorithm, false)
+	return sum, err
+}
+
+// GetOverlayHash returns the digest of the data appended to the ELF image
+// of a file, such as the payload of an AppImage
+func GetOverlayHash(filepath, algorithm string) ([]byte, error) {
+	return GetOverlayHashContext(context.Background(), filepath, algorithm)
+}
+
+// GetOverlayHashContext is GetOverlayHash, stopping with ctx.Err() when ctx
+// is done
+func GetOverlayHashContext(ctx context.Context, filepath, algorithm string) ([]byte, error) {
+	_, sum, err := getHashes(ctx, filepath, algorithm, true)
+	return sum, err
+}
+
+// getHashes returns the digest of the ELF image of a file and, if overlay
+// is set, of the data after it
+func getHashes(ctx context.Context, filepath, algorithm string, overlay bool) ([]byte, []byte, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	size, err := headerEnd(f, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	stat, err := r.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	regions := [][2]int64{{0, min(size, stat.Size())}}
+	if overlay {
+		regions = append(regions, [2]int64{min(size, stat.Size()), max(stat.Size()-size, 0)})
+	}
+	var total int64
+	for _, region := range regions {
+		total += region[1]
+	}
+	p := startProgress(ctx, total)
+	var sums [2][]byte
+	for i, region := range regions {
+		h, err := newHash(algorithm)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := copyContext(ctx, h, io.NewSectionReader(r, region[0], region[1]), region[1], p); err != nil {
+			return nil, nil, err
+		}
+		sums[i] = h.Sum(nil)
+	}
+	return sums[0], sums[1], nil
+}
+
+// SectionHash is the digest of the contents of a section
+type SectionHash struct {
+	Name   string `json:"name"`
+	Size   uint64 `json:"size"`
+	Digest string `json:"digest"` // hex encoded, empty for SHT_NOBITS sections
+}
+
+// GetSectionHashes returns the digest of every section of a file, in section
+// header order, so that two builds can be compared section by section. The
+// contents are hashed as stored, without decompressing them
+func GetSectionHashes(filepath, algorithm string) ([]SectionHash, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return nil, err
+	}
+	hashes := []SectionHash{}
+	for _, s := range f.Sections {
+		if s.Type == elf.SHT_NULL {
+			continue
+		}
+		digest, err := sectionDigest(r, s, algorithm)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, SectionHash{s.Name, s.Size, digest})
+	}
+	return hashes, nil
+}
+
+// sectionDigest returns the hex encoded digest of the stored contents of s,
+// or "" for SHT_NOBITS sections
+func sectionDigest(r io.ReaderAt, s *elf.Section, algorithm string) (string, error) {
+	h, err := newHash(algorithm)
+	if err != nil || s.Type == elf.SHT_NOBITS {
+		return "", err
+	}
+	if _, err := io.Copy(h, io.NewSectionReader(r, int64(s.Offset), int64(s.FileSize))); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashCommand implements "elfsize hash [-a algorithm] [--overlay] <file>..."
+func hashCommand(args []string) int {
+	fs := flag.NewFlagSet("hash", flag.ContinueOnError)
+	algorithm := fs.String("a", "sha256", "digest to use: blake3, sha1, sha256 or sha512")
+	overlay := fs.Bool("overlay", false, "also print the digest of the appended data, between the ELF digest and the path")
+	showProgress := fs.Bool("progress", false, "draw a progress bar on stderr")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s hash [-a algorithm] [--overlay] [--progress] <file>...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the digest of the ELF image of files, without appended data\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) == 0 {
+		fs.Usage()
+		return 2
+	}
+	if _, err := newHash(*algorithm); err != nil {
+		PrintError("hash", err)
+		return 2
+	}
+
+	status := 0
+	for _, path := range positional {
+		ctx, bar := progressContext(*showProgress, path)
+		sum, overlaySum, err := getHashes(ctx, path, *algorithm, *overlay)
+		bar.finish()
+		if err != nil {
+			PrintError("hash", fmt.Errorf("%s: %w", path, err))
+			status = 1
+			continue
+		}
+		if *overlay {
+			fmt.Printf("%s %s  %s\n", hex.EncodeToString(sum), hex.EncodeToString(overlaySum), path)
+		} else {
+			fmt.Printf("%s  %s\n", hex.EncodeToString(sum), path)
+		}
+	}
+	return status
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// hexDump writes the bytes read from r in the canonical format of
+// hexdump -C: 16 bytes per line in hexadecimal and as ASCII, after their
+// offset counted from base. Runs of identical lines are shown as "*" if
+// squeeze is set
+func hexDump(w io.Writer, r io.Reader, base int64, squeeze bool) error {
+	bw := bufio.NewWriter(w)
+	br := bufio.NewReader(r)
+	line := make([]byte, 16)
+	var previous []byte
+	skipping := false
+	off := base
+	for {
+		n, err := io.ReadFull(br, line)
+		if n == 0 {
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				return err
+			}
+			break
+		}
+		if squeeze && n == len(line) && bytes.Equal(line, previous) {
+			if !skipping {
+				fmt.Fprintln(bw, "*")
+				skipping = true
+			}
+			off += int64(n)
+			continue
+		}
+		skipping = false
+		previous = append(previous[:0], line[:n]...)
+
+		fmt.Fprintf(bw, "%08x ", off)
+		for i := 0; i < len(line); i++ {
+			if i%8 == 0 {
+				bw.WriteByte(' ')
+			}
+			if i < n {
+				fmt.Fprintf(bw, "%02x ", line[i])
+			} else {
+				bw.WriteString("   ")
+			}
+		}
+		bw.WriteString(" |")
+		for _, c := range line[:n] {
+			if c < 0x20 || c >= 0x7f {
+				c = '.'
+			}
+			bw.WriteByte(c)
+		}
+		bw.WriteString("|\n")
+		off += int64(n)
+		if err != nil {
+			break
+		}
+	}
+	if off > base {
+		fmt.Fprintf(bw, "%08x\n", off)
+	}
+	return bw.Flush()
+}
+
+// hexdumpCommand implements "elfsize hexdump <section> <file>"
+func hexdumpCommand(args []string) int {
+	fs := flag.NewFlagSet("hexdump", flag.ContinueOnError)
+	fileOffsets := fs.Bool("file-offsets", false, "count the offsets from the start of the file rather than of the section")
+	length := fs.Int64("n", -1, "dump at most this many bytes")
+	skip := fs.Int64("s", 0, "skip this many bytes of the section first")
+	verbose := fs.Bool("v", false, "print every line instead of \"*\" for repeated ones")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s hexdump [--file-offsets] [-s skip] [-n length] [-v] <section> <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the contents of a section in hexadecimal and as ASCII, like hexdump -C\n")
+		fmt.Fprintf(os.Stderr, "    The section may also be given as a glob pattern\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 2 || *skip < 0 {
+		fs.Usage()
+		return 2
+	}
+	name, path := positional[0], positional[1]
+
+	var base int64
+	if *fileOffsets {
+		offset, _, err := GetSectionOffsetAndLength(path, name)
+		if err != nil {
+			PrintError("hexdump", err)
+			return 1
+		}
+		base = int64(offset)
+	}
+	r, _, err := GetSectionReader(path, name)
+	if err != nil {
+		PrintError("hexdump", err)
+		return 1
+	}
+	defer r.Close()
+	if _, err := io.CopyN(io.Discard, r, *skip); err != nil && err != io.EOF {
+		PrintError("hexdump", err)
+		return 1
+	}
+	var data io.Reader = r
+	if *length >= 0 {
+		data = io.LimitReader(r, *length)
+	}
+	if err := hexDump(os.Stdout, data, base+*skip, !*verbose); err != nil {
+		PrintError("hexdump", err)
+		return 1
+	}
+	return 0
+}
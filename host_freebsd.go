@@ -0,0 +1,17 @@
+package main
+
+import (
+	"strings"
+	"syscall"
+)
+
+// hostOSRelease returns the release of the running kernel, e.g. "14.0" for
+// 14.0-RELEASE-p5, or "" if it cannot be told
+func hostOSRelease() string {
+	release, err := syscall.Sysctl("kern.osrelease")
+	if err != nil {
+		return ""
+	}
+	release, _, _ = strings.Cut(release, "-")
+	return release
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// hostOSRelease returns the version of the running kernel, e.g. "6.1.0"
+// for 6.1.0-18-amd64, or "" if it cannot be told
+func hostOSRelease() string {
+	data, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return ""
+	}
+	release, _, _ := strings.Cut(strings.TrimSpace(string(data)), "-")
+	return release
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !freebsd
+
+package main
+
+// hostOSRelease is not implemented on this system, so OS versions are not
+// checked
+func hostOSRelease() string {
+	return ""
+}
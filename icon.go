@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// iconSections lists the sections in which binaries are known to embed an
+// icon, in order of preference
+var iconSections = []string{".xdg_icon", ".icon"}
+
+// iconFormat returns "png" or "svg" depending on the contents of data,
+// or "" if it is neither
+func iconFormat(data []byte) string {
+	if bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")) {
+		return "png"
+	}
+	head := data
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	head = bytes.TrimSpace(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")))
+	if bytes.HasPrefix(head, []byte("<svg")) ||
+		(bytes.HasPrefix(head, []byte("<?xml")) && bytes.Contains(head, []byte("<svg"))) {
+		return "svg"
+	}
+	return ""
+}
+
+// GetEmbeddedIcon returns the icon embedded in an ELF section, its format
+// ("png" or "svg"), and err. It returns nil data if there is no icon
+func GetEmbeddedIcon(path string) ([]byte, string, error) {
+	for _, name := range iconSections {
+		data, err := GetSectionData(path, name)
+		if errors.Is(err, ErrSectionNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		// Sections reserved for an icon may be padded with NULs
+		data = bytes.TrimRight(data, "\x00")
+		if len(data) == 0 {
+			continue
+		}
+		format := iconFormat(data)
+		if format == "" {
+			return nil, "", errors.New(Tr(msgBadIcon, name))
+		}
+		return data, format, nil
+	}
+	return nil, "", nil
+}
+
+// iconCommand implements "elfsize icon <file> [-o output]"
+func iconCommand(args []string) int {
+	fs := flag.NewFlagSet("icon", flag.ContinueOnError)
+	output := fs.String("o", "", "write the icon to this path instead of <file>.png or <file>.svg")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s icon <file> [-o output]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Extract the icon embedded in an ELF section (%s)\n", strings.Join(iconSections, ", "))
+		fs.PrintDefaults()
+	}
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	data, format, err := GetEmbeddedIcon(positional[0])
+	if err != nil {
+		PrintError("icon", err)
+		return 1
+	}
+	if data == nil {
+		PrintError("icon", errors.New(Tr(msgNoIcon, positional[0])))
+		return 1
+	}
+
+	path := *output
+	if path == "" {
+		path = filepath.Base(positional[0]) + "." + format
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		PrintError("icon", err)
+		return 1
+	}
+	fmt.Println(path)
+	return 0
+}
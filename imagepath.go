@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// imagePathSeparator separates a filesystem image or archive from the path
+// of a file in it, as in "image.squashfs:/usr/bin/foo" or "archive.zip:bin/foo"
+const imagePathSeparator = ":"
+
+// maxImageLinkHops is how many symbolic links a path in an image may pass
+// through, like the 40 of Linux
+const maxImageLinkHops = 40
+
+// splitImagePath splits a path such as "image.squashfs:/usr/bin/foo" into the
+// image and the path in it. Paths that exist as they are, or where nothing
+// before a ":" is a regular file, are not split
+func splitImagePath(name string) (image, member string, ok bool) {
+	if _, err := os.Lstat(name); err == nil {
+		return "", "", false
+	}
+	for i := 0; ; i++ {
+		j := strings.Index(name[i:], imagePathSeparator)
+		if j < 0 {
+			return "", "", false
+		}
+		i += j
+		if stat, err := os.Stat(name[:i]); err == nil && stat.Mode().IsRegular() {
+			return name[:i], name[i+1:], true
+		}
+	}
+}
+
+// imagePathComponents splits a path in an image into its components,
+// without empty ones and "."
+func imagePathComponents(name string) []string {
+	var parts []string
+	for _, part := range strings.Split(name, "/") {
+		if part != "" && part != "." {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// openImageFS opens the filesystem in an image of size bytes: squashfs or
+// ISO 9660 at its start, the payload of an AppImage, or a zip archive, which
+// may follow an ELF image. It returns nil if there is none
+func openImageFS(r io.ReaderAt, size int64) (payloadFS, error) {
+	if _, err := readSquashfsSuperblock(r, 0); err == nil {
+		return openSquashfs(r, 0)
+	}
+	fs, err := openPayloadFS(r)
+	if fs != nil || err != nil {
+		return fs, err
+	}
+	if zr, err := openZip(r, size); err == nil {
+		return zr, nil
+	}
+	return nil, nil
+}
+
+// readImageFile returns the contents of the file at member in the
+// filesystem image or archive at image
+func readImageFile(image, member string) ([]byte, error) {
+	r, err := openFile(image)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	stat, err := r.Stat()
+	if err != nil {
+		return nil, err
+	}
+	fs, err := openImageFS(r, stat.Size())
+	if err != nil {
+		return nil, &FileError{image, err}
+	}
+	var data []byte
+	var ok bool
+	if fs != nil {
+		data, ok, err = fs.readPath(member)
+	} else if isStreamArchive(image) {
+		data, ok, err = readStreamMember(io.NewSectionReader(r, 0, stat.Size()), member)
+	} else {
+		return nil, &FileError{image, errors.New(Tr(msgNotAnImage))}
+	}
+	if err != nil {
+		return nil, &FileError{image, err}
+	}
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: image + ":" + member, Err: os.ErrNotExist}
+	}
+	return data, nil
+}
+
+// openImageMember opens a file inside a filesystem image for reading, as the
+// file at name, which is image:member. Its contents are extracted to a
+// temporary file, which is removed again when it is closed
+func openImageMember(name, image, member string, flags int) (*inputFile, error) {
+	if flags&(os.O_WRONLY|os.O_RDWR) != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: errors.New(Tr(msgImageReadOnly))}
+	}
+	data, err := readImageFile(image, member)
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp("", "elfsize-*")
+	if err != nil {
+		return nil, err
+	}
+	in := &inputFile{File: tmp, read: new(atomic.Int64), temp: tmp.Name()}
+	if _, err := tmp.Write(data); err != nil {
+		in.Close()
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		in.Close()
+		return nil, err
+	}
+	if err := checkHeaderLimits(tmp); err != nil {
+		in.Close()
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	stats.files.Add(1)
+	return in, nil
+}
+
+// isImagePath reports whether a path names a file inside a filesystem image
+func isImagePath(name string) bool {
+	_, _, ok := splitImagePath(name)
+	return ok
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// imagePadding is how far images may be apart, with zero bytes in
+// between, and still be considered back to back
+const imagePadding = 4096
+
+// ElfImage is one of several ELF images concatenated in a file
+type ElfImage struct {
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	Arch   string `json:"arch"`
+}
+
+// GetElfImages returns the ELF images a file consists of: the first one,
+// and every further ELF image that follows the end of the previous one,
+// directly or after zero padding, as with FatELF-style concatenation or a
+// runtime carrying another ELF file as payload
+func GetElfImages(filepath string) ([]ElfImage, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	stat, err := r.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return elfImages(r, stat.Size())
+}
+
+// elfImages does the work of GetElfImages on an opened file of fileSize bytes
+func elfImages(r io.ReaderAt, fileSize int64) ([]ElfImage, error) {
+	var images []ElfImage
+	for off := int64(0); off < fileSize; {
+		sr := io.NewSectionReader(r, off, fileSize-off)
+		f, err := elf.NewFile(sr)
+		if err != nil {
+			if len(images) == 0 {
+				return nil, err
+			}
+			break
+		}
+		size, err := maxEnd(f, sr)
+		if err != nil || size <= 0 {
+			if len(images) == 0 {
+				return nil, err
+			}
+			break
+		}
+		images = append(images, ElfImage{Offset: off, Size: size, Arch: elfArchitecture(f)})
+		// An image that the headers make end at or past the end of the
+		// file is the last one
+		if size >= fileSize-off {
+			break
+		}
+		next, ok := nextElfImage(r, off+size, fileSize)
+		if !ok {
+			break
+		}
+		off = next
+	}
+	return images, nil
+}
+
+// nextElfImage returns the offset of the ELF magic at off or after zero
+// padding of up to imagePadding bytes
+func nextElfImage(r io.ReaderAt, off, fileSize int64) (int64, bool) {
+	if off < 0 || off >= fileSize {
+		return 0, false
+	}
+	buf := make([]byte, min(imagePadding+4, fileSize-off))
+	n, _ := r.ReadAt(buf, off)
+	buf = buf[:n]
+	start := len(buf) - len(bytes.TrimLeft(buf, "\x00"))
+	if bytes.HasPrefix(buf[start:], []byte(elf.ELFMAG)) {
+		return off + int64(start), true
+	}
+	return 0, false
+}
+
+// imagesCommand implements "elfsize images <file>"
+func imagesCommand(args []string) int {
+	fs := flag.NewFlagSet("images", flag.ContinueOnError)
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s images <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the offset, size and architecture of every ELF image concatenated in a file\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	images, err := GetElfImages(positional[0])
+	if err != nil {
+		PrintError("images", err)
+		return 1
+	}
+	for _, image := range images {
+		fmt.Printf("%d\t%d\t%s\n", image.Offset, image.Size, image.Arch)
+	}
+	return 0
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"debug/buildinfo"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// ElfInfo is the machine-readable summary of an ELF file
+type ElfInfo struct {
+	Path        string `json:"path"`
+	Target      string `json:"target,omitempty"` // what Path resolves to if it is a symbolic link
+	Size        int64  `json:"size"`
+	FileSize    int64  `json:"file_size"`
+	Overlay     int64  `json:"overlay"`       // bytes appended after the ELF image
+	Slack       int64  `json:"slack"`         // zero bytes at the start of the overlay, padding
+	OverlayData int64  `json:"overlay_data"`  // the rest of the overlay, the actual payload
+	Signature   int64  `json:"signature"`     // bytes of a signature block appended after the overlay
+	MemSize     int64  `json:"mem_size"`      // bytes the PT_LOAD segments take in memory
+	BSSSize     int64  `json:"bss_size"`      // part of MemSize not stored in the file
+	LoadAlign   int64  `json:"load_align"`    // largest p_align of the PT_LOAD segments
+	MaxPageSize int64  `json:"max_page_size"` // largest of 4K, 16K and 64K pages it loads with, 0 if none
+	Arch        string `json:"arch"`
+	Class       int    `json:"class"`      // 32 or 64
+	Endianness  string `json:"endianness"` // "little" or "big"
+	Type        string `json:"type"`
+	OSABI       string `json:"osabi"`
+	Interpreter string `json:"interpreter"`
+	Soname      string `json:"soname"`
+	Stripped    bool   `json:"stripped"`
+	BuildID     string `json:"build_id"`      // hex encoded
+	GoVersion   string `json:"go_version"`    // empty unless built by Go
+	AppImage    int    `json:"appimage_type"` // 1 or 2, 0 if not an AppImage
+	Packed      bool   `json:"packed"`        // likely compressed by a packer such as UPX
+}
+
+// Stat returns the ElfInfo of a file from a single parse, as printed by the
+// info subcommand: sizes, architecture, class, byte order, type, OS ABI,
+// interpreter, build ID, whether it is stripped, and more
+func Stat(path string) (*ElfInfo, error) {
+	r, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return newElfInfo(path, r)
+}
+
+// newElfInfo collects the ElfInfo of an opened file
+func newElfInfo(path string, r *inputFile) (*ElfInfo, error) {
+	stat, err := r.Stat()
+	if err != nil {
+		return nil, err
+	}
+	info, err := elfInfoFrom(path, r, stat.Size())
+	if err != nil {
+		return nil, err
+	}
+	info.Target = linkTarget(path)
+	return info, nil
+}
+
+// elfInfoFrom collects the ElfInfo of the fileSize bytes of an ELF file in
+// r, which need not be on disk, such as a member of an archive
+func elfInfoFrom(path string, r io.ReaderAt, fileSize int64) (*ElfInfo, error) {
+	f, err := parseElf(path, r)
+	if err != nil {
+		return nil, err
+	}
+	interp, err := elfInterpreter(f)
+	if err != nil {
+		return nil, err
+	}
+	soname, err := elfSoname(f)
+	if err != nil {
+		return nil, err
+	}
+	buildID, err := elfBuildID(f)
+	if err != nil {
+		return nil, err
+	}
+	info := &ElfInfo{
+		Path:        path,
+		Size:        calculateElfSize(r),
+		FileSize:    fileSize,
+		Arch:        elfArchitecture(f),
+		Class:       elfClassBits(f.Class),
+		Endianness:  byteOrderName(f.ByteOrder),
+		Type:        elfType(f),
+		OSABI:       osabiName(f.OSABI),
+		Interpreter: interp,
+		Soname:      soname,
+		Stripped:    elfDebugInfo(f).Stripped(),
+		BuildID:     hex.EncodeToString(buildID),
+		AppImage:    appImageType(r),
+		Packed:      looksPacked(f, r),
+	}
+	mem, bss := elfMemSize(f)
+	info.MemSize, info.BSSSize = int64(mem), int64(bss)
+	info.LoadAlign, info.MaxPageSize = int64(elfLoadAlign(f)), int64(elfMaxPageSize(f))
+	if bi, err := buildinfo.Read(r); err == nil {
+		info.GoVersion = bi.GoVersion
+	}
+	info.Signature = appendedSignatureSize(r, info.Size, info.FileSize)
+	if end := info.FileSize - info.Signature; end > info.Size {
+		info.Overlay = end - info.Size
+		if info.Slack, err = elfSlack(r, info.Size, end); err != nil {
+			return nil, err
+		}
+		info.OverlayData = info.Overlay - info.Slack
+	}
+	return info, nil
+}
+
+// newFileInfo returns the MachOInfo, PEInfo, KernelImage, CoreInfo or
+// ElfInfo of an opened file
+func newFileInfo(path string, r *inputFile) (any, error) {
+	switch {
+	case isBzImage(r):
+		return newKernelImage(path, r)
+	case isCore(r):
+		return newCoreInfo(path, r)
+	case isMachO(r):
+		return newMachOInfo(path, r)
+	case isPE(r):
+		return newPEInfo(path, r)
+	}
+	return newElfInfo(path, r)
+}
+
+// parseFormatTemplate parses the argument of --format-template, a
+// text/template executed with the info of every file. Each result ends with
+// a newline unless the template already does. An empty text returns nil
+func parseFormatTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return template.New("format").Parse(text)
+}
+
+// elfClassBits returns 32 or 64 for ELFCLASS32 and ELFCLASS64, 0 otherwise
+func elfClassBits(class elf.Class) int {
+	switch class {
+	case elf.ELFCLASS32:
+		return 32
+	case elf.ELFCLASS64:
+		return 64
+	}
+	return 0
+}
+
+// byteOrderName returns "little" or "big"
+func byteOrderName(order binary.ByteOrder) string {
+	if order == binary.BigEndian {
+		return "big"
+	}
+	return "little"
+}
+
+// infoCommand implements "elfsize info <file>"
+func infoCommand(args []string) int {
+	fs := flag.NewFlagSet("info", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the summary as JSON")
+	porcelain := fs.Bool("porcelain", false, "print the summary as key=value lines whose format is stable across releases (ELF files only)")
+	formatTemplate := fs.String("format-template", "", "print the summary through a Go template, e.g. '{{.Path}} {{.Size}} {{.Arch}}'")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s info [--json | --porcelain | --format-template text] <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print a summary of everything elfsize knows about an ELF, Mach-O or PE file or a bzImage\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	tmpl, err := parseFormatTemplate(*formatTemplate)
+	if err != nil {
+		PrintError("info", err)
+		return 2
+	}
+	f, err := openFile(positional[0])
+	if err != nil {
+		PrintError("info", err)
+		return 1
+	}
+	defer f.Close()
+	info, err := newFileInfo(positional[0], f)
+	if err != nil {
+		PrintError("info", err)
+		return 1
+	}
+
+	if tmpl != nil {
+		if err := tmpl.Execute(os.Stdout, info); err != nil {
+			PrintError("info", err)
+			return 1
+		}
+		return 0
+	}
+	if *asJSON {
+		out, _ := json.MarshalIndent(info, "", "  ")
+		fmt.Println(string(out))
+		return 0
+	}
+	if *porcelain {
+		elfInfo, ok := info.(*ElfInfo)
+		if !ok {
+			PrintError("info", errors.New(Tr(msgPorcelainELF)))
+			return 1
+		}
+		if err := writePorcelain(os.Stdout, elfInfo); err != nil {
+			PrintError("info", err)
+			return 1
+		}
+		return 0
+	}
+	switch info := info.(type) {
+	case *MachOInfo:
+		printMachOInfo(info)
+	case *PEInfo:
+		printPEInfo(info)
+	case *CoreInfo:
+		printCoreInfo(info)
+	case *KernelImage:
+		printKernelImage(info)
+	case *ElfInfo:
+		printElfInfo(info)
+	}
+	return 0
+}
+
+// printElfInfo prints the text form of the info subcommand for ELF files
+func printElfInfo(info *ElfInfo) {
+	fmt.Printf("path:        %s\n", info.Path)
+	if info.Target != "" {
+		fmt.Printf("target:      %s\n", info.Target)
+	}
+	fmt.Printf("size:        %d\n", info.Size)
+	fmt.Printf("file_size:   %d\n", info.FileSize)
+	fmt.Printf("overlay:     %d\n", info.Overlay)
+	fmt.Printf("slack:       %d\n", info.Slack)
+	fmt.Printf("payload:     %d\n", info.OverlayData)
+	fmt.Printf("signature:   %d\n", info.Signature)
+	fmt.Printf("mem_size:    %d\n", info.MemSize)
+	fmt.Printf("bss_size:    %d\n", info.BSSSize)
+	fmt.Printf("load_align:  %d\n", info.LoadAlign)
+	fmt.Printf("page_size:   %d\n", info.MaxPageSize)
+	fmt.Printf("arch:        %s\n", info.Arch)
+	fmt.Printf("class:       %d\n", info.Class)
+	fmt.Printf("endianness:  %s\n", info.Endianness)
+	fmt.Printf("type:        %s\n", info.Type)
+	fmt.Printf("osabi:       %s\n", info.OSABI)
+	fmt.Printf("interpreter: %s\n", info.Interpreter)
+	fmt.Printf("soname:      %s\n", info.Soname)
+	fmt.Printf("stripped:    %t\n", info.Stripped)
+	fmt.Printf("build_id:    %s\n", info.BuildID)
+	fmt.Printf("go_version:  %s\n", info.GoVersion)
+	fmt.Printf("appimage:    %d\n", info.AppImage)
+	fmt.Printf("packed:      %t\n", info.Packed)
+}
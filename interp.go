@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// elfInterpreter returns the path in the PT_INTERP segment, or "" for
+// statically linked files
+func elfInterpreter(f *elf.File) (string, error) {
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_INTERP {
+			continue
+		}
+		data, err := io.ReadAll(prog.Open())
+		if err != nil {
+			return "", err
+		}
+		return string(bytes.TrimRight(data, "\x00")), nil
+	}
+	return "", nil
+}
+
+// GetElfInterpreter returns the dynamic linker an ELF file requests (e.g.
+// /libexec/ld-elf.so.1 on FreeBSD), or "" if it has none, and err
+func GetElfInterpreter(filepath string) (string, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return "", err
+	}
+	return elfInterpreter(f)
+}
+
+// SetElfInterpreter changes the dynamic linker an ELF file requests, and
+// returns err. A path that does not fit in place of the old one is stored in a
+// new loadable segment, since the dynamic linker reads its own name from
+// memory. The file is rewritten to output, or in place if output is empty
+func SetElfInterpreter(filepath string, interp string, output string) error {
+	img, err := loadElfImage(filepath)
+	if err != nil {
+		return err
+	}
+	progs, err := img.progs()
+	if err != nil {
+		return err
+	}
+	index := -1
+	for i, p := range progs {
+		if p.Type == elf.PT_INTERP {
+			index = i
+		}
+	}
+	if index < 0 {
+		return errors.New(Tr(msgNoInterpreter, filepath))
+	}
+
+	value := append([]byte(interp), 0)
+	old := progs[index]
+	if uint64(len(value)) <= old.Filesz {
+		padded := make([]byte, old.Filesz)
+		copy(padded, value)
+		img.writeBytes(old.Off, padded)
+	} else {
+		if err := img.checkNoOverlay(); err != nil {
+			return err
+		}
+		vaddr, off, err := img.addLoadSegment(value, elf.PF_R)
+		if err != nil {
+			return err
+		}
+		// addLoadSegment reorders the program headers
+		if progs, err = img.progs(); err != nil {
+			return err
+		}
+		for i, p := range progs {
+			if p.Type == elf.PT_INTERP {
+				progs[i].Off, progs[i].Vaddr, progs[i].Paddr = off, vaddr, vaddr
+				progs[i].Filesz, progs[i].Memsz = uint64(len(value)), uint64(len(value))
+			}
+		}
+		if err := img.setProgs(progs); err != nil {
+			return err
+		}
+		sections, err := img.sections()
+		if err != nil {
+			return err
+		}
+		for i, s := range sections {
+			if s.Off == old.Off && s.Size == old.Filesz && s.Type == elf.SHT_PROGBITS {
+				sections[i].Off, sections[i].Addr, sections[i].Size = off, vaddr, uint64(len(value))
+			}
+		}
+		if len(sections) > 0 {
+			if err := img.setSections(sections); err != nil {
+				return err
+			}
+		}
+	}
+
+	if output == "" {
+		output = filepath
+	}
+	return writeFileAtomic(output, img.data, img.mode)
+}
+
+// setInterpreterCommand implements "elfsize set-interpreter <file> <path>"
+func setInterpreterCommand(args []string) int {
+	fs := flag.NewFlagSet("set-interpreter", flag.ContinueOnError)
+	output := fs.String("o", "", "write the result to this file instead of changing the file in place")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s set-interpreter <file> <path> [-o output]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Change the dynamic linker an ELF file requests\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	if err := SetElfInterpreter(positional[0], positional[1], *output); err != nil {
+		PrintError("set-interpreter", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+// isoSectorSize is the size of an ISO 9660 logical sector; the volume
+// descriptors start at sector 16
+const isoSectorSize = 2048
+
+// isoFS is a minimal read-only ISO 9660 reader with Rock Ridge name and
+// symbolic link support, enough to get at the metadata of type-1 AppImages
+type isoFS struct {
+	r         io.ReaderAt
+	base      int64 // offset of the filesystem in r
+	blockSize int64
+	size      int64 // size of the filesystem in bytes
+	root      isoDirent
+	rockRidge bool // announced in the root directory, holds for all of them
+}
+
+// isoDirent is a directory record
+type isoDirent struct {
+	name    string
+	extent  int64 // logical block of the contents
+	size    int64
+	dir     bool
+	symlink string // Rock Ridge symbolic link target, if any
+}
+
+// openISO9660 reads the primary volume descriptor of a filesystem at base
+func openISO9660(r io.ReaderAt, base int64) (*isoFS, error) {
+	pvd := make([]byte, isoSectorSize)
+	if _, err := r.ReadAt(pvd, base+16*isoSectorSize); err != nil {
+		return nil, err
+	}
+	if pvd[0] != 1 || string(pvd[1:6]) != "CD001" {
+		return nil, errors.New(Tr(msgISONoPVD))
+	}
+	fs := &isoFS{r: r, base: base}
+	fs.blockSize = int64(binary.LittleEndian.Uint16(pvd[128:130]))
+	if fs.blockSize == 0 {
+		return nil, errors.New(Tr(msgISOBlockSize))
+	}
+	fs.size = int64(binary.LittleEndian.Uint32(pvd[80:84])) * fs.blockSize
+	root, ok := parseISODirent(pvd[156:190], false)
+	if !ok {
+		return nil, errors.New(Tr(msgISORootRecord))
+	}
+	fs.root = root
+	// Rock Ridge is announced by an SP entry in the "." record of the root
+	// directory only
+	dot := make([]byte, 255)
+	if _, err := r.ReadAt(dot, base+root.extent*fs.blockSize); err == nil && dot[0] > 34 {
+		fs.rockRidge = bytes.Contains(dot[33:dot[0]], []byte("SP\x07\x01\xbe\xef"))
+	}
+	return fs, nil
+}
+
+// parseISODirent decodes a directory record; rockRidge enables the
+// NM and SL System Use entries
+func parseISODirent(rec []byte, rockRidge bool) (isoDirent, bool) {
+	if len(rec) < 34 || int(rec[0]) > len(rec) || rec[0] < 34 {
+		return isoDirent{}, false
+	}
+	rec = rec[:rec[0]]
+	nameLen := int(rec[32])
+	if 33+nameLen > len(rec) {
+		return isoDirent{}, false
+	}
+	d := isoDirent{
+		name:   string(rec[33 : 33+nameLen]),
+		extent: int64(binary.LittleEndian.Uint32(rec[2:6])),
+		size:   int64(binary.LittleEndian.Uint32(rec[10:14])),
+		dir:    rec[25]&0x02 != 0,
+	}
+	if i := strings.IndexByte(d.name, ';'); i >= 0 {
+		d.name = strings.TrimSuffix(d.name[:i], ".")
+	}
+	if !rockRidge {
+		return d, true
+	}
+
+	su := 33 + nameLen
+	if nameLen%2 == 0 {
+		su++
+	}
+	var name strings.Builder
+	var link []string
+	for su+4 <= len(rec) {
+		sig, length := string(rec[su:su+2]), int(rec[su+2])
+		if length < 4 || su+length > len(rec) {
+			break
+		}
+		data := rec[su+4 : su+length]
+		switch sig {
+		case "NM":
+			if len(data) > 0 && data[0]&0x06 == 0 {
+				name.Write(data[1:])
+			}
+		case "SL":
+			if len(data) > 0 {
+				link = append(link, parseRockRidgeSymlink(data[1:])...)
+			}
+		}
+		su += length
+	}
+	if name.Len() > 0 {
+		d.name = name.String()
+	}
+	if len(link) > 0 {
+		d.symlink = strings.Join(link, "/")
+	}
+	return d, true
+}
+
+// parseRockRidgeSymlink decodes the component records of an SL entry
+func parseRockRidgeSymlink(data []byte) []string {
+	var parts []string
+	for len(data) >= 2 {
+		flags, length := data[0], int(data[1])
+		if 2+length > len(data) {
+			break
+		}
+		switch {
+		case flags&0x02 != 0:
+			parts = append(parts, ".")
+		case flags&0x04 != 0:
+			parts = append(parts, "..")
+		case flags&0x08 != 0:
+			parts = append(parts, "")
+		default:
+			parts = append(parts, string(data[2:2+length]))
+		}
+		data = data[2+length:]
+	}
+	return parts
+}
+
+// readDir returns the entries of a directory, without "." and ".."
+func (fs *isoFS) readDir(dir isoDirent) ([]isoDirent, error) {
+	data := make([]byte, dir.size)
+	if _, err := fs.r.ReadAt(data, fs.base+dir.extent*fs.blockSize); err != nil {
+		return nil, err
+	}
+	var entries []isoDirent
+	for pos := 0; pos < len(data); {
+		if data[pos] == 0 {
+			// Records do not cross sector boundaries; skip the padding
+			pos = (pos/isoSectorSize + 1) * isoSectorSize
+			continue
+		}
+		d, ok := parseISODirent(data[pos:], fs.rockRidge)
+		if !ok {
+			break
+		}
+		if nameLen := data[pos+32]; !(nameLen == 1 && (data[pos+33] == 0 || data[pos+33] == 1)) {
+			entries = append(entries, d)
+		}
+		pos += int(data[pos])
+	}
+	return entries, nil
+}
+
+// lookup finds a file in the root directory, following symbolic links that
+// stay within it
+func (fs *isoFS) lookup(name string) (isoDirent, bool, error) {
+	entries, err := fs.readDir(fs.root)
+	if err != nil {
+		return isoDirent{}, false, err
+	}
+	for hops := 0; hops < 8; hops++ {
+		var found *isoDirent
+		for i := range entries {
+			if entries[i].name == name {
+				found = &entries[i]
+				break
+			}
+		}
+		if found == nil {
+			return isoDirent{}, false, nil
+		}
+		if found.symlink == "" {
+			return *found, true, nil
+		}
+		name = path.Clean(found.symlink)
+		if strings.Contains(strings.TrimPrefix(name, "./"), "/") {
+			return isoDirent{}, false, nil
+		}
+		name = strings.TrimPrefix(name, "./")
+	}
+	return isoDirent{}, false, nil
+}
+
+// lookupPath finds a file by its path from the root directory, following
+// symbolic links within the filesystem; absolute ones start at its root
+func (fs *isoFS) lookupPath(name string) (isoDirent, bool, error) {
+	dirs := []isoDirent{fs.root}
+	parts := imagePathComponents(name)
+	for hops := 0; len(parts) > 0; {
+		part := parts[0]
+		parts = parts[1:]
+		if part == ".." {
+			if len(dirs) > 1 {
+				dirs = dirs[:len(dirs)-1]
+			}
+			continue
+		}
+		entries, err := fs.readDir(dirs[len(dirs)-1])
+		if err != nil {
+			return isoDirent{}, false, err
+		}
+		var found *isoDirent
+		for i := range entries {
+			if entries[i].name == part {
+				found = &entries[i]
+				break
+			}
+		}
+		switch {
+		case found == nil:
+			return isoDirent{}, false, nil
+		case found.symlink != "":
+			if hops++; hops > maxImageLinkHops {
+				return isoDirent{}, false, nil
+			}
+			if strings.HasPrefix(found.symlink, "/") {
+				dirs = dirs[:1]
+			}
+			parts = append(imagePathComponents(found.symlink), parts...)
+		case found.dir:
+			dirs = append(dirs, *found)
+		case len(parts) > 0:
+			return isoDirent{}, false, nil
+		default:
+			return *found, true, nil
+		}
+	}
+	return dirs[len(dirs)-1], true, nil
+}
+
+// readPath returns the contents of a file found by lookupPath
+func (fs *isoFS) readPath(name string) ([]byte, bool, error) {
+	d, ok, err := fs.lookupPath(name)
+	if err != nil || !ok || d.dir {
+		return nil, false, err
+	}
+	data, err := fs.readFile(d)
+	return data, err == nil, err
+}
+
+// readFile returns the contents of a file
+func (fs *isoFS) readFile(d isoDirent) ([]byte, error) {
+	data := make([]byte, d.size)
+	_, err := fs.r.ReadAt(data, fs.base+d.extent*fs.blockSize)
+	return data, err
+}
+
+// rootNames lists the root directory
+func (fs *isoFS) rootNames() ([]string, error) {
+	entries, err := fs.readDir(fs.root)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.name)
+	}
+	return names, nil
+}
+
+// readRootFile returns the contents of a file in the root directory
+func (fs *isoFS) readRootFile(name string) ([]byte, bool, error) {
+	d, ok, err := fs.lookup(name)
+	if err != nil || !ok || d.dir {
+		return nil, false, err
+	}
+	data, err := fs.readFile(d)
+	return data, err == nil, err
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// KernelImage is the summary of a compressed kernel such as a bzImage and
+// the ELF kernel inside it
+type KernelImage struct {
+	Path        string `json:"path"`
+	Format      string `json:"format"` // "bzImage", or "compressed" for other wrappers
+	FileSize    int64  `json:"file_size"`
+	Compression string `json:"compression"` // "gzip", "xz" or "zstd"
+	Offset      int64  `json:"offset"`      // of the compressed kernel in the file
+	Size        int64  `json:"size"`        // of the decompressed ELF kernel
+	Arch        string `json:"arch"`
+}
+
+// isBzImage reports whether r is an x86 bzImage, which has the "HdrS" magic
+// of the Linux boot protocol at 0x202
+func isBzImage(r io.ReaderAt) bool {
+	var magic [4]byte
+	_, err := r.ReadAt(magic[:], 0x202)
+	return err == nil && string(magic[:]) == "HdrS"
+}
+
+// GetKernelImage returns the summary of a compressed kernel. The ELF kernel
+// of a bzImage is found through its boot protocol header; in other wrappers,
+// everything that looks like the start of a gzip, xz or zstd stream is tried
+func GetKernelImage(filepath string) (*KernelImage, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return newKernelImage(filepath, r)
+}
+
+// newKernelImage collects the KernelImage of an opened file
+func newKernelImage(path string, r *inputFile) (*KernelImage, error) {
+	stat, err := r.Stat()
+	if err != nil {
+		return nil, err
+	}
+	k := &KernelImage{Path: path, Format: "compressed", FileSize: stat.Size()}
+	var candidates []int64
+	if isBzImage(r) {
+		k.Format = "bzImage"
+		if offset, ok := bzImagePayload(r); ok {
+			candidates = []int64{offset}
+		}
+	}
+	if candidates == nil {
+		if candidates, err = compressedStreams(r, stat.Size()); err != nil {
+			return nil, err
+		}
+	}
+	for _, offset := range candidates {
+		data, compression := decompressKernel(io.NewSectionReader(r, offset, stat.Size()-offset))
+		if data == nil {
+			continue
+		}
+		f, err := parseElf(path, bytes.NewReader(data))
+		if err != nil {
+			continue
+		}
+		size, err := readHeaderEnd(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		k.Compression, k.Offset, k.Size, k.Arch = compression, offset, size, elfArchitecture(f)
+		return k, nil
+	}
+	return nil, errors.New(Tr(msgNoKernel, path))
+}
+
+// bzImagePayload returns the offset of the compressed kernel of a bzImage
+// from payload_offset, which boot protocol 2.08 and later have at 0x248,
+// relative to the protected mode code after the setup sectors
+func bzImagePayload(r io.ReaderAt) (int64, bool) {
+	var hdr [0x250]byte
+	if _, err := r.ReadAt(hdr[:], 0); err != nil {
+		return 0, false
+	}
+	if binary.LittleEndian.Uint16(hdr[0x206:]) < 0x208 {
+		return 0, false
+	}
+	setupSects := int64(hdr[0x1f1])
+	if setupSects == 0 {
+		setupSects = 4
+	}
+	return (setupSects+1)*512 + int64(binary.LittleEndian.Uint32(hdr[0x248:])), true
+}
+
+// compressedStreams returns the offsets of everything in r that starts like
+// a gzip, xz or zstd stream
+func compressedStreams(r io.ReaderAt, size int64) ([]int64, error) {
+	magics := []string{"\x1f\x8b\x08"}
+	for _, d := range moduleDecompressors {
+		magics = append(magics, d.magic)
+	}
+	var offsets []int64
+	const chunk = 1 << 20
+	buf := make([]byte, chunk+8)
+	for base := int64(0); base < size; base += chunk {
+		n, err := r.ReadAt(buf, base)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		for i := 0; i < min(n, chunk); i++ {
+			for _, magic := range magics {
+				if bytes.HasPrefix(buf[i:n], []byte(magic)) {
+					offsets = append(offsets, base+int64(i))
+				}
+			}
+		}
+	}
+	return offsets, nil
+}
+
+// decompressKernel decompresses the stream at the start of r, or returns
+// nil. Whatever follows the stream is ignored, and so are errors once
+// something was decompressed: the caller checks that it is an ELF file
+func decompressKernel(r *io.SectionReader) ([]byte, string) {
+	var magic [6]byte
+	n, _ := r.ReadAt(magic[:], 0)
+	head := string(magic[:n])
+	if strings.HasPrefix(head, "\x1f\x8b") {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, ""
+		}
+		zr.Multistream(false)
+		data, _ := io.ReadAll(io.LimitReader(zr, maxModuleSize))
+		return data, "gzip"
+	}
+	for _, d := range moduleDecompressors {
+		if !strings.HasPrefix(head, d.magic) {
+			continue
+		}
+		cmd := exec.Command(d.command[0], d.command[1:]...)
+		cmd.Stdin = r
+		var stdout bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Run()
+		if stdout.Len() == 0 || stdout.Len() > maxModuleSize {
+			return nil, ""
+		}
+		return stdout.Bytes(), d.name
+	}
+	return nil, ""
+}
+
+// printKernelImage prints the text form of a KernelImage
+func printKernelImage(k *KernelImage) {
+	fmt.Printf("path:        %s\n", k.Path)
+	fmt.Printf("format:      %s\n", k.Format)
+	fmt.Printf("file_size:   %d\n", k.FileSize)
+	fmt.Printf("compression: %s\n", k.Compression)
+	fmt.Printf("offset:      %d\n", k.Offset)
+	fmt.Printf("size:        %d\n", k.Size)
+	fmt.Printf("arch:        %s\n", k.Arch)
+}
+
+// kernelCommand implements "elfsize kernel [--json] <file>"
+func kernelCommand(args []string) int {
+	fs := flag.NewFlagSet("kernel", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the summary as JSON")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s kernel [--json] <vmlinuz or bzImage>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the size and architecture of the ELF kernel inside a compressed\n")
+		fmt.Fprintf(os.Stderr, "    kernel image, decompressing gzip in process and xz and zstd with\n")
+		fmt.Fprintf(os.Stderr, "    the xz and zstd programs\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	k, err := GetKernelImage(positional[0])
+	if err != nil {
+		PrintError("kernel", err)
+		return 1
+	}
+	if *asJSON {
+		out, _ := json.MarshalIndent(k, "", "  ")
+		fmt.Println(string(out))
+		return 0
+	}
+	printKernelImage(k)
+	return 0
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// maxModuleSize limits how much a compressed kernel module may inflate to
+const maxModuleSize = 1 << 30
+
+// moduleDecompressors are the external programs used for the compression
+// formats the standard library cannot read, by magic
+var moduleDecompressors = []struct {
+	magic, name string
+	command     []string
+}{
+	{"\xfd7zXZ\x00", "xz", []string{"xz", "-dc"}},
+	{"\x28\xb5\x2f\xfd", "zstd", []string{"zstd", "-dc"}},
+}
+
+// moduleDecompressor returns the command of moduleDecompressors for the
+// format called name, or nil
+func moduleDecompressor(name string) []string {
+	for _, d := range moduleDecompressors {
+		if d.name == name {
+			return d.command
+		}
+	}
+	return nil
+}
+
+// KernelModule is the summary of a Linux or FreeBSD kernel module
+type KernelModule struct {
+	Path        string `json:"path"`
+	Compression string `json:"compression"` // "gzip", "xz", "zstd" or empty
+	Size        int64  `json:"size"`        // of the decompressed ELF image
+	Arch        string `json:"arch"`
+	Name        string `json:"name"`      // from .modinfo, Linux only
+	Vermagic    string `json:"vermagic"`  // from .modinfo, Linux only
+	Signature   int64  `json:"signature"` // bytes of the appended signature, 0 if unsigned
+}
+
+// GetKernelModule returns the summary of a .ko file, decompressing .ko.gz
+// in process and .ko.xz and .ko.zst with the xz and zstd programs, and err
+func GetKernelModule(filepath string) (*KernelModule, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, compression, err := decompressModule(r)
+	if err != nil {
+		return nil, err
+	}
+	f, err := parseElf(filepath, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	size, err := headerEnd(f, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	m := &KernelModule{Path: filepath, Compression: compression, Size: size, Arch: elfArchitecture(f)}
+	m.Signature = appendedSignatureSize(bytes.NewReader(data), size, int64(len(data)))
+	if s := f.Section(".modinfo"); s != nil {
+		info, err := s.Data()
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range bytes.Split(info, []byte{0}) {
+			key, value, _ := strings.Cut(string(entry), "=")
+			switch key {
+			case "name":
+				m.Name = value
+			case "vermagic":
+				m.Vermagic = value
+			}
+		}
+	}
+	return m, nil
+}
+
+// decompressModule returns the contents of a module file and its
+// compression format
+func decompressModule(r *inputFile) ([]byte, string, error) {
+	var magic [6]byte
+	n, _ := r.ReadAt(magic[:], 0)
+	head := string(magic[:n])
+	var out io.Reader
+	compression := ""
+	switch {
+	case strings.HasPrefix(head, "\x1f\x8b"):
+		zr, err := gzip.NewReader(io.NewSectionReader(r, 0, 1<<63-1))
+		if err != nil {
+			return nil, "", err
+		}
+		defer zr.Close()
+		out, compression = zr, "gzip"
+	default:
+		for _, d := range moduleDecompressors {
+			if !strings.HasPrefix(head, d.magic) {
+				continue
+			}
+			cmd := exec.Command(d.command[0], d.command[1:]...)
+			cmd.Stdin = io.NewSectionReader(r, 0, 1<<63-1)
+			var stdout bytes.Buffer
+			cmd.Stdout = &stdout
+			if err := cmd.Run(); err != nil {
+				return nil, "", errors.New(Tr(msgDecompressFailed, d.name, err))
+			}
+			out, compression = &stdout, d.name
+		}
+		if out == nil {
+			out = io.NewSectionReader(r, 0, 1<<63-1)
+		}
+	}
+	data, err := io.ReadAll(io.LimitReader(out, maxModuleSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > maxModuleSize {
+		return nil, "", errors.New(Tr(msgModuleTooLarge, maxModuleSize))
+	}
+	return data, compression, nil
+}
+
+// kmodCommand implements "elfsize kmod <module>"
+func kmodCommand(args []string) int {
+	fs := flag.NewFlagSet("kmod", flag.ContinueOnError)
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s kmod <module>...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the size, architecture, name, vermagic and signature size of kernel modules, which may be compressed\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	status := 0
+	for _, path := range positional {
+		m, err := GetKernelModule(path)
+		if err != nil {
+			PrintError("kmod", fmt.Errorf("%s: %w", path, err))
+			status = 1
+			continue
+		}
+		fmt.Printf("%s\t%d\t%s\t%s\t%s\t%d\n", m.Path, m.Size, m.Arch, m.Name, m.Vermagic, m.Signature)
+	}
+	return status
+}
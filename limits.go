@@ -0,0 +1,125 @@
+package main
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Limits on what a single file can make elfsize do, so that services
+// handing it untrusted files cannot be made to run out of memory or to
+// spend unbounded time on one. Like MaxSectionSize, a limit of 0 is off.
+// The defaults are far above what real binaries need; MaxBytesRead is off
+// by default, since digests of large AppImages read them completely
+var (
+	// MaxSections limits the number of section headers of an ELF file
+	MaxSections int64 = 1 << 17
+	// MaxSegments limits the number of program headers of an ELF file
+	MaxSegments int64 = 1 << 16
+	// MaxBytesRead limits the bytes read from a single opened file
+	MaxBytesRead int64
+)
+
+// ErrLimitExceeded is returned, wrapped with the limit and what exceeded
+// it, when a file runs into MaxSections, MaxSegments, MaxSectionSize or
+// MaxBytesRead
+var ErrLimitExceeded = errors.New(Tr(msgLimitExceeded))
+
+// limitExceeded wraps ErrLimitExceeded with a message
+func limitExceeded(id messageID, args ...interface{}) error {
+	return fmt.Errorf("%s: %w", Tr(id, args...), ErrLimitExceeded)
+}
+
+// checkHeaderLimits fails for ELF files with more section or program
+// headers than MaxSections or MaxSegments, before debug/elf allocates
+// memory for all of them. Extended numbering keeps the real counts in the
+// first section header
+func checkHeaderLimits(f io.ReaderAt) error {
+	var hdr [64]byte
+	n, _ := f.ReadAt(hdr[:], 0)
+	stats.syscalls.Add(1)
+	if n < 52 || string(hdr[:4]) != elf.ELFMAG {
+		return nil
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if elf.Data(hdr[elf.EI_DATA]) == elf.ELFDATA2MSB {
+		order = binary.BigEndian
+	}
+	var shoff, phnum, shnum uint64
+	var first []byte
+	switch elf.Class(hdr[elf.EI_CLASS]) {
+	case elf.ELFCLASS64:
+		if n < 64 {
+			return nil
+		}
+		shoff, phnum, shnum = order.Uint64(hdr[40:]), uint64(order.Uint16(hdr[56:])), uint64(order.Uint16(hdr[60:]))
+		first = make([]byte, 64)
+	case elf.ELFCLASS32:
+		shoff, phnum, shnum = uint64(order.Uint32(hdr[32:])), uint64(order.Uint16(hdr[44:])), uint64(order.Uint16(hdr[48:]))
+		first = make([]byte, 40)
+	default:
+		return nil
+	}
+	if shoff != 0 && (shnum == 0 || phnum == 0xffff) {
+		if _, err := f.ReadAt(first, int64(shoff)); err == nil {
+			// sh_size and sh_info of the first section header
+			if len(first) == 64 {
+				if shnum == 0 {
+					shnum = order.Uint64(first[32:])
+				}
+				if phnum == 0xffff {
+					phnum = uint64(order.Uint32(first[44:]))
+				}
+			} else {
+				if shnum == 0 {
+					shnum = uint64(order.Uint32(first[20:]))
+				}
+				if phnum == 0xffff {
+					phnum = uint64(order.Uint32(first[28:]))
+				}
+			}
+		}
+		stats.syscalls.Add(1)
+	}
+	if MaxSections > 0 && shnum > uint64(MaxSections) {
+		return limitExceeded(msgTooManySections, shnum, MaxSections)
+	}
+	if MaxSegments > 0 && phnum > uint64(MaxSegments) {
+		return limitExceeded(msgTooManySegments, phnum, MaxSegments)
+	}
+	return nil
+}
+
+// SetLimits sets the limits from a comma separated list of name=value pairs
+// of sections, segments, section-size and bytes, as in $ELFSIZE_LIMITS.
+// "none" turns all limits off
+func SetLimits(spec string) error {
+	if spec == "none" {
+		MaxSections, MaxSegments, MaxSectionSize, MaxBytesRead = 0, 0, 0, 0
+		return nil
+	}
+	for _, field := range strings.Split(spec, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			return errors.New(Tr(msgBadLimits, field))
+		}
+		switch name {
+		case "sections":
+			MaxSections = n
+		case "segments":
+			MaxSegments = n
+		case "section-size":
+			MaxSectionSize = n
+		case "bytes":
+			MaxBytesRead = n
+		default:
+			return errors.New(Tr(msgBadLimits, field))
+		}
+	}
+	return nil
+}
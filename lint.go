@@ -0,0 +1,244 @@
+package main
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// LintFinding is a structural problem of an ELF file. Code identifies the
+// kind of problem and does not change between releases or languages
+type LintFinding struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// linter collects the findings of LintElf
+type linter struct {
+	img      *elfImage
+	findings []LintFinding
+}
+
+func (l *linter) report(id messageID, args ...interface{}) {
+	l.findings = append(l.findings, LintFinding{string(id), Tr(id, args...)})
+}
+
+// LintElf checks the headers of an ELF file for structural problems that
+// loaders and tools may trip over, such as tables or contents past the end
+// of the file, overlapping sections and misordered segments. It returns the
+// problems found, and an error only if the file is not ELF at all
+func LintElf(filepath string) ([]LintFinding, error) {
+	img, err := loadElfImage(filepath)
+	if err != nil {
+		return nil, err
+	}
+	h, err := img.header()
+	if err != nil {
+		return nil, err
+	}
+	l := &linter{img: img}
+	size := uint64(len(img.data))
+	phentsize := uint64(binary.Size(elf.Prog32{}))
+	if img.class == elf.ELFCLASS64 {
+		phentsize = uint64(binary.Size(elf.Prog64{}))
+	}
+
+	if h.Phnum > 0 {
+		switch end := h.Phoff + uint64(h.Phnum)*uint64(h.Phentsize); {
+		case uint64(h.Phentsize) != phentsize:
+			l.report(msgLintPhentsize, h.Phentsize, phentsize)
+		case end > size || end < h.Phoff:
+			l.report(msgLintPhdrsEOF, end, size)
+		default:
+			progs, err := img.progs()
+			if err != nil {
+				return nil, err
+			}
+			l.segments(progs)
+		}
+	}
+	if h.Shoff != 0 && h.Shnum > 0 {
+		switch end := h.Shoff + uint64(h.Shnum)*uint64(h.Shentsize); {
+		case uint64(h.Shentsize) != img.sectionEntrySize():
+			l.report(msgLintShentsize, h.Shentsize, img.sectionEntrySize())
+		case end > size || end < h.Shoff:
+			l.report(msgLintShdrsEOF, end, size)
+		default:
+			sections, err := img.sections()
+			if err != nil {
+				return nil, err
+			}
+			l.sections(sections, h.Shstrndx)
+		}
+	}
+	return l.findings, nil
+}
+
+// segments checks the program headers
+func (l *linter) segments(progs []progHeader) {
+	size := uint64(len(l.img.data))
+	seenLoad, interps := false, 0
+	var lastVaddr uint64
+	for i, p := range progs {
+		if p.Type == elf.PT_INTERP {
+			interps++
+		}
+		if (p.Type == elf.PT_PHDR || p.Type == elf.PT_INTERP) && seenLoad {
+			l.report(msgLintAfterLoad, p.Type, i)
+		}
+		if end := p.Off + p.Filesz; p.Filesz > 0 && (end > size || end < p.Off) {
+			l.report(msgLintSegmentEOF, i, p.Type, end, size)
+		}
+		if p.Align&(p.Align-1) != 0 {
+			l.report(msgLintAlign, i, p.Align)
+		}
+		if p.Type != elf.PT_LOAD {
+			continue
+		}
+		if seenLoad && p.Vaddr < lastVaddr {
+			l.report(msgLintLoadOrder, i, p.Vaddr, lastVaddr)
+		}
+		seenLoad, lastVaddr = true, p.Vaddr
+		if p.Memsz == 0 {
+			l.report(msgLintEmptyLoad, i)
+		}
+		if p.Memsz < p.Filesz {
+			l.report(msgLintMemsz, i, p.Filesz, p.Memsz)
+		}
+		if p.Align > 1 && p.Align&(p.Align-1) == 0 && p.Off%p.Align != p.Vaddr%p.Align {
+			l.report(msgLintMisaligned, i, p.Off, p.Vaddr, p.Align)
+		}
+	}
+	if interps > 1 {
+		l.report(msgLintMultipleInterp, interps)
+	}
+}
+
+// sections checks the section headers
+func (l *linter) sections(sections []sectionHeader, shstrndx uint16) {
+	size := uint64(len(l.img.data))
+	name := func(i int) string { return fmt.Sprintf("[%d]", i) }
+	switch {
+	case shstrndx == uint16(elf.SHN_UNDEF):
+	case int(shstrndx) >= len(sections):
+		l.report(msgLintShstrndx, shstrndx, len(sections))
+	case sections[shstrndx].Type != elf.SHT_STRTAB:
+		l.report(msgLintShstrtab, shstrndx)
+	default:
+		names := l.img.sectionNames(sections, shstrndx)
+		name = func(i int) string { return names[i] }
+	}
+
+	var contents []int
+	for i, s := range sections {
+		if i > 0 && s.Link >= uint32(len(sections)) {
+			l.report(msgLintSectionLink, name(i), s.Link, len(sections))
+		}
+		if s.Type == elf.SHT_NULL || s.Type == elf.SHT_NOBITS || s.Size == 0 {
+			continue
+		}
+		// Sections past the end would overlap everything after them
+		if end := s.Off + s.Size; end > size || end < s.Off {
+			l.report(msgLintSectionEOF, name(i), end, size)
+			continue
+		}
+		contents = append(contents, i)
+	}
+	sort.SliceStable(contents, func(a, b int) bool { return sections[contents[a]].Off < sections[contents[b]].Off })
+	// Compare every section with the one reaching furthest before it
+	furthest := -1
+	for _, i := range contents {
+		if furthest >= 0 {
+			prev := sections[furthest]
+			if sections[i].Off < prev.Off+prev.Size {
+				l.report(msgLintSectionOverlap, name(furthest), name(i), sections[i].Off)
+			}
+		}
+		if furthest < 0 || sections[i].Off+sections[i].Size > sections[furthest].Off+sections[furthest].Size {
+			furthest = i
+		}
+	}
+}
+
+// lintCommand implements "elfsize lint [--json] [--baseline file] [--write-baseline file] <file>..."
+func lintCommand(args []string) int {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the findings as JSON, by file")
+	baselinePath := fs.String("baseline", "", "only report findings that are not in this baseline file")
+	writeBaseline := fs.String("write-baseline", "", "record the current findings in this baseline file")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s lint [--json] [--baseline file] [--write-baseline file] <file>...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Check ELF files for structural problems, printing one per line:\n")
+		fmt.Fprintf(os.Stderr, "    file, code and description. Exit with 0 if there are none, 1 if\n")
+		fmt.Fprintf(os.Stderr, "    there are and 2 on errors. A baseline matches findings by file and\n")
+		fmt.Fprintf(os.Stderr, "    code, so that they are accepted wherever they are in the file\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	var baseline Baseline
+	if *baselinePath != "" {
+		if baseline, err = LoadBaseline(*baselinePath); err != nil {
+			PrintError("lint", err)
+			return 2
+		}
+	}
+
+	status := 0
+	var keys []string
+	results := map[string][]LintFinding{}
+	for _, path := range positional {
+		findings, err := LintElf(path)
+		if err != nil {
+			PrintError("lint "+path, err)
+			status = 2
+			continue
+		}
+		reported := []LintFinding{}
+		for _, finding := range findings {
+			key := findingKey(path, "lint", finding.Code)
+			keys = append(keys, key)
+			if !baseline.Contains(key) {
+				reported = append(reported, finding)
+			}
+		}
+		if len(reported) > 0 && status == 0 {
+			status = 1
+		}
+		if *asJSON {
+			results[path] = reported
+			continue
+		}
+		for _, finding := range reported {
+			fmt.Printf("%s\t%s\t%s\n", path, finding.Code, finding.Message)
+		}
+	}
+	if *asJSON {
+		out, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Println(string(out))
+	}
+
+	if *writeBaseline != "" {
+		if err := WriteBaseline(*writeBaseline, keys); err != nil {
+			PrintError("lint", err)
+			return 2
+		}
+		// Recording a baseline accepts whatever was found
+		if status == 1 {
+			status = 0
+		}
+	}
+	return status
+}
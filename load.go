@@ -0,0 +1,182 @@
+package main
+
+import (
+	"debug/elf"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// elfMemSize returns the bytes the PT_LOAD segments of a file take in
+// memory, and how many of them are BSS, zero-filled by the loader rather
+// than read from the file
+func elfMemSize(f *elf.File) (mem, bss uint64) {
+	for _, p := range f.Progs {
+		if p.Type != elf.PT_LOAD {
+			continue
+		}
+		mem += p.Memsz
+		if p.Memsz > p.Filesz {
+			bss += p.Memsz - p.Filesz
+		}
+	}
+	return mem, bss
+}
+
+// pageSizes are the page sizes Linux kernels are built with, smallest first
+var pageSizes = []uint64{4 << 10, 16 << 10, 64 << 10}
+
+// elfLoadAlign returns the largest alignment of the PT_LOAD segments of a file
+func elfLoadAlign(f *elf.File) uint64 {
+	var align uint64
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_LOAD {
+			align = max(align, p.Align)
+		}
+	}
+	return align
+}
+
+// elfLoadsWithPageSize reports whether the loader can map the PT_LOAD
+// segments of a file with pages of the given size: every segment must be
+// aligned to at least a page, and its offset and address must agree within it
+func elfLoadsWithPageSize(f *elf.File, pageSize uint64) bool {
+	for _, p := range f.Progs {
+		if p.Type != elf.PT_LOAD {
+			continue
+		}
+		if p.Align < pageSize || p.Off%pageSize != p.Vaddr%pageSize {
+			return false
+		}
+	}
+	return true
+}
+
+// elfMaxPageSize returns the largest of pageSizes a file loads with, or 0
+func elfMaxPageSize(f *elf.File) uint64 {
+	var size uint64
+	for _, p := range pageSizes {
+		if elfLoadsWithPageSize(f, p) {
+			size = p
+		}
+	}
+	return size
+}
+
+// GetMemSize returns the bytes the loader maps for an ELF file, the sum of
+// the memory sizes of its PT_LOAD segments, and how many of them are BSS
+func GetMemSize(filepath string) (mem, bss int64, err error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return 0, 0, err
+	}
+	m, b := elfMemSize(f)
+	return int64(m), int64(b), nil
+}
+
+// Segment describes a program header of an ELF file
+type Segment struct {
+	Index  int // in the program header table
+	Type   elf.ProgType
+	Flags  elf.ProgFlag
+	Offset uint64
+	Vaddr  uint64
+	Filesz uint64
+	Memsz  uint64
+	Align  uint64
+}
+
+// GetSegments returns the program headers of a file in table order
+func GetSegments(filepath string) ([]Segment, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return nil, err
+	}
+	segments := make([]Segment, 0, len(f.Progs))
+	for i, p := range f.Progs {
+		segments = append(segments, Segment{i, p.Type, p.Flags, p.Off, p.Vaddr, p.Filesz, p.Memsz, p.Align})
+	}
+	return segments, nil
+}
+
+// segmentFlags formats the flags of a segment like ls does permissions,
+// e.g. "r-x"
+func segmentFlags(flags elf.ProgFlag) string {
+	b := []byte("---")
+	for i, f := range []elf.ProgFlag{elf.PF_R, elf.PF_W, elf.PF_X} {
+		if flags&f != 0 {
+			b[i] = "rwx"[i]
+		}
+	}
+	return string(b)
+}
+
+// segmentsCommand implements "elfsize segments [--load] [--json] <file>"
+func segmentsCommand(args []string) int {
+	fs := flag.NewFlagSet("segments", flag.ContinueOnError)
+	loadOnly := fs.Bool("load", false, "list only the PT_LOAD segments")
+	asJSON := fs.Bool("json", false, "print the segments as JSON")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s segments [--load] [--json] <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the type, flags, offset, address, size in the file and in memory,\n")
+		fmt.Fprintf(os.Stderr, "    and alignment of the segments, then on stderr where the loaded part of\n")
+		fmt.Fprintf(os.Stderr, "    the file ends and how much memory it takes\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	segments, err := GetSegments(positional[0])
+	if err != nil {
+		PrintError("segments", err)
+		return 1
+	}
+	type segmentJSON struct {
+		Index  int    `json:"index"`
+		Type   string `json:"type"`
+		Flags  string `json:"flags"`
+		Offset uint64 `json:"offset"`
+		Vaddr  uint64 `json:"vaddr"`
+		Filesz uint64 `json:"filesz"`
+		Memsz  uint64 `json:"memsz"`
+		Align  uint64 `json:"align"`
+	}
+	shown := []segmentJSON{}
+	var end, mem uint64
+	for _, s := range segments {
+		if s.Type == elf.PT_LOAD {
+			end, mem = max(end, s.Offset+s.Filesz), mem+s.Memsz
+		} else if *loadOnly {
+			continue
+		}
+		shown = append(shown, segmentJSON{s.Index, s.Type.String(), segmentFlags(s.Flags), s.Offset, s.Vaddr, s.Filesz, s.Memsz, s.Align})
+	}
+	if *asJSON {
+		out, _ := json.MarshalIndent(shown, "", "  ")
+		fmt.Println(string(out))
+		return 0
+	}
+	for _, s := range shown {
+		fmt.Printf("%s\t%s\t%#x\t%#x\t%d\t%d\t%#x\n", s.Type, s.Flags, s.Offset, s.Vaddr, s.Filesz, s.Memsz, s.Align)
+	}
+	fmt.Fprintln(os.Stderr, Tr(msgSegmentsEnd, end, mem))
+	return 0
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Verbosity levels of the diagnostics elfsize logs. Errors are logged at
+// slog.LevelError, problems found in files at slog.LevelWarn and notices at
+// slog.LevelInfo; what the library does is logged at LogVerbose and details
+// for debugging at LogDebug
+const (
+	LogQuiet   = slog.LevelError
+	LogNormal  = slog.LevelInfo
+	LogVerbose = slog.LevelDebug
+	LogDebug   = slog.LevelDebug - 4
+)
+
+// logLevel is the level of the logger of the command line
+var logLevel = new(slog.LevelVar)
+
+// logger receives all diagnostics, see SetLogger
+var logger = slog.New(newLogHandler(os.Stderr, logLevel))
+
+// SetLogger makes the library log its diagnostics to l instead of stderr,
+// so that an application can route or silence them. Records carry the
+// message ID from the catalog as "id". A nil l restores the default
+func SetLogger(l *slog.Logger) {
+	if l == nil {
+		l = slog.New(newLogHandler(os.Stderr, logLevel))
+	}
+	logger = l
+}
+
+// logMessage logs a message from the catalog at level
+func logMessage(level slog.Level, id messageID, args ...interface{}) {
+	if logger.Enabled(context.Background(), level) {
+		logger.Log(context.Background(), level, Tr(id, args...), "id", string(id))
+	}
+}
+
+// logHandler is the slog.Handler of the command line. It writes each
+// message on a line of its own, as elfsize always has, with the attributes
+// appended only at LogDebug. Groups are flattened
+type logHandler struct {
+	w     io.Writer
+	mu    *sync.Mutex
+	level slog.Leveler
+	attrs []slog.Attr
+}
+
+func newLogHandler(w io.Writer, level slog.Leveler) *logHandler {
+	return &logHandler{w: w, mu: new(sync.Mutex), level: level}
+}
+
+func (h *logHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *logHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	b.WriteString(r.Message)
+	if h.level.Level() <= LogDebug {
+		add := func(a slog.Attr) bool {
+			fmt.Fprintf(&b, " %s=%v", a.Key, a.Value)
+			return true
+		}
+		for _, a := range h.attrs {
+			add(a)
+		}
+		r.Attrs(add)
+	}
+	b.WriteByte('\n')
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	c.attrs = append(append([]slog.Attr(nil), h.attrs...), attrs...)
+	return &c
+}
+
+func (h *logHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// takeLogFlags applies the logging options at the start of a command line,
+// before the subcommand, and returns the rest:
+//
+//	-v, --verbose        also what elfsize does
+//	--debug              also details, and attributes after the messages
+//	--log-level level    quiet, normal, verbose or debug
+//	--log-json           write the log as JSON lines
+func takeLogFlags(args []string) ([]string, error) {
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		// Like the flag package, accept one dash or two
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(args[0][1:], "-"), "=")
+		switch name {
+		case "v", "verbose":
+			logLevel.Set(LogVerbose)
+		case "debug":
+			logLevel.Set(LogDebug)
+		case "log-json":
+			logger = slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel}))
+		case "log-level":
+			if !hasValue {
+				if len(args) < 2 {
+					return nil, errors.New(Tr(msgLogLevel, ""))
+				}
+				value, args = args[1], args[1:]
+			}
+			level, ok := map[string]slog.Level{"quiet": LogQuiet, "normal": LogNormal, "verbose": LogVerbose, "debug": LogDebug}[value]
+			if !ok {
+				return nil, errors.New(Tr(msgLogLevel, value))
+			}
+			logLevel.Set(level)
+		default:
+			return args, nil
+		}
+		args = args[1:]
+	}
+	return args, nil
+}
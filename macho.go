@@ -0,0 +1,165 @@
+package main
+
+import (
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// MachOSlice is one architecture of a Mach-O file
+type MachOSlice struct {
+	Arch   string `json:"arch"`
+	Offset int64  `json:"offset"` // 0 unless in a universal binary
+	Size   int64  `json:"size"`
+}
+
+// MachOInfo is the machine-readable summary of a Mach-O file
+type MachOInfo struct {
+	Path      string       `json:"path"`
+	Size      int64        `json:"size"`
+	FileSize  int64        `json:"file_size"`
+	Overlay   int64        `json:"overlay"`   // bytes appended after the last slice
+	Universal bool         `json:"universal"` // a fat binary with one slice per architecture
+	Slices    []MachOSlice `json:"slices"`
+}
+
+// Load commands of type linkedit_data_command, whose data need not lie in
+// a segment of object files
+const (
+	machoCodeSignature    = 0x1d
+	machoSegmentSplitInfo = 0x1e
+	machoFunctionStarts   = 0x26
+	machoDataInCode       = 0x29
+	machoExportsTrie      = 0x80000033
+	machoChainedFixups    = 0x80000034
+)
+
+// isMachO reports whether r starts with the magic of a thin or universal
+// Mach-O file
+func isMachO(r io.ReaderAt) bool {
+	var magic [4]byte
+	if _, err := r.ReadAt(magic[:], 0); err != nil {
+		return false
+	}
+	switch binary.BigEndian.Uint32(magic[:]) {
+	case macho.Magic32, macho.Magic64, macho.MagicFat, 0xcefaedfe, 0xcffaedfe:
+		return true
+	}
+	return false
+}
+
+// GetMachOInfo returns the size and architectures of a Mach-O file, and err
+func GetMachOInfo(filepath string) (*MachOInfo, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return newMachOInfo(filepath, r)
+}
+
+// newMachOInfo collects the MachOInfo of an opened file. Universal binaries
+// end with their last slice, thin ones with the last byte that a segment or
+// the link edit data refers to
+func newMachOInfo(path string, r *inputFile) (*MachOInfo, error) {
+	stat, err := r.Stat()
+	if err != nil {
+		return nil, err
+	}
+	info := &MachOInfo{Path: path, FileSize: stat.Size()}
+	if fat, err := macho.NewFatFile(r); err == nil {
+		defer fat.Close()
+		info.Universal = true
+		for _, arch := range fat.Arches {
+			info.Slices = append(info.Slices, MachOSlice{
+				Arch:   machoArchitecture(arch.Cpu),
+				Offset: int64(arch.Offset),
+				Size:   int64(arch.Size),
+			})
+			info.Size = max(info.Size, int64(arch.Offset)+int64(arch.Size))
+		}
+	} else {
+		f, err := macho.NewFile(r)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		info.Size = machoImageSize(f)
+		info.Slices = []MachOSlice{{Arch: machoArchitecture(f.Cpu), Size: info.Size}}
+	}
+	if info.FileSize > info.Size {
+		info.Overlay = info.FileSize - info.Size
+	}
+	return info, nil
+}
+
+// machoImageSize returns the end of the last structure referenced by the
+// header and load commands of a thin Mach-O file
+func machoImageSize(f *macho.File) int64 {
+	size := int64(f.Cmdsz) + 28
+	if f.Magic == macho.Magic64 {
+		size += 4
+	}
+	for _, s := range f.Sections {
+		size = max(size, int64(s.Offset)+int64(s.Size), int64(s.Reloff)+int64(s.Nreloc)*8)
+	}
+	for _, load := range f.Loads {
+		switch l := load.(type) {
+		case *macho.Segment:
+			size = max(size, int64(l.Offset)+int64(l.Filesz))
+		case *macho.Symtab:
+			entry := int64(12)
+			if f.Magic == macho.Magic64 {
+				entry = 16
+			}
+			size = max(size, int64(l.Symoff)+int64(l.Nsyms)*entry, int64(l.Stroff)+int64(l.Strsize))
+		default:
+			raw := load.Raw()
+			if len(raw) < 16 {
+				continue
+			}
+			switch f.ByteOrder.Uint32(raw) {
+			case machoCodeSignature, machoSegmentSplitInfo, machoFunctionStarts, machoDataInCode, machoExportsTrie, machoChainedFixups:
+				size = max(size, int64(f.ByteOrder.Uint32(raw[8:]))+int64(f.ByteOrder.Uint32(raw[12:])))
+			}
+		}
+	}
+	return size
+}
+
+// machoArchitecture names a Mach-O CPU type like elfArchitecture names the
+// corresponding ELF machine
+func machoArchitecture(cpu macho.Cpu) string {
+	switch cpu {
+	case macho.CpuAmd64:
+		return "x86_64"
+	case macho.Cpu386:
+		return "i686"
+	case macho.CpuArm:
+		return "armhf"
+	case macho.CpuArm64:
+		return "aarch64"
+	case macho.CpuPpc:
+		return "powerpc"
+	case macho.CpuPpc64:
+		return "ppc64"
+	}
+	return fmt.Sprintf("cpu%d", uint32(cpu))
+}
+
+// printMachOInfo prints the text form of the info subcommand for Mach-O files
+func printMachOInfo(info *MachOInfo) {
+	format := "macho"
+	if info.Universal {
+		format = "universal"
+	}
+	fmt.Printf("path:        %s\n", info.Path)
+	fmt.Printf("format:      %s\n", format)
+	fmt.Printf("size:        %d\n", info.Size)
+	fmt.Printf("file_size:   %d\n", info.FileSize)
+	fmt.Printf("overlay:     %d\n", info.Overlay)
+	for _, s := range info.Slices {
+		fmt.Printf("slice:       %s %d %d\n", s.Arch, s.Offset, s.Size)
+	}
+}
@@ -7,92 +7,716 @@ package main
 import (
 	"debug/elf"
 	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"log/slog"
+	"math"
 	"os"
+	"strings"
 )
 
+// subcommands maps the first command line argument to its implementation.
+// Apart from them, run knows "size", "help" and "completion", which refer to
+// this table.
+// Anything that is not a subcommand is treated as the path to an ELF file,
+// so that "elfsize <file>" keeps working as "elfsize size <file>"
+var subcommands = map[string]func(args []string) int{
+	"add-debuglink":     addDebugLinkCommand,
+	"add-section":       addSectionCommand,
+	"appdir":            appDirCommand,
+	"appimage-extract":  appimageExtractCommand,
+	"ar":                arCommand,
+	"arch":              archCommand,
+	"budget":            budgetCommand,
+	"build-id":          buildIDCommand,
+	"can-run":           canRunCommand,
+	"can-run-here":      canRunHereCommand,
+	"carve":             carveCommand,
+	"checksec":          checksecCommand,
+	"compare":           compareCommand,
+	"copy":              copyCommand,
+	"debuglink":         debugLinkCommand,
+	"defrag":            defragCommand,
+	"desktop-validate":  desktopValidateCommand,
+	"digest":            digestCommand,
+	"dynamic":           dynamicCommand,
+	"edit-header":       editHeaderCommand,
+	"embed-signature":   embedSignatureCommand,
+	"entropy":           entropyCommand,
+	"extract":           extractCommand,
+	"extract-section":   extractSectionCommand,
+	"extract-signature": extractSignatureCommand,
+	"gaps":              gapsCommand,
+	"get-updateinfo":    getUpdateInfoCommand,
+	"go-buildinfo":      goBuildInfoCommand,
+	"hash":              hashCommand,
+	"hexdump":           hexdumpCommand,
+	"icon":              iconCommand,
+	"images":            imagesCommand,
+	"info":              infoCommand,
+	"kernel":            kernelCommand,
+	"kmod":              kmodCommand,
+	"ldd":               lddCommand,
+	"lint":              lintCommand,
+	"mount-opts":        mountOptsCommand,
+	"needed":            neededCommand,
+	"notes":             notesCommand,
+	"oci":               ociCommand,
+	"overlay":           overlayCommand,
+	"patch-dir":         patchDirCommand,
+	"payload":           payloadCommand,
+	"pkg":               pkgCommand,
+	"release-diff":      releaseDiffCommand,
+	"relocs":            relocsCommand,
+	"remove-section":    removeSectionCommand,
+	"repair":            repairCommand,
+	"repro":             reproCommand,
+	"rpath":             rpathCommand,
+	"sbom":              sbomCommand,
+	"scan":              scanCommand,
+	"sections":          sectionsCommand,
+	"segments":          segmentsCommand,
+	"serve":             serveCommand,
+	"set-interpreter":   setInterpreterCommand,
+	"set-osabi":         setOSABICommand,
+	"set-rpath":         setRpathCommand,
+	"set-section":       setSectionCommand,
+	"set-soname":        setSonameCommand,
+	"set-updateinfo":    setUpdateInfoCommand,
+	"snapshot":          snapshotCommand,
+	"strings":           stringsCommand,
+	"symbols":           symbolsCommand,
+	"toolchain":         toolchainCommand,
+	"tui":               tuiCommand,
+	"verify-runtime":    verifyRuntimeCommand,
+	"verify-signature":  verifySignatureCommand,
+	"versions":          versionsCommand,
+	"zsync":             zsyncCommand,
+}
+
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "USAGE: %s <path to ELF file>\n", os.Args[0])
+	if aliases := os.Getenv("ELFSIZE_ARCH_ALIASES"); aliases != "" {
+		if err := LoadArchitectureAliases(aliases); err != nil {
+			PrintError("ELFSIZE_ARCH_ALIASES", err)
+			os.Exit(1)
+		}
+	}
+	if limits := os.Getenv("ELFSIZE_LIMITS"); limits != "" {
+		if err := SetLimits(limits); err != nil {
+			PrintError("ELFSIZE_LIMITS", err)
+			os.Exit(1)
+		}
+	}
+
+	os.Exit(run(os.Args[1:]))
+}
+
+// run executes one elfsize command line, without the program name, and
+// returns the exit status. Logging options may precede the subcommand, see
+// takeLogFlags
+func run(args []string) int {
+	args, err := takeLogFlags(args)
+	if err != nil {
+		PrintError("elfsize", err)
+		return 2
+	}
+	if len(args) >= 1 {
+		if cmd, ok := subcommands[args[0]]; ok {
+			return cmd(args[1:])
+		}
+		switch args[0] {
+		case "size":
+			return sizeCommand(args[1:])
+		case "help":
+			return helpCommand(args[1:])
+		case "completion":
+			return completionCommand(args[1:])
+		}
+	}
+	return sizeCommand(args)
+}
+
+// helpCommand implements "elfsize help [subcommand]"
+func helpCommand(args []string) int {
+	if len(args) == 1 {
+		if cmd, ok := subcommands[args[0]]; ok {
+			cmd([]string{"-h"})
+			return 0
+		}
+	}
+	if len(args) > 1 || (len(args) == 1 && args[0] != "size") {
+		fmt.Fprintf(os.Stderr, "USAGE: %s help [subcommand]\n", os.Args[0])
+		return 2
+	}
+	sizeCommand([]string{"-h"})
+	return 0
+}
+
+// printSubcommands lists the subcommands on stderr, wrapped like usage text
+func printSubcommands() {
+	line := "   "
+	for _, name := range commandNames() {
+		if len(line)+1+len(name) > 78 {
+			fmt.Fprintln(os.Stderr, line)
+			line = "   "
+		}
+		line += " " + name
+	}
+	fmt.Fprintln(os.Stderr, line)
+}
+
+// sizeCommand implements the plain "elfsize [options] <file>" invocation
+func sizeCommand(args []string) int {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	showStats := fs.Bool("stats", false, "print resource usage of the run to stderr")
+	quiet := fs.Bool("quiet", false, "do not tell on stderr when the file is larger or smaller than its ELF image")
+	showOSABI := fs.Bool("osabi", false, "print the OS ABI the file is branded for instead of the size")
+	showType := fs.Bool("type", false, "print the file type (exec, pie, shared, rel or core) instead of the size")
+	showAppImage := fs.Bool("appimage-type", false, "print 1 or 2 for type-1 and type-2 AppImages, 0 for other ELF files, instead of the size")
+	showInterp := fs.Bool("interpreter", false, "print the requested dynamic linker instead of the size")
+	showFreeBSD := fs.Bool("freebsd-version", false, "print the FreeBSD release and __FreeBSD_version a FreeBSD binary was built for, e.g. 13.2 and 1302000, instead of the size")
+	showGlibc := fs.Bool("glibc", false, "print the highest GLIBC, GLIBCXX and CXXABI versions required instead of the size")
+	showMemSize := fs.Bool("memsize", false, "print the bytes the PT_LOAD segments take in memory and, after a tab, how many of them are BSS, instead of the size")
+	pageSize := fs.Int64("page-size", 0, "check that the file loads on kernels with pages of this size, e.g. 16384 or 65536, exit with 1 if not")
+	showStripped := fs.Bool("stripped", false, "check that the file has no symbol table or debug info, exit with 1 if it has")
+	showStripSavings := fs.Bool("strip-savings", false, "print the bytes of debug info, .symtab and .strtab and how much stripping would save instead of the size")
+	hasOverlay := fs.Bool("has-overlay", false, "print nothing, exit with 0 if data is appended after the ELF image, 1 if not or only zero padding is, and 2 on errors")
+	showSlack := fs.Bool("slack", false, "print the zero bytes padding the file after the ELF image and, after a tab, the bytes of appended data after them, instead of the size")
+	showJSON := fs.Bool("json", false, "print the summary of the info subcommand as JSON")
+	porcelain := fs.Bool("porcelain", false, "print the summary of the info subcommand as key=value lines whose format is stable across releases")
+	desktopMetadata := fs.Bool("desktop-metadata", false, "print what file managers show for the given files, size, payload size, architecture, AppImage type, icon and signature, as key=value lines whose format is stable across releases")
+	xattr := fs.Bool("xattr", false, "with --desktop-metadata, write the fields to the extended attributes user.elfsize.<key> of the files instead of printing them")
+	formatTemplate := fs.String("format-template", "", "print the summary of the info subcommand through a Go template, e.g. '{{.Path}} {{.Size}} {{.Arch}}'")
+	strategy := fs.String("strategy", "", "define the end of the ELF image by header-end (default), segment-end, section-end or max")
+	showOffset := fs.Bool("offset", false, "print the offset at which a payload is appended, the size rounded up to --align, instead of the size")
+	align := fs.Int64("align", 0, "alignment in bytes of the offset printed by --offset")
+	base := fs.Int64("base", 0, "parse the ELF image starting at this byte of the file, e.g. one found by carve (not --offset, which prints the payload offset)")
+	watch := fs.Bool("watch", false, "print the sizes of the given files and the ELF files in the given directories, then again whenever they change")
+	daemon := fs.String("daemon", "", "answer requests for the JSON summary of files on this Unix socket, one path per line")
+	pid := fs.Int("pid", 0, "print the summary of the info subcommand for the executable of this running process, and whether it is still on disk")
+	batch := fs.String("batch", "", "run the elfsize command lines in this file, or stdin if it is '-', in one process")
+	fs.Func("arch-aliases", "load architecture names from a JSON or TOML file (also $ELFSIZE_ARCH_ALIASES)", LoadArchitectureAliases)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s [size] [options] <path to ELF file>\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "    Print the size of an ELF file in bytes\n")
 		fmt.Fprintf(os.Stderr, "    based on the information in the ELF header\n")
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "    Files inside squashfs and ISO 9660 images, AppImages and zip, tar and\n")
+		fmt.Fprintf(os.Stderr, "    cpio archives can be given as image:path/in/image to every subcommand\n")
+		fmt.Fprintf(os.Stderr, "    that reads them\n")
+		fmt.Fprintf(os.Stderr, "    To parse an ELF image that starts at byte N of a file, such as one\n")
+		fmt.Fprintf(os.Stderr, "    found by carve, use --base N. It is not called --offset, since\n")
+		fmt.Fprintf(os.Stderr, "    --offset already prints the offset to append a payload at\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nUSAGE: %s [log options] <subcommand> [options] <arguments>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Run one of the subcommands below, see '%s help <subcommand>'\n", os.Args[0])
+		printSubcommands()
+		fmt.Fprintf(os.Stderr, "    Log options, also before the plain invocation: -v, --verbose, --debug,\n")
+		fmt.Fprintf(os.Stderr, "    --log-level quiet|normal|verbose|debug, --log-json\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
 	}
 
-	if fileExists(os.Args[1]) != true {
-		fmt.Fprintf(os.Stderr, "%s does not exist, exiting\n", os.Args[1])
-		os.Exit(1)
+	if *showStats {
+		defer PrintStats(os.Stderr)
+	}
+	tmpl, err := parseFormatTemplate(*formatTemplate)
+	if err != nil {
+		PrintError("elfsize", err)
+		return 2
+	}
+	if *batch != "" {
+		return batchCommand(*batch)
+	}
+	if *daemon != "" {
+		return daemonCommand(*daemon)
+	}
+	if *watch {
+		return watchCommand(fs.Args())
+	}
+	if *desktopMetadata {
+		if fs.NArg() < 1 {
+			fs.Usage()
+			return 1
+		}
+		return desktopMetadataCommand(fs.Args(), *xattr)
+	}
+	if *pid != 0 {
+		p, err := GetProcessInfo(*pid)
+		if err != nil {
+			PrintError("elfsize", err)
+			return 1
+		}
+		if *showJSON {
+			out, _ := json.MarshalIndent(p, "", "  ")
+			fmt.Println(string(out))
+		} else {
+			printProcessInfo(p)
+		}
+		return 0
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return 1
 	}
 
-	fmt.Printf("%v\n", CalculateElfSize(os.Args[1]))
+	// Open first and inspect the handle rather than the path, so that the
+	// file cannot be swapped between the existence check and the parse
+	f, err := openFileAt(fs.Arg(0), *base)
+	if os.IsNotExist(err) {
+		logMessage(slog.LevelError, msgNotExist, fs.Arg(0))
+		return 1
+	}
+	if err != nil {
+		PrintError("elfsize", err)
+		return 1
+	}
+	defer f.Close()
 
+	switch {
+	case *hasOverlay:
+		// The end of the image is that printed by plain elfsize and the
+		// overlay subcommand, unless --strategy asks for another
+		size, err := readHeaderEnd(f)
+		if *strategy != "" {
+			size, err = elfSizeWith(*strategy, f)
+		}
+		if err != nil {
+			PrintError("elfsize", err)
+			return 2
+		}
+		stat, err := f.Stat()
+		if err != nil {
+			PrintError("elfsize", err)
+			return 2
+		}
+		end := stat.Size() - appendedSignatureSize(f, size, stat.Size())
+		if end <= size {
+			return 1
+		}
+		slack, err := elfSlack(f, size, end)
+		if err != nil {
+			PrintError("elfsize", err)
+			return 2
+		}
+		if size+slack == end {
+			return 1
+		}
+	case *porcelain:
+		info, err := newElfInfo(fs.Arg(0), f)
+		if err != nil {
+			PrintError("elfsize", err)
+			return 1
+		}
+		if err := writePorcelain(os.Stdout, info); err != nil {
+			PrintError("elfsize", err)
+			return 1
+		}
+	case *showStripSavings:
+		e, err := parseElf(fs.Arg(0), f)
+		if err != nil {
+			PrintError("elfsize elf.NewFile", err)
+			return 1
+		}
+		stat, err := f.Stat()
+		if err != nil {
+			PrintError("elfsize", err)
+			return 1
+		}
+		s := elfStripSavings(e, stat.Size())
+		if *showJSON {
+			out, _ := json.MarshalIndent(s, "", "  ")
+			fmt.Println(string(out))
+			break
+		}
+		fmt.Printf("debug:       %d\n", s.Debug)
+		fmt.Printf("symtab:      %d\n", s.Symtab)
+		fmt.Printf("strtab:      %d\n", s.Strtab)
+		fmt.Println(Tr(msgStripSavings, s.Total, s.Percent))
+	case *showJSON, tmpl != nil:
+		info, err := newFileInfo(fs.Arg(0), f)
+		if err != nil {
+			PrintError("elfsize", err)
+			return 1
+		}
+		if tmpl != nil {
+			if err := tmpl.Execute(os.Stdout, info); err != nil {
+				PrintError("elfsize", err)
+				return 1
+			}
+			break
+		}
+		out, _ := json.MarshalIndent(info, "", "  ")
+		fmt.Println(string(out))
+	case *showOSABI, *showType, *showAppImage, *showInterp:
+		e, err := parseElf(fs.Arg(0), f)
+		if err != nil {
+			PrintError("elfsize elf.NewFile", err)
+			return 1
+		}
+		if *showOSABI {
+			fmt.Println(osabiName(e.OSABI))
+		}
+		if *showType {
+			fmt.Println(elfType(e))
+		}
+		if *showAppImage {
+			fmt.Println(appImageType(f))
+		}
+		if *showInterp {
+			interp, err := elfInterpreter(e)
+			if err != nil {
+				PrintError("elfsize", err)
+				return 1
+			}
+			fmt.Println(interp)
+		}
+	case *showGlibc:
+		e, err := parseElf(fs.Arg(0), f)
+		if err != nil {
+			PrintError("elfsize elf.NewFile", err)
+			return 1
+		}
+		versions, err := maxSymbolVersions(e)
+		if err != nil {
+			PrintError("elfsize", err)
+			return 1
+		}
+		for _, v := range versions {
+			fmt.Println(v)
+		}
+	case *showFreeBSD:
+		e, err := parseElf(fs.Arg(0), f)
+		if err != nil {
+			PrintError("elfsize elf.NewFile", err)
+			return 1
+		}
+		version, err := elfFreeBSDVersion(e)
+		if err != nil {
+			PrintError("elfsize", err)
+			return 1
+		}
+		if version == 0 {
+			logMessage(slog.LevelError, msgNoFreeBSDTag, fs.Arg(0))
+			return 1
+		}
+		fmt.Printf("%s\t%d\n", freeBSDRelease(version), version)
+	case *showSlack:
+		stat, err := f.Stat()
+		if err != nil {
+			PrintError("elfsize", err)
+			return 1
+		}
+		size := calculateElfSize(f)
+		end := stat.Size() - appendedSignatureSize(f, size, stat.Size())
+		var slack int64
+		if size < end {
+			if slack, err = elfSlack(f, size, end); err != nil {
+				PrintError("elfsize", err)
+				return 1
+			}
+		}
+		fmt.Printf("%d\t%d\n", slack, max(end-size, 0)-slack)
+	case *showMemSize:
+		e, err := parseElf(fs.Arg(0), f)
+		if err != nil {
+			PrintError("elfsize elf.NewFile", err)
+			return 1
+		}
+		mem, bss := elfMemSize(e)
+		fmt.Printf("%d\t%d\n", mem, bss)
+	case *pageSize != 0:
+		if *pageSize < 0 || *pageSize&(*pageSize-1) != 0 {
+			logMessage(slog.LevelError, msgBadPageSize, *pageSize)
+			return 2
+		}
+		e, err := parseElf(fs.Arg(0), f)
+		if err != nil {
+			PrintError("elfsize elf.NewFile", err)
+			return 1
+		}
+		if !elfLoadsWithPageSize(e, uint64(*pageSize)) {
+			fmt.Println(Tr(msgPageSizeBad, *pageSize, elfLoadAlign(e)))
+			return 1
+		}
+		fmt.Println(Tr(msgPageSizeOK, *pageSize))
+	case *showStripped:
+		e, err := parseElf(fs.Arg(0), f)
+		if err != nil {
+			PrintError("elfsize elf.NewFile", err)
+			return 1
+		}
+		debug := elfDebugInfo(e)
+		if !debug.Stripped() {
+			fmt.Println(Tr(msgNotStripped, strings.Join(debug.Sections(), " ")))
+			return 1
+		}
+		fmt.Println(Tr(msgStripped))
+	case *showOffset:
+		name := *strategy
+		if name == "" {
+			name = "header-end"
+		}
+		if *align < 0 {
+			logMessage(slog.LevelError, msgBadAlignment, *align)
+			return 2
+		}
+		if err := offsetWithStrategy(name, f, *align); err != nil {
+			PrintError("elfsize", err)
+			return 1
+		}
+	case *strategy != "":
+		if err := sizeWithStrategy(*strategy, f); err != nil {
+			PrintError("elfsize", err)
+			return 1
+		}
+	case isMachO(f):
+		info, err := newMachOInfo(fs.Arg(0), f)
+		if err != nil {
+			PrintError("elfsize", err)
+			return 1
+		}
+		fmt.Println(info.Size)
+	case isPE(f):
+		info, err := newPEInfo(fs.Arg(0), f)
+		if err != nil {
+			PrintError("elfsize", err)
+			return 1
+		}
+		fmt.Println(info.Size)
+	default:
+		size := calculateElfSize(f)
+		fmt.Printf("%v\n", size)
+		if !*quiet {
+			sizeNotice(fs.Arg(0), f, size)
+		}
+	}
+	return 0
 }
 
-func fileExists(filename string) bool {
-	info, err := os.Stat(filename)
-	if os.IsNotExist(err) {
-		return false
+// sizeNotice tells if the size of a file differs from that of its
+// ELF image, which usually is the most interesting thing about it: an
+// AppImage payload, hidden data, padding or a truncated download
+func sizeNotice(path string, f *inputFile, size int64) {
+	stat, err := f.Stat()
+	if err != nil || size == 0 || size == stat.Size() {
+		return
+	}
+	if size > stat.Size() {
+		logMessage(slog.LevelWarn, msgSizeTruncated, path, size, stat.Size())
+		return
 	}
-	return !info.IsDir()
+	if slack, err := elfSlack(f, size, stat.Size()); err == nil && size+slack == stat.Size() {
+		logMessage(slog.LevelInfo, msgSizePadding, path, slack)
+		return
+	}
+	logMessage(slog.LevelInfo, msgSizeAppended, path, stat.Size()-size, size)
 }
 
-// PrintError prints error, prefixed by a string that explains the context
+// parseArgs parses flags that may appear anywhere between the positional
+// arguments of a subcommand and returns the positional arguments
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// PrintError logs error, prefixed by a string that explains the context
 func PrintError(context string, e error) {
 	if e != nil {
-		os.Stderr.WriteString("ERROR " + context + ": " + e.Error() + "\n")
+		logger.Error(Tr(msgError, context, e.Error()), "id", string(msgError), "context", context, "error", e.Error())
 	}
 }
 
-// GetSectionData returns the contents of an ELF section and error
+// printWarning logs an error that elfsize works around, prefixed by a
+// string that explains the context
+func printWarning(context string, e error) {
+	if e != nil {
+		logger.Warn(Tr(msgWarning, context, e.Error()), "id", string(msgWarning), "context", context, "error", e.Error())
+	}
+}
+
+// GetSectionData returns the contents of an ELF section and error. If no
+// section is called name, it is used as a glob pattern and the first match is
+// returned; see GetMatchingSections for all of them. Compressed sections, as
+// written by -gz, are returned decompressed; see GetRawSectionData.
+// If there is no such section, the error wraps ErrSectionNotFound
 func GetSectionData(filepath string, name string) ([]byte, error) {
+	return getSectionData(filepath, name, false)
+}
+
+// GetRawSectionData is like GetSectionData, but returns the bytes as stored
+// in the file, including the headers of compressed sections
+func GetRawSectionData(filepath string, name string) ([]byte, error) {
+	return getSectionData(filepath, name, true)
+}
+
+func getSectionData(filepath string, name string, raw bool) ([]byte, error) {
 	// fmt.Println("GetSectionData for '" + name + "'")
-	r, err := os.Open(filepath)
-	if err == nil {
-		defer r.Close()
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return nil, err
 	}
-	f, err := elf.NewFile(r)
+	section, err := findSection(f, name)
 	if err != nil {
 		return nil, err
 	}
-	section := f.Section(name)
 	if section == nil {
-		return nil, nil
+		return nil, sectionNotFound(filepath, name)
 	}
-	data, err := section.Data()
+	data, err := readSection(r, section, raw)
 	if err != nil {
 		return nil, err
 	}
 	return data, nil
 }
 
-// GetSectionOffsetAndLength returns the Offset and Length of an ELF section and error
+// GetSectionOffsetAndLength returns the Offset and Length of an ELF section and error.
+// Like GetSectionData, it falls back to matching name as a glob pattern and
+// returns an error wrapping ErrSectionNotFound if there is no match
 func GetSectionOffsetAndLength(filepath string, name string) (uint64, uint64, error) {
-	r, err := os.Open(filepath)
-	if err == nil {
-		defer r.Close()
+	r, err := openFile(filepath)
+	if err != nil {
+		return 0, 0, err
 	}
-	f, err := elf.NewFile(r)
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return 0, 0, err
+	}
+	section, err := findSection(f, name)
 	if err != nil {
 		return 0, 0, err
 	}
-	section := f.Section(name)
 	if section == nil {
-		return 0, 0, nil
+		return 0, 0, sectionNotFound(filepath, name)
+	}
+	return section.Offset, section.Size, nil
+}
+
+// GetSectionDataByIndex is GetSectionData for the section at index in the
+// section header table, for sections with empty or duplicate names. Index 0
+// is the null section. If there is no such section, the error wraps
+// ErrSectionNotFound
+func GetSectionDataByIndex(filepath string, index int) ([]byte, error) {
+	return getSectionDataByIndex(filepath, index, false)
+}
+
+// GetRawSectionDataByIndex is GetRawSectionData for the section at index
+func GetRawSectionDataByIndex(filepath string, index int) ([]byte, error) {
+	return getSectionDataByIndex(filepath, index, true)
+}
+
+func getSectionDataByIndex(filepath string, index int, raw bool) ([]byte, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return nil, err
+	}
+	section, err := sectionByIndex(filepath, f, index)
+	if err != nil {
+		return nil, err
+	}
+	return readSection(r, section, raw)
+}
+
+// GetSectionOffsetAndLengthByIndex is GetSectionOffsetAndLength for the
+// section at index
+func GetSectionOffsetAndLengthByIndex(filepath string, index int) (uint64, uint64, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return 0, 0, err
+	}
+	section, err := sectionByIndex(filepath, f, index)
+	if err != nil {
+		return 0, 0, err
 	}
 	return section.Offset, section.Size, nil
 }
 
+// sectionByIndex returns the section at index of a file, or an error
+// wrapping ErrSectionNotFound
+func sectionByIndex(filepath string, f *elf.File, index int) (*elf.Section, error) {
+	if index < 0 || index >= len(f.Sections) {
+		return nil, sectionNotFound(filepath, fmt.Sprintf("#%d", index))
+	}
+	return f.Sections[index], nil
+}
+
 // GetElfArchitecture returns the architecture of a file, and err
 func GetElfArchitecture(filepath string) (string, error) {
-	r, err := os.Open(filepath)
-	if err == nil {
-		defer r.Close()
+	r, err := openFile(filepath)
+	if err != nil {
+		return "", err
 	}
-	f, err := elf.NewFile(r)
+	defer r.Close()
+	f, err := parseElf(filepath, r)
 	if err != nil {
 		return "", err
 	}
+	return elfArchitecture(f), nil
+}
+
+// archCommand implements "elfsize arch <file>"
+func archCommand(args []string) int {
+	fs := flag.NewFlagSet("arch", flag.ContinueOnError)
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Func("arch-aliases", "load architecture names from a JSON or TOML file (also $ELFSIZE_ARCH_ALIASES)", LoadArchitectureAliases)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s arch <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the architecture of an ELF file, e.g. x86_64 or aarch64\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	arch, err := GetElfArchitecture(positional[0])
+	if err != nil {
+		PrintError("arch", err)
+		return 1
+	}
+	fmt.Println(arch)
+	return 0
+}
+
+// elfArchitecture returns the architecture name of a parsed ELF file
+func elfArchitecture(f *elf.File) string {
+	if alias, ok := ArchitectureAliases[f.Machine]; ok {
+		return alias
+	}
 	arch := f.Machine.String()
 	// Why does everyone name architectures differently?
 	switch arch {
@@ -104,8 +728,47 @@ func GetElfArchitecture(filepath string) (string, error) {
 		arch = "armhf"
 	case "EM_AARCH64":
 		arch = "aarch64"
+	case "EM_RISCV":
+		arch = "riscv64"
+		if f.Class == elf.ELFCLASS32 {
+			arch = "riscv32"
+		}
+	case "EM_PPC":
+		arch = "powerpc"
+	case "EM_PPC64":
+		arch = "ppc64"
+		if f.ByteOrder == binary.LittleEndian {
+			arch = "ppc64le"
+		}
+	case "EM_S390":
+		arch = "s390x"
+		if f.Class == elf.ELFCLASS32 {
+			arch = "s390"
+		}
+	case "EM_MIPS":
+		arch = "mips"
+		if f.Class == elf.ELFCLASS64 {
+			arch = "mips64"
+		}
+		if f.ByteOrder == binary.LittleEndian {
+			arch += "el"
+		}
+	case "EM_LOONGARCH":
+		arch = "loongarch64"
+		if f.Class == elf.ELFCLASS32 {
+			arch = "loongarch32"
+		}
+	default:
+		// Fall back to the lowercase constant name without the EM_ prefix,
+		// e.g. "EM_SPARCV9" becomes "sparcv9". Machines unknown to debug/elf
+		// stringify as a bare number, so label those explicitly
+		if strings.HasPrefix(arch, "EM_") {
+			arch = strings.ToLower(strings.TrimPrefix(arch, "EM_"))
+		} else {
+			arch = "unknown-" + arch
+		}
 	}
-	return arch, nil
+	return arch
 }
 
 // CalculateElfSize returns the size of an ELF binary as an int64 based on the information in the ELF header
@@ -113,85 +776,79 @@ func CalculateElfSize(file string) int64 {
 
 	// Open given elf file
 
-	f, err := os.Open(file)
+	f, err := openFile(file)
 	PrintError("ioReader", err)
-	// defer f.Close()
 	if err != nil {
 		return 0
 	}
+	defer f.Close()
 
-	_, err = f.Stat()
-	PrintError("ioReader", err)
-	if err != nil {
-		return 0
-	}
+	return calculateElfSize(f)
+}
 
-	e, err := elf.NewFile(f)
+// calculateElfSize does the work of CalculateElfSize on an already opened file.
+// It reads nothing but the ELF header
+func calculateElfSize(f io.ReaderAt) int64 {
+	size, err := readHeaderEnd(f)
 	if err != nil {
-		PrintError("elfsize elf.NewFile", err)
+		PrintError("elfsize", err)
 		return 0
 	}
+	return size
+}
 
-	// Read identifier
-	var ident [16]uint8
-	_, err = f.ReadAt(ident[0:], 0)
-	if err != nil {
-		PrintError("elfsize read identifier", err)
-		return 0
+// readHeaderEnd returns the end of the section header table like headerEnd,
+// but from the ELF header alone, without parsing the file with elf.NewFile,
+// which reads all section headers and the section name table. Core dumps
+// have no section headers and end with their last segment
+func readHeaderEnd(r io.ReaderAt) (int64, error) {
+	var hdr [64]byte
+	n, err := r.ReadAt(hdr[:], 0)
+	if err != nil && err != io.EOF {
+		return 0, err
 	}
-
-	// Decode identifier
-	if ident[0] != '\x7f' ||
-		ident[1] != 'E' ||
-		ident[2] != 'L' ||
-		ident[3] != 'F' {
-		fmt.Fprintf(os.Stderr, "Bad magic number at %d\n", ident[0:4])
-		return 0
+	if n < 4 || string(hdr[:4]) != elf.ELFMAG {
+		return 0, withKind(ErrNotELF, errors.New(Tr(msgBadMagic, hdr[:4])))
 	}
-
-	// Process by architecture
-	sr := io.NewSectionReader(f, 0, 1<<63-1)
-	var shoff, shentsize, shnum int64
-	switch e.Class.String() {
-	case "ELFCLASS64":
-		hdr := new(elf.Header64)
-		_, err = sr.Seek(0, 0)
-		if err != nil {
-			PrintError("elfsize", err)
-			return 0
-		}
-		err = binary.Read(sr, e.ByteOrder, hdr)
-		if err != nil {
-			PrintError("elfsize", err)
-			return 0
-		}
-
-		shoff = int64(hdr.Shoff)
-		shnum = int64(hdr.Shnum)
-		shentsize = int64(hdr.Shentsize)
-	case "ELFCLASS32":
-		hdr := new(elf.Header32)
-		_, err = sr.Seek(0, 0)
-		if err != nil {
-			PrintError("elfsize", err)
-			return 0
+	if n < elf.EI_NIDENT {
+		return 0, withKind(ErrTruncated, io.ErrUnexpectedEOF)
+	}
+	var order binary.ByteOrder
+	switch elf.Data(hdr[elf.EI_DATA]) {
+	case elf.ELFDATA2LSB:
+		order = binary.LittleEndian
+	case elf.ELFDATA2MSB:
+		order = binary.BigEndian
+	default:
+		return 0, withKind(ErrUnsupportedClass, errors.New(Tr(msgUnsupportedEncoding, hdr[elf.EI_DATA])))
+	}
+	if elf.Type(order.Uint16(hdr[16:])) == elf.ET_CORE {
+		return coreSize(r)
+	}
+	switch elf.Class(hdr[elf.EI_CLASS]) {
+	case elf.ELFCLASS64:
+		if n < 64 {
+			return 0, withKind(ErrTruncated, io.ErrUnexpectedEOF)
 		}
-		err = binary.Read(sr, e.ByteOrder, hdr)
-		if err != nil {
-			PrintError("elfsize", err)
-			return 0
+		// e_shoff at 40, e_shentsize and e_shnum at 58 and 60
+		return sectionTableEnd(order.Uint64(hdr[40:]), order.Uint16(hdr[58:]), order.Uint16(hdr[60:]))
+	case elf.ELFCLASS32:
+		if n < 52 {
+			return 0, withKind(ErrTruncated, io.ErrUnexpectedEOF)
 		}
-
-		shoff = int64(hdr.Shoff)
-		shnum = int64(hdr.Shnum)
-		shentsize = int64(hdr.Shentsize)
-	default:
-		fmt.Fprintf(os.Stderr, "unsupported elf architecture")
-		return 0
+		// e_shoff at 32, e_shentsize and e_shnum at 46 and 48
+		return sectionTableEnd(uint64(order.Uint32(hdr[32:])), order.Uint16(hdr[46:]), order.Uint16(hdr[48:]))
 	}
+	return 0, ErrUnsupportedClass
+}
 
-	// Calculate ELF size
-	elfsize := shoff + (shentsize * shnum)
-	// log.Println("elfsize:", elfsize, file)
-	return elfsize
+// sectionTableEnd returns the end of a section header table of shnum
+// entries of shentsize bytes at shoff, or an error if it does not fit in an
+// int64, as in crafted files
+func sectionTableEnd(shoff uint64, shentsize, shnum uint16) (int64, error) {
+	length := uint64(shentsize) * uint64(shnum)
+	if shoff > math.MaxInt64-length {
+		return 0, errors.New(Tr(msgCorruptHeader, shoff, shnum, shentsize))
+	}
+	return int64(shoff + length), nil
 }
@@ -0,0 +1,783 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// messageID identifies a user-facing diagnostic in the message catalog.
+// IDs never change once released, so they double as machine-readable codes
+type messageID string
+
+// Message IDs
+const (
+	msgError                messageID = "error"
+	msgNotExist             messageID = "not-exist"
+	msgNotRegular           messageID = "not-regular"
+	msgNotELF               messageID = "not-elf"
+	msgBadMagic             messageID = "bad-magic"
+	msgUnsupportedClass     messageID = "unsupported-class"
+	msgNoElfSize            messageID = "no-elf-size"
+	msgTruncated            messageID = "truncated"
+	msgUnknownOSABI         messageID = "unknown-osabi"
+	msgNoIcon               messageID = "no-icon"
+	msgBadIcon              messageID = "bad-icon"
+	msgNoBuildID            messageID = "no-build-id"
+	msgUnknownStrategy      messageID = "unknown-strategy"
+	msgNotGoBinary          messageID = "not-go-binary"
+	msgNotSquashfs          messageID = "not-squashfs"
+	msgBadSquashfs          messageID = "bad-squashfs"
+	msgPayloadTruncated     messageID = "payload-truncated"
+	msgPayloadPadded        messageID = "payload-padded"
+	msgShortSection         messageID = "short-section"
+	msgSectionTooLarge      messageID = "section-too-large"
+	msgSectionNotFound      messageID = "section-not-found"
+	msgSectionNotWritable   messageID = "section-not-writable"
+	msgSectionTooSmall      messageID = "section-too-small"
+	msgNoPayload            messageID = "no-payload"
+	msgNoDesktopEntry       messageID = "no-desktop-entry"
+	msgTruncatedHeader      messageID = "truncated-header"
+	msgOutOfBounds          messageID = "out-of-bounds"
+	msgNoDynamic            messageID = "no-dynamic"
+	msgUnmappedAddress      messageID = "unmapped-address"
+	msgHasOverlay           messageID = "has-overlay"
+	msgNoSpareHeader        messageID = "no-spare-header"
+	msgCannotMoveDynamic    messageID = "cannot-move-dynamic"
+	msgNoInterpreter        messageID = "no-interpreter"
+	msgStripped             messageID = "stripped"
+	msgNotStripped          messageID = "not-stripped"
+	msgBatchLine            messageID = "batch-line"
+	msgUnterminatedQuote    messageID = "unterminated-quote"
+	msgRuntimeTrailing      messageID = "runtime-trailing-data"
+	msgRuntimeTooLarge      messageID = "runtime-too-large"
+	msgRuntimeNoMagic       messageID = "runtime-no-magic"
+	msgRuntimeNoSection     messageID = "runtime-no-section"
+	msgRuntimeMissingLib    messageID = "runtime-missing-library"
+	msgPackedUPX            messageID = "packed-upx"
+	msgPackedLayout         messageID = "packed-layout"
+	msgPackedEntropy        messageID = "packed-entropy"
+	msgNoSectionHeaders     messageID = "no-section-headers"
+	msgSectionExists        messageID = "section-exists"
+	msgSectionInUse         messageID = "section-in-use"
+	msgBadUpdateInfo        messageID = "bad-update-info"
+	msgNoSignature          messageID = "no-signature"
+	msgNoSignatureKey       messageID = "no-signature-key"
+	msgUnsupportedSignature messageID = "unsupported-signature"
+	msgSignatureKeyMismatch messageID = "signature-key-mismatch"
+	msgBadSignature         messageID = "bad-signature"
+	msgBadAlignment         messageID = "bad-alignment"
+	msgSquashfsCompression  messageID = "squashfs-compression"
+	msgBadBlockSize         messageID = "bad-block-size"
+	msgNotArchive           messageID = "not-archive"
+	msgBadArchive           messageID = "bad-archive"
+	msgDecompressFailed     messageID = "decompress-failed"
+	msgModuleTooLarge       messageID = "module-too-large"
+	msgBadOffset            messageID = "bad-offset"
+	msgUnknownFormat        messageID = "unknown-format"
+	msgPorcelainELF         messageID = "porcelain-elf"
+	msgSocketInUse          messageID = "socket-in-use"
+	msgUnknownHash          messageID = "unknown-hash"
+	msgUnsupportedEncoding  messageID = "unsupported-encoding"
+	msgNoProcesses          messageID = "no-processes"
+	msgNoProcfs             messageID = "no-procfs"
+	msgPageSizeOK           messageID = "page-size-ok"
+	msgPageSizeBad          messageID = "page-size-bad"
+	msgBadPageSize          messageID = "bad-page-size"
+	msgNoKernel             messageID = "no-kernel"
+	msgNoFreeBSDTag         messageID = "no-freebsd-tag"
+	msgNoSectionTable       messageID = "no-section-table"
+	msgNothingToRepair      messageID = "nothing-to-repair"
+	msgLintPhdrsEOF         messageID = "program-headers-past-eof"
+	msgLintShdrsEOF         messageID = "section-headers-past-eof"
+	msgLintPhentsize        messageID = "bad-phentsize"
+	msgLintShentsize        messageID = "bad-shentsize"
+	msgLintShstrndx         messageID = "shstrndx-out-of-range"
+	msgLintShstrtab         messageID = "shstrndx-not-strtab"
+	msgLintSectionEOF       messageID = "section-past-eof"
+	msgLintSectionOverlap   messageID = "sections-overlap"
+	msgLintSectionLink      messageID = "section-link-out-of-range"
+	msgLintSegmentEOF       messageID = "segment-past-eof"
+	msgLintLoadOrder        messageID = "load-segments-unordered"
+	msgLintAfterLoad        messageID = "segment-after-load"
+	msgLintMultipleInterp   messageID = "multiple-interp"
+	msgLintEmptyLoad        messageID = "empty-load-segment"
+	msgLintMemsz            messageID = "memsz-below-filesz"
+	msgLintAlign            messageID = "bad-segment-alignment"
+	msgLintMisaligned       messageID = "segment-misaligned"
+	msgLimitExceeded        messageID = "limit-exceeded"
+	msgTooManySections      messageID = "too-many-sections"
+	msgTooManySegments      messageID = "too-many-segments"
+	msgTooMuchRead          messageID = "too-much-read"
+	msgBadLimits            messageID = "bad-limits"
+	msgBadFilter            messageID = "bad-filter"
+	msgFilterString         messageID = "filter-string"
+	msgFilterNumber         messageID = "filter-number"
+	msgFilterUnexpected     messageID = "filter-unexpected"
+	msgFilterEnd            messageID = "filter-end"
+	msgFilterTypes          messageID = "filter-types"
+	msgFilterOperator       messageID = "filter-operator"
+	msgFilterField          messageID = "filter-field"
+	msgUnknownSortKey       messageID = "unknown-sort-key"
+	msgGapsTotal            messageID = "gaps-total"
+	msgSizeAppended         messageID = "size-appended"
+	msgSizePadding          messageID = "size-padding"
+	msgSizeTruncated        messageID = "size-truncated"
+	msgStripSavings         messageID = "strip-savings"
+	msgBadDebugLink         messageID = "bad-debuglink"
+	msgNoDebugLink          messageID = "no-debuglink"
+	msgDebugFileNotFound    messageID = "debug-file-not-found"
+	msgDebugFileCRC         messageID = "debug-file-crc"
+	msgLogLevel             messageID = "log-level"
+	msgWarning              messageID = "warning"
+	msgCacheHit             messageID = "cache-hit"
+	msgSkipNotELF           messageID = "skip-not-elf"
+	msgScanning             messageID = "scanning"
+	msgNotAnELF             messageID = "not-an-elf"
+	msgFileTruncated        messageID = "file-truncated"
+	msgSegmentsEnd          messageID = "segments-end"
+	msgTextRel              messageID = "text-rel"
+	msgUnknownEncoding      messageID = "unknown-encoding"
+	msgDryRunPatches        messageID = "dry-run-patches"
+	msgBadTarget            messageID = "bad-target"
+	msgTargetMachine        messageID = "target-machine"
+	msgTargetClass          messageID = "target-class"
+	msgTargetByteOrder      messageID = "target-byte-order"
+	msgTargetFloatABI       messageID = "target-float-abi"
+	msgTargetOSABI          messageID = "target-osabi"
+	msgTargetBuiltFor       messageID = "target-built-for"
+	msgTargetTooOld         messageID = "target-too-old"
+	msgTargetCanRun         messageID = "target-can-run"
+	msgHostNoELF            messageID = "host-no-elf"
+	msgHereNoInterpreter    messageID = "here-no-interpreter"
+	msgHereMissingLibrary   messageID = "here-missing-library"
+	msgAppDirMixed          messageID = "appdir-mixed"
+	msgAppDirTotal          messageID = "appdir-total"
+	msgNotAnImage           messageID = "not-an-image"
+	msgImageReadOnly        messageID = "image-read-only"
+	msgBudgetExceeded       messageID = "budget-exceeded"
+	msgBudgetOK             messageID = "budget-ok"
+	msgSizeRegressions      messageID = "size-regressions"
+	msgTotalGrowth          messageID = "total-growth"
+	msgHeaderField          messageID = "header-field"
+	msgHeaderValue          messageID = "header-value"
+	msgHeaderValueRange     messageID = "header-value-range"
+	msgHeaderEntsize        messageID = "header-entsize"
+	msgHeaderTableOutside   messageID = "header-table-outside"
+	msgHeaderShstrndx       messageID = "header-shstrndx"
+	msgHeaderNotWritten     messageID = "header-not-written"
+	msgNoToolchain          messageID = "no-toolchain"
+	msgReproDate            messageID = "repro-date"
+	msgReproTime            messageID = "repro-time"
+	msgReproTimestamp       messageID = "repro-timestamp"
+	msgReproSourcePath      messageID = "repro-source-path"
+	msgReproBuildDir        messageID = "repro-build-dir"
+	msgReproCompDir         messageID = "repro-comp-dir"
+	msgReproTrimpath        messageID = "repro-trimpath"
+	msgReproBuildID         messageID = "repro-build-id"
+	msgBadSBOMFormat        messageID = "bad-sbom-format"
+	msgNoXattr              messageID = "no-xattr"
+	msgNotStreamArchive     messageID = "not-stream-archive"
+	msgBadCpioHeader        messageID = "bad-cpio-header"
+	msgMemberTooLarge       messageID = "member-too-large"
+	msgBadDigest            messageID = "bad-digest"
+	msgNotOCIImage          messageID = "not-oci-image"
+	msgOCISummary           messageID = "oci-summary"
+	msgNotPackage           messageID = "not-package"
+	msgBadPackageManifest   messageID = "bad-package-manifest"
+	msgPathsDisabled        messageID = "paths-disabled"
+	msgNoPathGiven          messageID = "no-path-given"
+	msgOutsideRoot          messageID = "outside-root"
+	msgNoFilePart           messageID = "no-file-part"
+	msgListening            messageID = "listening"
+	msgCorruptHeader        messageID = "corrupt-header"
+	msgBadSectionLink       messageID = "bad-section-link"
+	msgOutputRequired       messageID = "output-required"
+	msgNotInBaseline        messageID = "not-in-baseline"
+	msgSelfSigned           messageID = "self-signed"
+	msgNoTrustedKey         messageID = "no-trusted-key"
+	msgSignatureTrusted     messageID = "signature-trusted"
+	msgSignatureUnverified  messageID = "signature-unverified"
+	msgISONoPVD             messageID = "iso-no-pvd"
+	msgISOBlockSize         messageID = "iso-block-size"
+	msgISORootRecord        messageID = "iso-root-record"
+	msgAtLine               messageID = "at-line"
+	msgExpectedYAMLPair     messageID = "expected-yaml-pair"
+	msgLimitOutsideGlob     messageID = "limit-outside-glob"
+	msgUnknownBudgetLimit   messageID = "unknown-budget-limit"
+	msgNoBudgetLimit        messageID = "no-budget-limit"
+	msgInvalidSize          messageID = "invalid-size"
+	msgSnapshotVersion      messageID = "snapshot-version"
+	msgUnknownSizeField     messageID = "unknown-size-field"
+	msgInvalidPercentage    messageID = "invalid-percentage"
+	msgUnknownMachine       messageID = "unknown-machine"
+	msgExpectedTOMLPair     messageID = "expected-toml-pair"
+	msgTOMLUnquoted         messageID = "toml-unquoted"
+	msgPhdrTableSize        messageID = "phdr-table-size"
+	msgShdrTableSize        messageID = "shdr-table-size"
+	msgUnknownCopyRegion    messageID = "unknown-copy-region"
+	msgCacheMalformed       messageID = "cache-malformed"
+	msgSameFile             messageID = "same-file"
+	msgScanCacheRemote      messageID = "scan-cache-remote"
+	msgCacheStale           messageID = "cache-stale"
+	msgRpathEmpty           messageID = "rpath-empty"
+	msgRpathRelative        messageID = "rpath-relative"
+	msgRpathAbsolute        messageID = "rpath-absolute"
+
+	msgDesktopBadGroup       messageID = "desktop-bad-group"
+	msgDesktopFirstGroup     messageID = "desktop-first-group"
+	msgDesktopOutsideGroup   messageID = "desktop-outside-group"
+	msgDesktopBadLine        messageID = "desktop-bad-line"
+	msgDesktopBadKey         messageID = "desktop-bad-key"
+	msgDesktopDuplicateKey   messageID = "desktop-duplicate-key"
+	msgDesktopBoolean        messageID = "desktop-boolean"
+	msgDesktopRead           messageID = "desktop-read"
+	msgDesktopNoEntry        messageID = "desktop-no-entry"
+	msgDesktopMissingKey     messageID = "desktop-missing-key"
+	msgDesktopMissingExec    messageID = "desktop-missing-exec"
+	msgDesktopMissingURL     messageID = "desktop-missing-url"
+	msgDesktopUnknownType    messageID = "desktop-unknown-type"
+	msgDesktopMissingIcon    messageID = "desktop-missing-icon"
+	msgDesktopIconPath       messageID = "desktop-icon-path"
+	msgDesktopIconExtension  messageID = "desktop-icon-extension"
+	msgDesktopCategories     messageID = "desktop-categories"
+	msgDesktopExecEmpty      messageID = "desktop-exec-empty"
+	msgDesktopExecTrailing   messageID = "desktop-exec-trailing-percent"
+	msgDesktopExecDeprecated messageID = "desktop-exec-deprecated-code"
+	msgDesktopExecInvalid    messageID = "desktop-exec-invalid-code"
+	msgDesktopExecQuotes     messageID = "desktop-exec-quotes"
+	msgDesktopExecFiles      messageID = "desktop-exec-multiple-files"
+)
+
+// catalog holds the format strings of every message per language.
+// English is complete and is used for anything missing in a translation
+var catalog = map[string]map[messageID]string{
+	"en": {
+		msgError:                "ERROR %s: %s",
+		msgNotExist:             "%s does not exist, exiting",
+		msgNotRegular:           "not a regular file",
+		msgNotELF:               "%s is not an ELF file",
+		msgBadMagic:             "Bad magic number at %d",
+		msgUnsupportedClass:     "unsupported elf architecture",
+		msgNoElfSize:            "could not determine the ELF size of %s",
+		msgTruncated:            "%s is truncated: ELF size %d exceeds file size %d",
+		msgUnknownOSABI:         "unknown OS ABI %q",
+		msgNoIcon:               "%s has no embedded icon",
+		msgBadIcon:              "section %s does not contain a PNG or SVG image",
+		msgNoBuildID:            "%s has no GNU build-id",
+		msgUnknownStrategy:      "unknown size strategy %q, expected one of %s",
+		msgNotGoBinary:          "%s is not a Go binary or has no build information",
+		msgNotSquashfs:          "no squashfs superblock at offset %d",
+		msgBadSquashfs:          "unsupported or corrupt squashfs superblock at offset %d",
+		msgPayloadTruncated:     "payload claims %d bytes but only %d follow its offset, the file is truncated",
+		msgPayloadPadded:        "%d bytes follow the payload beyond its recorded size",
+		msgShortSection:         "section %s is shorter than its recorded size",
+		msgSectionTooLarge:      "section %s has %d bytes, more than the limit of %d",
+		msgSectionNotFound:      "section not found",
+		msgSectionNotWritable:   "section %s has no contents that could be replaced in place",
+		msgSectionTooSmall:      "section %s holds %d bytes, %d do not fit",
+		msgNoPayload:            "%s does not carry a filesystem image",
+		msgNoDesktopEntry:       "%s has no top-level desktop entry",
+		msgTruncatedHeader:      "file is too short for an ELF header",
+		msgOutOfBounds:          "structure at offset %d extends past the end of the file",
+		msgNoDynamic:            "file has no dynamic section",
+		msgUnmappedAddress:      "address 0x%x is not in any loaded segment",
+		msgHasOverlay:           "file has %d bytes appended after the ELF image",
+		msgNoSpareHeader:        "no program header that could be turned into a new segment, and no room for a larger program header table",
+		msgCannotMoveDynamic:    "the dynamic section cannot be moved on this architecture",
+		msgNoInterpreter:        "%s has no PT_INTERP segment",
+		msgStripped:             "stripped",
+		msgNotStripped:          "not stripped: %s",
+		msgBatchLine:            "batch %s:%d",
+		msgUnterminatedQuote:    "unterminated quote",
+		msgRuntimeTrailing:      "%d bytes of trailing data after the ELF image",
+		msgRuntimeTooLarge:      "%d bytes exceed the limit of %d bytes",
+		msgRuntimeNoMagic:       "AppImage magic 'AI\\x02' missing at offset 8",
+		msgRuntimeNoSection:     "reserved section %s is missing",
+		msgRuntimeMissingLib:    "library %s needed by %s not found",
+		msgPackedUPX:            "UPX signature found in the headers",
+		msgPackedLayout:         "only %d sections and %d loadable segments",
+		msgPackedEntropy:        "entropy of %.2f bits per byte suggests compressed contents",
+		msgNoSectionHeaders:     "%s has no section header table",
+		msgSectionExists:        "section %s already exists",
+		msgSectionInUse:         "section %s is still used by %s",
+		msgBadUpdateInfo:        "unknown update information type %q, expected one of %s",
+		msgNoSignature:          "%s carries no signature",
+		msgNoSignatureKey:       "%s carries no public key, pass one with --key",
+		msgUnsupportedSignature: "unsupported signature format",
+		msgSignatureKeyMismatch: "the signature was made with a different key",
+		msgBadSignature:         "signature is not valid",
+		msgBadAlignment:         "invalid alignment %d",
+		msgSquashfsCompression:  "squashfs images compressed with %s are not supported, only gzip, xz and zstd",
+		msgBadBlockSize:         "block size %d is not a power of two",
+		msgNotArchive:           "not an ar archive",
+		msgBadArchive:           "malformed ar member header at offset %d",
+		msgDecompressFailed:     "cannot decompress with %s: %v",
+		msgModuleTooLarge:       "module inflates to more than %d bytes",
+		msgBadOffset:            "offset %d is outside the file of %d bytes",
+		msgUnknownFormat:        "unknown output format %q",
+		msgPorcelainELF:         "--porcelain supports ELF files only",
+		msgSocketInUse:          "another process is listening on %s",
+		msgUnknownHash:          "unknown digest %q, choose one of %s",
+		msgUnsupportedEncoding:  "unsupported ELF data encoding %d",
+		msgNoProcesses:          "cannot inspect processes on %s",
+		msgNoProcfs:             "cannot find the executable of process %d, is procfs mounted on /proc? %v",
+		msgPageSizeOK:           "loadable on kernels with %d byte pages",
+		msgPageSizeBad:          "not loadable on kernels with %d byte pages, the PT_LOAD segments are aligned to %d bytes",
+		msgBadPageSize:          "page size must be a power of two, not %d",
+		msgNoKernel:             "%s contains no compressed ELF kernel",
+		msgNoFreeBSDTag:         "%s has no FreeBSD ABI tag",
+		msgNoSectionTable:       "no intact section header table found in %s",
+		msgNothingToRepair:      "the section header fields of %s are intact",
+		msgLintPhdrsEOF:         "the program header table extends to %d, past the end of the file at %d",
+		msgLintShdrsEOF:         "the section header table extends to %d, past the end of the file at %d",
+		msgLintPhentsize:        "e_phentsize is %d instead of %d",
+		msgLintShentsize:        "e_shentsize is %d instead of %d",
+		msgLintShstrndx:         "e_shstrndx %d is out of range for %d sections",
+		msgLintShstrtab:         "e_shstrndx %d is not a string table",
+		msgLintSectionEOF:       "section %s extends to %d, past the end of the file at %d",
+		msgLintSectionOverlap:   "sections %s and %s overlap at %d",
+		msgLintSectionLink:      "section %s links to section %d of %d",
+		msgLintSegmentEOF:       "segment %d (%s) extends to %d, past the end of the file at %d",
+		msgLintLoadOrder:        "PT_LOAD segment %d at %#x follows one at %#x",
+		msgLintAfterLoad:        "%s segment %d follows a PT_LOAD segment",
+		msgLintMultipleInterp:   "there are %d PT_INTERP segments",
+		msgLintEmptyLoad:        "PT_LOAD segment %d has a memory size of 0",
+		msgLintMemsz:            "segment %d has a file size of %d but a memory size of %d",
+		msgLintAlign:            "segment %d has a p_align of %d, which is not a power of two",
+		msgLintMisaligned:       "PT_LOAD segment %d has offset %#x and address %#x, which differ modulo its p_align of %d",
+		msgLimitExceeded:        "resource limit exceeded",
+		msgTooManySections:      "%d section headers, more than the limit of %d",
+		msgTooManySegments:      "%d program headers, more than the limit of %d",
+		msgTooMuchRead:          "read more than the limit of %d bytes",
+		msgBadLimits:            "invalid limit %q, expected none or a comma separated list of sections, segments, section-size or bytes=N",
+		msgBadFilter:            "invalid filter %q: %v",
+		msgFilterString:         "unterminated string at position %d",
+		msgFilterNumber:         "invalid number %q at position %d",
+		msgFilterUnexpected:     "unexpected %q at position %d",
+		msgFilterEnd:            "unexpected end of the expression",
+		msgFilterTypes:          "cannot compare %s with %s",
+		msgFilterOperator:       "operator %s does not apply to %s",
+		msgFilterField:          "unknown field %q, known fields are %s",
+		msgUnknownSortKey:       "unknown sort key %q, use size, file_size, overlay, path or arch",
+		msgGapsTotal:            "%d gaps, %d bytes, %d of them not zero",
+		msgSizeAppended:         "note: %s has %d bytes appended after the ELF image, which ends at %d",
+		msgSizePadding:          "note: %s ends with %d zero bytes of padding after the ELF image",
+		msgSizeTruncated:        "note: %s is truncated, its ELF image is %d bytes but the file only %d",
+		msgStripSavings:         "stripping would save %d bytes (%.1f%%)",
+		msgBadDebugLink:         "malformed %s section",
+		msgNoDebugLink:          "%s has no %s section",
+		msgDebugFileNotFound:    "debug file %s not found",
+		msgDebugFileCRC:         "%s does not have the CRC %08x of the link",
+		msgLogLevel:             "unknown log level \"%s\", use quiet, normal, verbose or debug",
+		msgWarning:              "WARNING %s: %s",
+		msgCacheHit:             "found %s in the cache",
+		msgSkipNotELF:           "skipping %s, not an ELF file",
+		msgScanning:             "scanning %s",
+		msgNotAnELF:             "not an ELF file",
+		msgFileTruncated:        "file is truncated",
+		msgSegmentsEnd:          "the PT_LOAD segments end at %#x in the file and take %d bytes in memory",
+		msgTextRel:              "%s has text relocations: its code is patched at load time, which means it was not built with -fPIC",
+		msgUnknownEncoding:      "unknown encoding %q, use one of s, S, l, b, L or B",
+		msgDryRunPatches:        "dry run, %d files would be changed",
+		msgBadTarget:            "unknown target %q, expected <arch>-<os>[version] such as aarch64-freebsd14",
+		msgTargetMachine:        "built for %s, not %s",
+		msgTargetClass:          "%d-bit, the target is %d-bit",
+		msgTargetByteOrder:      "%s endian, the target is %s endian",
+		msgTargetFloatABI:       "uses the %s-float ABI, the target the %s-float one",
+		msgTargetOSABI:          "branded %s, the target runs %s binaries",
+		msgTargetBuiltFor:       "built for %s, the target runs %s",
+		msgTargetTooOld:         "needs %s or later, the target is %s",
+		msgTargetCanRun:         "%s can run on %s",
+		msgHostNoELF:            "%s/%s does not run ELF files",
+		msgHereNoInterpreter:    "the interpreter %s does not exist",
+		msgHereMissingLibrary:   "%s, needed by %s, is not found",
+		msgAppDirMixed:          "the AppDir mixes architectures: %s",
+		msgAppDirTotal:          "%d ELF files of %d bytes, %d bytes in total",
+		msgNotAnImage:           "not a squashfs or ISO 9660 image, an AppImage, or a zip, tar or cpio archive",
+		msgImageReadOnly:        "files inside filesystem images and archives cannot be changed",
+		msgBudgetExceeded:       "%d limits exceeded or files unreadable in %d files checked",
+		msgBudgetOK:             "%d files checked, all within their budget",
+		msgSizeRegressions:      "%d files grew by more than allowed",
+		msgTotalGrowth:          "all files together grew by %+d bytes, more than allowed",
+		msgHeaderField:          "expected field=value with one of the ELF header fields, not %q",
+		msgHeaderValue:          "invalid value %q for %s",
+		msgHeaderValueRange:     "%d does not fit in %s, which has %d bytes",
+		msgHeaderEntsize:        "%s is %d, but must be %d for this class",
+		msgHeaderTableOutside:   "the table at %s %d with %d entries of %d bytes does not fit in the file of %d bytes",
+		msgHeaderShstrndx:       "e_shstrndx %d is not below e_shnum %d",
+		msgHeaderNotWritten:     "%s: not written because of the problems with the new header, use --force to write it anyway",
+		msgNoToolchain:          "%s does not identify the compiler or linker that built it",
+		msgReproDate:            "date %s, as __DATE__ expands to",
+		msgReproTime:            "time %s, as __TIME__ expands to",
+		msgReproTimestamp:       "timestamp %s",
+		msgReproSourcePath:      "absolute source path %s, as __FILE__ expands to",
+		msgReproBuildDir:        "build directory %s",
+		msgReproCompDir:         "debug information records the build directory %s, map it with -fdebug-prefix-map",
+		msgReproTrimpath:        "Go binary built without -trimpath, which records absolute source paths",
+		msgReproBuildID:         "the build-id has 16 bytes like the random ones of --build-id=uuid, not 20 like hashes of the contents",
+		msgBadSBOMFormat:        "unknown SBOM format %q, expected spdx, cyclonedx or json",
+		msgNoXattr:              "extended attributes are not supported on this system",
+		msgNotStreamArchive:     "not a tar or cpio archive",
+		msgBadCpioHeader:        "malformed cpio header",
+		msgMemberTooLarge:       "%s is larger than %d bytes",
+		msgBadDigest:            "invalid digest %q",
+		msgNotOCIImage:          "not an OCI image layout or docker save output, no index.json or manifest.json",
+		msgOCISummary:           "%d layers, %d ELF files, %d bytes",
+		msgNotPackage:           "not a FreeBSD package, there is no +COMPACT_MANIFEST or +MANIFEST",
+		msgBadPackageManifest:   "cannot read package manifest: %v",
+		msgPathsDisabled:        "requests for paths are disabled, start the server with --root",
+		msgNoPathGiven:          "no path given",
+		msgOutsideRoot:          "%s is not under %s",
+		msgNoFilePart:           "the form has no field \"file\"",
+		msgListening:            "listening on %s",
+		msgCorruptHeader:        "corrupt ELF header: section header table at offset %d with %d entries of %d bytes",
+		msgBadSectionLink:       "section %d refers to section %d, but there are only %d",
+		msgOutputRequired:       "-o is required; the input file is not changed",
+		msgNotInBaseline:        "%s: %s is not in the baseline",
+		msgSelfSigned:           "the signature is only valid for the key embedded in the file, which anyone can replace: self-signed, unverified",
+		msgNoTrustedKey:         "%s is not signed with any key in %s",
+		msgSignatureTrusted:     "%s: trusted, signed with %s",
+		msgSignatureUnverified:  "%s: self-signed, unverified",
+		msgISONoPVD:             "no ISO 9660 primary volume descriptor",
+		msgISOBlockSize:         "ISO 9660 logical block size is zero",
+		msgISORootRecord:        "malformed ISO 9660 root directory record",
+		msgAtLine:               "line %d",
+		msgExpectedYAMLPair:     "expected key: value",
+		msgLimitOutsideGlob:     "limit outside of a glob",
+		msgUnknownBudgetLimit:   "unknown limit %q, expected elf or overlay",
+		msgNoBudgetLimit:        "no limit for %q",
+		msgInvalidSize:          "invalid size %q",
+		msgSnapshotVersion:      "unsupported snapshot version %d",
+		msgUnknownSizeField:     "unknown size %q, expected elf, overlay or file",
+		msgInvalidPercentage:    "invalid percentage %q",
+		msgUnknownMachine:       "unknown machine %q",
+		msgExpectedTOMLPair:     "expected key = value",
+		msgTOMLUnquoted:         "value must be a quoted string",
+		msgPhdrTableSize:        "program header table cannot change size",
+		msgShdrTableSize:        "section header table cannot change size in place",
+		msgUnknownCopyRegion:    "unknown copy region %d",
+		msgCacheMalformed:       "ignoring malformed entry %s",
+		msgSameFile:             "%s and %s are the same file",
+		msgScanCacheRemote:      "the scan cache must be a local directory, not %s, since its keys are inode numbers that only this machine knows",
+		msgCacheStale:           "%s in the cache is out of date",
+		msgRpathEmpty:           "empty entry, searches the current directory",
+		msgRpathRelative:        "relative to the current directory, use $ORIGIN",
+		msgRpathAbsolute:        "absolute path does not move with the file, consider $ORIGIN",
+
+		msgDesktopBadGroup:       "malformed group header %q",
+		msgDesktopFirstGroup:     "first group is [%s], must be [Desktop Entry]",
+		msgDesktopOutsideGroup:   "key outside of any group",
+		msgDesktopBadLine:        "line is neither a comment, a group header nor a key=value pair",
+		msgDesktopBadKey:         "invalid key %q",
+		msgDesktopDuplicateKey:   "duplicate key %s, first defined on line %d",
+		msgDesktopBoolean:        "%s must be true or false, not %q",
+		msgDesktopRead:           "%v",
+		msgDesktopNoEntry:        "no [Desktop Entry] group",
+		msgDesktopMissingKey:     "required key %s is missing",
+		msgDesktopMissingExec:    "Exec is required for an AppImage application",
+		msgDesktopMissingURL:     "required key URL is missing for Type=Link",
+		msgDesktopUnknownType:    "unknown Type %q",
+		msgDesktopMissingIcon:    "Icon is required for an AppImage",
+		msgDesktopIconPath:       "Icon should be an icon name, not the path %q",
+		msgDesktopIconExtension:  "Icon should be given without the %s extension",
+		msgDesktopCategories:     "Categories should end with a semicolon",
+		msgDesktopExecEmpty:      "Exec: empty command",
+		msgDesktopExecTrailing:   "Exec: trailing %%",
+		msgDesktopExecDeprecated: "Exec: deprecated field code %%%c",
+		msgDesktopExecInvalid:    "Exec: invalid field code %%%c",
+		msgDesktopExecQuotes:     "Exec: unbalanced quotes",
+		msgDesktopExecFiles:      "Exec: more than one of %%f, %%F, %%u and %%U",
+	},
+	"de": {
+		msgError:                "FEHLER %s: %s",
+		msgNotExist:             "%s existiert nicht, Abbruch",
+		msgNotRegular:           "keine reguläre Datei",
+		msgNotELF:               "%s ist keine ELF-Datei",
+		msgBadMagic:             "Ungültige magische Zahl %d",
+		msgUnsupportedClass:     "nicht unterstützte ELF-Klasse",
+		msgNoElfSize:            "ELF-Größe von %s konnte nicht bestimmt werden",
+		msgTruncated:            "%s ist abgeschnitten: ELF-Größe %d übersteigt Dateigröße %d",
+		msgUnknownOSABI:         "unbekannte OS-ABI %q",
+		msgNoIcon:               "%s enthält kein eingebettetes Icon",
+		msgBadIcon:              "Abschnitt %s enthält kein PNG- oder SVG-Bild",
+		msgNoBuildID:            "%s hat keine GNU-Build-ID",
+		msgUnknownStrategy:      "unbekannte Größenstrategie %q, erwartet wird eine von %s",
+		msgNotGoBinary:          "%s ist kein Go-Programm oder enthält keine Build-Informationen",
+		msgNotSquashfs:          "kein squashfs-Superblock an Position %d",
+		msgBadSquashfs:          "nicht unterstützter oder beschädigter squashfs-Superblock an Position %d",
+		msgPayloadTruncated:     "Nutzlast gibt %d Bytes an, aber nur %d folgen ihrem Anfang, die Datei ist abgeschnitten",
+		msgPayloadPadded:        "%d Bytes folgen der Nutzlast über ihre angegebene Größe hinaus",
+		msgShortSection:         "Abschnitt %s ist kürzer als seine angegebene Größe",
+		msgSectionTooLarge:      "Abschnitt %s hat %d Bytes, mehr als die Grenze von %d",
+		msgSectionNotFound:      "Abschnitt nicht gefunden",
+		msgSectionNotWritable:   "Abschnitt %s hat keinen Inhalt, der an Ort und Stelle ersetzt werden könnte",
+		msgSectionTooSmall:      "Abschnitt %s fasst %d Bytes, %d passen nicht hinein",
+		msgNoPayload:            "%s enthält kein Dateisystemabbild",
+		msgNoDesktopEntry:       "%s hat keinen Desktop-Eintrag auf oberster Ebene",
+		msgTruncatedHeader:      "Datei ist zu kurz für einen ELF-Header",
+		msgOutOfBounds:          "Struktur an Offset %d reicht über das Dateiende hinaus",
+		msgNoDynamic:            "Datei hat keinen dynamischen Abschnitt",
+		msgUnmappedAddress:      "Adresse 0x%x liegt in keinem geladenen Segment",
+		msgHasOverlay:           "Datei hat %d Bytes nach dem ELF-Abbild angehängt",
+		msgNoSpareHeader:        "kein Programmheader, der zu einem neuen Segment werden könnte, und kein Platz für eine größere Programmheadertabelle",
+		msgCannotMoveDynamic:    "der dynamische Abschnitt kann auf dieser Architektur nicht verschoben werden",
+		msgNoInterpreter:        "%s hat kein PT_INTERP-Segment",
+		msgStripped:             "gestrippt",
+		msgNotStripped:          "nicht gestrippt: %s",
+		msgBatchLine:            "Stapel %s:%d",
+		msgUnterminatedQuote:    "Anführungszeichen nicht geschlossen",
+		msgRuntimeTrailing:      "%d Bytes nachgestellte Daten hinter dem ELF-Abbild",
+		msgRuntimeTooLarge:      "%d Bytes überschreiten die Grenze von %d Bytes",
+		msgRuntimeNoMagic:       "AppImage-Kennung 'AI\\x02' fehlt an Position 8",
+		msgRuntimeNoSection:     "reservierter Abschnitt %s fehlt",
+		msgRuntimeMissingLib:    "von %[2]s benötigte Bibliothek %[1]s nicht gefunden",
+		msgPackedUPX:            "UPX-Kennung in den Kopfdaten gefunden",
+		msgPackedLayout:         "nur %d Abschnitte und %d ladbare Segmente",
+		msgPackedEntropy:        "Entropie von %.2f Bit pro Byte deutet auf komprimierte Inhalte hin",
+		msgNoSectionHeaders:     "%s hat keine Abschnittskopftabelle",
+		msgSectionExists:        "Abschnitt %s existiert bereits",
+		msgSectionInUse:         "Abschnitt %s wird noch von %s verwendet",
+		msgBadUpdateInfo:        "unbekannte Art von Aktualisierungsinformationen %q, erwartet wird eine von %s",
+		msgNoSignature:          "%s trägt keine Signatur",
+		msgNoSignatureKey:       "%s trägt keinen öffentlichen Schlüssel, einen mit --key angeben",
+		msgUnsupportedSignature: "nicht unterstütztes Signaturformat",
+		msgSignatureKeyMismatch: "die Signatur wurde mit einem anderen Schlüssel erstellt",
+		msgBadSignature:         "Signatur ist ungültig",
+		msgBadAlignment:         "ungültige Ausrichtung %d",
+		msgSquashfsCompression:  "mit %s komprimierte squashfs-Abbilder werden nicht unterstützt, nur gzip, xz und zstd",
+		msgBadBlockSize:         "Blockgröße %d ist keine Zweierpotenz",
+		msgNotArchive:           "kein ar-Archiv",
+		msgBadArchive:           "fehlerhafter ar-Mitgliedskopf an Position %d",
+		msgDecompressFailed:     "Dekomprimieren mit %s fehlgeschlagen: %v",
+		msgModuleTooLarge:       "Modul ist entpackt größer als %d Bytes",
+		msgBadOffset:            "Position %d liegt außerhalb der Datei mit %d Bytes",
+		msgUnknownFormat:        "unbekanntes Ausgabeformat %q",
+		msgPorcelainELF:         "--porcelain unterstützt nur ELF-Dateien",
+		msgSocketInUse:          "ein anderer Prozess lauscht bereits auf %s",
+		msgUnknownHash:          "unbekannter Hash %q, einen von %s wählen",
+		msgUnsupportedEncoding:  "nicht unterstützte ELF-Datenkodierung %d",
+		msgNoProcesses:          "Prozesse können unter %s nicht untersucht werden",
+		msgNoProcfs:             "die ausführbare Datei von Prozess %d ist nicht zu finden, ist procfs unter /proc eingehängt? %v",
+		msgPageSizeOK:           "auf Kerneln mit %d Byte großen Seiten ladbar",
+		msgPageSizeBad:          "auf Kerneln mit %d Byte großen Seiten nicht ladbar, die PT_LOAD-Segmente sind an %d Bytes ausgerichtet",
+		msgBadPageSize:          "die Seitengröße muss eine Zweierpotenz sein, nicht %d",
+		msgNoKernel:             "%s enthält keinen komprimierten ELF-Kernel",
+		msgNoFreeBSDTag:         "%s hat kein FreeBSD-ABI-Tag",
+		msgNoSectionTable:       "in %s wurde keine intakte Section-Header-Tabelle gefunden",
+		msgNothingToRepair:      "die Section-Header-Felder von %s sind intakt",
+		msgLintPhdrsEOF:         "die Program-Header-Tabelle reicht bis %d, über das Dateiende bei %d hinaus",
+		msgLintShdrsEOF:         "die Section-Header-Tabelle reicht bis %d, über das Dateiende bei %d hinaus",
+		msgLintPhentsize:        "e_phentsize ist %d statt %d",
+		msgLintShentsize:        "e_shentsize ist %d statt %d",
+		msgLintShstrndx:         "e_shstrndx %d liegt außerhalb der %d Sections",
+		msgLintShstrtab:         "e_shstrndx %d ist keine String-Tabelle",
+		msgLintSectionEOF:       "Section %s reicht bis %d, über das Dateiende bei %d hinaus",
+		msgLintSectionOverlap:   "die Sections %s und %s überlappen bei %d",
+		msgLintSectionLink:      "Section %s verweist auf Section %d von %d",
+		msgLintSegmentEOF:       "Segment %d (%s) reicht bis %d, über das Dateiende bei %d hinaus",
+		msgLintLoadOrder:        "PT_LOAD-Segment %d bei %#x folgt auf eines bei %#x",
+		msgLintAfterLoad:        "%s-Segment %d folgt auf ein PT_LOAD-Segment",
+		msgLintMultipleInterp:   "es gibt %d PT_INTERP-Segmente",
+		msgLintEmptyLoad:        "PT_LOAD-Segment %d hat eine Speichergröße von 0",
+		msgLintMemsz:            "Segment %d hat eine Dateigröße von %d, aber eine Speichergröße von %d",
+		msgLintAlign:            "Segment %d hat ein p_align von %d, das keine Zweierpotenz ist",
+		msgLintMisaligned:       "PT_LOAD-Segment %d hat Offset %#x und Adresse %#x, die sich modulo p_align %d unterscheiden",
+		msgLimitExceeded:        "Ressourcengrenze überschritten",
+		msgTooManySections:      "%d Section-Header, mehr als die Grenze von %d",
+		msgTooManySegments:      "%d Program-Header, mehr als die Grenze von %d",
+		msgTooMuchRead:          "mehr als die Grenze von %d Bytes gelesen",
+		msgBadLimits:            "ungültige Grenze %q, erwartet wird none oder eine durch Kommas getrennte Liste von sections, segments, section-size oder bytes=N",
+		msgBadFilter:            "ungültiger Filter %q: %v",
+		msgFilterString:         "nicht abgeschlossene Zeichenkette an Position %d",
+		msgFilterNumber:         "ungültige Zahl %q an Position %d",
+		msgFilterUnexpected:     "unerwartetes %q an Position %d",
+		msgFilterEnd:            "unerwartetes Ende des Ausdrucks",
+		msgFilterTypes:          "%s kann nicht mit %s verglichen werden",
+		msgFilterOperator:       "Operator %s ist auf %s nicht anwendbar",
+		msgFilterField:          "unbekanntes Feld %q, bekannte Felder sind %s",
+		msgUnknownSortKey:       "unbekannter Sortierschlüssel %q, möglich sind size, file_size, overlay, path und arch",
+		msgGapsTotal:            "%d Lücken, %d Bytes, davon %d nicht null",
+		msgSizeAppended:         "Hinweis: an %[1]s sind nach dem ELF-Abbild, das bei %[3]d endet, %[2]d Bytes angehängt",
+		msgSizePadding:          "Hinweis: %s endet nach dem ELF-Abbild mit %d Null-Bytes Auffüllung",
+		msgSizeTruncated:        "Hinweis: %s ist abgeschnitten, das ELF-Abbild hat %d Bytes, die Datei nur %d",
+		msgStripSavings:         "Strippen würde %d Bytes sparen (%.1f %%)",
+		msgBadDebugLink:         "fehlerhafter Abschnitt %s",
+		msgNoDebugLink:          "%s hat keinen Abschnitt %s",
+		msgDebugFileNotFound:    "Debug-Datei %s nicht gefunden",
+		msgDebugFileCRC:         "%s hat nicht die CRC %08x der Verknüpfung",
+		msgLogLevel:             "unbekannte Protokollstufe \"%s\", erlaubt sind quiet, normal, verbose und debug",
+		msgWarning:              "WARNUNG %s: %s",
+		msgCacheHit:             "%s im Cache gefunden",
+		msgSkipNotELF:           "überspringe %s, keine ELF-Datei",
+		msgScanning:             "untersuche %s",
+		msgNotAnELF:             "keine ELF-Datei",
+		msgFileTruncated:        "Datei ist abgeschnitten",
+		msgSegmentsEnd:          "die PT_LOAD-Segmente enden bei %#x in der Datei und belegen %d Bytes im Speicher",
+		msgTextRel:              "%s hat Textrelokationen: sein Code wird beim Laden angepasst, es wurde also nicht mit -fPIC gebaut",
+		msgUnknownEncoding:      "unbekannte Kodierung %q, verwende s, S, l, b, L oder B",
+		msgDryRunPatches:        "Probelauf, %d Dateien würden geändert",
+		msgBadTarget:            "unbekanntes Ziel %q, erwartet wird <Architektur>-<System>[Version] wie aarch64-freebsd14",
+		msgTargetMachine:        "für %s gebaut, nicht für %s",
+		msgTargetClass:          "%d Bit, das Ziel hat %d Bit",
+		msgTargetByteOrder:      "%s endian, das Ziel ist %s endian",
+		msgTargetFloatABI:       "verwendet die %s-float-ABI, das Ziel die %s-float-ABI",
+		msgTargetOSABI:          "als %s markiert, das Ziel führt %s-Programme aus",
+		msgTargetBuiltFor:       "für %s gebaut, das Ziel verwendet %s",
+		msgTargetTooOld:         "benötigt %s oder neuer, das Ziel ist %s",
+		msgTargetCanRun:         "%s kann auf %s laufen",
+		msgHostNoELF:            "%s/%s führt keine ELF-Dateien aus",
+		msgHereNoInterpreter:    "der Interpreter %s existiert nicht",
+		msgHereMissingLibrary:   "%s, benötigt von %s, wurde nicht gefunden",
+		msgAppDirMixed:          "das AppDir mischt Architekturen: %s",
+		msgAppDirTotal:          "%d ELF-Dateien mit %d Bytes, insgesamt %d Bytes",
+		msgNotAnImage:           "kein squashfs- oder ISO-9660-Abbild, AppImage oder zip-, tar- oder cpio-Archiv",
+		msgImageReadOnly:        "Dateien in Dateisystemabbildern und Archiven können nicht geändert werden",
+		msgBudgetExceeded:       "%d Grenzen überschritten oder Dateien unlesbar in %d geprüften Dateien",
+		msgBudgetOK:             "%d Dateien geprüft, alle innerhalb ihres Budgets",
+		msgSizeRegressions:      "%d Dateien sind stärker als erlaubt gewachsen",
+		msgTotalGrowth:          "alle Dateien zusammen sind um %+d Bytes gewachsen, mehr als erlaubt",
+		msgHeaderField:          "Feld=Wert mit einem der Felder des ELF-Headers erwartet, nicht %q",
+		msgHeaderValue:          "ungültiger Wert %q für %s",
+		msgHeaderValueRange:     "%d passt nicht in %s, das %d Bytes hat",
+		msgHeaderEntsize:        "%s ist %d, muss für diese Klasse aber %d sein",
+		msgHeaderTableOutside:   "die Tabelle bei %s %d mit %d Einträgen zu %d Bytes passt nicht in die Datei mit %d Bytes",
+		msgHeaderShstrndx:       "e_shstrndx %d ist nicht kleiner als e_shnum %d",
+		msgHeaderNotWritten:     "%s: wegen der Probleme mit dem neuen Header nicht geschrieben, mit --force trotzdem schreiben",
+		msgNoToolchain:          "%s gibt den Compiler oder Linker, der es gebaut hat, nicht an",
+		msgReproDate:            "Datum %s, wie __DATE__ es einsetzt",
+		msgReproTime:            "Uhrzeit %s, wie __TIME__ sie einsetzt",
+		msgReproTimestamp:       "Zeitstempel %s",
+		msgReproSourcePath:      "absoluter Quellpfad %s, wie __FILE__ ihn einsetzt",
+		msgReproBuildDir:        "Build-Verzeichnis %s",
+		msgReproCompDir:         "die Debug-Informationen enthalten das Build-Verzeichnis %s, mit -fdebug-prefix-map abbilden",
+		msgReproTrimpath:        "Go-Programm ohne -trimpath gebaut, das absolute Quellpfade enthält",
+		msgReproBuildID:         "die Build-ID hat 16 Bytes wie die zufälligen von --build-id=uuid, nicht 20 wie Hashes des Inhalts",
+		msgBadSBOMFormat:        "unbekanntes SBOM-Format %q, erwartet spdx, cyclonedx oder json",
+		msgNoXattr:              "erweiterte Attribute werden auf diesem System nicht unterstützt",
+		msgNotStreamArchive:     "kein tar- oder cpio-Archiv",
+		msgBadCpioHeader:        "fehlerhafter cpio-Header",
+		msgMemberTooLarge:       "%s ist größer als %d Bytes",
+		msgBadDigest:            "ungültiger Digest %q",
+		msgNotOCIImage:          "kein OCI-Image-Layout und keine Ausgabe von docker save, weder index.json noch manifest.json vorhanden",
+		msgOCISummary:           "%d Schichten, %d ELF-Dateien, %d Bytes",
+		msgNotPackage:           "kein FreeBSD-Paket, weder +COMPACT_MANIFEST noch +MANIFEST vorhanden",
+		msgBadPackageManifest:   "Paketmanifest nicht lesbar: %v",
+		msgPathsDisabled:        "Anfragen nach Pfaden sind abgeschaltet, den Server mit --root starten",
+		msgNoPathGiven:          "kein Pfad angegeben",
+		msgOutsideRoot:          "%s liegt nicht unter %s",
+		msgNoFilePart:           "das Formular hat kein Feld \"file\"",
+		msgListening:            "lausche auf %s",
+		msgCorruptHeader:        "beschädigter ELF-Header: Abschnittstabelle an Position %d mit %d Einträgen zu %d Bytes",
+		msgBadSectionLink:       "Abschnitt %d verweist auf Abschnitt %d, es gibt aber nur %d",
+		msgOutputRequired:       "-o ist erforderlich; die Eingabedatei wird nicht verändert",
+		msgNotInBaseline:        "%s: %s ist nicht in der Ausgangsbasis",
+		msgSelfSigned:           "die Signatur ist nur für den in der Datei eingebetteten Schlüssel gültig, den jeder ersetzen kann: selbst signiert, nicht überprüft",
+		msgNoTrustedKey:         "%s ist mit keinem Schlüssel aus %s signiert",
+		msgSignatureTrusted:     "%s: vertrauenswürdig, signiert mit %s",
+		msgSignatureUnverified:  "%s: selbst signiert, nicht überprüft",
+		msgISONoPVD:             "kein primärer Volumendeskriptor nach ISO 9660",
+		msgISOBlockSize:         "logische Blockgröße nach ISO 9660 ist null",
+		msgISORootRecord:        "fehlerhafter Eintrag des Wurzelverzeichnisses nach ISO 9660",
+		msgAtLine:               "Zeile %d",
+		msgExpectedYAMLPair:     "erwartet Schlüssel: Wert",
+		msgLimitOutsideGlob:     "Grenze außerhalb eines Musters",
+		msgUnknownBudgetLimit:   "unbekannte Grenze %q, erwartet elf oder overlay",
+		msgNoBudgetLimit:        "keine Grenze für %q",
+		msgInvalidSize:          "ungültige Größe %q",
+		msgSnapshotVersion:      "nicht unterstützte Version %d des Schnappschusses",
+		msgUnknownSizeField:     "unbekannte Größe %q, erwartet elf, overlay oder file",
+		msgInvalidPercentage:    "ungültiger Prozentsatz %q",
+		msgUnknownMachine:       "unbekannte Maschine %q",
+		msgExpectedTOMLPair:     "erwartet Schlüssel = Wert",
+		msgTOMLUnquoted:         "der Wert muss eine Zeichenkette in Anführungszeichen sein",
+		msgPhdrTableSize:        "die Größe der Programmkopftabelle kann sich nicht ändern",
+		msgShdrTableSize:        "die Größe der Abschnittstabelle kann sich an Ort und Stelle nicht ändern",
+		msgUnknownCopyRegion:    "unbekannter Kopierbereich %d",
+		msgCacheMalformed:       "fehlerhafter Eintrag %s wird ignoriert",
+		msgSameFile:             "%s und %s sind dieselbe Datei",
+		msgScanCacheRemote:      "der Scan-Cache muss ein lokales Verzeichnis sein, nicht %s, da seine Schlüssel Inode-Nummern sind, die nur dieser Rechner kennt",
+		msgCacheStale:           "%s im Cache ist veraltet",
+		msgRpathEmpty:           "leerer Eintrag, durchsucht das aktuelle Verzeichnis",
+		msgRpathRelative:        "relativ zum aktuellen Verzeichnis, $ORIGIN verwenden",
+		msgRpathAbsolute:        "absoluter Pfad wandert nicht mit der Datei, $ORIGIN erwägen",
+
+		msgDesktopBadGroup:       "fehlerhafte Gruppenüberschrift %q",
+		msgDesktopFirstGroup:     "erste Gruppe ist [%s], muss [Desktop Entry] sein",
+		msgDesktopOutsideGroup:   "Schlüssel außerhalb einer Gruppe",
+		msgDesktopBadLine:        "Zeile ist weder Kommentar noch Gruppenüberschrift noch Schlüssel=Wert-Paar",
+		msgDesktopBadKey:         "ungültiger Schlüssel %q",
+		msgDesktopDuplicateKey:   "doppelter Schlüssel %s, zuerst definiert in Zeile %d",
+		msgDesktopBoolean:        "%s muss true oder false sein, nicht %q",
+		msgDesktopNoEntry:        "keine Gruppe [Desktop Entry]",
+		msgDesktopMissingKey:     "erforderlicher Schlüssel %s fehlt",
+		msgDesktopMissingExec:    "Exec ist für eine AppImage-Anwendung erforderlich",
+		msgDesktopMissingURL:     "erforderlicher Schlüssel URL fehlt für Type=Link",
+		msgDesktopUnknownType:    "unbekannter Type %q",
+		msgDesktopMissingIcon:    "Icon ist für ein AppImage erforderlich",
+		msgDesktopIconPath:       "Icon sollte ein Icon-Name sein, nicht der Pfad %q",
+		msgDesktopIconExtension:  "Icon sollte ohne die Endung %s angegeben werden",
+		msgDesktopCategories:     "Categories sollte mit einem Semikolon enden",
+		msgDesktopExecEmpty:      "Exec: leerer Befehl",
+		msgDesktopExecTrailing:   "Exec: %% am Ende",
+		msgDesktopExecDeprecated: "Exec: veralteter Feldcode %%%c",
+		msgDesktopExecInvalid:    "Exec: ungültiger Feldcode %%%c",
+		msgDesktopExecQuotes:     "Exec: unausgeglichene Anführungszeichen",
+		msgDesktopExecFiles:      "Exec: mehr als eines von %%f, %%F, %%u und %%U",
+	},
+}
+
+// language is the catalog language selected by the environment
+var language = messageLanguage()
+
+// messageLanguage picks the catalog language from LC_ALL, LC_MESSAGES and
+// LANG, in the order of precedence POSIX defines for them
+func messageLanguage() string {
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		// ll_CC.encoding@modifier
+		fields := strings.FieldsFunc(value, func(r rune) bool {
+			return r == '_' || r == '.' || r == '@'
+		})
+		if len(fields) > 0 {
+			if _, ok := catalog[strings.ToLower(fields[0])]; ok {
+				return strings.ToLower(fields[0])
+			}
+		}
+		return "en"
+	}
+	return "en"
+}
+
+// Problem is a finding of a check, identified by its message ID so that
+// scripts do not depend on the language of the message
+type Problem struct {
+	ID      messageID
+	Message string
+}
+
+// newProblem returns the Problem with the message id in the language of the
+// environment
+func newProblem(id messageID, args ...interface{}) Problem {
+	return Problem{id, Tr(id, args...)}
+}
+
+// Tr formats a message from the catalog in the language of the environment
+func Tr(id messageID, args ...interface{}) string {
+	return trIn(language, id, args...)
+}
+
+// trIn formats a message from the catalog in the given language
+func trIn(lang string, id messageID, args ...interface{}) string {
+	format, ok := catalog[lang][id]
+	if !ok {
+		format, ok = catalog["en"][id]
+	}
+	if !ok {
+		return string(id)
+	}
+	return fmt.Sprintf(format, args...)
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// mmap is not implemented; files are read with ReadAt instead
+func mmap(f *os.File, size int64) ([]byte, error) {
+	return nil, errors.ErrUnsupported
+}
+
+// munmap is never called without mmap
+func munmap(data []byte) error {
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package main
+
+import (
+	"math"
+	"os"
+	"syscall"
+)
+
+// mmap maps size bytes of f read-only
+func mmap(f *os.File, size int64) ([]byte, error) {
+	if size > math.MaxInt {
+		return nil, syscall.EFBIG
+	}
+	return syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// munmap releases a mapping made by mmap
+func munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
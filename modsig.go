@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// moduleSigMagic ends files signed by the Linux sign-file tool, such as
+// kernel modules
+const moduleSigMagic = "~Module signature appended~\n"
+
+// moduleSigInfoSize is the size of struct module_signature, which comes
+// right before moduleSigMagic
+const moduleSigInfoSize = 12
+
+// moduleSigIDTypes names the id_type of struct module_signature
+var moduleSigIDTypes = []string{"pgp", "x509", "pkcs7"}
+
+// AppendedSignature is a signature block appended to a file after its ELF
+// image, such as that of a signed Linux kernel module
+type AppendedSignature struct {
+	Offset int64  `json:"offset"` // where the block starts
+	Size   int64  `json:"size"`   // of the whole block, up to the end of the file
+	Length int64  `json:"length"` // of the signature itself
+	Type   string `json:"type"`   // "pkcs7", "x509" or "pgp"
+}
+
+// GetAppendedSignature returns the signature block appended to a file, or
+// nil if it has none
+func GetAppendedSignature(filepath string) (*AppendedSignature, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	stat, err := r.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return appendedSignature(r, stat.Size())
+}
+
+// appendedSignature reads the signature block at the end of r, which is
+// fileSize long, or returns nil if there is none. Blocks that do not fit in
+// the file are not taken for one
+func appendedSignature(r io.ReaderAt, fileSize int64) (*AppendedSignature, error) {
+	trailer := int64(moduleSigInfoSize + len(moduleSigMagic))
+	if fileSize < trailer {
+		return nil, nil
+	}
+	buf := make([]byte, trailer)
+	if _, err := r.ReadAt(buf, fileSize-trailer); err != nil {
+		return nil, err
+	}
+	if string(buf[moduleSigInfoSize:]) != moduleSigMagic {
+		return nil, nil
+	}
+	// struct module_signature: algo, hash, id_type, signer_len, key_id_len,
+	// three bytes of padding, then sig_len in big endian
+	signerLen, keyIDLen := int64(buf[3]), int64(buf[4])
+	length := int64(binary.BigEndian.Uint32(buf[8:]))
+	size := length + signerLen + keyIDLen + trailer
+	if size > fileSize {
+		return nil, nil
+	}
+	sig := &AppendedSignature{Offset: fileSize - size, Size: size, Length: length, Type: "unknown"}
+	if id := int(buf[2]); id < len(moduleSigIDTypes) {
+		sig.Type = moduleSigIDTypes[id]
+	}
+	return sig, nil
+}
+
+// appendedSignatureSize returns the size of the signature block appended to
+// r, or 0. The block is not part of the overlay, but it is not part of the
+// ELF image either
+func appendedSignatureSize(r io.ReaderAt, size, fileSize int64) int64 {
+	sig, err := appendedSignature(r, fileSize)
+	if err != nil || sig == nil || sig.Offset < size {
+		return 0
+	}
+	return sig.Size
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// elfNote is a single entry of a note section or PT_NOTE segment
+type elfNote struct {
+	Name string
+	Type uint32
+	Desc []byte
+}
+
+// Types of the notes named "GNU"
+const (
+	ntGNUABITag       = 1 // NT_GNU_ABI_TAG, the minimum kernel version
+	ntGNUHWCap        = 2 // NT_GNU_HWCAP
+	ntGNUBuildID      = 3 // NT_GNU_BUILD_ID, the build-id
+	ntGNUGoldVersion  = 4 // NT_GNU_GOLD_VERSION, the version of gold that linked the file
+	ntGNUPropertyType = 5 // NT_GNU_PROPERTY_TYPE_0, program properties
+)
+
+// Types of the notes named "FreeBSD"
+const (
+	ntFreeBSDABITag     = 1 // NT_FREEBSD_ABI_TAG, __FreeBSD_version of the build system
+	ntFreeBSDNoInitTag  = 2 // NT_FREEBSD_NOINIT_TAG
+	ntFreeBSDArchTag    = 3 // NT_FREEBSD_ARCH_TAG, the MACHINE_ARCH
+	ntFreeBSDFeatureCtl = 4 // NT_FREEBSD_FEATURE_CTL, features to disable, as set by elfctl(1)
+)
+
+// freeBSDFeatures are the bits of NT_FREEBSD_FEATURE_CTL, named like elfctl -l
+var freeBSDFeatures = []string{"noaslr", "noprotmax", "nostackgap", "wxneeded", "la48", "noasg"}
+
+// ntFDOPackagingMetadata is the type of the "FDO" note holding the JSON
+// package metadata of https://systemd.io/ELF_PACKAGE_METADATA/
+const ntFDOPackagingMetadata = 0xcafe1a7e
+
+// gnuABIOS are the operating systems of NT_GNU_ABI_TAG
+var gnuABIOS = []string{"Linux", "Hurd", "Solaris", "FreeBSD"}
+
+// gnuPropertyFeatures names the bits of the GNU properties that are
+// feature sets, by property type
+var gnuPropertyFeatures = map[uint32]struct {
+	name string
+	bits []string
+}{
+	0xc0000000: {"aarch64 features", []string{"bti", "pac", "gcs"}},
+	0xc0000002: {"x86 features", []string{"ibt", "shstk", "lam_u48", "lam_u57"}},
+	0xc0008002: {"x86 ISA needed", []string{"x86-64-baseline", "x86-64-v2", "x86-64-v3", "x86-64-v4"}},
+	0xc0010001: {"x86 ISA used", []string{"x86-64-baseline", "x86-64-v2", "x86-64-v3", "x86-64-v4"}},
+}
+
+// parseNotes decodes the notes in data. Entries are padded to align bytes,
+// which is 4 for everything except some 8-byte aligned GNU property notes
+func parseNotes(data []byte, order binary.ByteOrder, align uint64) []elfNote {
+	if align != 8 {
+		align = 4
+	}
+	pad := func(n uint64) uint64 { return (n + align - 1) &^ (align - 1) }
+
+	var notes []elfNote
+	for uint64(len(data)) >= 12 {
+		namesz := uint64(order.Uint32(data[0:4]))
+		descsz := uint64(order.Uint32(data[4:8]))
+		typ := order.Uint32(data[8:12])
+		data = data[12:]
+		// The padding is relative to the start of the entry
+		nameEnd := pad(12+namesz) - 12
+		if nameEnd > uint64(len(data)) {
+			break
+		}
+		name := cString(data[:namesz])
+		data = data[nameEnd:]
+		if descsz > uint64(len(data)) {
+			break
+		}
+		notes = append(notes, elfNote{Name: name, Type: typ, Desc: data[:descsz]})
+		if pad(descsz) >= uint64(len(data)) {
+			break
+		}
+		data = data[pad(descsz):]
+	}
+	return notes
+}
+
+// elfNotes returns the notes of a file from its SHT_NOTE sections, or from
+// its PT_NOTE segments if the section headers carry none
+func elfNotes(f *elf.File) ([]elfNote, error) {
+	var notes []elfNote
+	for _, section := range f.Sections {
+		if section.Type != elf.SHT_NOTE {
+			continue
+		}
+		if MaxSectionSize > 0 && int64(section.Size) > MaxSectionSize {
+			return nil, limitExceeded(msgSectionTooLarge, section.Name, section.Size, MaxSectionSize)
+		}
+		data, err := section.Data()
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, parseNotes(data, f.ByteOrder, section.Addralign)...)
+	}
+	if len(notes) > 0 {
+		return notes, nil
+	}
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_NOTE {
+			continue
+		}
+		if MaxSectionSize > 0 && int64(prog.Filesz) > MaxSectionSize {
+			return nil, limitExceeded(msgSectionTooLarge, prog.Type, prog.Filesz, MaxSectionSize)
+		}
+		data, err := io.ReadAll(prog.Open())
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, parseNotes(data, f.ByteOrder, prog.Align)...)
+	}
+	return notes, nil
+}
+
+// elfBuildID returns the GNU build-id of a file as raw bytes, or nil
+func elfBuildID(f *elf.File) ([]byte, error) {
+	notes, err := elfNotes(f)
+	if err != nil {
+		return nil, err
+	}
+	for _, note := range notes {
+		if note.Name == "GNU" && note.Type == ntGNUBuildID {
+			return note.Desc, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetBuildID returns the hex encoded GNU build-id of a file, or "" if it has none
+func GetBuildID(path string) (string, error) {
+	r, err := openFile(path)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	f, err := parseElf(path, r)
+	if err != nil {
+		return "", err
+	}
+	id, err := elfBuildID(f)
+	return hex.EncodeToString(id), err
+}
+
+// ElfNote is a decoded note of an ELF file
+type ElfNote struct {
+	Owner string `json:"owner"`
+	Type  uint32 `json:"type"`
+	Kind  string `json:"kind"`  // e.g. "build-id", or "" if unknown
+	Value string `json:"value"` // decoded, or the contents in hex if unknown
+}
+
+// GetNotes returns the notes of an ELF file, decoding those it knows
+func GetNotes(filepath string) ([]ElfNote, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return nil, err
+	}
+	notes, err := elfNotes(f)
+	if err != nil {
+		return nil, err
+	}
+	decoded := make([]ElfNote, len(notes))
+	for i, note := range notes {
+		kind, value := decodeNote(note, f)
+		if kind == "" {
+			value = hex.EncodeToString(note.Desc)
+		}
+		decoded[i] = ElfNote{note.Name, note.Type, kind, value}
+	}
+	return decoded, nil
+}
+
+// decodeNote returns what a note is and its value, or "" if unknown
+func decodeNote(note elfNote, f *elf.File) (kind, value string) {
+	order := f.ByteOrder
+	switch {
+	case note.Name == "GNU" && note.Type == ntGNUABITag && len(note.Desc) >= 16:
+		os := fmt.Sprint(order.Uint32(note.Desc))
+		if n := order.Uint32(note.Desc); n < uint32(len(gnuABIOS)) {
+			os = gnuABIOS[n]
+		}
+		return "abi-tag", fmt.Sprintf("%s %d.%d.%d", os, order.Uint32(note.Desc[4:]), order.Uint32(note.Desc[8:]), order.Uint32(note.Desc[12:]))
+	case note.Name == "GNU" && note.Type == ntGNUBuildID:
+		return "build-id", hex.EncodeToString(note.Desc)
+	case note.Name == "GNU" && note.Type == ntGNUGoldVersion:
+		return "gold-version", cString(note.Desc)
+	case note.Name == "GNU" && note.Type == ntGNUPropertyType:
+		return "properties", gnuProperties(note.Desc, f)
+	case note.Name == "FreeBSD" && note.Type == ntFreeBSDABITag && len(note.Desc) >= 4:
+		version := order.Uint32(note.Desc)
+		return "abi-tag", fmt.Sprintf("FreeBSD %s (%d)", freeBSDRelease(version), version)
+	case note.Name == "FreeBSD" && note.Type == ntFreeBSDNoInitTag:
+		return "noinit", ""
+	case note.Name == "FreeBSD" && note.Type == ntFreeBSDArchTag:
+		return "arch", cString(note.Desc)
+	case note.Name == "FreeBSD" && note.Type == ntFreeBSDFeatureCtl && len(note.Desc) >= 4:
+		var names []string
+		bits := order.Uint32(note.Desc)
+		for i, name := range freeBSDFeatures {
+			if bits&(1<<i) != 0 {
+				names = append(names, name)
+			}
+		}
+		return "feature-control", strings.Join(names, ",")
+	case note.Name == "FDO" && note.Type == ntFDOPackagingMetadata:
+		return "package", cString(note.Desc)
+	case note.Name == "Go" && note.Type == 4:
+		return "go-build-id", string(note.Desc)
+	}
+	return "", ""
+}
+
+// freeBSDRelease returns the release of a __FreeBSD_version, e.g. "13.2"
+// for 1302000. Versions between releases, of -STABLE and -CURRENT, are
+// counted up from the release branch they follow
+func freeBSDRelease(version uint32) string {
+	return fmt.Sprintf("%d.%d", version/100000, version/1000%100)
+}
+
+// elfFreeBSDVersion returns the __FreeBSD_version of the NT_FREEBSD_ABI_TAG
+// note of a file, or 0 if it has none
+func elfFreeBSDVersion(f *elf.File) (uint32, error) {
+	notes, err := elfNotes(f)
+	if err != nil {
+		return 0, err
+	}
+	for _, note := range notes {
+		if note.Name == "FreeBSD" && note.Type == ntFreeBSDABITag && len(note.Desc) >= 4 {
+			return f.ByteOrder.Uint32(note.Desc), nil
+		}
+	}
+	return 0, nil
+}
+
+// GetFreeBSDVersion returns the __FreeBSD_version that a FreeBSD binary was
+// built for, e.g. 1302000 for 13.2, or 0 if it has no ABI tag
+func GetFreeBSDVersion(filepath string) (uint32, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return 0, err
+	}
+	return elfFreeBSDVersion(f)
+}
+
+// gnuProperties describes the properties of an NT_GNU_PROPERTY_TYPE_0
+// note: type, size and data, padded to 8 bytes in 64-bit files
+func gnuProperties(data []byte, f *elf.File) string {
+	align := 4
+	if f.Class == elf.ELFCLASS64 {
+		align = 8
+	}
+	var props []string
+	for len(data) >= 8 {
+		typ := f.ByteOrder.Uint32(data)
+		size := int(f.ByteOrder.Uint32(data[4:]))
+		data = data[8:]
+		if size > len(data) {
+			break
+		}
+		prop := fmt.Sprintf("%#x=%x", typ, data[:size])
+		if features, ok := gnuPropertyFeatures[typ]; ok && size >= 4 {
+			var names []string
+			bits := f.ByteOrder.Uint32(data)
+			for i, name := range features.bits {
+				if bits&(1<<i) != 0 {
+					names = append(names, name)
+				}
+			}
+			if rest := bits >> len(features.bits); rest != 0 {
+				names = append(names, fmt.Sprintf("%#x", rest<<len(features.bits)))
+			}
+			prop = features.name + ": " + strings.Join(names, ",")
+		}
+		props = append(props, prop)
+		data = data[min(len(data), (size+align-1)&^(align-1)):]
+	}
+	return strings.Join(props, "; ")
+}
+
+// notesCommand implements "elfsize notes [--json] <file>"
+func notesCommand(args []string) int {
+	fs := flag.NewFlagSet("notes", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the notes as JSON")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s notes [--json] <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the notes of an ELF file, one per line: owner, type, kind and value,\n")
+		fmt.Fprintf(os.Stderr, "    which is in hex for the notes elfsize does not know\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	notes, err := GetNotes(positional[0])
+	if err != nil {
+		PrintError("notes", err)
+		return 1
+	}
+	if *asJSON {
+		if notes == nil {
+			notes = []ElfNote{}
+		}
+		out, _ := json.MarshalIndent(notes, "", "  ")
+		fmt.Println(string(out))
+		return 0
+	}
+	for _, note := range notes {
+		kind := note.Kind
+		if kind == "" {
+			kind = "-"
+		}
+		fmt.Printf("%s\t%#x\t%s\t%s\n", note.Owner, note.Type, kind, note.Value)
+	}
+	return 0
+}
+
+// buildIDCommand implements "elfsize build-id <file>"
+func buildIDCommand(args []string) int {
+	fs := flag.NewFlagSet("build-id", flag.ContinueOnError)
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s build-id <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the GNU build-id of an ELF file in hex\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	id, err := GetBuildID(positional[0])
+	if err == nil && id == "" {
+		err = errors.New(Tr(msgNoBuildID, positional[0]))
+	}
+	if err != nil {
+		PrintError("build-id", err)
+		return 1
+	}
+	fmt.Println(id)
+	return 0
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ociDigest matches the digests of OCI content descriptors, which name the
+// blobs as blobs/<algorithm>/<hex>
+var ociDigest = regexp.MustCompile(`^([a-z0-9]+(?:[+._-][a-z0-9]+)*):([a-fA-F0-9]{32,})$`)
+
+// OCIBinary is an ELF file in a layer of a container image
+type OCIBinary struct {
+	Layer     string     `json:"layer"` // digest of the layer, or its path in docker save output
+	Path      string     `json:"path"`  // in the layer
+	Size      int64      `json:"size"`
+	FileSize  int64      `json:"file_size"`
+	Arch      string     `json:"arch"`
+	Type      string     `json:"type"`
+	Hardening *Hardening `json:"hardening"`
+}
+
+// OCIImage is the ELF inventory of a container image
+type OCIImage struct {
+	Layers   []string    `json:"layers"` // scanned, each once however many manifests share it
+	Binaries []OCIBinary `json:"binaries"`
+	Problems []string    `json:"problems"` // layers and files that could not be read
+}
+
+// ociDescriptor is the part of an OCI content descriptor, or of an index or
+// image manifest, that ScanOCIImage needs. Docker's manifest lists and
+// manifests have the same fields
+type ociDescriptor struct {
+	MediaType string          `json:"mediaType"`
+	Digest    string          `json:"digest"`
+	Manifests []ociDescriptor `json:"manifests"` // of an index
+	Layers    []ociDescriptor `json:"layers"`    // of an image manifest
+}
+
+// dockerManifest is an entry of the manifest.json of docker save output
+type dockerManifest struct {
+	Layers []string `json:"Layers"`
+}
+
+// ociSource opens the files of an image layout, in a directory or a tar
+// archive, by their path in it
+type ociSource func(name string) (io.ReadCloser, error)
+
+// dirSource is the ociSource of an image layout in a directory
+func dirSource(dir string) ociSource {
+	return func(name string) (io.ReadCloser, error) {
+		name = path.Clean(name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		return openFile(filepath.Join(dir, filepath.FromSlash(name)))
+	}
+}
+
+// tarSource is the ociSource of an image layout in an uncompressed tar
+// archive, as written by docker save and skopeo, indexing its members
+// in one pass
+func tarSource(r io.ReaderAt, size int64) (ociSource, error) {
+	type member struct{ offset, size int64 }
+	members := map[string]member{}
+	sr := io.NewSectionReader(r, 0, size)
+	tr := tar.NewReader(sr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// The tar reader reads headers in whole blocks and nothing ahead,
+		// so the contents start where it stopped
+		if hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA {
+			offset, _ := sr.Seek(0, io.SeekCurrent)
+			members[path.Clean(strings.TrimPrefix(hdr.Name, "./"))] = member{offset, hdr.Size}
+		}
+	}
+	return func(name string) (io.ReadCloser, error) {
+		m, ok := members[path.Clean(name)]
+		if !ok {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		return io.NopCloser(io.NewSectionReader(r, m.offset, m.size)), nil
+	}, nil
+}
+
+// readSourceJSON decodes a JSON file of an image layout
+func readSourceJSON(open ociSource, name string, v any) error {
+	r, err := open(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, 16<<20))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// blobPath returns the path of the blob with a digest in an OCI image layout
+func blobPath(digest string) (string, error) {
+	m := ociDigest.FindStringSubmatch(digest)
+	if m == nil {
+		return "", errors.New(Tr(msgBadDigest, digest))
+	}
+	return "blobs/" + m[1] + "/" + m[2], nil
+}
+
+// ociLayers returns the layers of the images in an OCI image layout, in the
+// order of its index and manifests, each once. Indexes in the index, such
+// as those of multi-platform images, are followed, and layers that are not
+// tar archives, such as those of attestations, are left out
+func ociLayers(open ociSource) ([]ociDescriptor, error) {
+	var index ociDescriptor
+	if err := readSourceJSON(open, "index.json", &index); err != nil {
+		return nil, err
+	}
+	var layers []ociDescriptor
+	seen := map[string]bool{}
+	var visit func(d ociDescriptor, depth int) error
+	visit = func(d ociDescriptor, depth int) error {
+		for _, layer := range d.Layers {
+			if !seen[layer.Digest] && (layer.MediaType == "" || strings.Contains(layer.MediaType, "tar")) {
+				seen[layer.Digest] = true
+				layers = append(layers, layer)
+			}
+		}
+		for _, m := range d.Manifests {
+			if seen[m.Digest] || depth > 8 {
+				continue
+			}
+			seen[m.Digest] = true
+			name, err := blobPath(m.Digest)
+			if err != nil {
+				return err
+			}
+			var manifest ociDescriptor
+			if err := readSourceJSON(open, name, &manifest); err != nil {
+				return err
+			}
+			if err := visit(manifest, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return layers, visit(index, 0)
+}
+
+// ScanOCIImage lists the ELF files in a container image: an OCI image
+// layout, or the output of docker save, in a directory or a tar archive of
+// one. Every layer is scanned once, however many images and platforms share
+// it, and read as a stream, compressed with gzip or zstd or not; nothing is
+// extracted. Files that whiteouts of later layers remove are still listed
+// with the layer they are in
+func ScanOCIImage(filepath string) (*OCIImage, error) {
+	var open ociSource
+	if stat, err := os.Stat(filepath); err == nil && stat.IsDir() {
+		open = dirSource(filepath)
+	} else {
+		r, err := openFile(filepath)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		stat, err := r.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if open, err = tarSource(r, stat.Size()); err != nil {
+			return nil, &FileError{filepath, err}
+		}
+	}
+
+	// docker save wrote only manifest.json before Docker 25, and both since
+	type layer struct{ id, path string }
+	var layers []layer
+	if r, err := open("index.json"); err == nil {
+		r.Close()
+		descriptors, err := ociLayers(open)
+		if err != nil {
+			return nil, &FileError{filepath, err}
+		}
+		for _, d := range descriptors {
+			name, err := blobPath(d.Digest)
+			if err != nil {
+				return nil, &FileError{filepath, err}
+			}
+			layers = append(layers, layer{d.Digest, name})
+		}
+	} else {
+		var manifests []dockerManifest
+		if err := readSourceJSON(open, "manifest.json", &manifests); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil, &FileError{filepath, errors.New(Tr(msgNotOCIImage))}
+			}
+			return nil, &FileError{filepath, err}
+		}
+		seen := map[string]bool{}
+		for _, m := range manifests {
+			for _, name := range m.Layers {
+				if !seen[name] {
+					seen[name] = true
+					layers = append(layers, layer{name, name})
+				}
+			}
+		}
+	}
+
+	image := &OCIImage{Layers: []string{}, Binaries: []OCIBinary{}, Problems: []string{}}
+	for _, l := range layers {
+		image.Layers = append(image.Layers, l.id)
+		r, err := open(l.path)
+		if err != nil {
+			image.Problems = append(image.Problems, fmt.Sprintf("%s: %v", l.id, err))
+			continue
+		}
+		_, err = walkStreamElfs(r, func(name string, data []byte, err error) error {
+			name = "/" + strings.Join(imagePathComponents(name), "/")
+			if err != nil {
+				image.Problems = append(image.Problems, fmt.Sprintf("%s: %v", l.id, err))
+				return nil
+			}
+			binary, err := ociBinary(l.id, name, data)
+			if err != nil {
+				image.Problems = append(image.Problems, fmt.Sprintf("%s: %v", l.id, err))
+				return nil
+			}
+			image.Binaries = append(image.Binaries, *binary)
+			return nil
+		})
+		r.Close()
+		if err != nil {
+			image.Problems = append(image.Problems, fmt.Sprintf("%s: %v", l.id, err))
+		}
+	}
+	return image, nil
+}
+
+// ociBinary returns the OCIBinary of the ELF file at name in a layer
+func ociBinary(layer, name string, data []byte) (*OCIBinary, error) {
+	info, err := elfInfoFrom(name, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	f, err := parseElf(name, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	h, err := elfHardening(f)
+	if err != nil {
+		return nil, err
+	}
+	h.Path = name
+	return &OCIBinary{layer, name, info.Size, info.FileSize, info.Arch, info.Type, h}, nil
+}
+
+// shortDigest abbreviates a layer digest to 12 hex digits, like docker
+func shortDigest(id string) string {
+	if m := ociDigest.FindStringSubmatch(id); m != nil {
+		return m[2][:12]
+	}
+	return id
+}
+
+// ociCommand implements "elfsize oci [--json] <image directory or tar>"
+func ociCommand(args []string) int {
+	fs := flag.NewFlagSet("oci", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the layers, ELF files and problems as JSON")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s oci [--json] <image directory or tar>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    List the ELF files in the layers of a container image, an OCI image\n")
+		fmt.Fprintf(os.Stderr, "    layout or docker save output, with layer, path, size, architecture\n")
+		fmt.Fprintf(os.Stderr, "    and hardening like checksec. Layers shared by several images or\n")
+		fmt.Fprintf(os.Stderr, "    platforms are scanned once. Exits with 1 if something could not be read\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	image, err := ScanOCIImage(positional[0])
+	if err != nil {
+		PrintError("oci", err)
+		return 1
+	}
+	status := 0
+	if len(image.Problems) > 0 {
+		status = 1
+	}
+	if *asJSON {
+		out, _ := json.MarshalIndent(image, "", "  ")
+		fmt.Println(string(out))
+		return status
+	}
+	var total int64
+	for _, b := range image.Binaries {
+		total += b.Size
+		h := b.Hardening
+		fmt.Printf("%s\t%s\t%d\t%s\trelro=%s pie=%t nx=%t canary=%t fortify=%t textrel=%t\n",
+			shortDigest(b.Layer), b.Path, b.Size, b.Arch, h.RELRO, h.PIE, h.NX, h.Canary, h.Fortify, h.TextRel)
+	}
+	for _, problem := range image.Problems {
+		printWarning("oci", errors.New(problem))
+	}
+	fmt.Fprintln(os.Stderr, Tr(msgOCISummary, len(image.Layers), len(image.Binaries), total))
+	return status
+}
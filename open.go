@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// SafeOpen makes every file access refuse symbolic links and anything that is
+// not a regular file. Enable it when operating on world-writable directories,
+// where another user could replace a file with a link or a FIFO at any time
+var SafeOpen bool
+
+// MmapThreshold is the size from which files opened for reading are mapped
+// into memory instead of read with a system call for every header and
+// section. On a 400 MB AppImage this made small scattered reads ten times
+// faster, while hashing the whole file took as long as before, so small
+// files, which need few reads, are not mapped. 0 disables mapping; where it
+// is not available, or fails, files are read as usual
+var MmapThreshold int64 = 16 << 20
+
+// errNotRegular is returned by openFile for directories and, with SafeOpen, for
+// device nodes, FIFOs and sockets
+var errNotRegular = errors.New(Tr(msgNotRegular))
+
+// openFile opens a file for reading and checks its type on the opened handle,
+// so that what is parsed is guaranteed to be what was checked
+func openFile(path string) (*inputFile, error) {
+	return openFileFlags(path, os.O_RDONLY)
+}
+
+// openFileForUpdate is like openFile but opens the file for reading and writing
+func openFileForUpdate(path string) (*inputFile, error) {
+	return openFileFlags(path, os.O_RDWR)
+}
+
+// openFileAt is like openFile but makes the file appear to start at byte
+// base, so that an ELF image inside a container file can be parsed in place
+func openFileAt(path string, base int64) (*inputFile, error) {
+	f, err := openFile(path)
+	if err != nil || base == 0 {
+		return f, err
+	}
+	info, err := f.File.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if base < 0 || base > info.Size() {
+		f.Close()
+		return nil, errors.New(Tr(msgBadOffset, base, info.Size()))
+	}
+	if _, err := f.File.Seek(base, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	f.base = base
+	if err := checkHeaderLimits(f); err != nil {
+		f.Close()
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return f, nil
+}
+
+// Seek implements io.Seeker relative to the base of the file
+func (f inputFile) Seek(offset int64, whence int) (int64, error) {
+	if whence == io.SeekStart {
+		offset += f.base
+	}
+	pos, err := f.File.Seek(offset, whence)
+	return pos - f.base, err
+}
+
+// Stat returns the file info with the size counted from the base of the file
+func (f inputFile) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil || f.base == 0 {
+		return info, err
+	}
+	return baseFileInfo{info, f.base}, nil
+}
+
+// baseFileInfo is the info of a file opened by openFileAt
+type baseFileInfo struct {
+	os.FileInfo
+	base int64
+}
+
+// Size returns the size of the file after its base
+func (fi baseFileInfo) Size() int64 {
+	return fi.FileInfo.Size() - fi.base
+}
+
+// linkTarget returns the path a symbolic link finally resolves to, or ""
+// if path is not a symbolic link
+func linkTarget(path string) string {
+	stat, err := os.Lstat(path)
+	if err != nil || stat.Mode()&os.ModeSymlink == 0 {
+		return ""
+	}
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return ""
+	}
+	return target
+}
+
+func openFileFlags(path string, flags int) (*inputFile, error) {
+	if SafeOpen {
+		flags |= safeOpenFlags
+	}
+	f, err := os.OpenFile(path, flags, 0)
+	stats.syscalls.Add(2)
+	if os.IsNotExist(err) {
+		if image, member, ok := splitImagePath(path); ok {
+			return openImageMember(path, image, member, flags)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() || (SafeOpen && !info.Mode().IsRegular()) {
+		f.Close()
+		return nil, &os.PathError{Op: "open", Path: path, Err: errNotRegular}
+	}
+	if err := checkHeaderLimits(f); err != nil {
+		f.Close()
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	stats.files.Add(1)
+	in := &inputFile{File: f, read: new(atomic.Int64)}
+	if flags&(os.O_WRONLY|os.O_RDWR) == 0 && MmapThreshold > 0 && info.Mode().IsRegular() && info.Size() >= MmapThreshold {
+		if data, err := mmap(f, info.Size()); err == nil {
+			stats.syscalls.Add(1)
+			in.data = data
+		}
+	}
+	return in, nil
+}
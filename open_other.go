@@ -0,0 +1,7 @@
+//go:build !unix
+
+package main
+
+// safeOpenFlags is empty where O_NOFOLLOW is not available; the type check on
+// the opened handle still applies
+const safeOpenFlags = 0
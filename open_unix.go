@@ -0,0 +1,9 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+// safeOpenFlags refuses to follow a symbolic link in the last path component
+// and keeps the open from blocking on a FIFO before its type can be checked
+const safeOpenFlags = syscall.O_NOFOLLOW | syscall.O_NONBLOCK
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"debug/elf"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// osabiNames holds the names used for the EI_OSABI byte, matching the brand
+// names understood by FreeBSD's brandelf(1) where there is one
+var osabiNames = map[elf.OSABI]string{
+	elf.ELFOSABI_NONE:       "sysv",
+	elf.ELFOSABI_HPUX:       "hpux",
+	elf.ELFOSABI_NETBSD:     "netbsd",
+	elf.ELFOSABI_LINUX:      "linux",
+	elf.ELFOSABI_HURD:       "hurd",
+	elf.ELFOSABI_SOLARIS:    "solaris",
+	elf.ELFOSABI_AIX:        "aix",
+	elf.ELFOSABI_IRIX:       "irix",
+	elf.ELFOSABI_FREEBSD:    "freebsd",
+	elf.ELFOSABI_TRU64:      "tru64",
+	elf.ELFOSABI_OPENBSD:    "openbsd",
+	elf.ELFOSABI_CLOUDABI:   "cloudabi",
+	elf.ELFOSABI_ARM:        "arm",
+	elf.ELFOSABI_STANDALONE: "standalone",
+}
+
+// osabiName returns the name of an EI_OSABI value, or the lowercase
+// constant name for values without an entry in osabiNames
+func osabiName(abi elf.OSABI) string {
+	if name, ok := osabiNames[abi]; ok {
+		return name
+	}
+	name := abi.String()
+	if strings.HasPrefix(name, "ELFOSABI_") {
+		return strings.ToLower(strings.TrimPrefix(name, "ELFOSABI_"))
+	}
+	return "unknown-" + name
+}
+
+// GetElfOSABI returns the OS ABI a file is branded for (e.g. "freebsd", "linux"
+// or "sysv"), and err.
+// Note that many Linux binaries are branded sysv rather than linux
+func GetElfOSABI(filepath string) (string, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return "", err
+	}
+	return osabiName(f.OSABI), nil
+}
+
+// parseOSABI returns the EI_OSABI value for a name from osabiNames, matched
+// case-insensitively, or for a number in decimal or 0x-prefixed hex
+func parseOSABI(name string) (elf.OSABI, error) {
+	for abi, n := range osabiNames {
+		if strings.EqualFold(n, name) {
+			return abi, nil
+		}
+	}
+	// brandelf(1) calls SYSV by its old name
+	if strings.EqualFold(name, "svr4") {
+		return elf.ELFOSABI_NONE, nil
+	}
+	v, err := strconv.ParseUint(name, 0, 8)
+	if err != nil {
+		return 0, errors.New(Tr(msgUnknownOSABI, name))
+	}
+	return elf.OSABI(v), nil
+}
+
+// SetElfOSABI rewrites the EI_OSABI byte of an ELF file in place, like
+// FreeBSD's brandelf(1), and returns err
+func SetElfOSABI(filepath string, abi elf.OSABI) error {
+	f, err := openFileForUpdate(filepath)
+	if err != nil {
+		return err
+	}
+
+	var ident [elf.EI_NIDENT]byte
+	if _, err := f.ReadAt(ident[:], 0); err != nil {
+		f.Close()
+		return err
+	}
+	if string(ident[:4]) != elf.ELFMAG {
+		f.Close()
+		return withKind(ErrNotELF, errors.New(Tr(msgNotELF, filepath)))
+	}
+	if _, err := f.WriteAt([]byte{byte(abi)}, elf.EI_OSABI); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// setOSABICommand implements "elfsize set-osabi <file> <abi>"
+func setOSABICommand(args []string) int {
+	fs := flag.NewFlagSet("set-osabi", flag.ContinueOnError)
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s set-osabi <file> freebsd|linux|sysv|<number>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Rewrite the OS ABI the file is branded for\n")
+		fs.PrintDefaults()
+	}
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	abi, err := parseOSABI(positional[1])
+	if err != nil {
+		PrintError("set-osabi", err)
+		return 2
+	}
+	if err := SetElfOSABI(positional[0], abi); err != nil {
+		PrintError("set-osabi", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"debug/elf"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BundlePatchOptions controls what PatchBundle changes
+type BundlePatchOptions struct {
+	// Interpreter is the dynamic linker to set in every file that requests
+	// one, or "" to leave them alone
+	Interpreter string
+	// LibraryDirs are directories relative to the root that every RUNPATH
+	// points to. If there are none, the RUNPATH of every file points to the
+	// directories in the tree that hold the libraries it needs
+	LibraryDirs []string
+	// DryRun only reports what would be changed
+	DryRun bool
+}
+
+// BundlePatch records what PatchBundle changed in a file, or would change. A
+// field is "" when it stays as it is
+type BundlePatch struct {
+	Path           string `json:"path"`
+	OldRunPath     string `json:"old_runpath,omitempty"`
+	RunPath        string `json:"runpath,omitempty"`
+	OldInterpreter string `json:"old_interpreter,omitempty"`
+	Interpreter    string `json:"interpreter,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// PatchBundle rewrites the RUNPATH of every dynamically linked ELF file under
+// root, such as an AppDir, to $ORIGIN-relative directories, and sets its
+// interpreter if opts asks for it. Symbolic links are not followed, so that
+// no file is patched twice, nor one outside the tree. Files that need no
+// change are left out of the result; files that could not be patched are in
+// it with Error set, and the others are still patched
+func PatchBundle(root string, opts BundlePatchOptions) ([]BundlePatch, error) {
+	var files []string
+	libraryDirs := map[string][]string{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		// The dynamic linker finds libraries by the names of links as well
+		libraryDirs[d.Name()] = append(libraryDirs[d.Name()], filepath.Dir(path))
+		if d.Type().IsRegular() && isElfCandidate(path, d) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	patches := []BundlePatch{}
+	for _, path := range files {
+		patch, err := planBundlePatch(root, path, opts, libraryDirs)
+		if err == nil && patch == nil {
+			continue
+		}
+		if err == nil && !opts.DryRun {
+			err = applyBundlePatch(patch)
+		}
+		if err != nil {
+			var fileErr *FileError
+			if !errors.As(err, &fileErr) {
+				err = &FileError{path, err}
+			}
+			patch = &BundlePatch{Path: path, Error: err.Error()}
+		}
+		patches = append(patches, *patch)
+	}
+	return patches, nil
+}
+
+// planBundlePatch returns what PatchBundle changes in the file at path, or
+// nil if it needs no change or is not dynamically linked
+func planBundlePatch(root, path string, opts BundlePatchOptions, libraryDirs map[string][]string) (*BundlePatch, error) {
+	r, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(path, r)
+	if err != nil {
+		return nil, err
+	}
+	if f.Type != elf.ET_EXEC && f.Type != elf.ET_DYN || !hasProg(f, elf.PT_DYNAMIC) {
+		return nil, nil
+	}
+	patch := &BundlePatch{Path: path}
+	changed := false
+
+	var dirs []string
+	if len(opts.LibraryDirs) > 0 {
+		for _, dir := range opts.LibraryDirs {
+			dirs = append(dirs, filepath.Join(root, dir))
+		}
+	} else {
+		needed, err := f.ImportedLibraries()
+		if err != nil {
+			return nil, err
+		}
+		for _, lib := range needed {
+			dirs = append(dirs, libraryDirs[lib]...)
+		}
+	}
+	if runpath := originRunPath(filepath.Dir(path), dirs); runpath != "" {
+		old, err := f.DynString(elf.DT_RUNPATH)
+		if err != nil {
+			return nil, err
+		}
+		if len(old) == 0 {
+			if old, err = f.DynString(elf.DT_RPATH); err != nil {
+				return nil, err
+			}
+		}
+		if len(old) == 0 || old[0] != runpath {
+			if len(old) > 0 {
+				patch.OldRunPath = old[0]
+			}
+			patch.RunPath, changed = runpath, true
+		}
+	}
+
+	if opts.Interpreter != "" && hasProg(f, elf.PT_INTERP) {
+		old, err := elfInterpreter(f)
+		if err != nil {
+			return nil, err
+		}
+		if old != opts.Interpreter {
+			patch.OldInterpreter, patch.Interpreter, changed = old, opts.Interpreter, true
+		}
+	}
+	if !changed {
+		return nil, nil
+	}
+	return patch, nil
+}
+
+// originRunPath returns a RUNPATH that makes the dynamic linker search dirs
+// from a file in dir, each once and in order, relative to $ORIGIN
+func originRunPath(dir string, dirs []string) string {
+	var entries []string
+	seen := map[string]bool{}
+	for _, d := range dirs {
+		rel, err := filepath.Rel(dir, d)
+		if err != nil {
+			continue
+		}
+		entry := "$ORIGIN"
+		if rel != "." {
+			entry += "/" + filepath.ToSlash(rel)
+		}
+		if !seen[entry] {
+			seen[entry] = true
+			entries = append(entries, entry)
+		}
+	}
+	return strings.Join(entries, ":")
+}
+
+// applyBundlePatch makes the changes planned for a file
+func applyBundlePatch(patch *BundlePatch) error {
+	if patch.RunPath != "" {
+		if err := SetRunPath(patch.Path, patch.RunPath, false, ""); err != nil {
+			return err
+		}
+	}
+	if patch.Interpreter != "" {
+		if err := SetElfInterpreter(patch.Path, patch.Interpreter, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasProg reports whether a file has a program header of the given type
+func hasProg(f *elf.File, typ elf.ProgType) bool {
+	for _, p := range f.Progs {
+		if p.Type == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// patchDirCommand implements "elfsize patch-dir [--interpreter path] [--lib-dir dir]... [--dry-run] <dir>"
+func patchDirCommand(args []string) int {
+	fs := flag.NewFlagSet("patch-dir", flag.ContinueOnError)
+	var opts BundlePatchOptions
+	fs.StringVar(&opts.Interpreter, "interpreter", "", "also set the interpreter of every file that requests one")
+	fs.Func("lib-dir", "point every RUNPATH to this directory, relative to <dir>; may be repeated", func(dir string) error {
+		opts.LibraryDirs = append(opts.LibraryDirs, dir)
+		return nil
+	})
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "only print what would be changed")
+	asJSON := fs.Bool("json", false, "print the changes as JSON")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s patch-dir [--interpreter path] [--lib-dir dir]... [--dry-run] [--json] <dir>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Rewrite the RUNPATH of every dynamically linked ELF file in a directory\n")
+		fmt.Fprintf(os.Stderr, "    tree such as an AppDir to $ORIGIN-relative paths to the directories in\n")
+		fmt.Fprintf(os.Stderr, "    the tree that hold the libraries it needs, or to the --lib-dir ones\n")
+		fmt.Fprintf(os.Stderr, "    Exits with 1 if a file could not be patched\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	patches, err := PatchBundle(positional[0], opts)
+	if err != nil {
+		PrintError("patch-dir", err)
+		return 1
+	}
+	status, changed := 0, 0
+	for _, p := range patches {
+		if p.Error != "" {
+			status = 1
+		} else {
+			changed++
+		}
+	}
+	if *asJSON {
+		out, _ := json.MarshalIndent(patches, "", "  ")
+		fmt.Println(string(out))
+		return status
+	}
+	for _, p := range patches {
+		if p.Error != "" {
+			PrintError("patch-dir", errors.New(p.Error))
+			continue
+		}
+		if p.RunPath != "" {
+			fmt.Printf("runpath\t%s\t%s\t%s\n", p.Path, p.OldRunPath, p.RunPath)
+		}
+		if p.Interpreter != "" {
+			fmt.Printf("interpreter\t%s\t%s\t%s\n", p.Path, p.OldInterpreter, p.Interpreter)
+		}
+	}
+	if opts.DryRun {
+		fmt.Fprintln(os.Stderr, Tr(msgDryRunPatches, changed))
+	}
+	return status
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// PEInfo is the machine-readable summary of a PE/COFF file
+type PEInfo struct {
+	Path              string `json:"path"`
+	Size              int64  `json:"size"` // headers, sections and COFF symbols
+	FileSize          int64  `json:"file_size"`
+	Overlay           int64  `json:"overlay"` // bytes appended after the image and certificates
+	Arch              string `json:"arch"`
+	CertificateOffset int64  `json:"certificate_offset"` // Authenticode signature, 0 if unsigned
+	CertificateSize   int64  `json:"certificate_size"`
+}
+
+// isPE reports whether r starts with an MS-DOS stub pointing to a PE header
+func isPE(r io.ReaderAt) bool {
+	var stub [64]byte
+	if _, err := r.ReadAt(stub[:], 0); err != nil || string(stub[:2]) != "MZ" {
+		return false
+	}
+	var sig [4]byte
+	_, err := r.ReadAt(sig[:], int64(binary.LittleEndian.Uint32(stub[60:])))
+	return err == nil && string(sig[:]) == "PE\x00\x00"
+}
+
+// GetPEInfo returns the size, overlay and certificate table of a PE file,
+// and err
+func GetPEInfo(filepath string) (*PEInfo, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return newPEInfo(filepath, r)
+}
+
+// newPEInfo collects the PEInfo of an opened file. The image ends with the
+// last section or the COFF symbol table; the certificate table, which
+// signing tools append, is reported separately and not counted as overlay
+func newPEInfo(path string, r *inputFile) (*PEInfo, error) {
+	f, err := pe.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stat, err := r.Stat()
+	if err != nil {
+		return nil, err
+	}
+	info := &PEInfo{Path: path, FileSize: stat.Size(), Arch: peArchitecture(f.Machine)}
+
+	var dirs []pe.DataDirectory
+	switch h := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		info.Size = int64(h.SizeOfHeaders)
+		dirs = h.DataDirectory[:min(h.NumberOfRvaAndSizes, uint32(len(h.DataDirectory)))]
+	case *pe.OptionalHeader64:
+		info.Size = int64(h.SizeOfHeaders)
+		dirs = h.DataDirectory[:min(h.NumberOfRvaAndSizes, uint32(len(h.DataDirectory)))]
+	}
+	for _, s := range f.Sections {
+		info.Size = max(info.Size, int64(s.Offset)+int64(s.Size))
+	}
+	if f.PointerToSymbolTable != 0 {
+		// The string table follows the symbols and starts with its size
+		end := int64(f.PointerToSymbolTable) + int64(f.NumberOfSymbols)*pe.COFFSymbolSize
+		var size [4]byte
+		if _, err := r.ReadAt(size[:], end); err == nil {
+			end += int64(binary.LittleEndian.Uint32(size[:]))
+		}
+		info.Size = max(info.Size, end)
+	}
+	if len(dirs) > pe.IMAGE_DIRECTORY_ENTRY_SECURITY {
+		// Unlike the other directories, this one holds a file offset
+		cert := dirs[pe.IMAGE_DIRECTORY_ENTRY_SECURITY]
+		if cert.Size != 0 {
+			info.CertificateOffset, info.CertificateSize = int64(cert.VirtualAddress), int64(cert.Size)
+		}
+	}
+	if end := max(info.Size, info.CertificateOffset+info.CertificateSize); info.FileSize > end {
+		info.Overlay = info.FileSize - end
+	}
+	return info, nil
+}
+
+// peArchitecture names a PE machine like elfArchitecture names the
+// corresponding ELF machine
+func peArchitecture(machine uint16) string {
+	switch machine {
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		return "x86_64"
+	case pe.IMAGE_FILE_MACHINE_I386:
+		return "i686"
+	case pe.IMAGE_FILE_MACHINE_ARMNT:
+		return "armhf"
+	case pe.IMAGE_FILE_MACHINE_ARM64:
+		return "aarch64"
+	case pe.IMAGE_FILE_MACHINE_RISCV64:
+		return "riscv64"
+	case pe.IMAGE_FILE_MACHINE_LOONGARCH64:
+		return "loongarch64"
+	}
+	return fmt.Sprintf("machine%#x", machine)
+}
+
+// printPEInfo prints the text form of the info subcommand for PE files
+func printPEInfo(info *PEInfo) {
+	fmt.Printf("path:        %s\n", info.Path)
+	fmt.Printf("format:      pe\n")
+	fmt.Printf("size:        %d\n", info.Size)
+	fmt.Printf("file_size:   %d\n", info.FileSize)
+	fmt.Printf("overlay:     %d\n", info.Overlay)
+	fmt.Printf("arch:        %s\n", info.Arch)
+	fmt.Printf("certificate: %d %d\n", info.CertificateOffset, info.CertificateSize)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// PackageBinary is an ELF file of a FreeBSD package
+type PackageBinary struct {
+	Path     string `json:"path"` // where it is installed
+	Size     int64  `json:"size"`
+	FileSize int64  `json:"file_size"`
+	Arch     string `json:"arch"`
+	Type     string `json:"type"`
+	OSABI    string `json:"osabi"`
+}
+
+// PackageInfo is the ELF composition of a FreeBSD package
+type PackageInfo struct {
+	Path      string          `json:"path"` // of the package file
+	Name      string          `json:"name"`
+	Version   string          `json:"version"`
+	ABI       string          `json:"abi"`      // e.g. FreeBSD:14:amd64
+	FlatSize  int64           `json:"flatsize"` // installed size of all files, from the manifest
+	Binaries  []PackageBinary `json:"binaries"`
+	TotalSize int64           `json:"total_size"`      // of the ELF images
+	TotalFile int64           `json:"total_file_size"` // of the ELF files
+	Problems  []string        `json:"problems"`        // files that could not be parsed
+}
+
+// packageManifests are the names of the manifests of pkg(8) packages, in
+// the archive root. +COMPACT_MANIFEST comes first and is enough
+var packageManifests = []string{"+COMPACT_MANIFEST", "+MANIFEST"}
+
+// GetPackageInfo returns the ELF files of a FreeBSD package, a .pkg
+// archive compressed with zstd or the .txz of older pkg versions, with the
+// name, version, ABI and installed size from its manifest. The archive is
+// read as a stream; nothing is extracted
+func GetPackageInfo(filepath string) (*PackageInfo, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	info := &PackageInfo{Path: filepath, Binaries: []PackageBinary{}, Problems: []string{}}
+	manifestSeen := false
+	_, err = walkStreamArchive(io.NewSectionReader(r, 0, 1<<63-1), func(name string, size int64, body io.Reader) error {
+		path := "/" + strings.Join(imagePathComponents(name), "/")
+		for _, manifest := range packageManifests {
+			if path == "/"+manifest {
+				if manifestSeen {
+					return nil
+				}
+				manifestSeen = true
+				return info.readManifest(body)
+			}
+		}
+		data, ok, err := readElfMember(name, size, body)
+		if !ok {
+			return err
+		}
+		if err == nil {
+			err = info.add(path, data)
+		}
+		if err != nil {
+			info.Problems = append(info.Problems, err.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, &FileError{filepath, err}
+	}
+	if !manifestSeen {
+		return nil, &FileError{filepath, errors.New(Tr(msgNotPackage))}
+	}
+	return info, nil
+}
+
+// readManifest takes the name, version, ABI and flat size from a package
+// manifest, which pkg writes as JSON
+func (info *PackageInfo) readManifest(r io.Reader) error {
+	data, err := io.ReadAll(io.LimitReader(r, 16<<20))
+	if err != nil {
+		return err
+	}
+	var manifest struct {
+		Name     string `json:"name"`
+		Version  string `json:"version"`
+		ABI      string `json:"abi"`
+		FlatSize int64  `json:"flatsize"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return errors.New(Tr(msgBadPackageManifest, err))
+	}
+	info.Name, info.Version, info.ABI, info.FlatSize = manifest.Name, manifest.Version, manifest.ABI, manifest.FlatSize
+	return nil
+}
+
+// add counts the ELF file installed at path
+func (info *PackageInfo) add(path string, data []byte) error {
+	elfInfo, err := elfInfoFrom(path, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	info.Binaries = append(info.Binaries, PackageBinary{path, elfInfo.Size, elfInfo.FileSize, elfInfo.Arch, elfInfo.Type, elfInfo.OSABI})
+	info.TotalSize += elfInfo.Size
+	info.TotalFile += elfInfo.FileSize
+	return nil
+}
+
+// pkgCommand implements "elfsize pkg [--json] <package>..."
+func pkgCommand(args []string) int {
+	fs := flag.NewFlagSet("pkg", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the packages as a JSON array")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s pkg [--json] <package>...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    List the ELF files of FreeBSD packages, .pkg or .txz, with their\n")
+		fmt.Fprintf(os.Stderr, "    size, file size, architecture and type, then for each package the\n")
+		fmt.Fprintf(os.Stderr, "    number of ELF files, their sizes and the share of the installed\n")
+		fmt.Fprintf(os.Stderr, "    size they take. Nothing is extracted\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	status := 0
+	packages := []*PackageInfo{}
+	for _, path := range positional {
+		info, err := GetPackageInfo(path)
+		if err != nil {
+			PrintError("pkg", err)
+			status = 1
+			continue
+		}
+		if len(info.Problems) > 0 {
+			status = 1
+		}
+		packages = append(packages, info)
+		if *asJSON {
+			continue
+		}
+		pkg := info.Name + "-" + info.Version
+		for _, b := range info.Binaries {
+			fmt.Printf("%s\t%s\t%d\t%d\t%s\t%s\n", pkg, b.Path, b.Size, b.FileSize, b.Arch, b.Type)
+		}
+		for _, problem := range info.Problems {
+			printWarning("pkg "+path, errors.New(problem))
+		}
+		share := "-"
+		if info.FlatSize > 0 {
+			share = fmt.Sprintf("%.1f%%", float64(info.TotalFile)*100/float64(info.FlatSize))
+		}
+		fmt.Fprintf(os.Stderr, "total\t%s\t%d files\t%d\t%d\t%s of %d\n", pkg, len(info.Binaries), info.TotalSize, info.TotalFile, share, info.FlatSize)
+	}
+	if *asJSON {
+		out, _ := json.MarshalIndent(packages, "", "  ")
+		fmt.Println(string(out))
+	}
+	return status
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PorcelainVersion is the version of the --porcelain field set, printed as
+// its first line. Within a version, the fields, their order and the format
+// of their values never change; new fields mean a new version
+const PorcelainVersion = 1
+
+// porcelainEscaper keeps every value on its line
+var porcelainEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// writePorcelain writes the --porcelain form of info to w: one key=value
+// pair per line, in this order for version 1:
+//
+//	porcelain=1
+//	path=<as given>
+//	size=<bytes>
+//	file_size=<bytes>
+//	overlay=<bytes>
+//	arch=<architecture, e.g. x86_64 or aarch64>
+//	class=<32 or 64>
+//	endianness=<little or big>
+//	type=<exec, pie, shared, rel or core>
+//	osabi=<name>
+//	interpreter=<path, empty if none>
+//	soname=<empty if none>
+//	stripped=<true or false>
+//	build_id=<hex, empty if none>
+//	appimage_type=<0, 1 or 2>
+//
+// Backslashes and newlines in values are written as \\ and \n
+func writePorcelain(w io.Writer, info *ElfInfo) error {
+	fields := []struct {
+		key   string
+		value any
+	}{
+		{"porcelain", PorcelainVersion},
+		{"path", info.Path},
+		{"size", info.Size},
+		{"file_size", info.FileSize},
+		{"overlay", info.Overlay},
+		{"arch", info.Arch},
+		{"class", info.Class},
+		{"endianness", info.Endianness},
+		{"type", info.Type},
+		{"osabi", info.OSABI},
+		{"interpreter", info.Interpreter},
+		{"soname", info.Soname},
+		{"stripped", info.Stripped},
+		{"build_id", info.BuildID},
+		{"appimage_type", info.AppImage},
+	}
+	for _, f := range fields {
+		if _, err := fmt.Fprintf(w, "%s=%s\n", f.key, porcelainEscaper.Replace(fmt.Sprint(f.value))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
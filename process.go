@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// ProcessInfo describes the executable a running process was started from
+type ProcessInfo struct {
+	PID        int    `json:"pid"`
+	Executable string `json:"executable"`
+	// OnDisk is "current" if Executable still is the file that is running,
+	// "replaced" if another file was put in its place since and "deleted"
+	// if there is none
+	OnDisk string   `json:"on_disk"`
+	Info   *ElfInfo `json:"info"` // of the running image, even if it is gone from disk
+}
+
+// GetProcessInfo returns the ProcessInfo of the process with the given pid
+func GetProcessInfo(pid int) (*ProcessInfo, error) {
+	image, executable, err := processExecutable(pid)
+	if err != nil {
+		return nil, err
+	}
+	f, err := openFile(image)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := newElfInfo(executable, f)
+	if err != nil {
+		return nil, err
+	}
+	running, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	p := &ProcessInfo{PID: pid, Executable: executable, OnDisk: "current", Info: info}
+	onDisk, err := os.Stat(executable)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		p.OnDisk = "deleted"
+	case err != nil:
+		return nil, err
+	case !os.SameFile(running, onDisk):
+		p.OnDisk = "replaced"
+	}
+	return p, nil
+}
+
+// printProcessInfo prints a ProcessInfo like the info subcommand
+func printProcessInfo(p *ProcessInfo) {
+	fmt.Printf("pid:         %d\n", p.PID)
+	fmt.Printf("on_disk:     %s\n", p.OnDisk)
+	printElfInfo(p.Info)
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// processExecutable returns a path that opens the image a process is
+// running and the path it was started from, both from procfs
+func processExecutable(pid int) (image, executable string, err error) {
+	image = fmt.Sprintf("/proc/%d/file", pid)
+	executable, err = os.Readlink(image)
+	if err != nil {
+		return "", "", errors.New(Tr(msgNoProcfs, pid, err))
+	}
+	return image, executable, nil
+}
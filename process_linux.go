@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// processExecutable returns a path that opens the image a process is
+// running and the path it was started from
+func processExecutable(pid int) (image, executable string, err error) {
+	image = fmt.Sprintf("/proc/%d/exe", pid)
+	executable, err = os.Readlink(image)
+	if err != nil {
+		return "", "", err
+	}
+	// The kernel marks images that were unlinked, which stat finds out too
+	return image, strings.TrimSuffix(executable, " (deleted)"), nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !freebsd
+
+package main
+
+import (
+	"errors"
+	"runtime"
+)
+
+// processExecutable is not implemented on this system
+func processExecutable(pid int) (image, executable string, err error) {
+	return "", "", errors.New(Tr(msgNoProcesses, runtime.GOOS))
+}
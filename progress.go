@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ProgressFunc receives the progress of a long operation: the bytes
+// processed so far and how many there are in total
+type ProgressFunc func(done, total int64)
+
+// progressStep is how many bytes an operation processes between calls of
+// its ProgressFunc
+const progressStep = 1 << 20
+
+type progressKey struct{}
+
+// WithProgress returns a context that makes the Context variants of the
+// digest, copy and zsync functions report their progress to fn. fn is
+// called from the goroutine doing the work, so it should return quickly
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// progress counts the bytes processed by an operation for the ProgressFunc
+// of its context. A nil *progress counts nothing
+type progress struct {
+	fn                    ProgressFunc
+	done, total, reported int64
+}
+
+// startProgress starts counting an operation that processes total bytes,
+// or returns nil if ctx has no ProgressFunc
+func startProgress(ctx context.Context, total int64) *progress {
+	fn, _ := ctx.Value(progressKey{}).(ProgressFunc)
+	if fn == nil {
+		return nil
+	}
+	fn(0, total)
+	return &progress{fn: fn, total: total}
+}
+
+// add counts n more bytes
+func (p *progress) add(n int64) {
+	if p == nil {
+		return
+	}
+	p.done += n
+	if p.done-p.reported >= progressStep || (p.done >= p.total && p.reported < p.total) {
+		p.reported = p.done
+		p.fn(p.done, p.total)
+	}
+}
+
+// progressBar draws progress on stderr, at most ten times a second
+type progressBar struct {
+	label string
+	last  time.Time
+}
+
+// update implements ProgressFunc. A negative total draws just the count
+func (b *progressBar) update(done, total int64) {
+	if now := time.Now(); now.Sub(b.last) >= 100*time.Millisecond || done == total {
+		b.last = now
+		if total < 0 {
+			fmt.Fprintf(os.Stderr, "\r\033[K%s %s", mebibytes(done), b.label)
+			return
+		}
+		const width = 30
+		percent := int64(100)
+		if total > 0 {
+			percent = min(done*100/total, 100)
+		}
+		filled := int(percent * width / 100)
+		fmt.Fprintf(os.Stderr, "\r\033[K[%s%s] %3d%% %s / %s %s", strings.Repeat("#", filled), strings.Repeat(" ", width-filled),
+			percent, mebibytes(done), mebibytes(total), b.label)
+	}
+}
+
+// finish erases the bar, so that it does not mix with the output, and
+// makes the next update draw it again. A nil bar does nothing
+func (b *progressBar) finish() {
+	if b != nil && !b.last.IsZero() {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+		b.last = time.Time{}
+	}
+}
+
+// mebibytes formats a size for progress bars
+func mebibytes(n int64) string {
+	return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+}
+
+// progressContext returns a context that draws the progress of operations
+// on a bar labeled with label if enabled is set, and the bar to finish, or
+// nil
+func progressContext(enabled bool, label string) (context.Context, *progressBar) {
+	if !enabled {
+		return context.Background(), nil
+	}
+	b := &progressBar{label: label}
+	return WithProgress(context.Background(), b.update), b
+}
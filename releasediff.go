@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// releaseArtifact is a file of a release tree
+type releaseArtifact struct {
+	Path      string // relative to the tree
+	Size      int64
+	Info      *ElfInfo // nil unless the file is an ELF file or an AppImage
+	Needed    []string
+	Hardening *Hardening
+}
+
+// ReleaseChange describes how an artifact differs between two releases
+type ReleaseChange struct {
+	Status      string   `json:"status"`             // "added", "removed", "changed" or "renamed"
+	Path        string   `json:"path,omitempty"`     // empty if removed
+	OldPath     string   `json:"old_path,omitempty"` // set if removed or renamed
+	OldSize     int64    `json:"old_size"`
+	NewSize     int64    `json:"new_size"`
+	OldArch     string   `json:"old_arch,omitempty"`
+	NewArch     string   `json:"new_arch,omitempty"`
+	AddedDeps   []string `json:"added_deps,omitempty"`
+	RemovedDeps []string `json:"removed_deps,omitempty"`
+	Regressions []string `json:"hardening_regressions,omitempty"`
+}
+
+// SizeDelta returns how much the artifact grew
+func (c ReleaseChange) SizeDelta() int64 {
+	return c.NewSize - c.OldSize
+}
+
+// loadReleaseTree collects the artifacts below root
+func loadReleaseTree(root string) (map[string]*releaseArtifact, error) {
+	artifacts := map[string]*releaseArtifact{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		a, err := loadReleaseArtifact(path)
+		if err != nil {
+			return err
+		}
+		a.Path = filepath.ToSlash(rel)
+		artifacts[a.Path] = a
+		return nil
+	})
+	return artifacts, err
+}
+
+// loadReleaseArtifact analyzes a single file. Files that are not ELF are
+// compared by size only
+func loadReleaseArtifact(path string) (*releaseArtifact, error) {
+	r, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	stat, err := r.Stat()
+	if err != nil {
+		return nil, err
+	}
+	a := &releaseArtifact{Size: stat.Size()}
+	f, err := parseElf(path, r)
+	if err != nil {
+		return a, nil
+	}
+	if a.Info, err = newElfInfo(path, r); err != nil {
+		return nil, err
+	}
+	if a.Needed, err = f.ImportedLibraries(); err != nil {
+		return nil, err
+	}
+	if a.Hardening, err = elfHardening(f); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// CompareReleases pairs the artifacts of two release trees by relative path,
+// and then the remaining ELF files by build-id, and returns what changed.
+// Unchanged artifacts are left out
+func CompareReleases(oldDir string, newDir string) ([]ReleaseChange, error) {
+	oldTree, err := loadReleaseTree(oldDir)
+	if err != nil {
+		return nil, err
+	}
+	newTree, err := loadReleaseTree(newDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []ReleaseChange
+	pair := func(o, n *releaseArtifact) {
+		if c, changed := compareArtifacts(o, n); changed {
+			changes = append(changes, c)
+		}
+		delete(oldTree, o.Path)
+		delete(newTree, n.Path)
+	}
+	for path, n := range newTree {
+		if o, ok := oldTree[path]; ok {
+			pair(o, n)
+		}
+	}
+	byBuildID := map[string]*releaseArtifact{}
+	for _, o := range oldTree {
+		if o.Info != nil && o.Info.BuildID != "" {
+			byBuildID[o.Info.BuildID] = o
+		}
+	}
+	for _, n := range newTree {
+		if n.Info == nil || n.Info.BuildID == "" {
+			continue
+		}
+		if o, ok := byBuildID[n.Info.BuildID]; ok {
+			delete(byBuildID, n.Info.BuildID)
+			pair(o, n)
+		}
+	}
+	for _, o := range oldTree {
+		changes = append(changes, ReleaseChange{Status: "removed", OldPath: o.Path, OldSize: o.Size})
+	}
+	for _, n := range newTree {
+		changes = append(changes, ReleaseChange{Status: "added", Path: n.Path, NewSize: n.Size})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return releaseChangeKey(changes[i]) < releaseChangeKey(changes[j])
+	})
+	return changes, nil
+}
+
+func releaseChangeKey(c ReleaseChange) string {
+	if c.Path != "" {
+		return c.Path
+	}
+	return c.OldPath
+}
+
+// compareArtifacts returns the differences between two versions of an
+// artifact, and whether there are any
+func compareArtifacts(o, n *releaseArtifact) (ReleaseChange, bool) {
+	c := ReleaseChange{Status: "changed", Path: n.Path, OldSize: o.Size, NewSize: n.Size}
+	if o.Path != n.Path {
+		c.Status, c.OldPath = "renamed", o.Path
+	}
+	if o.Info != nil && n.Info != nil {
+		if o.Info.Arch != n.Info.Arch {
+			c.OldArch, c.NewArch = o.Info.Arch, n.Info.Arch
+		}
+		c.AddedDeps = missingFrom(n.Needed, o.Needed)
+		c.RemovedDeps = missingFrom(o.Needed, n.Needed)
+		c.Regressions = hardeningRegressions(o.Hardening, n.Hardening)
+	}
+	changed := c.Status == "renamed" || c.SizeDelta() != 0 || c.OldArch != "" ||
+		len(c.AddedDeps) > 0 || len(c.RemovedDeps) > 0 || len(c.Regressions) > 0
+	return c, changed
+}
+
+// missingFrom returns the elements of a that are not in b
+func missingFrom(a, b []string) []string {
+	have := map[string]bool{}
+	for _, s := range b {
+		have[s] = true
+	}
+	var missing []string
+	for _, s := range a {
+		if !have[s] {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
+
+// relroLevels orders the RELRO levels from weakest to strongest
+var relroLevels = map[string]int{RelroNone: 0, RelroPartial: 1, RelroFull: 2}
+
+// hardeningRegressions returns the mitigations that n lost compared to o
+func hardeningRegressions(o, n *Hardening) []string {
+	var lost []string
+	if relroLevels[n.RELRO] < relroLevels[o.RELRO] {
+		lost = append(lost, "relro "+o.RELRO+" -> "+n.RELRO)
+	}
+	for _, m := range []struct {
+		name     string
+		old, new bool
+	}{
+		{"pie", o.PIE, n.PIE},
+		{"nx", o.NX, n.NX},
+		{"canary", o.Canary, n.Canary},
+		{"fortify", o.Fortify, n.Fortify},
+		{"no textrel", !o.TextRel, !n.TextRel},
+	} {
+		if m.old && !m.new {
+			lost = append(lost, m.name)
+		}
+	}
+	return lost
+}
+
+// releaseDiffCommand implements "elfsize release-diff <old dir> <new dir>"
+func releaseDiffCommand(args []string) int {
+	fs := flag.NewFlagSet("release-diff", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the changes as a JSON array")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s release-diff [--json] <old dir> <new dir>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Report size, architecture, dependency and hardening changes between two release trees\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	changes, err := CompareReleases(positional[0], positional[1])
+	if err != nil {
+		PrintError("release-diff", err)
+		return 1
+	}
+	if *asJSON {
+		if changes == nil {
+			changes = []ReleaseChange{}
+		}
+		out, _ := json.MarshalIndent(changes, "", "  ")
+		fmt.Println(string(out))
+		return 0
+	}
+
+	var total int64
+	for _, c := range changes {
+		total += c.SizeDelta()
+		switch c.Status {
+		case "removed":
+			fmt.Printf("%s\t%s\t%+d\n", c.Status, c.OldPath, c.SizeDelta())
+		case "renamed":
+			fmt.Printf("%s\t%s\t%+d\t(%s)\n", c.Status, c.Path, c.SizeDelta(), c.OldPath)
+		default:
+			fmt.Printf("%s\t%s\t%+d\n", c.Status, c.Path, c.SizeDelta())
+		}
+		if c.OldArch != "" {
+			fmt.Printf("\tarch: %s -> %s\n", c.OldArch, c.NewArch)
+		}
+		if len(c.AddedDeps) > 0 || len(c.RemovedDeps) > 0 {
+			var deps []string
+			for _, d := range c.AddedDeps {
+				deps = append(deps, "+"+d)
+			}
+			for _, d := range c.RemovedDeps {
+				deps = append(deps, "-"+d)
+			}
+			fmt.Printf("\tneeded: %s\n", strings.Join(deps, " "))
+		}
+		if len(c.Regressions) > 0 {
+			fmt.Printf("\thardening lost: %s\n", strings.Join(c.Regressions, ", "))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "total\t%+d\n", total)
+	return 0
+}
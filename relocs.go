@@ -0,0 +1,240 @@
+package main
+
+import (
+	"debug/elf"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/bits"
+	"os"
+	"strings"
+)
+
+// RelocationSection counts the relocations of one SHT_REL, SHT_RELA or
+// SHT_RELR section
+type RelocationSection struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"` // "REL", "RELA" or "RELR"
+	Size     uint64 `json:"size"`
+	Count    int    `json:"count"`
+	Relative int    `json:"relative"` // cheap ones that need no symbol lookup
+	Copy     int    `json:"copy"`
+}
+
+// CopyRelocation is an R_*_COPY relocation, which makes the loader copy a
+// variable of a shared library into the executable at startup
+type CopyRelocation struct {
+	Symbol string `json:"symbol"`
+	Size   uint64 `json:"size"`
+}
+
+// RelocationStats summarizes the relocations of an ELF file
+type RelocationStats struct {
+	Sections []RelocationSection `json:"sections"`
+	Count    int                 `json:"count"`
+	Size     uint64              `json:"size"`
+	Relative int                 `json:"relative"`
+	Copies   []CopyRelocation    `json:"copies"`
+	CopySize uint64              `json:"copy_size"` // bytes copied at startup
+	TextRel  bool                `json:"textrel"`   // code is relocated, not built with -fPIC
+}
+
+// relocTypes are the R_*_COPY and R_*_RELATIVE types of the machines that
+// have them
+var relocTypes = map[elf.Machine]struct{ copy, relative uint32 }{
+	elf.EM_X86_64:    {uint32(elf.R_X86_64_COPY), uint32(elf.R_X86_64_RELATIVE)},
+	elf.EM_386:       {uint32(elf.R_386_COPY), uint32(elf.R_386_RELATIVE)},
+	elf.EM_AARCH64:   {uint32(elf.R_AARCH64_COPY), uint32(elf.R_AARCH64_RELATIVE)},
+	elf.EM_ARM:       {uint32(elf.R_ARM_COPY), uint32(elf.R_ARM_RELATIVE)},
+	elf.EM_PPC:       {uint32(elf.R_PPC_COPY), uint32(elf.R_PPC_RELATIVE)},
+	elf.EM_PPC64:     {uint32(elf.R_PPC64_COPY), uint32(elf.R_PPC64_RELATIVE)},
+	elf.EM_RISCV:     {uint32(elf.R_RISCV_COPY), uint32(elf.R_RISCV_RELATIVE)},
+	elf.EM_S390:      {uint32(elf.R_390_COPY), uint32(elf.R_390_RELATIVE)},
+	elf.EM_SPARC:     {uint32(elf.R_SPARC_COPY), uint32(elf.R_SPARC_RELATIVE)},
+	elf.EM_SPARCV9:   {uint32(elf.R_SPARC_COPY), uint32(elf.R_SPARC_RELATIVE)},
+	elf.EM_LOONGARCH: {uint32(elf.R_LARCH_COPY), uint32(elf.R_LARCH_RELATIVE)},
+}
+
+// GetRelocationStats returns the number and size of the relocations of an
+// ELF file per section, its COPY relocations and whether it has text
+// relocations
+func GetRelocationStats(filepath string) (*RelocationStats, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return nil, err
+	}
+	return elfRelocationStats(f)
+}
+
+// elfRelocationStats does the work of GetRelocationStats
+func elfRelocationStats(f *elf.File) (*RelocationStats, error) {
+	stats := &RelocationStats{Sections: []RelocationSection{}, Copies: []CopyRelocation{}}
+	types, known := relocTypes[f.Machine]
+	dynsyms, _ := f.DynamicSymbols()
+	for _, s := range f.Sections {
+		if s.Type != elf.SHT_REL && s.Type != elf.SHT_RELA && s.Type != shtRelr {
+			continue
+		}
+		rs := RelocationSection{Name: s.Name, Type: strings.TrimPrefix(s.Type.String(), "SHT_"), Size: s.Size}
+		data, err := s.Data()
+		if err != nil {
+			return nil, err
+		}
+		if s.Type == shtRelr {
+			rs.Type = "RELR"
+			rs.Count = relrCount(f, data)
+			rs.Relative = rs.Count
+		} else {
+			size := relocEntrySize(f, s)
+			for off := 0; off+size <= len(data); off += size {
+				typ, sym := relocInfo(f, data[off:off+size])
+				rs.Count++
+				switch {
+				case !known:
+				case typ == types.relative:
+					rs.Relative++
+				case typ == types.copy:
+					rs.Copy++
+					copyReloc := CopyRelocation{}
+					if sym > 0 && int(sym) <= len(dynsyms) {
+						copyReloc = CopyRelocation{dynsyms[sym-1].Name, dynsyms[sym-1].Size}
+					}
+					stats.Copies = append(stats.Copies, copyReloc)
+					stats.CopySize += copyReloc.Size
+				}
+			}
+		}
+		stats.Sections = append(stats.Sections, rs)
+		stats.Count += rs.Count
+		stats.Size += rs.Size
+		stats.Relative += rs.Relative
+	}
+	textRel, err := elfTextRel(f)
+	if err != nil {
+		return nil, err
+	}
+	stats.TextRel = textRel
+	return stats, nil
+}
+
+// relocEntrySize returns the size of the entries of a SHT_REL or SHT_RELA
+// section, from sh_entsize or else from the class of the file
+func relocEntrySize(f *elf.File, s *elf.Section) int {
+	if s.Entsize > 0 {
+		return int(s.Entsize)
+	}
+	size := 8
+	if f.Class == elf.ELFCLASS64 {
+		size = 16
+	}
+	if s.Type == elf.SHT_RELA {
+		size += size / 2
+	}
+	return size
+}
+
+// relocInfo returns the type and symbol index of a relocation from its
+// r_info field, which follows r_offset
+func relocInfo(f *elf.File, entry []byte) (typ, sym uint32) {
+	if f.Class == elf.ELFCLASS64 {
+		info := f.ByteOrder.Uint64(entry[8:])
+		return elf.R_TYPE64(info), elf.R_SYM64(info)
+	}
+	info := f.ByteOrder.Uint32(entry[4:])
+	return elf.R_TYPE32(info), elf.R_SYM32(info)
+}
+
+// relrCount returns the number of relocations a SHT_RELR section describes:
+// one for every address entry, and one for every set bit but the lowest of
+// every bitmap entry
+func relrCount(f *elf.File, data []byte) int {
+	count := 0
+	if f.Class == elf.ELFCLASS64 {
+		for off := 0; off+8 <= len(data); off += 8 {
+			entry := f.ByteOrder.Uint64(data[off:])
+			if entry&1 == 0 {
+				count++
+			} else {
+				count += bits.OnesCount64(entry) - 1
+			}
+		}
+		return count
+	}
+	for off := 0; off+4 <= len(data); off += 4 {
+		entry := f.ByteOrder.Uint32(data[off:])
+		if entry&1 == 0 {
+			count++
+		} else {
+			count += bits.OnesCount32(entry) - 1
+		}
+	}
+	return count
+}
+
+// elfTextRel reports whether a file has text relocations, from DT_TEXTREL or
+// DF_TEXTREL
+func elfTextRel(f *elf.File) (bool, error) {
+	flags, err := dynValue(f, elf.DT_FLAGS)
+	if err != nil {
+		return false, err
+	}
+	textRel, err := f.DynValue(elf.DT_TEXTREL)
+	if err != nil {
+		return false, err
+	}
+	return len(textRel) > 0 || flags&uint64(elf.DF_TEXTREL) != 0, nil
+}
+
+// relocsCommand implements "elfsize relocs [--json] <file>"
+func relocsCommand(args []string) int {
+	fs := flag.NewFlagSet("relocs", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the statistics as JSON")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s relocs [--json] <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the size and number of relocations of every relocation section,\n")
+		fmt.Fprintf(os.Stderr, "    how many of them are relative or COPY relocations, and the symbols the\n")
+		fmt.Fprintf(os.Stderr, "    COPY relocations copy at startup\n")
+		fmt.Fprintf(os.Stderr, "    Exits with 1 if the file has text relocations\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	stats, err := GetRelocationStats(positional[0])
+	if err != nil {
+		PrintError("relocs", err)
+		return 1
+	}
+	status := 0
+	if stats.TextRel {
+		status = 1
+	}
+	if *asJSON {
+		out, _ := json.MarshalIndent(stats, "", "  ")
+		fmt.Println(string(out))
+		return status
+	}
+	for _, s := range stats.Sections {
+		fmt.Printf("%s\t%s\t%d\t%d\t%d\t%d\n", s.Name, s.Type, s.Size, s.Count, s.Relative, s.Copy)
+	}
+	fmt.Printf("total\t\t%d\t%d\t%d\t%d\n", stats.Size, stats.Count, stats.Relative, len(stats.Copies))
+	for _, c := range stats.Copies {
+		fmt.Printf("copy\t%s\t%d\n", c.Symbol, c.Size)
+	}
+	if stats.TextRel {
+		fmt.Fprintln(os.Stderr, Tr(msgTextRel, positional[0]))
+	}
+	return status
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"debug/elf"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// shtRelr is SHT_RELR, the highest generic section type
+const shtRelr = 19
+
+// HeaderRepair is a field of the ELF header changed by RepairSectionHeaders
+// or EditHeader
+type HeaderRepair struct {
+	Field string `json:"field"`
+	Old   uint64 `json:"old"`
+	New   uint64 `json:"new"`
+}
+
+// RepairSectionHeaders recomputes e_shoff, e_shnum, e_shentsize and
+// e_shstrndx of a file whose section header table is intact but no longer
+// described correctly by the ELF header, e.g. after a bad download. The
+// table is searched for from the end of the segments on: a null entry
+// followed by plausible ones, one of them .shstrtab. The repaired file is
+// written to output, or to the file itself if output is empty. Nothing is
+// written and no repairs are returned if the fields are consistent
+func RepairSectionHeaders(filepath string, output string) ([]HeaderRepair, error) {
+	img, err := loadElfImage(filepath)
+	if err != nil {
+		return nil, err
+	}
+	h, err := img.header()
+	if err != nil {
+		return nil, err
+	}
+	entsize := img.sectionEntrySize()
+	if h.Shentsize == uint16(entsize) && img.sectionTableAt(h.Shoff, int(h.Shnum)) == int(h.Shnum) && img.isShstrtab(h.Shoff, h.Shstrndx) {
+		return nil, nil
+	}
+
+	// The ELF header may be too broken for debug/elf, but the program
+	// headers are intact
+	start := uint64(img.headerSize())
+	progs, err := img.progs()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range progs {
+		start = max(start, alignUp(p.Off+p.Filesz, img.wordSize()))
+	}
+	var best struct {
+		off      uint64
+		num      int
+		shstrndx uint16
+	}
+	for off := start; off+2*entsize <= uint64(len(img.data)); off += img.wordSize() {
+		num := img.sectionTableAt(off, 0)
+		if num < 2 || num <= best.num || num > 0xffff {
+			continue
+		}
+		for i := 1; i < num; i++ {
+			if img.isShstrtab(off, uint16(i)) {
+				best.off, best.num, best.shstrndx = off, num, uint16(i)
+				break
+			}
+		}
+	}
+	if best.num == 0 {
+		return nil, errors.New(Tr(msgNoSectionTable, filepath))
+	}
+
+	var repairs []HeaderRepair
+	for _, field := range []struct {
+		name     string
+		old, new uint64
+	}{
+		{"e_shoff", h.Shoff, best.off},
+		{"e_shentsize", uint64(h.Shentsize), entsize},
+		{"e_shnum", uint64(h.Shnum), uint64(best.num)},
+		{"e_shstrndx", uint64(h.Shstrndx), uint64(best.shstrndx)},
+	} {
+		if field.old != field.new {
+			repairs = append(repairs, HeaderRepair{field.name, field.old, field.new})
+		}
+	}
+	h.Shoff, h.Shentsize, h.Shnum, h.Shstrndx = best.off, uint16(entsize), uint16(best.num), best.shstrndx
+	if err := img.setHeader(h); err != nil {
+		return nil, err
+	}
+	if output == "" {
+		output = filepath
+	}
+	return repairs, writeFileAtomic(output, img.data, img.mode)
+}
+
+// sectionTableAt returns how many plausible section headers follow a null
+// one at off, or checks num of them if num is not 0 and returns num if they
+// are all plausible
+func (img *elfImage) sectionTableAt(off uint64, num int) int {
+	entsize := img.sectionEntrySize()
+	if off == 0 || off+entsize > uint64(len(img.data)) || off%4 != 0 {
+		return 0
+	}
+	for _, b := range img.data[off : off+entsize] {
+		if b != 0 {
+			return 0
+		}
+	}
+	i := 1
+	for ; num == 0 || i < num; i++ {
+		s, err := img.sectionAt(off + uint64(i)*entsize)
+		if err != nil || !img.plausibleSection(s) {
+			break
+		}
+	}
+	if num != 0 && i != num {
+		return 0
+	}
+	return i
+}
+
+// plausibleSection reports whether s looks like a section header rather than
+// other data: a known type, contents within the file and a valid alignment
+func (img *elfImage) plausibleSection(s sectionHeader) bool {
+	if s.Type == elf.SHT_NULL || (s.Type > shtRelr && s.Type < elf.SHT_LOOS) {
+		return false
+	}
+	if s.Type != elf.SHT_NOBITS && (s.Off+s.Size < s.Off || s.Off+s.Size > uint64(len(img.data))) {
+		return false
+	}
+	return s.Addralign&(s.Addralign-1) == 0
+}
+
+// isShstrtab reports whether section index of the table at off is a string
+// table that names itself .shstrtab
+func (img *elfImage) isShstrtab(off uint64, index uint16) bool {
+	s, err := img.sectionAt(off + uint64(index)*img.sectionEntrySize())
+	if err != nil || s.Type != elf.SHT_STRTAB || uint64(s.Name) >= s.Size || s.Off+s.Size > uint64(len(img.data)) {
+		return false
+	}
+	return img.cString(s.Off+uint64(s.Name)) == ".shstrtab"
+}
+
+// repairCommand implements "elfsize repair <file> [-o output | --in-place]"
+func repairCommand(args []string) int {
+	fs := flag.NewFlagSet("repair", flag.ContinueOnError)
+	output := fs.String("o", "", "write the repaired file here (default <file>.repaired)")
+	inPlace := fs.Bool("in-place", false, "repair the file itself instead of writing a copy")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s repair <file> [-o output | --in-place]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Find the section header table of a file whose ELF header no longer\n")
+		fmt.Fprintf(os.Stderr, "    describes it correctly and rewrite e_shoff, e_shentsize, e_shnum and\n")
+		fmt.Fprintf(os.Stderr, "    e_shstrndx, printing each change. This is a best effort\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 || (*inPlace && *output != "") {
+		fs.Usage()
+		return 2
+	}
+
+	if !*inPlace && *output == "" {
+		*output = positional[0] + ".repaired"
+	}
+	repairs, err := RepairSectionHeaders(positional[0], *output)
+	if err != nil {
+		PrintError("repair", err)
+		return 1
+	}
+	if repairs == nil {
+		fmt.Println(Tr(msgNothingToRepair, positional[0]))
+		return 0
+	}
+	for _, r := range repairs {
+		fmt.Printf("%s\t%d\t%d\n", r.Field, r.Old, r.New)
+	}
+	return 0
+}
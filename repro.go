@@ -0,0 +1,199 @@
+package main
+
+import (
+	"debug/buildinfo"
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ReproFinding is content of an ELF file that likely differs between two
+// builds of the same source. Code identifies the kind of finding and does
+// not change between releases or languages
+type ReproFinding struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Section string `json:"section,omitempty"`
+	Offset  int64  `json:"offset"` // in the section, -1 if not applicable
+	Value   string `json:"value"`
+}
+
+// reproPatterns find what __DATE__, __TIME__ and __TIMESTAMP__ expand to,
+// and other timestamps, in strings, as the first subexpression
+var reproPatterns = []struct {
+	id messageID
+	re *regexp.Regexp
+}{
+	{msgReproDate, regexp.MustCompile(`\b((?:Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) [ 0-3][0-9] (?:19|20)[0-9][0-9])\b`)},
+	{msgReproTime, regexp.MustCompile(`(?:^|[^0-9:])((?:[01][0-9]|2[0-3]):[0-5][0-9]:[0-5][0-9])(?:[^0-9:]|$)`)},
+	{msgReproTimestamp, regexp.MustCompile(`\b((?:19|20)[0-9][0-9]-[01][0-9]-[0-3][0-9][T ][0-2][0-9]:[0-5][0-9])`)},
+}
+
+// sourcePath matches absolute paths of source files, as __FILE__ and
+// assert() embed them
+var sourcePath = regexp.MustCompile(`(^|[\s"'(=:])(/[^\s"':]+\.(c|cc|cpp|cxx|h|hh|hpp|m|mm|go|rs|s|S|zig))\b`)
+
+// reproducibility collects the findings of AuditReproducibility
+type reproducibility struct {
+	findings []ReproFinding
+}
+
+func (rp *reproducibility) report(section string, offset int64, value string, id messageID, args ...interface{}) {
+	rp.findings = append(rp.findings, ReproFinding{string(id), Tr(id, args...), section, offset, value})
+}
+
+// AuditReproducibility looks for what makes builds of an ELF file
+// irreproducible: dates, times and timestamps, absolute paths of source
+// files and the build directory in the strings of its data sections, build
+// directories recorded in DWARF, Go binaries built without -trimpath, and
+// build-ids that may be random UUIDs rather than hashes of the contents.
+// Findings in strings give the matching part as Value and its offset.
+// These are heuristics; a string that looks like a date may just be one
+func AuditReproducibility(filepath string) ([]ReproFinding, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return nil, err
+	}
+	rp := &reproducibility{}
+
+	// ld --build-id=uuid makes random ones of 16 bytes; sha1 ones, the
+	// default, have 20. md5 ones have 16 too but are rare
+	if id, err := elfBuildID(f); err == nil && len(id) == 16 {
+		rp.report(".note.gnu.build-id", -1, hex.EncodeToString(id), msgReproBuildID)
+	}
+
+	var buildDirs []string
+	if d, err := f.DWARF(); err == nil {
+		buildDirs = dwarfBuildDirs(d)
+		for _, dir := range buildDirs {
+			rp.report(".debug_info", -1, dir, msgReproCompDir, dir)
+		}
+	}
+	if bi, err := buildinfo.Read(r); err == nil && goBuildSetting(bi, "-trimpath") != "true" {
+		rp.report(".go.buildinfo", -1, bi.Path, msgReproTrimpath)
+	}
+
+	for _, s := range f.Sections {
+		// The file names Go records for its tracebacks are up to -trimpath
+		if s.Type != elf.SHT_PROGBITS || s.Flags&elf.SHF_EXECINSTR != 0 || strings.HasPrefix(s.Name, ".debug") || strings.HasPrefix(s.Name, ".go") {
+			continue
+		}
+		name := s.Name
+		err := WalkSectionStrings(filepath, name, 6, "s", func(str ExtractedString) error {
+			for _, p := range reproPatterns {
+				for _, loc := range p.re.FindAllStringSubmatchIndex(str.Value, -1) {
+					if m := str.Value[loc[2]:loc[3]]; !goReferenceTime(m) {
+						rp.report(name, str.Offset+int64(loc[2]), m, p.id, m)
+					}
+				}
+			}
+			for _, m := range sourcePath.FindAllStringSubmatchIndex(str.Value, -1) {
+				path := str.Value[m[4]:m[5]]
+				rp.report(name, str.Offset+int64(m[4]), path, msgReproSourcePath, path)
+			}
+			for _, dir := range buildDirs {
+				if i := strings.Index(str.Value, dir); i >= 0 && !sourcePath.MatchString(str.Value[i:]) {
+					rp.report(name, str.Offset+int64(i), dir, msgReproBuildDir, dir)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rp.findings, nil
+}
+
+// goReferenceTime reports whether a time or date is part of the reference
+// time Go's time package has in its layouts, Mon Jan 2 15:04:05 MST 2006
+func goReferenceTime(m string) bool {
+	return m == "15:04:05" || strings.HasPrefix(m, "2006-01-02")
+}
+
+// dwarfBuildDirs returns the distinct absolute DW_AT_comp_dir of the
+// compilation units, which are the directories the compiler ran in unless
+// mapped with -fdebug-prefix-map
+func dwarfBuildDirs(d *dwarf.Data) []string {
+	var dirs []string
+	seen := map[string]bool{}
+	r := d.Reader()
+	for {
+		entry, err := r.Next()
+		if err != nil || entry == nil {
+			break
+		}
+		if entry.Tag == dwarf.TagCompileUnit || entry.Tag == dwarf.TagPartialUnit {
+			if dir, ok := entry.Val(dwarf.AttrCompDir).(string); ok && strings.HasPrefix(dir, "/") && len(dir) > 1 && !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
+		}
+		r.SkipChildren()
+	}
+	return dirs
+}
+
+// reproCommand implements "elfsize repro [--json] <file>..."
+func reproCommand(args []string) int {
+	fs := flag.NewFlagSet("repro", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the findings as JSON, by file")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s repro [--json] <file>...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Look for content that makes builds irreproducible: __DATE__, __TIME__\n")
+		fmt.Fprintf(os.Stderr, "    and other timestamps, absolute source and build paths, Go builds\n")
+		fmt.Fprintf(os.Stderr, "    without -trimpath and random build-ids, printing one per line: file,\n")
+		fmt.Fprintf(os.Stderr, "    code, section, offset in it, and the string found. Exit with 0 if\n")
+		fmt.Fprintf(os.Stderr, "    there are none, 1 if there are and 2 on errors\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	status := 0
+	results := map[string][]ReproFinding{}
+	for _, path := range positional {
+		findings, err := AuditReproducibility(path)
+		if err != nil {
+			PrintError("repro "+path, err)
+			status = 2
+			continue
+		}
+		if len(findings) > 0 && status == 0 {
+			status = 1
+		}
+		if *asJSON {
+			if findings == nil {
+				findings = []ReproFinding{}
+			}
+			results[path] = findings
+			continue
+		}
+		for _, finding := range findings {
+			fmt.Printf("%s\t%s\t%s\t%d\t%s\n", path, finding.Code, finding.Section, finding.Offset, finding.Value)
+		}
+	}
+	if *asJSON {
+		out, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Println(string(out))
+	}
+	return status
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runtimeSections are reserved in the runtime and filled in by the tool that
+// appends the filesystem image
+var runtimeSections = []string{".upd_info", ".sha256_sig"}
+
+// defaultRuntimeMaxSize is the default limit for verify-runtime
+const defaultRuntimeMaxSize = 2 << 20
+
+// VerifyRuntime checks whether an ELF file can serve as the runtime of a type
+// 2 AppImage: it must not carry trailing data, must be no larger than maxSize
+// bytes, must contain the AppImage magic and the reserved sections, and must
+// be statically linked or have all its libraries available. It returns the
+// problems found, none if the runtime is usable
+func VerifyRuntime(filepath string, maxSize int64) ([]Problem, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := r.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []Problem
+	report := func(id messageID, args ...interface{}) {
+		problems = append(problems, newProblem(id, args...))
+	}
+	if size := calculateElfSize(r); size < stat.Size() {
+		report(msgRuntimeTrailing, stat.Size()-size)
+	}
+	if stat.Size() > maxSize {
+		report(msgRuntimeTooLarge, stat.Size(), maxSize)
+	}
+	if appImageType(r) != 2 {
+		report(msgRuntimeNoMagic)
+	}
+	for _, name := range runtimeSections {
+		if f.Section(name) == nil {
+			report(msgRuntimeNoSection, name)
+		}
+	}
+
+	needed, err := f.ImportedLibraries()
+	if err != nil {
+		return nil, err
+	}
+	if len(needed) > 0 {
+		libs, err := ResolveDependencies(filepath)
+		if err != nil {
+			return nil, err
+		}
+		for _, lib := range libs {
+			if lib.Path == "" {
+				report(msgRuntimeMissingLib, lib.Name, lib.NeededBy)
+			}
+		}
+	}
+	return problems, nil
+}
+
+// verifyRuntimeCommand implements "elfsize verify-runtime <file>"
+func verifyRuntimeCommand(args []string) int {
+	fs := flag.NewFlagSet("verify-runtime", flag.ContinueOnError)
+	maxSize := fs.Int64("max-size", defaultRuntimeMaxSize, "largest acceptable runtime in bytes")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s verify-runtime <file> [--max-size bytes]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Check that an ELF file can be used as the runtime of a type 2 AppImage\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	problems, err := VerifyRuntime(positional[0], *maxSize)
+	if err != nil {
+		PrintError("verify-runtime", err)
+		return 1
+	}
+	for _, p := range problems {
+		fmt.Printf("%s: %s [%s]\n", positional[0], p.Message, p.ID)
+	}
+	if len(problems) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"debug/buildinfo"
+	"debug/elf"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SBOMComponent is what a software bill of materials records about an ELF
+// file, independent of the format
+type SBOMComponent struct {
+	Path      string      `json:"path"`
+	Name      string      `json:"name"`
+	Type      string      `json:"type"` // "application" or "library"
+	Arch      string      `json:"arch"`
+	BuildID   string      `json:"build_id"`
+	Soname    string      `json:"soname"`
+	SHA1      string      `json:"sha1"`
+	SHA256    string      `json:"sha256"`
+	Needed    []string    `json:"needed"`     // DT_NEEDED entries
+	GoModules []GoModule  `json:"go_modules"` // the main module first
+	Toolchain []Toolchain `json:"toolchain"`
+}
+
+// GoModule is a Go module linked into a binary
+type GoModule struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+}
+
+// purl returns the package URL of a Go module
+func (m GoModule) purl() string {
+	if m.Version == "" || m.Version == "(devel)" {
+		return "pkg:golang/" + m.Path
+	}
+	return "pkg:golang/" + m.Path + "@" + m.Version
+}
+
+// GetSBOMComponent collects what a software bill of materials records
+// about an ELF file: its name, type, architecture, build-id and hashes, the
+// libraries it needs, the Go modules linked into it and the toolchains
+// that built it
+func GetSBOMComponent(path string) (*SBOMComponent, error) {
+	r, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(path, r)
+	if err != nil {
+		return nil, err
+	}
+	c := &SBOMComponent{Path: path, Name: filepath.Base(path), Type: "application", Arch: elfArchitecture(f), Needed: []string{}, GoModules: []GoModule{}}
+	if id, err := elfBuildID(f); err == nil {
+		c.BuildID = hex.EncodeToString(id)
+	}
+	if sonames, err := f.DynString(elf.DT_SONAME); err == nil && len(sonames) > 0 {
+		c.Soname = sonames[0]
+	}
+	if f.Type == elf.ET_REL || (c.Soname != "" && !hasProg(f, elf.PT_INTERP)) {
+		c.Type = "library"
+	}
+	if c.Needed, err = f.ImportedLibraries(); err != nil {
+		return nil, err
+	}
+	if c.Needed == nil {
+		c.Needed = []string{}
+	}
+	if bi, err := buildinfo.Read(r); err == nil {
+		c.GoModules = append(c.GoModules, GoModule{bi.Main.Path, bi.Main.Version})
+		for _, dep := range bi.Deps {
+			if dep.Replace != nil {
+				dep = dep.Replace
+			}
+			c.GoModules = append(c.GoModules, GoModule{dep.Path, dep.Version})
+		}
+	}
+
+	h1, h256 := sha1.New(), sha256.New()
+	if _, err := io.Copy(io.MultiWriter(h1, h256), io.NewSectionReader(r, 0, 1<<63-1)); err != nil {
+		return nil, err
+	}
+	c.SHA1, c.SHA256 = hex.EncodeToString(h1.Sum(nil)), hex.EncodeToString(h256.Sum(nil))
+
+	if c.Toolchain, err = GetToolchains(path); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// sbomTime returns the creation time to record, SOURCE_DATE_EPOCH if set so
+// that the output is reproducible
+func sbomTime() string {
+	if epoch, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		return time.Unix(epoch, 0).UTC().Format(time.RFC3339)
+	}
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+// spdxID turns a string into the characters an SPDX identifier may contain
+func spdxID(prefix, s string) string {
+	return prefix + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '-'
+	}, s)
+}
+
+// WriteSPDX writes an SPDX 2.3 JSON document with a package for each
+// component, the Go modules it contains and the libraries it depends on
+func WriteSPDX(w io.Writer, components []*SBOMComponent) error {
+	type checksum struct {
+		Algorithm string `json:"algorithm"`
+		Value     string `json:"checksumValue"`
+	}
+	type externalRef struct {
+		Category string `json:"referenceCategory"`
+		Type     string `json:"referenceType"`
+		Locator  string `json:"referenceLocator"`
+	}
+	type pkg struct {
+		ID            string        `json:"SPDXID"`
+		Name          string        `json:"name"`
+		Version       string        `json:"versionInfo,omitempty"`
+		Download      string        `json:"downloadLocation"`
+		FilesAnalyzed bool          `json:"filesAnalyzed"`
+		Checksums     []checksum    `json:"checksums,omitempty"`
+		Purpose       string        `json:"primaryPackagePurpose,omitempty"`
+		Comment       string        `json:"comment,omitempty"`
+		ExternalRefs  []externalRef `json:"externalRefs,omitempty"`
+	}
+	type relationship struct {
+		Element string `json:"spdxElementId"`
+		Type    string `json:"relationshipType"`
+		Related string `json:"relatedSpdxElement"`
+	}
+	doc := struct {
+		Version       string         `json:"spdxVersion"`
+		DataLicense   string         `json:"dataLicense"`
+		ID            string         `json:"SPDXID"`
+		Name          string         `json:"name"`
+		Namespace     string         `json:"documentNamespace"`
+		CreationInfo  any            `json:"creationInfo"`
+		Packages      []pkg          `json:"packages"`
+		Relationships []relationship `json:"relationships"`
+	}{
+		Version:     "SPDX-2.3",
+		DataLicense: "CC0-1.0",
+		ID:          "SPDXRef-DOCUMENT",
+		CreationInfo: map[string]any{
+			"created":  sbomTime(),
+			"creators": []string{"Tool: elfsize"},
+		},
+		Packages:      []pkg{},
+		Relationships: []relationship{},
+	}
+
+	var names []string
+	ns := sha256.New()
+	seen := map[string]bool{}
+	for i, c := range components {
+		names = append(names, c.Name)
+		ns.Write([]byte(c.SHA256))
+		id := spdxID(fmt.Sprintf("SPDXRef-%d-", i+1), c.Name)
+		comment := "arch: " + c.Arch
+		if c.BuildID != "" {
+			comment += ", build-id: " + c.BuildID
+		}
+		if c.Soname != "" {
+			comment += ", soname: " + c.Soname
+		}
+		for _, t := range c.Toolchain {
+			comment += ", " + t.Kind + ": " + strings.TrimSpace(t.Name+" "+t.Version)
+		}
+		doc.Packages = append(doc.Packages, pkg{
+			ID: id, Name: c.Name, Download: "NOASSERTION",
+			Checksums: []checksum{{"SHA1", c.SHA1}, {"SHA256", c.SHA256}},
+			Purpose:   strings.ToUpper(c.Type), Comment: comment,
+		})
+		doc.Relationships = append(doc.Relationships, relationship{"SPDXRef-DOCUMENT", "DESCRIBES", id})
+		for _, m := range c.GoModules {
+			modID := spdxID("SPDXRef-gomod-", m.Path+"-"+m.Version)
+			if !seen[modID] {
+				seen[modID] = true
+				doc.Packages = append(doc.Packages, pkg{
+					ID: modID, Name: m.Path, Version: m.Version, Download: "NOASSERTION",
+					Purpose:      "LIBRARY",
+					ExternalRefs: []externalRef{{"PACKAGE-MANAGER", "purl", m.purl()}},
+				})
+			}
+			doc.Relationships = append(doc.Relationships, relationship{id, "CONTAINS", modID})
+		}
+		for _, lib := range c.Needed {
+			libID := spdxID("SPDXRef-needed-", lib)
+			if !seen[libID] {
+				seen[libID] = true
+				doc.Packages = append(doc.Packages, pkg{ID: libID, Name: lib, Download: "NOASSERTION", Purpose: "LIBRARY"})
+			}
+			doc.Relationships = append(doc.Relationships, relationship{id, "DEPENDS_ON", libID})
+		}
+	}
+	doc.Name = strings.Join(names, ", ")
+	doc.Namespace = "https://spdx.org/spdxdocs/elfsize-" + hex.EncodeToString(ns.Sum(nil))[:32]
+
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(out))
+	return err
+}
+
+// WriteCycloneDX writes a CycloneDX 1.5 JSON BOM with a component for each
+// component, the Go modules it contains as its subcomponents and the
+// libraries it needs as dependencies
+func WriteCycloneDX(w io.Writer, components []*SBOMComponent) error {
+	type hash struct {
+		Alg     string `json:"alg"`
+		Content string `json:"content"`
+	}
+	type property struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	type component struct {
+		Type       string      `json:"type"`
+		Ref        string      `json:"bom-ref"`
+		Name       string      `json:"name"`
+		Version    string      `json:"version,omitempty"`
+		Purl       string      `json:"purl,omitempty"`
+		Hashes     []hash      `json:"hashes,omitempty"`
+		Properties []property  `json:"properties,omitempty"`
+		Components []component `json:"components,omitempty"`
+	}
+	type dependency struct {
+		Ref       string   `json:"ref"`
+		DependsOn []string `json:"dependsOn"`
+	}
+	bom := struct {
+		Format       string       `json:"bomFormat"`
+		Spec         string       `json:"specVersion"`
+		Version      int          `json:"version"`
+		Metadata     any          `json:"metadata"`
+		Components   []component  `json:"components"`
+		Dependencies []dependency `json:"dependencies"`
+	}{
+		Format:  "CycloneDX",
+		Spec:    "1.5",
+		Version: 1,
+		Metadata: map[string]any{
+			"timestamp": sbomTime(),
+			"tools":     map[string]any{"components": []map[string]string{{"type": "application", "name": "elfsize"}}},
+		},
+		Components:   []component{},
+		Dependencies: []dependency{},
+	}
+
+	seen := map[string]bool{}
+	for i, c := range components {
+		ref := fmt.Sprintf("elf-%d-%s", i+1, c.Name)
+		props := []property{{"elfsize:arch", c.Arch}}
+		if c.BuildID != "" {
+			props = append(props, property{"elfsize:build-id", c.BuildID})
+		}
+		if c.Soname != "" {
+			props = append(props, property{"elfsize:soname", c.Soname})
+		}
+		for _, t := range c.Toolchain {
+			props = append(props, property{"elfsize:" + t.Kind, strings.TrimSpace(t.Name + " " + t.Version)})
+		}
+		comp := component{
+			Type: c.Type, Ref: ref, Name: c.Name,
+			Hashes:     []hash{{"SHA-1", c.SHA1}, {"SHA-256", c.SHA256}},
+			Properties: props,
+		}
+		for _, m := range c.GoModules {
+			comp.Components = append(comp.Components, component{Type: "library", Ref: ref + ":" + m.purl(), Name: m.Path, Version: m.Version, Purl: m.purl()})
+		}
+		bom.Components = append(bom.Components, comp)
+		dep := dependency{Ref: ref, DependsOn: []string{}}
+		for _, lib := range c.Needed {
+			libRef := "needed:" + lib
+			if !seen[libRef] {
+				seen[libRef] = true
+				bom.Components = append(bom.Components, component{Type: "library", Ref: libRef, Name: lib})
+			}
+			dep.DependsOn = append(dep.DependsOn, libRef)
+		}
+		bom.Dependencies = append(bom.Dependencies, dep)
+	}
+
+	out, err := json.MarshalIndent(bom, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(out))
+	return err
+}
+
+// sbomCommand implements "elfsize sbom [--format spdx|cyclonedx] <file>..."
+func sbomCommand(args []string) int {
+	fs := flag.NewFlagSet("sbom", flag.ContinueOnError)
+	format := fs.String("format", "spdx", "spdx for SPDX 2.3, cyclonedx for CycloneDX 1.5, json for the plain data")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s sbom [--format spdx|cyclonedx|json] <file>...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print a software bill of materials for ELF files: name, architecture,\n")
+		fmt.Fprintf(os.Stderr, "    build-id, SHA-1 and SHA-256, the DT_NEEDED libraries and the Go\n")
+		fmt.Fprintf(os.Stderr, "    modules linked in. The creation time is $SOURCE_DATE_EPOCH if set\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) == 0 {
+		fs.Usage()
+		return 2
+	}
+	write := map[string]func(io.Writer, []*SBOMComponent) error{
+		"spdx":      WriteSPDX,
+		"cyclonedx": WriteCycloneDX,
+		"json": func(w io.Writer, components []*SBOMComponent) error {
+			out, _ := json.MarshalIndent(components, "", "  ")
+			_, err := fmt.Fprintln(w, string(out))
+			return err
+		},
+	}[*format]
+	if write == nil {
+		PrintError("sbom", errors.New(Tr(msgBadSBOMFormat, *format)))
+		return 2
+	}
+
+	status := 0
+	var components []*SBOMComponent
+	for _, path := range positional {
+		c, err := GetSBOMComponent(path)
+		if err != nil {
+			PrintError("sbom", err)
+			status = 1
+			continue
+		}
+		components = append(components, c)
+	}
+	if len(components) == 0 {
+		return 1
+	}
+	if err := write(os.Stdout, components); err != nil {
+		PrintError("sbom", err)
+		return 1
+	}
+	return status
+}
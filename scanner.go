@@ -0,0 +1,550 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"debug/elf"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+// Scanner collects the ElfInfo of many files. The optional hooks let
+// embedding applications drive progress displays and metrics
+type Scanner struct {
+	// OnFileStart is called before a file is opened
+	OnFileStart func(path string)
+	// OnFileDone is called with the result for every file that was parsed
+	OnFileDone func(info *ElfInfo)
+	// OnError is called for every file or directory that could not be processed
+	OnError func(path string, err error)
+	// Cache, if set, holds the ElfInfo of files by device, inode and
+	// modification time, so that unchanged files are not parsed again.
+	// These keys are only valid on this machine, so it must not be shared
+	// with others, as an HTTPCache would be
+	Cache Cache
+	// FollowLinks makes Scan descend into symbolic links to directories and
+	// scan every file once, however many links lead to it
+	FollowLinks bool
+	// SkipLinks makes Scan leave out the symbolic links it finds in
+	// directories. Without either, links to files are scanned and links to
+	// directories are left out
+	SkipLinks bool
+	// Filter, if set, leaves out the files it does not match, as if they
+	// were not there
+	Filter *Filter
+	// Archives makes Scan report the ELF files in the tar and cpio archives
+	// it finds in directories, compressed or not, as archive:path. Archives
+	// given by name are always scanned
+	Archives bool
+	// Stream makes Scan return nothing, for scans too large to keep the
+	// results of in memory; use OnFileDone to get at them
+	Stream bool
+
+	stopped atomic.Bool
+	ctx     context.Context // of the running scan
+	seen    map[string]bool // identities of the files and directories scanned with FollowLinks
+}
+
+// Stop makes a running Scan return after the file it is working on.
+// It is safe to call from another goroutine, e.g. a signal handler
+func (s *Scanner) Stop() {
+	s.stopped.Store(true)
+}
+
+// Stopped reports whether Stop was called
+func (s *Scanner) Stopped() bool {
+	return s.stopped.Load()
+}
+
+// done reports whether the running scan should stop, calling Stop once its
+// context is done
+func (s *Scanner) done() bool {
+	if s.ctx.Err() != nil {
+		s.Stop()
+	}
+	return s.Stopped()
+}
+
+// Scan returns the ElfInfo of every given file, descending into directories.
+// Files in directories are only parsed if they start with the ELF magic,
+// whatever their name. Files that cannot be processed are reported to
+// OnError and left out.
+// If Stop is called, the results collected so far are returned
+func (s *Scanner) Scan(paths ...string) []*ElfInfo {
+	return s.ScanContext(context.Background(), paths...)
+}
+
+// ScanContext is Scan, stopping as if Stop was called once ctx is done.
+// Requests to a ContextCache are canceled with ctx
+func (s *Scanner) ScanContext(ctx context.Context, paths ...string) []*ElfInfo {
+	s.ctx = ctx
+	var infos []*ElfInfo
+	s.seen = map[string]bool{}
+	for _, root := range paths {
+		if s.done() {
+			break
+		}
+		// Links given by name are always followed, as by find -H
+		if target := linkTarget(root); target != "" {
+			if stat, err := os.Stat(target); err == nil && stat.IsDir() {
+				s.walk(target, root, &infos)
+				continue
+			}
+		}
+		s.walk(root, root, &infos)
+	}
+	return infos
+}
+
+// walk scans the tree at dir, reporting the paths in it as if dir was at
+// display
+func (s *Scanner) walk(dir, display string, infos *[]*ElfInfo) {
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if s.done() {
+			return fs.SkipAll
+		}
+		if dir != display {
+			rel, _ := filepath.Rel(dir, path)
+			path = filepath.Join(display, rel)
+		}
+		if err != nil {
+			s.fail(path, err)
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 && path != display {
+			if s.SkipLinks {
+				return nil
+			}
+			stat, err := os.Stat(path)
+			if err != nil {
+				s.fail(path, err)
+				return nil
+			}
+			if stat.IsDir() {
+				if s.FollowLinks {
+					target, _ := filepath.EvalSymlinks(path)
+					s.walk(target, path, infos)
+				}
+				return nil
+			}
+		}
+		if s.FollowLinks {
+			stat, err := os.Stat(path)
+			if err == nil && !s.firstVisit(path, stat) {
+				if stat.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if (path == display || s.Archives) && isStreamArchiveEntry(path, d) {
+			s.scanArchive(path, infos)
+			return nil
+		}
+		if path != display && !isElfCandidate(path, d) {
+			return nil
+		}
+		if info := s.scanFile(path); info != nil && !s.Stream {
+			*infos = append(*infos, info)
+		}
+		return nil
+	})
+}
+
+// isElfCandidate reports whether a file found in a directory is worth
+// parsing: a regular file, or a link to one, that starts with the ELF magic.
+// Scripts, data and special files are left out, which is only logged at
+// LogVerbose. Files that cannot be read are candidates, so that scanFile
+// reports the error
+func isElfCandidate(path string, d fs.DirEntry) bool {
+	if d.Type()&fs.ModeSymlink != 0 {
+		if stat, err := os.Stat(path); err != nil || !stat.Mode().IsRegular() {
+			return false
+		}
+	} else if !d.Type().IsRegular() {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return true
+	}
+	defer f.Close()
+	var magic [4]byte
+	n, err := io.ReadFull(f, magic[:])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return true
+	}
+	if string(magic[:n]) != elf.ELFMAG {
+		logMessage(LogVerbose, msgSkipNotELF, path)
+		return false
+	}
+	return true
+}
+
+// firstVisit records a file or directory and reports whether it was not
+// seen before under another path
+func (s *Scanner) firstVisit(path string, stat os.FileInfo) bool {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	id := fileIdentity(path, stat)
+	if s.seen[id] {
+		return false
+	}
+	s.seen[id] = true
+	return true
+}
+
+// scanFile returns the ElfInfo of a single file, or nil after reporting an error
+func (s *Scanner) scanFile(path string) *ElfInfo {
+	if s.OnFileStart != nil {
+		s.OnFileStart(path)
+	}
+	logMessage(LogVerbose, msgScanning, path)
+	f, err := openFile(path)
+	if err != nil {
+		s.fail(path, err)
+		return nil
+	}
+	defer f.Close()
+	var key string
+	if s.Cache != nil {
+		stat, err := f.Stat()
+		if err != nil {
+			s.fail(path, err)
+			return nil
+		}
+		key = fileCacheKey("info", path, stat)
+	}
+	info := &ElfInfo{}
+	err = cachedAnalysis(s.ctx, s.Cache, key, info, func() error {
+		computed, err := newElfInfo(path, f)
+		if err == nil {
+			*info = *computed
+		}
+		return err
+	})
+	if err != nil {
+		s.fail(path, err)
+		return nil
+	}
+	// A cached result may have been stored under another link to the file
+	info.Path = path
+	info.Target = linkTarget(path)
+	if s.Filter != nil && !s.Filter.Match(info) {
+		return nil
+	}
+	if s.OnFileDone != nil {
+		s.OnFileDone(info)
+	}
+	return info
+}
+
+func (s *Scanner) fail(path string, err error) {
+	if s.OnError != nil {
+		s.OnError(path, err)
+	}
+}
+
+// scanLargest is how many of the largest files the summary of a scan lists
+const scanLargest = 10
+
+// scanSummary is the summary printed at the end of a scan
+type scanSummary struct {
+	Files         int                     `json:"files"`
+	TotalSize     int64                   `json:"total_size"`
+	TotalFileSize int64                   `json:"total_file_size"`
+	TotalOverlay  int64                   `json:"total_overlay"`
+	Arches        map[string]*archSummary `json:"arches"`
+	Largest       []scanLargestFile       `json:"largest"` // by file size, largest first
+}
+
+// archSummary is the part of a scanSummary for one architecture
+type archSummary struct {
+	Files     int   `json:"files"`
+	TotalSize int64 `json:"total_size"`
+}
+
+// scanLargestFile is an entry of the largest files of a scan
+type scanLargestFile struct {
+	Path     string `json:"path"`
+	FileSize int64  `json:"file_size"`
+}
+
+// add counts a file
+func (s *scanSummary) add(info *ElfInfo) {
+	s.Files++
+	s.TotalSize += info.Size
+	s.TotalFileSize += info.FileSize
+	s.TotalOverlay += info.Overlay
+	arch := s.Arches[info.Arch]
+	if arch == nil {
+		arch = &archSummary{}
+		s.Arches[info.Arch] = arch
+	}
+	arch.Files++
+	arch.TotalSize += info.Size
+	i := sort.Search(len(s.Largest), func(i int) bool { return s.Largest[i].FileSize < info.FileSize })
+	if i < scanLargest {
+		s.Largest = slices.Insert(s.Largest, i, scanLargestFile{info.Path, info.FileSize})
+		s.Largest = s.Largest[:min(len(s.Largest), scanLargest)]
+	}
+}
+
+// print prints the text form of the summary to w
+func (s *scanSummary) print(w io.Writer) {
+	fmt.Fprintf(w, "files:       %d\n", s.Files)
+	fmt.Fprintf(w, "elf_bytes:   %d\n", s.TotalSize)
+	fmt.Fprintf(w, "overlay:     %d\n", s.TotalOverlay)
+	fmt.Fprintf(w, "file_bytes:  %d\n", s.TotalFileSize)
+	arches := make([]string, 0, len(s.Arches))
+	for arch := range s.Arches {
+		arches = append(arches, arch)
+	}
+	sort.Strings(arches)
+	for _, arch := range arches {
+		fmt.Fprintf(w, "arch:        %s %d files, %d bytes\n", arch, s.Arches[arch].Files, s.Arches[arch].TotalSize)
+	}
+	for _, f := range s.Largest {
+		fmt.Fprintf(w, "largest:     %d %s\n", f.FileSize, f.Path)
+	}
+}
+
+// scanSortOrder returns the comparison of ElfInfos for the --sort flag of
+// scan, or nil if spec is empty: a key, reversed by a leading "-". Ties are
+// broken by path
+func scanSortOrder(spec string) (func(a, b *ElfInfo) int, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	key, descending := strings.CutPrefix(spec, "-")
+	keys := map[string]func(a, b *ElfInfo) int{
+		"size":      func(a, b *ElfInfo) int { return cmp.Compare(a.Size, b.Size) },
+		"file_size": func(a, b *ElfInfo) int { return cmp.Compare(a.FileSize, b.FileSize) },
+		"overlay":   func(a, b *ElfInfo) int { return cmp.Compare(a.Overlay, b.Overlay) },
+		"path":      func(a, b *ElfInfo) int { return 0 },
+		"arch":      func(a, b *ElfInfo) int { return strings.Compare(a.Arch, b.Arch) },
+	}
+	compare, ok := keys[key]
+	if !ok {
+		return nil, errors.New(Tr(msgUnknownSortKey, spec))
+	}
+	return func(a, b *ElfInfo) int {
+		c := compare(a, b)
+		if c == 0 {
+			c = strings.Compare(a.Path, b.Path)
+		}
+		if descending {
+			return -c
+		}
+		return c
+	}, nil
+}
+
+// scanColumns are the columns of the csv and tsv formats of scan. Add new
+// ones at the end to keep scripts working
+var scanColumns = []string{"path", "size", "file_size", "overlay", "arch", "type", "target", "slack"}
+
+// scanRow returns the scanColumns of a file
+func scanRow(info *ElfInfo) []string {
+	return []string{
+		info.Path,
+		strconv.FormatInt(info.Size, 10),
+		strconv.FormatInt(info.FileSize, 10),
+		strconv.FormatInt(info.Overlay, 10),
+		info.Arch,
+		info.Type,
+		info.Target,
+		strconv.FormatInt(info.Slack, 10),
+	}
+}
+
+// scanCommand implements "elfsize scan [--format=text|json|jsonl|csv|tsv] <path>..."
+func scanCommand(args []string) int {
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the results as a JSON document, like --format=json")
+	formatTemplate := fs.String("format-template", "", "print every result through a Go template, e.g. '{{.Path}} {{.Size}} {{.Arch}}'")
+	cacheDir := fs.String("cache", os.Getenv("ELFSIZE_SCAN_CACHE"), "local directory caching results by device, inode and modification time (default $ELFSIZE_SCAN_CACHE)")
+	follow := fs.Bool("follow", false, "descend into symbolic links to directories and scan every file once, however many links lead to it")
+	noFollow := fs.Bool("no-follow", false, "leave out the symbolic links found in directories")
+	archives := fs.Bool("archives", false, "also report the ELF files in the tar and cpio archives found in directories, such as initramfs images and release tarballs")
+	format := fs.String("format", "text", "print the results as text, json, one JSON object per line (jsonl), csv or tsv")
+	showProgress := fs.Bool("progress", false, "draw the number of files and bytes scanned so far on stderr")
+	showSummary := fs.Bool("summary", false, fmt.Sprintf("print totals of ELF and overlay bytes, by architecture, and the %d largest files to stderr at the end", scanLargest))
+	sortKey := fs.String("sort", "", "sort the results by size, file_size, overlay, path or arch, descending with a leading '-', e.g. --sort=-size")
+	var filter *Filter
+	fs.Var(filterFlag{&filter}, "where", "print only the files matching an expression, e.g. 'overlay > 1M && arch == \"x86_64\"'")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s scan [--format=text|json|jsonl|csv|tsv] <file or directory>...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the size of every ELF file, descending into directories\n")
+		fmt.Fprintf(os.Stderr, "    and tar and cpio archives given by name, which may be compressed\n")
+		fmt.Fprintf(os.Stderr, "    with gzip, bzip2, xz or zstd; their ELF files are read as a stream\n")
+		fmt.Fprintf(os.Stderr, "    and printed as archive:path\n")
+		fmt.Fprintf(os.Stderr, "    On SIGINT or SIGTERM the scan stops after the current file,\n")
+		fmt.Fprintf(os.Stderr, "    prints what it has and exits with 128 plus the signal number\n")
+		fmt.Fprintf(os.Stderr, "    --where compares the fields of the JSON output with ==, !=, <, <=, >,\n")
+		fmt.Fprintf(os.Stderr, "    >= and =~ (a regular expression), combined with &&, || and !\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	if *asJSON {
+		*format = "json"
+	}
+	tmpl, err := parseFormatTemplate(*formatTemplate)
+	if err != nil {
+		PrintError("scan", err)
+		return 2
+	}
+	var table *csv.Writer
+	switch *format {
+	case "text", "json", "jsonl":
+	case "csv", "tsv":
+		table = csv.NewWriter(os.Stdout)
+		if *format == "tsv" {
+			table.Comma = '\t'
+		}
+		table.Write(scanColumns)
+	default:
+		logMessage(slog.LevelError, msgUnknownFormat, *format)
+		return 2
+	}
+
+	if *follow && *noFollow {
+		fs.Usage()
+		return 2
+	}
+	compare, err := scanSortOrder(*sortKey)
+	if err != nil {
+		PrintError("scan", err)
+		return 2
+	}
+	scanner := &Scanner{Stream: *format != "json", FollowLinks: *follow, SkipLinks: *noFollow, Archives: *archives, Filter: filter}
+	if *cacheDir != "" {
+		if isCacheURL(*cacheDir) {
+			PrintError("scan", errors.New(Tr(msgScanCacheRemote, *cacheDir)))
+			return 2
+		}
+		scanner.Cache = DirCache{*cacheDir}
+	}
+	status := 0
+	summary := scanSummary{Arches: map[string]*archSummary{}, Largest: []scanLargestFile{}}
+	var bar *progressBar
+	if *showProgress {
+		bar = &progressBar{}
+	}
+	// Results printed to the terminal go between redraws of the bar
+	interleave := *format != "json" && isTerminal(os.Stdout)
+	scanner.OnError = func(path string, err error) {
+		bar.finish()
+		PrintError("scan "+path, err)
+		status = 1
+	}
+	output := func(info *ElfInfo) {
+		switch {
+		case tmpl != nil:
+			if err := tmpl.Execute(os.Stdout, info); err != nil {
+				PrintError("scan "+info.Path, err)
+				status = 1
+			}
+		case table != nil:
+			table.Write(scanRow(info))
+		case *format == "jsonl":
+			out, _ := json.Marshal(info)
+			fmt.Println(string(out))
+		case *format == "text" && info.Target != "":
+			fmt.Printf("%d\t%s -> %s\n", info.Size, info.Path, info.Target)
+		case *format == "text":
+			fmt.Printf("%d\t%s\n", info.Size, info.Path)
+		}
+	}
+	var sorted []*ElfInfo
+	scanner.OnFileDone = func(info *ElfInfo) {
+		summary.add(info)
+		if compare != nil {
+			// Sorted results can only be printed at the end
+			sorted = append(sorted, info)
+		} else {
+			if bar != nil && interleave {
+				bar.finish()
+			}
+			output(info)
+		}
+		if bar != nil {
+			bar.label = fmt.Sprintf("in %d files", summary.Files)
+			bar.update(summary.TotalSize, -1)
+		}
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	var received atomic.Value
+	go func() {
+		sig := <-signals
+		received.Store(sig)
+		scanner.Stop()
+	}()
+
+	infos := scanner.Scan(positional...)
+	signal.Stop(signals)
+	bar.finish()
+	if compare != nil {
+		slices.SortStableFunc(infos, compare)
+		slices.SortStableFunc(sorted, compare)
+		for _, info := range sorted {
+			output(info)
+		}
+	}
+
+	if table != nil {
+		table.Flush()
+	}
+	if *format == "json" {
+		if infos == nil {
+			infos = []*ElfInfo{}
+		}
+		out, _ := json.MarshalIndent(struct {
+			Files     []*ElfInfo  `json:"files"`
+			Summary   scanSummary `json:"summary"`
+			Truncated bool        `json:"truncated"`
+		}{infos, summary, scanner.Stopped()}, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		if *showSummary {
+			summary.print(os.Stderr)
+		} else {
+			fmt.Fprintf(os.Stderr, "%d files, %d bytes\n", summary.Files, summary.TotalSize)
+		}
+	}
+
+	if sig, ok := received.Load().(syscall.Signal); ok {
+		return 128 + int(sig)
+	}
+	return status
+}
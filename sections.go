@@ -0,0 +1,474 @@
+package main
+
+import (
+	"compress/zlib"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// SectionData is the name, location and contents of one ELF section
+type SectionData struct {
+	Name   string
+	Offset uint64
+	Size   uint64
+	Data   []byte // nil for SHT_NOBITS sections
+}
+
+// matchSections returns the sections of f whose names match the glob
+// pattern, e.g. ".debug_*", in section header order
+func matchSections(f *elf.File, pattern string) ([]*elf.Section, error) {
+	// Validate the pattern even if there are no sections to match
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	var matches []*elf.Section
+	for _, s := range f.Sections {
+		if ok, _ := path.Match(pattern, s.Name); ok {
+			matches = append(matches, s)
+		}
+	}
+	return matches, nil
+}
+
+// findSection returns the section called name, or the first section matching
+// name as a glob pattern, or nil
+func findSection(f *elf.File, name string) (*elf.Section, error) {
+	if s := f.Section(name); s != nil {
+		return s, nil
+	}
+	matches, err := matchSections(f, name)
+	if err != nil || len(matches) == 0 {
+		return nil, err
+	}
+	return matches[0], nil
+}
+
+// ErrSectionNotFound is returned, wrapped with the file and section name,
+// when a file has no section of the requested name
+var ErrSectionNotFound = errors.New(Tr(msgSectionNotFound))
+
+// sectionNotFound returns ErrSectionNotFound for the section name of a file
+func sectionNotFound(filepath string, name string) error {
+	return &FileError{filepath, fmt.Errorf("%s: %w", name, ErrSectionNotFound)}
+}
+
+// MaxSectionSize limits the size of the sections GetSectionData and
+// GetSectionReader hand out, after decompression, and of the notes read
+// into memory, if it is larger than 0. It bounds the memory hostile files
+// can make long-running processes allocate; see also MaxSections
+var MaxSectionSize int64 = 1 << 30
+
+// sectionReader returns a reader for the contents of s and their size.
+// Unless raw is set, sections compressed with SHF_COMPRESSED (zlib or zstd)
+// or in the older GNU .zdebug format are decompressed
+func sectionReader(r io.ReaderAt, s *elf.Section, raw bool) (io.Reader, int64, error) {
+	var sr io.Reader
+	var size int64
+	switch {
+	case raw:
+		sr, size = io.NewSectionReader(r, int64(s.Offset), int64(s.FileSize)), int64(s.FileSize)
+	case s.Flags&elf.SHF_COMPRESSED == 0 && strings.HasPrefix(s.Name, ".zdebug") && s.FileSize >= 12:
+		// "ZLIB", the big-endian uncompressed size, then a zlib stream
+		var header [12]byte
+		if _, err := r.ReadAt(header[:], int64(s.Offset)); err != nil {
+			return nil, 0, err
+		}
+		if string(header[:4]) != "ZLIB" {
+			sr, size = s.Open(), int64(s.Size)
+			break
+		}
+		z, err := zlib.NewReader(io.NewSectionReader(r, int64(s.Offset)+12, int64(s.FileSize)-12))
+		if err != nil {
+			return nil, 0, err
+		}
+		sr, size = z, int64(binary.BigEndian.Uint64(header[4:]))
+	default:
+		// debug/elf takes care of SHF_COMPRESSED itself
+		sr, size = s.Open(), int64(s.Size)
+	}
+	if MaxSectionSize > 0 && size > MaxSectionSize {
+		return nil, 0, limitExceeded(msgSectionTooLarge, s.Name, size, MaxSectionSize)
+	}
+	return io.LimitReader(sr, size), size, nil
+}
+
+// readSection returns the contents of s, see sectionReader
+func readSection(r io.ReaderAt, s *elf.Section, raw bool) ([]byte, error) {
+	sr, size, err := sectionReader(r, s, raw)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(sr)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != size {
+		return nil, errors.New(Tr(msgShortSection, s.Name))
+	}
+	return data, nil
+}
+
+// sectionReadCloser closes the file a section is read from
+type sectionReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// GetSectionReader returns a reader for the contents of an ELF section and
+// their size, decompressing them like GetSectionData but without reading them
+// into memory. The section is looked up like in GetSectionData. The caller
+// must close the reader
+func GetSectionReader(filepath string, name string) (io.ReadCloser, int64, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, 0, err
+	}
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		r.Close()
+		return nil, 0, err
+	}
+	section, err := findSection(f, name)
+	if err == nil && section == nil {
+		err = sectionNotFound(filepath, name)
+	}
+	if err != nil {
+		r.Close()
+		return nil, 0, err
+	}
+	sr, size, err := sectionReader(r, section, false)
+	if err != nil {
+		r.Close()
+		return nil, 0, err
+	}
+	return sectionReadCloser{sr, r}, size, nil
+}
+
+// GetMatchingSections returns the contents of all sections whose names match
+// the glob pattern, in section header order
+func GetMatchingSections(filepath string, pattern string) ([]SectionData, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := matchSections(f, pattern)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]SectionData, 0, len(matches))
+	for _, s := range matches {
+		sd := SectionData{Name: s.Name, Offset: s.Offset, Size: s.Size}
+		if s.Type != elf.SHT_NOBITS {
+			if sd.Data, err = readSection(r, s, false); err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, sd)
+	}
+	return result, nil
+}
+
+// SectionInfo describes a section without its contents, which
+// GetSectionDataByIndex returns
+type SectionInfo struct {
+	Index  int // in the section header table
+	Name   string
+	Type   elf.SectionType
+	Flags  elf.SectionFlag
+	Offset uint64
+	Size   uint64 // in memory, and in the file unless Type is SHT_NOBITS
+}
+
+// GetSections returns all sections of a file in section header order,
+// starting with the null section
+func GetSections(filepath string) ([]SectionInfo, error) {
+	var sections []SectionInfo
+	err := WalkSections(filepath, func(s SectionInfo) error {
+		sections = append(sections, s)
+		return nil
+	})
+	return sections, err
+}
+
+// GetSectionNames returns the names of all sections of a file in section
+// header order, starting with the empty name of the null section.
+// Names may repeat
+func GetSectionNames(filepath string) ([]string, error) {
+	var names []string
+	err := WalkSections(filepath, func(s SectionInfo) error {
+		names = append(names, s.Name)
+		return nil
+	})
+	return names, err
+}
+
+// WalkSections calls fn for every section of a file in section header
+// order. If fn returns an error, WalkSections stops and returns it, unless
+// it is fs.SkipAll, which just stops the walk
+func WalkSections(filepath string, fn func(SectionInfo) error) error {
+	r, err := openFile(filepath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return err
+	}
+	for i, s := range f.Sections {
+		err := fn(SectionInfo{Index: i, Name: s.Name, Type: s.Type, Flags: s.Flags, Offset: s.Offset, Size: s.Size})
+		if err == fs.SkipAll {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sectionsCommand implements "elfsize sections [--hash algorithm] <file> [pattern...]"
+func sectionsCommand(args []string) int {
+	fs := flag.NewFlagSet("sections", flag.ContinueOnError)
+	algorithm := fs.String("hash", "", "also print the digest of the contents of each section with this algorithm, e.g. sha256, or - for SHT_NOBITS sections")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s sections [--hash algorithm] <file> [pattern...]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the name, offset and size of the sections matching the glob patterns, e.g. '.debug_*'\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) < 1 {
+		fs.Usage()
+		return 2
+	}
+	patterns := positional[1:]
+	if len(patterns) == 0 {
+		patterns = []string{"*"}
+	}
+
+	r, err := openFile(positional[0])
+	if err != nil {
+		PrintError("sections", err)
+		return 1
+	}
+	defer r.Close()
+	f, err := parseElf(positional[0], r)
+	if err != nil {
+		PrintError("sections", err)
+		return 1
+	}
+	if *algorithm != "" {
+		if _, err := newHash(*algorithm); err != nil {
+			PrintError("sections", err)
+			return 2
+		}
+	}
+	for _, pattern := range patterns {
+		matches, err := matchSections(f, pattern)
+		if err != nil {
+			PrintError("sections", err)
+			return 2
+		}
+		for _, s := range matches {
+			if *algorithm == "" {
+				fmt.Printf("%s\t%d\t%d\n", s.Name, s.Offset, s.Size)
+				continue
+			}
+			digest, err := sectionDigest(r, s, *algorithm)
+			if err != nil {
+				PrintError("sections", err)
+				return 1
+			}
+			if digest == "" {
+				digest = "-"
+			}
+			fmt.Printf("%s\t%d\t%d\t%s\n", s.Name, s.Offset, s.Size, digest)
+		}
+	}
+	return 0
+}
+
+// SetSectionData overwrites the contents of an existing section in place,
+// padding them with NULs, and returns err. Nothing else in the file moves, so
+// this works on AppImages with their payload appended, e.g. to fill in the
+// .upd_info and .sha256_sig placeholders. It fails if data does not fit
+func SetSectionData(filepath string, name string, data []byte) error {
+	w, err := openFileForUpdate(filepath)
+	if err != nil {
+		return err
+	}
+	f, err := parseElf(filepath, w)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	section := f.Section(name)
+	switch {
+	case section == nil:
+		err = sectionNotFound(filepath, name)
+	case section.Type == elf.SHT_NOBITS || section.Flags&elf.SHF_COMPRESSED != 0:
+		err = errors.New(Tr(msgSectionNotWritable, name))
+	case uint64(len(data)) > section.FileSize:
+		err = errors.New(Tr(msgSectionTooSmall, name, section.FileSize, len(data)))
+	}
+	if err != nil {
+		w.Close()
+		return err
+	}
+	padded := make([]byte, section.FileSize)
+	copy(padded, data)
+	if _, err := w.WriteAt(padded, int64(section.Offset)); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// setSectionCommand implements "elfsize set-section <file> <section> <data file>"
+func setSectionCommand(args []string) int {
+	fs := flag.NewFlagSet("set-section", flag.ContinueOnError)
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s set-section <file> <section> <data file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Overwrite the contents of a section in place with a file, or stdin if it is '-'\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 3 {
+		fs.Usage()
+		return 2
+	}
+
+	data, err := readDataArg(positional[2])
+	if err == nil {
+		err = SetSectionData(positional[0], positional[1], data)
+	}
+	if err != nil {
+		PrintError("set-section", err)
+		return 1
+	}
+	return 0
+}
+
+// readDataArg reads the file named on the command line, or stdin for "-"
+func readDataArg(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// AddSection adds a section that is not loaded at run time, such as an icon
+// or a manifest, to an ELF file and returns err. The contents and a new
+// section name string table are appended, followed by the section header
+// table. The file is rewritten to output, or in place if output is empty
+func AddSection(filepath string, name string, data []byte, output string) error {
+	img, err := loadElfImage(filepath)
+	if err != nil {
+		return err
+	}
+	if err := img.checkNoOverlay(); err != nil {
+		return err
+	}
+	h, err := img.header()
+	if err != nil {
+		return err
+	}
+	sections, err := img.sections()
+	if err != nil {
+		return err
+	}
+	if h.Shoff == 0 || int(h.Shstrndx) >= len(sections) {
+		return errors.New(Tr(msgNoSectionHeaders, filepath))
+	}
+	names := sections[h.Shstrndx]
+	if names.Off+names.Size > uint64(len(img.data)) {
+		return errors.New(Tr(msgOutOfBounds, names.Off))
+	}
+	table := append([]byte(nil), img.data[names.Off:names.Off+names.Size]...)
+	for _, s := range sections {
+		if img.cString(names.Off+uint64(s.Name)) == name {
+			return errors.New(Tr(msgSectionExists, name))
+		}
+	}
+
+	// The section header table is dropped and written anew at the end. The
+	// name table usually sits right before it and can go, too
+	end := h.Shoff
+	if names.Off+names.Size <= h.Shoff {
+		end = names.Off
+		for _, s := range sections {
+			if s.Type != elf.SHT_NOBITS && s.Off+s.Size > names.Off && s.Off < h.Shoff && s.Off != names.Off {
+				end = h.Shoff
+			}
+		}
+	}
+	img.data = img.data[:end]
+
+	off := uint64(len(img.data))
+	img.writeBytes(off, data)
+	nameOff := uint32(len(table))
+	table = append(append(table, name...), 0)
+	names.Off, names.Size = off+uint64(len(data)), uint64(len(table))
+	img.writeBytes(names.Off, table)
+	sections[h.Shstrndx] = names
+	sections = append(sections, sectionHeader{Name: nameOff, Type: elf.SHT_PROGBITS, Off: off, Size: uint64(len(data)), Addralign: 1})
+
+	if err := img.writeSections(sections, alignUp(uint64(len(img.data)), img.wordSize())); err != nil {
+		return err
+	}
+	if output == "" {
+		output = filepath
+	}
+	return writeFileAtomic(output, img.data, img.mode)
+}
+
+// addSectionCommand implements "elfsize add-section <file> <section> <data file>"
+func addSectionCommand(args []string) int {
+	fs := flag.NewFlagSet("add-section", flag.ContinueOnError)
+	output := fs.String("o", "", "write the result to this file instead of changing the file in place")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s add-section <file> <section> <data file> [-o output]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Add a section with the contents of a file, or stdin if it is '-'\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 3 {
+		fs.Usage()
+		return 2
+	}
+
+	data, err := readDataArg(positional[2])
+	if err == nil {
+		err = AddSection(positional[0], positional[1], data, *output)
+	}
+	if err != nil {
+		PrintError("add-section", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// HTTPServer answers requests for the summaries of files over HTTP, as
+// printed by elfsize info --json, so that scan jobs need not start a
+// process per file:
+//
+//	GET  /v1/info?path=<path>   the summary of a file on the server
+//	POST /v1/info[?name=<name>] the summary of the file in the body, sent
+//	                            as is or as the field "file" of a form
+//	POST /v1/batch              the summaries of {"paths": [...]}, in order
+//	GET  /healthz               "ok"
+//
+// Errors are replied as {"path": ..., "error": ...}, as by Serve, with a
+// 4xx or 5xx status; in batches with the others. There is no gRPC
+// interface, since the standard library has no implementation of it
+type HTTPServer struct {
+	// Root is the directory the paths requested must be in, after
+	// resolving symbolic links. Requests for paths are refused if it is ""
+	Root string
+	// MaxUpload is the largest file that may be sent, in bytes
+	MaxUpload int64
+}
+
+// batchRequest is the body of a request to /v1/batch
+type batchRequest struct {
+	Paths []string `json:"paths"`
+}
+
+// Handler returns the http.Handler of the API
+func (s *HTTPServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/info", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			s.servePath(w, r.URL.Query().Get("path"))
+		case http.MethodPost:
+			s.serveUpload(w, r)
+		default:
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			replyError(w, http.StatusMethodNotAllowed, "", errors.New(http.StatusText(http.StatusMethodNotAllowed)))
+		}
+	})
+	mux.HandleFunc("/v1/batch", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			replyError(w, http.StatusMethodNotAllowed, "", errors.New(http.StatusText(http.StatusMethodNotAllowed)))
+			return
+		}
+		var req batchRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<20)).Decode(&req); err != nil {
+			replyError(w, http.StatusBadRequest, "", err)
+			return
+		}
+		replies := make([]any, len(req.Paths))
+		for i, path := range req.Paths {
+			resolved, _, err := s.resolve(path)
+			if err != nil {
+				replies[i] = daemonError{path, err.Error()}
+				continue
+			}
+			replies[i] = daemonReply(resolved)
+		}
+		replyJSON(w, http.StatusOK, replies)
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	return mux
+}
+
+// resolve returns the file to open for a requested path, which is relative
+// to Root if not absolute, with symbolic links resolved so that the file
+// checked is the one opened, or the status to reply with if it may not be
+// opened
+func (s *HTTPServer) resolve(path string) (string, int, error) {
+	if s.Root == "" {
+		return "", http.StatusForbidden, errors.New(Tr(msgPathsDisabled))
+	}
+	if path == "" {
+		return "", http.StatusBadRequest, errors.New(Tr(msgNoPathGiven))
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.Root, path)
+	}
+	// Files in images are allowed if the image is
+	check, member := path, ""
+	if image, name, ok := splitImagePath(path); ok {
+		check, member = image, name
+	}
+	root, err := filepath.EvalSymlinks(s.Root)
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	if root, err = filepath.Abs(root); err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	resolved, err := filepath.EvalSymlinks(check)
+	if err != nil {
+		return "", http.StatusNotFound, err
+	}
+	if resolved, err = filepath.Abs(resolved); err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	if rel, err := filepath.Rel(root, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", http.StatusForbidden, errors.New(Tr(msgOutsideRoot, path, s.Root))
+	}
+	if member != "" {
+		resolved += imagePathSeparator + member
+	}
+	return resolved, 0, nil
+}
+
+// servePath replies with the summary of the file at path
+func (s *HTTPServer) servePath(w http.ResponseWriter, path string) {
+	resolved, status, err := s.resolve(path)
+	if err != nil {
+		replyError(w, status, path, err)
+		return
+	}
+	f, err := openFile(resolved)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if os.IsNotExist(err) {
+			status = http.StatusNotFound
+		}
+		replyError(w, status, path, err)
+		return
+	}
+	defer f.Close()
+	info, err := newFileInfo(resolved, f)
+	if err != nil {
+		replyError(w, http.StatusUnprocessableEntity, path, err)
+		return
+	}
+	replyJSON(w, http.StatusOK, info)
+}
+
+// serveUpload replies with the summary of the file in the body of r, which
+// is stored in a temporary file while it is parsed
+func (s *HTTPServer) serveUpload(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	r.Body = http.MaxBytesReader(w, r.Body, s.MaxUpload)
+	body := io.Reader(r.Body)
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		reader, err := r.MultipartReader()
+		if err != nil {
+			replyError(w, http.StatusBadRequest, name, err)
+			return
+		}
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				replyError(w, http.StatusBadRequest, name, errors.New(Tr(msgNoFilePart)))
+				return
+			}
+			if part.FormName() == "file" {
+				if name == "" {
+					name = part.FileName()
+				}
+				body = part
+				break
+			}
+		}
+	}
+	if name == "" {
+		name = "upload"
+	}
+
+	tmp, err := os.CreateTemp("", "elfsize-upload-*")
+	if err != nil {
+		replyError(w, http.StatusInternalServerError, name, err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if _, err := io.Copy(tmp, body); err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		replyError(w, status, name, err)
+		return
+	}
+
+	f, err := openFile(tmp.Name())
+	if err != nil {
+		replyError(w, http.StatusInternalServerError, name, err)
+		return
+	}
+	defer f.Close()
+	info, err := newFileInfo(tmp.Name(), f)
+	if err != nil {
+		// The client knows the file by its name, not the temporary one
+		replyError(w, http.StatusUnprocessableEntity, name, errors.New(strings.ReplaceAll(err.Error(), tmp.Name(), name)))
+		return
+	}
+	setInfoPath(info, name)
+	replyJSON(w, http.StatusOK, info)
+}
+
+// setInfoPath sets the path in a summary returned by newFileInfo
+func setInfoPath(info any, path string) {
+	switch info := info.(type) {
+	case *ElfInfo:
+		info.Path = path
+	case *KernelImage:
+		info.Path = path
+	case *CoreInfo:
+		info.Path = path
+	case *MachOInfo:
+		info.Path = path
+	case *PEInfo:
+		info.Path = path
+	}
+}
+
+// replyJSON writes v as the JSON body of a reply
+func replyJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	out, _ := json.MarshalIndent(v, "", "  ")
+	w.Write(append(out, '\n'))
+}
+
+// replyError replies with a daemonError
+func replyError(w http.ResponseWriter, status int, path string, err error) {
+	replyJSON(w, status, daemonError{path, err.Error()})
+}
+
+// serveCommand implements "elfsize serve [--listen addr] [--root dir] [--max-upload size]"
+func serveCommand(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	listen := fs.String("listen", "localhost:8080", "address to listen on, host:port")
+	server := &HTTPServer{MaxUpload: 256 << 20}
+	fs.StringVar(&server.Root, "root", "", "answer requests for the files under this directory, none if empty; uploads are always answered")
+	fs.Func("max-upload", "largest file that may be sent, with an optional K, M or G suffix (default 256M)", func(s string) error {
+		n, err := parseByteSize(s)
+		server.MaxUpload = n
+		return err
+	})
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s serve [--listen host:port] [--root dir] [--max-upload size]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Answer HTTP requests for the JSON summary of files, as printed by\n")
+		fmt.Fprintf(os.Stderr, "    info --json, until SIGINT or SIGTERM:\n")
+		fmt.Fprintf(os.Stderr, "    GET /v1/info?path=<path> for files under --root, POST /v1/info with\n")
+		fmt.Fprintf(os.Stderr, "    the file as the body or the form field \"file\", and POST /v1/batch\n")
+		fmt.Fprintf(os.Stderr, "    with {\"paths\": [...]} for many files under --root at once.\n")
+		fmt.Fprintf(os.Stderr, "    There is no gRPC interface, since the standard library has none\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 0 {
+		fs.Usage()
+		return 2
+	}
+
+	srv := &http.Server{Addr: *listen, Handler: server.Handler(), ReadHeaderTimeout: 30 * time.Second}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+	logMessage(LogVerbose, msgListening, *listen)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		PrintError("serve", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// Sections reserved in AppImage runtimes for a detached signature of the
+// AppImage and the public key to check it with
+const (
+	signatureSection    = ".sha256_sig"
+	signatureKeySection = ".sig_key"
+)
+
+// GetSignature returns the signature and public key embedded in an AppImage,
+// without the NUL padding of their sections. The key is nil if the runtime
+// has no .sig_key section
+func GetSignature(filepath string) ([]byte, []byte, error) {
+	sig, err := GetSectionData(filepath, signatureSection)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := GetSectionData(filepath, signatureKeySection)
+	if err != nil && !errors.Is(err, ErrSectionNotFound) {
+		return nil, nil, err
+	}
+	return bytes.TrimRight(sig, "\x00"), bytes.TrimRight(key, "\x00"), nil
+}
+
+// SetSignature embeds a detached signature, such as the ASCII armored output
+// of gpg, and optionally the public key into an AppImage in place, and
+// returns err. What is signed is the digest of the AppImage, see GetDigest
+func SetSignature(filepath string, sig []byte, key []byte) error {
+	// The key goes first: runtimes without a .sig_key section are then
+	// rejected before anything changed
+	if key != nil {
+		if err := SetSectionData(filepath, signatureKeySection, key); err != nil {
+			return err
+		}
+	}
+	return SetSectionData(filepath, signatureSection, sig)
+}
+
+// embedSignatureCommand implements "elfsize embed-signature <appimage> <signature> [key]"
+func embedSignatureCommand(args []string) int {
+	fs := flag.NewFlagSet("embed-signature", flag.ContinueOnError)
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s embed-signature <appimage> <signature file> [public key file]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Embed a detached signature and public key into the reserved sections of an AppImage\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 2 && len(positional) != 3 {
+		fs.Usage()
+		return 2
+	}
+
+	sig, err := readDataArg(positional[1])
+	var key []byte
+	if err == nil && len(positional) == 3 {
+		key, err = readDataArg(positional[2])
+	}
+	if err == nil {
+		err = SetSignature(positional[0], sig, key)
+	}
+	if err != nil {
+		PrintError("embed-signature", err)
+		return 1
+	}
+	return 0
+}
+
+// extractSignatureCommand implements "elfsize extract-signature <appimage>"
+func extractSignatureCommand(args []string) int {
+	fs := flag.NewFlagSet("extract-signature", flag.ContinueOnError)
+	output := fs.String("o", "", "write the signature to this file instead of stdout")
+	keyOutput := fs.String("key", "", "also write the public key to this file")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s extract-signature <appimage> [-o file] [--key file]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the signature embedded in an AppImage\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	sig, key, err := GetSignature(positional[0])
+	if err == nil && len(sig) == 0 {
+		err = errors.New(Tr(msgNoSignature, positional[0]))
+	}
+	if err == nil && *keyOutput != "" {
+		err = os.WriteFile(*keyOutput, key, 0644)
+	}
+	if err == nil && *output != "" {
+		err = os.WriteFile(*output, sig, 0644)
+	} else if err == nil {
+		_, err = os.Stdout.Write(sig)
+	}
+	if err != nil {
+		PrintError("extract-signature", err)
+		return 1
+	}
+	return 0
+}
+
+// GetDigest returns the SHA-256 digest of an AppImage as defined by the
+// AppImage specification: the whole file, with the contents of the signature
+// and key sections read as zeroes, so that embedding them does not change it
+func GetDigest(filepath string) ([]byte, error) {
+	return GetDigestContext(context.Background(), filepath)
+}
+
+// GetDigestContext is GetDigest, stopping with ctx.Err() when ctx is done
+func GetDigestContext(ctx context.Context, filepath string) ([]byte, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := r.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var holes []*elf.Section
+	for _, name := range []string{signatureSection, signatureKeySection} {
+		if s := f.Section(name); s != nil && s.Type != elf.SHT_NOBITS {
+			holes = append(holes, s)
+		}
+	}
+	sort.Slice(holes, func(i, j int) bool { return holes[i].Offset < holes[j].Offset })
+
+	h := sha256.New()
+	p := startProgress(ctx, stat.Size())
+	var pos int64
+	for _, s := range holes {
+		start, end := max(pos, int64(s.Offset)), min(stat.Size(), int64(s.Offset+s.FileSize))
+		if start >= end {
+			continue
+		}
+		if _, err := copyContext(ctx, h, io.NewSectionReader(r, pos, start-pos), start-pos, p); err != nil {
+			return nil, err
+		}
+		if _, err := io.CopyN(h, zeroReader{}, end-start); err != nil {
+			return nil, err
+		}
+		p.add(end - start)
+		pos = end
+	}
+	if _, err := copyContext(ctx, h, io.NewSectionReader(r, pos, stat.Size()-pos), stat.Size()-pos, p); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// zeroReader reads zeroes forever
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// digestCommand implements "elfsize digest <appimage>"
+func digestCommand(args []string) int {
+	fs := flag.NewFlagSet("digest", flag.ContinueOnError)
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	showProgress := fs.Bool("progress", false, "draw a progress bar on stderr")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s digest [--progress] <appimage>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the SHA-256 digest of an AppImage that its signature covers\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	ctx, bar := progressContext(*showProgress, positional[0])
+	digest, err := GetDigestContext(ctx, positional[0])
+	bar.finish()
+	if err != nil {
+		PrintError("digest", err)
+		return 1
+	}
+	fmt.Println(hex.EncodeToString(digest))
+	return 0
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// SizeStrategy defines where an ELF image ends. Tools disagree: appimagetool
+// looks for the end of the section header table, packers care about the end
+// of the loaded segments, forensic tools want the furthest byte referenced
+type SizeStrategy interface {
+	ElfSize(f *elf.File, r io.ReaderAt) (int64, error)
+}
+
+// SizeFunc is a custom SizeStrategy
+type SizeFunc func(f *elf.File, r io.ReaderAt) (int64, error)
+
+// ElfSize calls fn
+func (fn SizeFunc) ElfSize(f *elf.File, r io.ReaderAt) (int64, error) {
+	return fn(f, r)
+}
+
+var (
+	// HeaderEnd ends the image with the section header table, the classic
+	// elfsize definition which assumes the table is written last
+	HeaderEnd SizeStrategy = SizeFunc(headerEnd)
+	// SegmentEnd ends the image with the last byte of any segment
+	SegmentEnd SizeStrategy = SizeFunc(segmentEnd)
+	// SectionEnd ends the image with the last byte of any section contents
+	SectionEnd SizeStrategy = SizeFunc(sectionEnd)
+	// Max ends the image with the last byte referenced by any of the above
+	Max SizeStrategy = SizeFunc(maxEnd)
+)
+
+// SizeStrategies maps the names accepted by --strategy to strategies.
+// Callers may add their own
+var SizeStrategies = map[string]SizeStrategy{
+	"header-end":  HeaderEnd,
+	"segment-end": SegmentEnd,
+	"section-end": SectionEnd,
+	"max":         Max,
+}
+
+// CalculateElfSizeWith returns the size of an ELF binary as defined by strategy
+func CalculateElfSizeWith(filepath string, strategy SizeStrategy) (int64, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return 0, err
+	}
+	return strategy.ElfSize(f, r)
+}
+
+// parseSizeStrategy looks up a strategy by name
+func parseSizeStrategy(name string) (SizeStrategy, error) {
+	if s, ok := SizeStrategies[name]; ok {
+		return s, nil
+	}
+	names := make([]string, 0, len(SizeStrategies))
+	for n := range SizeStrategies {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return nil, errors.New(Tr(msgUnknownStrategy, name, strings.Join(names, ", ")))
+}
+
+// headerEnd returns the end of the section header table
+func headerEnd(f *elf.File, r io.ReaderAt) (int64, error) {
+	sr := io.NewSectionReader(r, 0, 1<<63-1)
+	switch f.Class {
+	case elf.ELFCLASS64:
+		var hdr elf.Header64
+		if err := binary.Read(sr, f.ByteOrder, &hdr); err != nil {
+			return 0, err
+		}
+		return sectionTableEnd(hdr.Shoff, hdr.Shentsize, hdr.Shnum)
+	case elf.ELFCLASS32:
+		var hdr elf.Header32
+		if err := binary.Read(sr, f.ByteOrder, &hdr); err != nil {
+			return 0, err
+		}
+		return sectionTableEnd(uint64(hdr.Shoff), hdr.Shentsize, hdr.Shnum)
+	}
+	return 0, ErrUnsupportedClass
+}
+
+// segmentEnd returns the end of the segment that reaches furthest into the file
+func segmentEnd(f *elf.File, r io.ReaderAt) (int64, error) {
+	var end int64
+	for _, p := range f.Progs {
+		end = max(end, int64(p.Off+p.Filesz))
+	}
+	return end, nil
+}
+
+// sectionEnd returns the end of the section contents that reach furthest
+// into the file
+func sectionEnd(f *elf.File, r io.ReaderAt) (int64, error) {
+	var end int64
+	for _, s := range f.Sections {
+		if s.Type == elf.SHT_NULL || s.Type == elf.SHT_NOBITS {
+			continue
+		}
+		end = max(end, int64(s.Offset+s.FileSize))
+	}
+	return end, nil
+}
+
+// maxEnd returns the largest of the other strategies' results
+func maxEnd(f *elf.File, r io.ReaderAt) (int64, error) {
+	var end int64
+	for _, s := range []SizeFunc{headerEnd, segmentEnd, sectionEnd} {
+		v, err := s(f, r)
+		if err != nil {
+			return 0, err
+		}
+		end = max(end, v)
+	}
+	return end, nil
+}
+
+// sizeWithStrategy prints the size of an opened file as defined by the named
+// strategy
+func sizeWithStrategy(name string, r io.ReaderAt) error {
+	size, err := elfSizeWith(name, r)
+	if err != nil {
+		return err
+	}
+	fmt.Println(size)
+	return nil
+}
+
+// offsetWithStrategy prints the payload offset for the --offset flag
+func offsetWithStrategy(name string, r io.ReaderAt, align int64) error {
+	size, err := elfSizeWith(name, r)
+	if err != nil {
+		return err
+	}
+	fmt.Println(PayloadOffset(size, align))
+	return nil
+}
+
+// elfSizeWith returns the size of the ELF image in r as defined by the named
+// strategy
+func elfSizeWith(name string, r io.ReaderAt) (int64, error) {
+	strategy, err := parseSizeStrategy(name)
+	if err != nil {
+		return 0, err
+	}
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return 0, err
+	}
+	return strategy.ElfSize(f, r)
+}
+
+// PayloadOffset returns the offset at which a payload is appended to an ELF
+// image of the given size, which is size rounded up to a multiple of align.
+// An align of 0 or 1 appends right after the image
+func PayloadOffset(size, align int64) int64 {
+	if align <= 1 {
+		return size
+	}
+	return (size + align - 1) / align * align
+}
+
+// GetPayloadOffset returns the offset at which a payload is appended to an
+// ELF binary whose end is defined by strategy
+func GetPayloadOffset(filepath string, strategy SizeStrategy, align int64) (int64, error) {
+	size, err := CalculateElfSizeWith(filepath, strategy)
+	if err != nil {
+		return 0, err
+	}
+	return PayloadOffset(size, align), nil
+}
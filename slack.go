@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io"
+)
+
+// slackChunk is how much of the overlay elfSlack reads at a time
+const slackChunk = 64 * 1024
+
+// GetSlack splits the bytes appended to the ELF image of a file into slack,
+// the zero bytes right after the image that only pad the file, e.g. to a
+// block or page boundary, and the data after them, the real overlay. A file
+// that ends with zeroes alone has slack but no overlay data
+func GetSlack(filepath string) (slack, data int64, err error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer r.Close()
+	stat, err := r.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	size := calculateElfSize(r)
+	end := stat.Size() - appendedSignatureSize(r, size, stat.Size())
+	if size >= end {
+		return 0, 0, nil
+	}
+	slack, err = elfSlack(r, size, end)
+	return slack, end - size - slack, err
+}
+
+// elfSlack returns the number of zero bytes in r from the end of the ELF
+// image at size on, up to the first other byte or fileSize. There is none
+// if the image does not end inside the file
+func elfSlack(r io.ReaderAt, size, fileSize int64) (int64, error) {
+	if size < 0 || size >= fileSize {
+		return 0, nil
+	}
+	buf := make([]byte, slackChunk)
+	pos := size
+	for pos < fileSize {
+		n, err := r.ReadAt(buf[:min(int64(len(buf)), fileSize-pos)], pos)
+		for i, c := range buf[:n] {
+			if c != 0 {
+				return pos + int64(i) - size, nil
+			}
+		}
+		pos += int64(n)
+		if err == io.EOF || n == 0 {
+			break
+		}
+		if err != nil {
+			return pos - size, err
+		}
+	}
+	return pos - size, nil
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// SnapshotEntry records the sizes of an ELF file
+type SnapshotEntry struct {
+	Size     int64 `json:"size"` // of the ELF image
+	Overlay  int64 `json:"overlay"`
+	FileSize int64 `json:"file_size"`
+}
+
+// SizeSnapshot records the sizes of the ELF files of a tree, by their path
+// relative to it, to compare later trees against
+type SizeSnapshot struct {
+	Version int                      `json:"version"`
+	Files   map[string]SnapshotEntry `json:"files"`
+}
+
+// snapshotFields are the sizes of a SnapshotEntry that can be compared
+var snapshotFields = map[string]func(SnapshotEntry) int64{
+	"elf":     func(e SnapshotEntry) int64 { return e.Size },
+	"overlay": func(e SnapshotEntry) int64 { return e.Overlay },
+	"file":    func(e SnapshotEntry) int64 { return e.FileSize },
+}
+
+// TakeSnapshot records the sizes of the ELF files in the tree at root.
+// Symbolic links are not followed
+func TakeSnapshot(root string) (*SizeSnapshot, error) {
+	snap := &SizeSnapshot{Version: 1, Files: map[string]SnapshotEntry{}}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || !isElfCandidate(path, d) {
+			return nil
+		}
+		info, err := Stat(path)
+		if err != nil {
+			printWarning("snapshot", err)
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		snap.Files[filepath.ToSlash(rel)] = SnapshotEntry{info.Size, info.Overlay, info.FileSize}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// LoadSnapshot reads a snapshot written by WriteSnapshot, and err
+func LoadSnapshot(path string) (*SizeSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var snap SizeSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if snap.Version != 1 {
+		return nil, fmt.Errorf("%s: %s", path, Tr(msgSnapshotVersion, snap.Version))
+	}
+	return &snap, nil
+}
+
+// WriteSnapshot writes a snapshot to a file, and returns err
+func WriteSnapshot(path string, snap *SizeSnapshot) error {
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// SizeChange is how the size of an ELF file changed since a snapshot
+type SizeChange struct {
+	Status     string `json:"status"` // "added", "removed" or "changed"
+	Path       string `json:"path"`
+	OldSize    int64  `json:"old_size"`
+	NewSize    int64  `json:"new_size"`
+	Regression bool   `json:"regression"` // grew by more than a threshold
+}
+
+// Delta returns how much the file grew
+func (c SizeChange) Delta() int64 {
+	return c.NewSize - c.OldSize
+}
+
+// SizeThresholds are how much files, and all of them together, may grow
+// before it counts as a regression. -1 means not limited
+type SizeThresholds struct {
+	File         int64
+	FilePercent  float64
+	Total        int64
+	TotalPercent float64
+}
+
+// exceeded reports whether growing from one size to another exceeds a
+// limit in bytes or in percent. Anything that grows from nothing exceeds a
+// limit in percent
+func exceeded(from, to, limit int64, percent float64) bool {
+	delta := to - from
+	if limit >= 0 && delta > limit {
+		return true
+	}
+	return percent >= 0 && delta > 0 && (from == 0 || float64(delta)*100/float64(from) > percent)
+}
+
+// CompareSnapshot compares the sizes of the ELF files in the tree at root,
+// as given by field, "elf", "overlay" or "file", with those in a snapshot.
+// It returns the files that changed, with those that grew beyond the
+// thresholds marked, and whether the total did
+func CompareSnapshot(snap *SizeSnapshot, root, field string, limits SizeThresholds) ([]SizeChange, bool, error) {
+	size, ok := snapshotFields[field]
+	if !ok {
+		return nil, false, errors.New(Tr(msgUnknownSizeField, field))
+	}
+	current, err := TakeSnapshot(root)
+	if err != nil {
+		return nil, false, err
+	}
+	changes := []SizeChange{}
+	var oldTotal, newTotal int64
+	for path, o := range snap.Files {
+		oldTotal += size(o)
+		c := SizeChange{Status: "removed", Path: path, OldSize: size(o)}
+		if n, ok := current.Files[path]; ok {
+			c.Status, c.NewSize = "changed", size(n)
+		}
+		if c.Delta() != 0 {
+			changes = append(changes, c)
+		}
+	}
+	for path, n := range current.Files {
+		newTotal += size(n)
+		if _, ok := snap.Files[path]; !ok {
+			changes = append(changes, SizeChange{Status: "added", Path: path, NewSize: size(n)})
+		}
+	}
+	for i := range changes {
+		changes[i].Regression = exceeded(changes[i].OldSize, changes[i].NewSize, limits.File, limits.FilePercent)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, exceeded(oldTotal, newTotal, limits.Total, limits.TotalPercent), nil
+}
+
+// snapshotCommand implements "elfsize snapshot -o <file> <dir>"
+func snapshotCommand(args []string) int {
+	fs := flag.NewFlagSet("snapshot", flag.ContinueOnError)
+	output := fs.String("o", "", "file to write the snapshot to, - for stdout")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse symbolic links and anything that is not a regular file")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s snapshot -o <baseline.json> <dir>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Record the sizes of the ELF files in a tree, for compare\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 || *output == "" {
+		fs.Usage()
+		return 2
+	}
+
+	snap, err := TakeSnapshot(positional[0])
+	if err != nil {
+		PrintError("snapshot", err)
+		return 1
+	}
+	if *output == "-" {
+		out, _ := json.MarshalIndent(snap, "", "  ")
+		fmt.Println(string(out))
+		return 0
+	}
+	if err := WriteSnapshot(*output, snap); err != nil {
+		PrintError("snapshot", err)
+		return 1
+	}
+	return 0
+}
+
+// thresholdFlag is a flag for a growth threshold: a size with an optional
+// K, M or G suffix, or with a % suffix a percentage
+type thresholdFlag struct {
+	bytes   *int64
+	percent *float64
+}
+
+func (t thresholdFlag) String() string {
+	return ""
+}
+
+func (t thresholdFlag) Set(s string) error {
+	if n := len(s); n > 0 && s[n-1] == '%' {
+		p, err := strconv.ParseFloat(s[:n-1], 64)
+		if err != nil || p < 0 {
+			return errors.New(Tr(msgInvalidPercentage, s))
+		}
+		*t.percent = p
+		return nil
+	}
+	n, err := parseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*t.bytes = n
+	return nil
+}
+
+// compareCommand implements "elfsize compare <baseline.json> <dir>"
+func compareCommand(args []string) int {
+	fs := flag.NewFlagSet("compare", flag.ContinueOnError)
+	field := fs.String("size", "file", "size to compare: elf, overlay or file")
+	asJSON := fs.Bool("json", false, "print the changes as JSON")
+	limits := SizeThresholds{-1, -1, -1, -1}
+	fs.Var(thresholdFlag{&limits.File, &limits.FilePercent}, "max-growth", "how much a file may grow, in bytes with an optional K, M or G suffix, or in percent with %; may be given twice")
+	fs.Var(thresholdFlag{&limits.Total, &limits.TotalPercent}, "max-total-growth", "how much all files together may grow, like --max-growth")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse symbolic links and anything that is not a regular file")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s compare [--size elf|overlay|file] [--max-growth N[%%]] [--max-total-growth N[%%]] [--json] <baseline.json> <dir>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    List the ELF files in a tree whose size changed since a snapshot,\n")
+		fmt.Fprintf(os.Stderr, "    added and removed ones included, then on stderr the total change\n")
+		fmt.Fprintf(os.Stderr, "    Exits with 1 if a file or the total grew by more than allowed\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	snap, err := LoadSnapshot(positional[0])
+	if err != nil {
+		PrintError("compare", err)
+		return 2
+	}
+	changes, totalExceeded, err := CompareSnapshot(snap, positional[1], *field, limits)
+	if err != nil {
+		PrintError("compare", err)
+		return 1
+	}
+	status := 0
+	if totalExceeded {
+		status = 1
+	}
+	regressions := 0
+	for _, c := range changes {
+		if c.Regression {
+			regressions++
+			status = 1
+		}
+	}
+	if *asJSON {
+		out, _ := json.MarshalIndent(changes, "", "  ")
+		fmt.Println(string(out))
+		return status
+	}
+	var total int64
+	for _, c := range changes {
+		total += c.Delta()
+		percent := "-"
+		if c.OldSize > 0 {
+			percent = fmt.Sprintf("%+.1f%%", float64(c.Delta())*100/float64(c.OldSize))
+		}
+		line := fmt.Sprintf("%s\t%s\t%d\t%d\t%+d\t%s", c.Status, c.Path, c.OldSize, c.NewSize, c.Delta(), percent)
+		if c.Regression {
+			line += "\tregression"
+		}
+		fmt.Println(line)
+	}
+	fmt.Fprintf(os.Stderr, "total\t%+d\n", total)
+	if regressions > 0 {
+		printWarning("compare", errors.New(Tr(msgSizeRegressions, regressions)))
+	}
+	if totalExceeded {
+		printWarning("compare", errors.New(Tr(msgTotalGrowth, total)))
+	}
+	return status
+}
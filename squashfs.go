@@ -0,0 +1,552 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// squashfsMagic starts a little-endian squashfs 4.0 superblock
+const squashfsMagic = "hsqs"
+
+// squashfsPadding is the block size mksquashfs pads images to by default
+const squashfsPadding = 4096
+
+// squashfsCompressors names the compression ids of squashfs 4.0. gzip is
+// read with the standard library, xz and zstd with the programs of
+// moduleDecompressors, since every block is a complete stream of its own
+var squashfsCompressors = map[uint16]string{1: "gzip", 2: "lzma", 3: "lzo", 4: "xz", 5: "lz4", 6: "zstd"}
+
+const (
+	squashfsGzip         = 1
+	squashfsMetadataSize = 8192 // uncompressed size of a metadata block
+	squashfsUncompressed = 1 << 24
+	squashfsNoFragment   = 0xffffffff
+	squashfsMaxFileSize  = 256 << 20 // refuse to read larger files into memory
+)
+
+// squashfs inode types
+const (
+	squashfsDir        = 1
+	squashfsFile       = 2
+	squashfsSymlink    = 3
+	squashfsExtDir     = 8
+	squashfsExtFile    = 9
+	squashfsExtSymlink = 10
+)
+
+// squashfsSuperblock is the on-disk superblock of a squashfs 4.0 image
+type squashfsSuperblock struct {
+	Magic       [4]byte
+	Inodes      uint32
+	MkfsTime    uint32
+	BlockSize   uint32
+	Fragments   uint32
+	Compression uint16
+	BlockLog    uint16
+	Flags       uint16
+	IDs         uint16
+	Major       uint16
+	Minor       uint16
+	RootInode   uint64
+	BytesUsed   uint64 // size of the image, without padding
+	IDTable     uint64
+	XattrTable  uint64
+	InodeTable  uint64
+	DirTable    uint64
+	FragTable   uint64
+	ExportTable uint64
+}
+
+// readSquashfsSuperblock reads and sanity checks the superblock of a
+// squashfs image starting at off
+func readSquashfsSuperblock(r io.ReaderAt, off int64) (*squashfsSuperblock, error) {
+	buf := make([]byte, binary.Size(squashfsSuperblock{}))
+	if _, err := r.ReadAt(buf, off); err != nil {
+		return nil, err
+	}
+	var sb squashfsSuperblock
+	if err := binary.Read(bytes.NewReader(buf), binary.LittleEndian, &sb); err != nil {
+		return nil, err
+	}
+	if string(sb.Magic[:]) != squashfsMagic {
+		return nil, errors.New(Tr(msgNotSquashfs, off))
+	}
+	if sb.Major != 4 || sb.BlockLog >= 32 || sb.BlockSize != 1<<sb.BlockLog {
+		return nil, errors.New(Tr(msgBadSquashfs, off))
+	}
+	return &sb, nil
+}
+
+// payloadProblems compares the size a payload claims with the data that
+// actually follows its offset in a file of fileSize bytes. A payload may be
+// followed by the padding mksquashfs adds, but not by more
+func payloadProblems(p *Payload, fileSize int64) []Problem {
+	var problems []Problem
+	available := fileSize - p.Offset
+	switch {
+	case p.Size > available:
+		problems = append(problems, newProblem(msgPayloadTruncated, p.Size, available))
+	case available > int64(alignUp(uint64(p.Size), squashfsPadding)):
+		problems = append(problems, newProblem(msgPayloadPadded, available-p.Size))
+	}
+	return problems
+}
+
+// squashfsFS is a minimal read-only squashfs 4.0 reader for gzip, xz and
+// zstd compressed images, enough to get at the metadata of type-2 AppImages
+type squashfsFS struct {
+	r    io.ReaderAt
+	base int64 // offset of the filesystem in r
+	sb   *squashfsSuperblock
+	root squashfsInode
+	// blocks are the metadata blocks decompressed so far, by position,
+	// since every inode and directory read starts at the beginning of its
+	// block
+	blocks map[int64]squashfsBlock
+}
+
+// squashfsBlock is a decompressed metadata block
+type squashfsBlock struct {
+	data []byte
+	next int64 // position of the block after it
+}
+
+// squashfsInode is the part of an inode the reader needs
+type squashfsInode struct {
+	kind uint16
+	// Directories
+	dirBlock  uint32
+	dirOffset uint16
+	dirSize   uint32
+	// Regular files
+	blocksStart uint64
+	size        uint64
+	fragment    uint32
+	fragOffset  uint32
+	blockSizes  []uint32
+	// Symbolic links
+	symlink string
+}
+
+// squashfsDirent is a directory entry
+type squashfsDirent struct {
+	name  string
+	inode uint64 // reference: metadata block << 16 | offset in the block
+}
+
+// openSquashfs reads the superblock and root inode of a filesystem at base
+func openSquashfs(r io.ReaderAt, base int64) (*squashfsFS, error) {
+	sb, err := readSquashfsSuperblock(r, base)
+	if err != nil {
+		return nil, err
+	}
+	name, ok := squashfsCompressors[sb.Compression]
+	if !ok {
+		return nil, errors.New(Tr(msgSquashfsCompression, fmt.Sprint(sb.Compression)))
+	}
+	if sb.Compression != squashfsGzip && moduleDecompressor(name) == nil {
+		return nil, errors.New(Tr(msgSquashfsCompression, name))
+	}
+	fs := &squashfsFS{r: r, base: base, sb: sb, blocks: map[int64]squashfsBlock{}}
+	if fs.root, err = fs.readInode(sb.RootInode); err != nil {
+		return nil, err
+	}
+	if fs.root.kind != squashfsDir && fs.root.kind != squashfsExtDir {
+		return nil, errors.New(Tr(msgBadSquashfs, base))
+	}
+	return fs, nil
+}
+
+// corrupt returns the error for inconsistent filesystem structures
+func (fs *squashfsFS) corrupt() error {
+	return errors.New(Tr(msgBadSquashfs, fs.base))
+}
+
+// decompress inflates a block of at most limit bytes
+func (fs *squashfsFS) decompress(data []byte, limit int64) ([]byte, error) {
+	var out []byte
+	if fs.sb.Compression == squashfsGzip {
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		if out, err = io.ReadAll(io.LimitReader(zr, limit+1)); err != nil {
+			return nil, err
+		}
+	} else {
+		name := squashfsCompressors[fs.sb.Compression]
+		command := moduleDecompressor(name)
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Stdin = bytes.NewReader(data)
+		var stdout bytes.Buffer
+		cmd.Stdout = &stdout
+		if err := cmd.Run(); err != nil {
+			return nil, errors.New(Tr(msgDecompressFailed, name, err))
+		}
+		out = stdout.Bytes()
+	}
+	if int64(len(out)) > limit {
+		return nil, fs.corrupt()
+	}
+	return out, nil
+}
+
+// squashfsMetadata reads a stream of metadata blocks
+type squashfsMetadata struct {
+	fs   *squashfsFS
+	next int64 // position of the next block, relative to the filesystem
+	buf  []byte
+}
+
+// metadata returns a reader for the metadata starting offset bytes into the
+// block at pos
+func (fs *squashfsFS) metadata(pos int64, offset int) (*squashfsMetadata, error) {
+	m := &squashfsMetadata{fs: fs, next: pos}
+	if _, err := m.read(offset); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// read returns the next n bytes of metadata
+func (m *squashfsMetadata) read(n int) ([]byte, error) {
+	for len(m.buf) < n {
+		if block, ok := m.fs.blocks[m.next]; ok {
+			m.buf = append(m.buf, block.data...)
+			m.next = block.next
+			continue
+		}
+		var header [2]byte
+		if _, err := m.fs.r.ReadAt(header[:], m.fs.base+m.next); err != nil {
+			return nil, err
+		}
+		h := binary.LittleEndian.Uint16(header[:])
+		size := int64(h & 0x7fff)
+		if size == 0 || size > squashfsMetadataSize {
+			return nil, m.fs.corrupt()
+		}
+		block := make([]byte, size)
+		if _, err := m.fs.r.ReadAt(block, m.fs.base+m.next+2); err != nil {
+			return nil, err
+		}
+		if h&0x8000 == 0 {
+			var err error
+			if block, err = m.fs.decompress(block, squashfsMetadataSize); err != nil {
+				return nil, err
+			}
+		}
+		m.fs.blocks[m.next] = squashfsBlock{block, m.next + 2 + size}
+		m.next += 2 + size
+		m.buf = append(m.buf, block...)
+	}
+	data := m.buf[:n]
+	m.buf = m.buf[n:]
+	return data, nil
+}
+
+// readInode decodes the inode a reference points to
+func (fs *squashfsFS) readInode(ref uint64) (squashfsInode, error) {
+	var ino squashfsInode
+	m, err := fs.metadata(int64(fs.sb.InodeTable+ref>>16), int(ref&0xffff))
+	if err != nil {
+		return ino, err
+	}
+	header, err := m.read(16)
+	if err != nil {
+		return ino, err
+	}
+	le := binary.LittleEndian
+	ino.kind = le.Uint16(header)
+	switch ino.kind {
+	case squashfsDir:
+		b, err := m.read(16)
+		if err != nil {
+			return ino, err
+		}
+		ino.dirBlock, ino.dirSize, ino.dirOffset = le.Uint32(b), uint32(le.Uint16(b[8:])), le.Uint16(b[10:])
+	case squashfsExtDir:
+		b, err := m.read(24)
+		if err != nil {
+			return ino, err
+		}
+		ino.dirSize, ino.dirBlock, ino.dirOffset = le.Uint32(b[4:]), le.Uint32(b[8:]), le.Uint16(b[18:])
+	case squashfsFile, squashfsExtFile:
+		if ino.kind == squashfsFile {
+			b, err := m.read(16)
+			if err != nil {
+				return ino, err
+			}
+			ino.blocksStart, ino.fragment, ino.fragOffset, ino.size = uint64(le.Uint32(b)), le.Uint32(b[4:]), le.Uint32(b[8:]), uint64(le.Uint32(b[12:]))
+		} else {
+			b, err := m.read(40)
+			if err != nil {
+				return ino, err
+			}
+			ino.blocksStart, ino.size, ino.fragment, ino.fragOffset = le.Uint64(b), le.Uint64(b[8:]), le.Uint32(b[28:]), le.Uint32(b[32:])
+		}
+		if ino.size > squashfsMaxFileSize {
+			return ino, fs.corrupt()
+		}
+		blocks := ino.size / uint64(fs.sb.BlockSize)
+		if ino.fragment == squashfsNoFragment && ino.size%uint64(fs.sb.BlockSize) != 0 {
+			blocks++
+		}
+		b, err := m.read(int(blocks) * 4)
+		if err != nil {
+			return ino, err
+		}
+		for i := uint64(0); i < blocks; i++ {
+			ino.blockSizes = append(ino.blockSizes, le.Uint32(b[i*4:]))
+		}
+	case squashfsSymlink, squashfsExtSymlink:
+		b, err := m.read(8)
+		if err != nil {
+			return ino, err
+		}
+		size := le.Uint32(b[4:])
+		if size > 4096 {
+			return ino, fs.corrupt()
+		}
+		target, err := m.read(int(size))
+		if err != nil {
+			return ino, err
+		}
+		ino.symlink = string(target)
+	}
+	return ino, nil
+}
+
+// readDir returns the entries of a directory
+func (fs *squashfsFS) readDir(dir squashfsInode) ([]squashfsDirent, error) {
+	// The recorded size counts "." and ".." as 3 bytes that are not stored
+	if dir.dirSize < 3 {
+		return nil, nil
+	}
+	m, err := fs.metadata(int64(fs.sb.DirTable)+int64(dir.dirBlock), int(dir.dirOffset))
+	if err != nil {
+		return nil, err
+	}
+	le := binary.LittleEndian
+	var entries []squashfsDirent
+	for left := int(dir.dirSize) - 3; left > 0; {
+		header, err := m.read(12)
+		if err != nil {
+			return nil, err
+		}
+		left -= 12
+		count, start := le.Uint32(header)+1, le.Uint32(header[4:])
+		if count > 256 {
+			return nil, fs.corrupt()
+		}
+		for i := uint32(0); i < count; i++ {
+			e, err := m.read(8)
+			if err != nil {
+				return nil, err
+			}
+			name, err := m.read(int(le.Uint16(e[6:])) + 1)
+			if err != nil {
+				return nil, err
+			}
+			left -= 8 + len(name)
+			entries = append(entries, squashfsDirent{
+				name:  string(name),
+				inode: uint64(start)<<16 | uint64(le.Uint16(e)),
+			})
+		}
+	}
+	return entries, nil
+}
+
+// lookup finds a file in the root directory, following symbolic links that
+// stay within it
+func (fs *squashfsFS) lookup(name string) (squashfsInode, bool, error) {
+	entries, err := fs.readDir(fs.root)
+	if err != nil {
+		return squashfsInode{}, false, err
+	}
+	for hops := 0; hops < 8; hops++ {
+		var found *squashfsDirent
+		for i := range entries {
+			if entries[i].name == name {
+				found = &entries[i]
+				break
+			}
+		}
+		if found == nil {
+			return squashfsInode{}, false, nil
+		}
+		ino, err := fs.readInode(found.inode)
+		if err != nil {
+			return squashfsInode{}, false, err
+		}
+		if ino.kind != squashfsSymlink && ino.kind != squashfsExtSymlink {
+			return ino, true, nil
+		}
+		name = path.Clean(ino.symlink)
+		if strings.Contains(strings.TrimPrefix(name, "./"), "/") {
+			return squashfsInode{}, false, nil
+		}
+		name = strings.TrimPrefix(name, "./")
+	}
+	return squashfsInode{}, false, nil
+}
+
+// lookupPath finds a file by its path from the root directory, following
+// symbolic links within the filesystem; absolute ones start at its root
+func (fs *squashfsFS) lookupPath(name string) (squashfsInode, bool, error) {
+	dirs := []squashfsInode{fs.root}
+	parts := imagePathComponents(name)
+	for hops := 0; len(parts) > 0; {
+		part := parts[0]
+		parts = parts[1:]
+		if part == ".." {
+			if len(dirs) > 1 {
+				dirs = dirs[:len(dirs)-1]
+			}
+			continue
+		}
+		entries, err := fs.readDir(dirs[len(dirs)-1])
+		if err != nil {
+			return squashfsInode{}, false, err
+		}
+		var found *squashfsDirent
+		for i := range entries {
+			if entries[i].name == part {
+				found = &entries[i]
+				break
+			}
+		}
+		if found == nil {
+			return squashfsInode{}, false, nil
+		}
+		ino, err := fs.readInode(found.inode)
+		if err != nil {
+			return squashfsInode{}, false, err
+		}
+		switch {
+		case ino.kind == squashfsSymlink || ino.kind == squashfsExtSymlink:
+			if hops++; hops > maxImageLinkHops {
+				return squashfsInode{}, false, nil
+			}
+			if strings.HasPrefix(ino.symlink, "/") {
+				dirs = dirs[:1]
+			}
+			parts = append(imagePathComponents(ino.symlink), parts...)
+		case ino.kind == squashfsDir || ino.kind == squashfsExtDir:
+			dirs = append(dirs, ino)
+		case len(parts) > 0:
+			return squashfsInode{}, false, nil
+		default:
+			return ino, true, nil
+		}
+	}
+	return dirs[len(dirs)-1], true, nil
+}
+
+// readPath returns the contents of a regular file found by lookupPath
+func (fs *squashfsFS) readPath(name string) ([]byte, bool, error) {
+	ino, ok, err := fs.lookupPath(name)
+	if err != nil || !ok || (ino.kind != squashfsFile && ino.kind != squashfsExtFile) {
+		return nil, false, err
+	}
+	data, err := fs.readFile(ino)
+	return data, err == nil, err
+}
+
+// readFile returns the contents of a regular file
+func (fs *squashfsFS) readFile(ino squashfsInode) ([]byte, error) {
+	if ino.kind != squashfsFile && ino.kind != squashfsExtFile {
+		return nil, fs.corrupt()
+	}
+	blockSize := int64(fs.sb.BlockSize)
+	data := make([]byte, 0, ino.size)
+	pos := int64(ino.blocksStart)
+	for _, size := range ino.blockSizes {
+		block, err := fs.readBlock(pos, size, blockSize)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, block...)
+		pos += int64(size &^ squashfsUncompressed)
+	}
+	if ino.fragment != squashfsNoFragment {
+		// Fragment entries are 16 bytes, 512 to a metadata block, found
+		// through a table of block positions
+		var index [8]byte
+		if _, err := fs.r.ReadAt(index[:], fs.base+int64(fs.sb.FragTable)+int64(ino.fragment/512)*8); err != nil {
+			return nil, err
+		}
+		m, err := fs.metadata(int64(binary.LittleEndian.Uint64(index[:])), int(ino.fragment%512)*16)
+		if err != nil {
+			return nil, err
+		}
+		entry, err := m.read(16)
+		if err != nil {
+			return nil, err
+		}
+		block, err := fs.readBlock(int64(binary.LittleEndian.Uint64(entry)), binary.LittleEndian.Uint32(entry[8:]), blockSize)
+		if err != nil {
+			return nil, err
+		}
+		tail := ino.size - uint64(len(data))
+		if uint64(ino.fragOffset)+tail > uint64(len(block)) {
+			return nil, fs.corrupt()
+		}
+		data = append(data, block[ino.fragOffset:uint64(ino.fragOffset)+tail]...)
+	}
+	if uint64(len(data)) < ino.size {
+		return nil, fs.corrupt()
+	}
+	return data[:ino.size], nil
+}
+
+// readBlock reads a data block at pos whose size field is size
+func (fs *squashfsFS) readBlock(pos int64, size uint32, blockSize int64) ([]byte, error) {
+	n := int64(size &^ squashfsUncompressed)
+	if n == 0 {
+		// Sparse block
+		return make([]byte, blockSize), nil
+	}
+	if n > blockSize {
+		return nil, fs.corrupt()
+	}
+	block := make([]byte, n)
+	if _, err := fs.r.ReadAt(block, fs.base+pos); err != nil {
+		return nil, err
+	}
+	if size&squashfsUncompressed != 0 {
+		return block, nil
+	}
+	return fs.decompress(block, blockSize)
+}
+
+// rootNames lists the root directory
+func (fs *squashfsFS) rootNames() ([]string, error) {
+	entries, err := fs.readDir(fs.root)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.name)
+	}
+	return names, nil
+}
+
+// readRootFile returns the contents of a regular file in the root directory
+func (fs *squashfsFS) readRootFile(name string) ([]byte, bool, error) {
+	ino, ok, err := fs.lookup(name)
+	if err != nil || !ok || (ino.kind != squashfsFile && ino.kind != squashfsExtFile) {
+		return nil, false, err
+	}
+	data, err := fs.readFile(ino)
+	return data, err == nil, err
+}
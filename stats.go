@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// ioStats accumulates the resource usage shown by --stats
+type ioStats struct {
+	start     time.Time
+	files     atomic.Int64
+	bytesRead atomic.Int64
+	syscalls  atomic.Int64
+}
+
+// stats is the resource usage of this process
+var stats = ioStats{start: time.Now()}
+
+// inputFile is a file opened by openFile. Reads and closes through it are
+// accounted for in stats; use the embedded File to bypass that
+type inputFile struct {
+	*os.File
+	base int64         // offset of the contents in File, see openFileAt
+	data []byte        // the whole file if it is mapped, see MmapThreshold
+	read *atomic.Int64 // bytes read so far, for MaxBytesRead
+	temp string        // removed on Close, see openImageMember
+}
+
+// account adds n bytes read to stats and fails once they exceed MaxBytesRead
+func (f inputFile) account(n int) error {
+	stats.bytesRead.Add(int64(n))
+	if f.read != nil && MaxBytesRead > 0 && f.read.Add(int64(n)) > MaxBytesRead {
+		return limitExceeded(msgTooMuchRead, MaxBytesRead)
+	}
+	return nil
+}
+
+// Read implements io.Reader
+func (f inputFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	stats.syscalls.Add(1)
+	if err := f.account(n); err != nil {
+		return n, err
+	}
+	return n, err
+}
+
+// ReadAt implements io.ReaderAt
+func (f inputFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.data != nil {
+		off += f.base
+		if off < 0 || off >= int64(len(f.data)) {
+			return 0, io.EOF
+		}
+		n := copy(p, f.data[off:])
+		if err := f.account(n); err != nil {
+			return n, err
+		}
+		if n < len(p) {
+			return n, io.EOF
+		}
+		return n, nil
+	}
+	n, err := f.File.ReadAt(p, f.base+off)
+	stats.syscalls.Add(1)
+	if err := f.account(n); err != nil {
+		return n, err
+	}
+	return n, err
+}
+
+// Close implements io.Closer
+func (f inputFile) Close() error {
+	stats.syscalls.Add(1)
+	if f.data != nil {
+		stats.syscalls.Add(1)
+		munmap(f.data)
+	}
+	err := f.File.Close()
+	if f.temp != "" {
+		os.Remove(f.temp)
+	}
+	return err
+}
+
+// PrintStats writes a report of the resources used so far to w, one
+// key=value pair per line in a fixed order so that runs can be compared
+func PrintStats(w io.Writer) {
+	elapsed := time.Since(stats.start)
+	files := stats.files.Load()
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(files) / elapsed.Seconds()
+	}
+	fmt.Fprintf(w, "files=%d\n", files)
+	fmt.Fprintf(w, "bytes_read=%d\n", stats.bytesRead.Load())
+	fmt.Fprintf(w, "syscalls=%d\n", stats.syscalls.Load())
+	fmt.Fprintf(w, "peak_memory=%d\n", peakMemory())
+	fmt.Fprintf(w, "elapsed=%s\n", elapsed)
+	fmt.Fprintf(w, "files_per_second=%.1f\n", rate)
+}
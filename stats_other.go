@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import "runtime"
+
+// peakMemory returns the memory obtained from the OS by the Go runtime, which
+// is the closest available approximation of the peak footprint
+func peakMemory() int64 {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return int64(m.Sys)
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"debug/elf"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// maxMemberSize limits how large an ELF member of a tar or cpio archive may
+// be, since it is read into memory rather than extracted
+const maxMemberSize = 1 << 30
+
+// cpioTrailer is the name of the entry that ends a cpio archive
+const cpioTrailer = "TRAILER!!!"
+
+// decompressedStream is the contents of a possibly compressed stream: gzip
+// and bzip2 are decompressed in process, xz and zstd by the programs of
+// moduleDecompressors, and anything else is passed through
+type decompressedStream struct {
+	*bufio.Reader
+	compression string // "gzip", "bzip2", "xz", "zstd" or empty
+	cmd         *exec.Cmd
+}
+
+// newDecompressedStream starts decompressing r, recognizing the compression
+// by its magic
+func newDecompressedStream(r io.Reader) (*decompressedStream, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReaderSize(r, 64<<10)
+	}
+	head, _ := br.Peek(6)
+	switch {
+	case bytes.HasPrefix(head, []byte("\x1f\x8b")):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return &decompressedStream{Reader: bufio.NewReaderSize(zr, 64<<10), compression: "gzip"}, nil
+	case bytes.HasPrefix(head, []byte("BZh")):
+		return &decompressedStream{Reader: bufio.NewReaderSize(bzip2.NewReader(br), 64<<10), compression: "bzip2"}, nil
+	}
+	for _, d := range moduleDecompressors {
+		if !bytes.HasPrefix(head, []byte(d.magic)) {
+			continue
+		}
+		cmd := exec.Command(d.command[0], d.command[1:]...)
+		cmd.Stdin = br
+		out, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, errors.New(Tr(msgDecompressFailed, d.name, err))
+		}
+		return &decompressedStream{Reader: bufio.NewReaderSize(out, 64<<10), compression: d.name, cmd: cmd}, nil
+	}
+	return &decompressedStream{Reader: br}, nil
+}
+
+// finish reads the rest of the stream and reports whether the program
+// decompressing it failed
+func (s *decompressedStream) finish() error {
+	if s.cmd == nil {
+		return nil
+	}
+	io.Copy(io.Discard, s.Reader)
+	if err := s.cmd.Wait(); err != nil {
+		return errors.New(Tr(msgDecompressFailed, s.compression, err))
+	}
+	return nil
+}
+
+// abort stops the program decompressing the stream, if any
+func (s *decompressedStream) abort() {
+	if s.cmd != nil {
+		s.cmd.Process.Kill()
+		s.cmd.Wait()
+	}
+}
+
+// streamArchiveFormat returns "tar" or "cpio" if head is the start of such
+// an archive, or ""
+func streamArchiveFormat(head []byte) string {
+	switch {
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		return "tar"
+	case bytes.HasPrefix(head, []byte("070701")), bytes.HasPrefix(head, []byte("070702")), bytes.HasPrefix(head, []byte("070707")):
+		return "cpio"
+	}
+	return ""
+}
+
+// isStreamArchive reports whether a file is a tar or cpio archive, which
+// may be compressed with gzip, bzip2, xz or zstd
+func isStreamArchive(path string) bool {
+	r, err := openFile(path)
+	if err != nil {
+		return false
+	}
+	defer r.Close()
+	s, err := newDecompressedStream(io.NewSectionReader(r, 0, 1<<63-1))
+	if err != nil {
+		return false
+	}
+	defer s.abort()
+	head, _ := s.Peek(512)
+	return streamArchiveFormat(head) != ""
+}
+
+// walkStreamArchive calls fn with the name, size and contents of every
+// regular file in the tar or cpio archive read from r, compressed or not,
+// and returns the format of the archive. Archives are read as a stream and
+// nothing is extracted. Concatenated cpio archives, such as initramfs images
+// that start with uncompressed microcode, are read one after the other;
+// anything else after the end of a cpio archive is ignored. If fn returns
+// fs.SkipAll the walk stops without an error
+func walkStreamArchive(r io.Reader, fn func(name string, size int64, body io.Reader) error) (string, error) {
+	s, err := newDecompressedStream(r)
+	if err != nil {
+		return "", err
+	}
+	head, _ := s.Peek(512)
+	format := streamArchiveFormat(head)
+	switch format {
+	case "tar":
+		err = walkTar(s.Reader, fn)
+	case "cpio":
+		err = walkCpio(s.Reader, fn)
+	default:
+		s.abort()
+		return "", errors.New(Tr(msgNotStreamArchive))
+	}
+	if err == fs.SkipAll {
+		s.abort()
+		return format, nil
+	}
+	if err != nil {
+		s.abort()
+		return format, err
+	}
+	return format, s.finish()
+}
+
+// walkTar is walkStreamArchive for a tar archive
+func walkTar(r io.Reader, fn func(name string, size int64, body io.Reader) error) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		if err := fn(hdr.Name, hdr.Size, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// walkCpio is walkStreamArchive for the cpio archives at the start of br:
+// the portable ASCII formats, with and without checksums, and the old
+// character one. Binary cpio archives are not supported
+func walkCpio(br *bufio.Reader, fn func(name string, size int64, body io.Reader) error) error {
+	for {
+		magic, _ := br.Peek(6)
+		var hdr []byte
+		var mode, nameSize, size uint64
+		var err error
+		switch string(magic) {
+		case "070701", "070702":
+			hdr = make([]byte, 110)
+			if _, err := io.ReadFull(br, hdr); err != nil {
+				return err
+			}
+			mode, err = strconv.ParseUint(string(hdr[14:22]), 16, 32)
+			if err == nil {
+				size, err = strconv.ParseUint(string(hdr[54:62]), 16, 32)
+			}
+			if err == nil {
+				nameSize, err = strconv.ParseUint(string(hdr[94:102]), 16, 32)
+			}
+		case "070707":
+			hdr = make([]byte, 76)
+			if _, err := io.ReadFull(br, hdr); err != nil {
+				return err
+			}
+			mode, err = strconv.ParseUint(string(hdr[18:24]), 8, 32)
+			if err == nil {
+				nameSize, err = strconv.ParseUint(string(hdr[59:65]), 8, 32)
+			}
+			if err == nil {
+				size, err = strconv.ParseUint(string(hdr[65:76]), 8, 64)
+			}
+		default:
+			return errors.New(Tr(msgBadCpioHeader))
+		}
+		if err != nil || nameSize == 0 || nameSize > 4096 {
+			return errors.New(Tr(msgBadCpioHeader))
+		}
+		// The ASCII format with and without checksums pads the header and
+		// name, and the data, to 4 bytes
+		padded := len(hdr) == 110
+		name := make([]byte, nameSize)
+		if _, err := io.ReadFull(br, name); err != nil {
+			return err
+		}
+		if padded {
+			if err := discard(br, (4-int(110+nameSize)%4)%4); err != nil {
+				return err
+			}
+		}
+		entry := strings.TrimRight(string(name), "\x00")
+		if entry == cpioTrailer {
+			return nextCpioArchive(br, fn)
+		}
+
+		body := &io.LimitedReader{R: br, N: int64(size)}
+		if mode&0170000 == 0100000 && size > 0 {
+			if err := fn(entry, int64(size), body); err != nil {
+				return err
+			}
+		}
+		if _, err := io.Copy(io.Discard, body); err != nil {
+			return err
+		}
+		if body.N > 0 {
+			return io.ErrUnexpectedEOF
+		}
+		if padded {
+			if err := discard(br, (4-int(size%4))%4); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// nextCpioArchive continues walkCpio with the archive that follows the
+// trailer of another, skipping the zeros padding it to a block, if it is
+// one. Anything else is left alone
+func nextCpioArchive(br *bufio.Reader, fn func(name string, size int64, body io.Reader) error) error {
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if b != 0 {
+			br.UnreadByte()
+			break
+		}
+	}
+	s, err := newDecompressedStream(br)
+	if err != nil {
+		return nil
+	}
+	head, _ := s.Peek(512)
+	if streamArchiveFormat(head) != "cpio" {
+		s.abort()
+		return nil
+	}
+	if err := walkCpio(s.Reader, fn); err != nil {
+		s.abort()
+		return err
+	}
+	return s.finish()
+}
+
+// discard skips n bytes of br, failing if there are fewer
+func discard(br *bufio.Reader, n int) error {
+	if _, err := br.Discard(n); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return nil
+}
+
+// readStreamMember returns the contents of the regular file at member in
+// the tar or cpio archive read from r, and whether there is one
+func readStreamMember(r io.Reader, member string) ([]byte, bool, error) {
+	want := strings.Join(imagePathComponents(member), "/")
+	var data []byte
+	found := false
+	_, err := walkStreamArchive(r, func(name string, size int64, body io.Reader) error {
+		if strings.Join(imagePathComponents(name), "/") != want {
+			return nil
+		}
+		if size > maxMemberSize {
+			return errors.New(Tr(msgMemberTooLarge, name, maxMemberSize))
+		}
+		var err error
+		if data, err = io.ReadAll(body); err != nil {
+			return err
+		}
+		found = true
+		return fs.SkipAll
+	})
+	return data, found, err
+}
+
+// walkStreamElfs is walkStreamArchive for the ELF files of an archive,
+// which fn gets the contents of, by name as recorded in the archive. The
+// other files are only read as far as their magic. For ELF files larger
+// than maxMemberSize, fn gets an error instead
+func walkStreamElfs(r io.Reader, fn func(name string, data []byte, err error) error) (string, error) {
+	return walkStreamArchive(r, func(name string, size int64, body io.Reader) error {
+		data, ok, err := readElfMember(name, size, body)
+		if !ok {
+			return err
+		}
+		return fn(name, data, err)
+	})
+}
+
+// readElfMember reads a file of size bytes of an archive from body if it is
+// an ELF file, and returns whether it is. Files larger than maxMemberSize
+// are not read; their error is returned with ok set. Other errors are
+// reading ones, with ok unset
+func readElfMember(name string, size int64, body io.Reader) ([]byte, bool, error) {
+	var magic [4]byte
+	if n, _ := io.ReadFull(body, magic[:]); n < len(magic) || string(magic[:]) != elf.ELFMAG {
+		return nil, false, nil
+	}
+	if size > maxMemberSize {
+		return nil, true, errors.New(Tr(msgMemberTooLarge, name, maxMemberSize))
+	}
+	data := make([]byte, size)
+	copy(data, magic[:])
+	if _, err := io.ReadFull(body, data[len(magic):]); err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// scanArchive reports the ElfInfo of every ELF file in the tar or cpio
+// archive at path to OnFileDone, as path:name, reading each into memory
+func (s *Scanner) scanArchive(path string, infos *[]*ElfInfo) {
+	logMessage(LogVerbose, msgScanning, path)
+	r, err := openFile(path)
+	if err != nil {
+		s.fail(path, err)
+		return
+	}
+	defer r.Close()
+	_, err = walkStreamElfs(io.NewSectionReader(r, 0, 1<<63-1), func(name string, data []byte, err error) error {
+		if s.done() {
+			return fs.SkipAll
+		}
+		display := path + imagePathSeparator + strings.Join(imagePathComponents(name), "/")
+		if s.OnFileStart != nil {
+			s.OnFileStart(display)
+		}
+		if err != nil {
+			s.fail(display, err)
+			return nil
+		}
+		info, err := elfInfoFrom(display, bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			s.fail(display, err)
+			return nil
+		}
+		if s.Filter != nil && !s.Filter.Match(info) {
+			return nil
+		}
+		if s.OnFileDone != nil {
+			s.OnFileDone(info)
+		}
+		if !s.Stream {
+			*infos = append(*infos, info)
+		}
+		return nil
+	})
+	if err != nil {
+		s.fail(path, err)
+	}
+}
+
+// isStreamArchiveEntry reports whether a file found in a directory is a
+// tar or cpio archive to scan with Scanner.Archives, or a link to one
+func isStreamArchiveEntry(path string, d fs.DirEntry) bool {
+	if !d.Type().IsRegular() {
+		if stat, err := os.Stat(path); err != nil || !stat.Mode().IsRegular() {
+			return false
+		}
+	}
+	return isStreamArchive(path)
+}
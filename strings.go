@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// stringEncodings are the character sizes and byte orders of the encodings
+// the strings subcommand knows, by the letters strings(1) uses for them
+var stringEncodings = map[string]struct {
+	width int
+	order binary.ByteOrder
+	high  bool // bytes from 0x80 count as printable
+}{
+	"s": {1, nil, false},
+	"S": {1, nil, true},
+	"l": {2, binary.LittleEndian, false},
+	"b": {2, binary.BigEndian, false},
+	"L": {4, binary.LittleEndian, false},
+	"B": {4, binary.BigEndian, false},
+}
+
+// ExtractedString is a run of printable characters found in a section
+type ExtractedString struct {
+	Offset int64  `json:"offset"` // in the section
+	Value  string `json:"value"`
+}
+
+// GetSectionStrings returns the runs of at least minLength printable
+// characters in a section of an ELF file, like strings(1) does for whole
+// files. The section is looked up like in GetSectionData. encoding is one of
+// the letters strings(1) accepts: s for 7-bit, S for 8-bit characters, l and
+// b for 16-bit and L and B for 32-bit little and big endian ones
+func GetSectionStrings(filepath string, section string, minLength int, encoding string) ([]ExtractedString, error) {
+	result := []ExtractedString{}
+	err := WalkSectionStrings(filepath, section, minLength, encoding, func(s ExtractedString) error {
+		result = append(result, s)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// WalkSectionStrings is like GetSectionStrings, but calls fn with every
+// string as it is found instead of collecting them. It stops with the first
+// error fn returns
+func WalkSectionStrings(filepath string, section string, minLength int, encoding string, fn func(ExtractedString) error) error {
+	enc, ok := stringEncodings[encoding]
+	if !ok {
+		return errors.New(Tr(msgUnknownEncoding, encoding))
+	}
+	r, _, err := GetSectionReader(filepath, section)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	br := bufio.NewReaderSize(r, 64<<10)
+	unit := make([]byte, enc.width)
+	var run []byte
+	var off, start int64
+	for {
+		if _, err := io.ReadFull(br, unit); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return err
+		}
+		c, printable := unit[0], false
+		if enc.width == 1 {
+			printable = isPrintable(c) || enc.high && c >= 0x80
+		} else {
+			var v uint32
+			if enc.width == 2 {
+				v = uint32(enc.order.Uint16(unit))
+			} else {
+				v = enc.order.Uint32(unit)
+			}
+			c, printable = byte(v), v < 0x80 && isPrintable(byte(v))
+		}
+		if printable {
+			if len(run) == 0 {
+				start = off
+			}
+			run = append(run, c)
+		} else {
+			if err := flushString(run, start, minLength, fn); err != nil {
+				return err
+			}
+			run = run[:0]
+		}
+		off += int64(enc.width)
+	}
+	return flushString(run, start, minLength, fn)
+}
+
+// flushString calls fn with a run of printable characters if it is long
+// enough
+func flushString(run []byte, start int64, minLength int, fn func(ExtractedString) error) error {
+	if len(run) == 0 || len(run) < minLength {
+		return nil
+	}
+	return fn(ExtractedString{start, string(run)})
+}
+
+// isPrintable reports whether strings(1) counts an ASCII character as part of
+// a string: the graphic ones, space and tab
+func isPrintable(c byte) bool {
+	return c >= 0x20 && c < 0x7f || c == '\t'
+}
+
+// stringsCommand implements "elfsize strings [--section name] [-n length] [-e encoding] <file>"
+func stringsCommand(args []string) int {
+	fs := flag.NewFlagSet("strings", flag.ContinueOnError)
+	section := fs.String("section", ".rodata", "the section to search, or a glob pattern matching it")
+	minLength := fs.Int("n", 4, "the minimum length of a string")
+	encoding := fs.String("e", "s", "the character encoding: s for 7-bit, S for 8-bit, l, b for 16-bit and L, B for 32-bit little and big endian")
+	offsets := fs.Bool("t", false, "print the offset of every string in the section in hexadecimal")
+	asJSON := fs.Bool("json", false, "print the strings and their offsets as JSON")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s strings [--section name] [-n length] [-e encoding] [-t] [--json] <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the printable strings in one section of an ELF file, like strings(1)\n")
+		fmt.Fprintf(os.Stderr, "    does for the whole file\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+	if _, ok := stringEncodings[*encoding]; !ok {
+		PrintError("strings", errors.New(Tr(msgUnknownEncoding, *encoding)))
+		return 2
+	}
+
+	if *asJSON {
+		result, err := GetSectionStrings(positional[0], *section, *minLength, *encoding)
+		if err != nil {
+			PrintError("strings", err)
+			return 1
+		}
+		out, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(out))
+		return 0
+	}
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	err = WalkSectionStrings(positional[0], *section, *minLength, *encoding, func(s ExtractedString) error {
+		if *offsets {
+			_, err := fmt.Fprintf(w, "%7x %s\n", s.Offset, s.Value)
+			return err
+		}
+		_, err := fmt.Fprintln(w, s.Value)
+		return err
+	})
+	if err != nil {
+		w.Flush()
+		PrintError("strings", err)
+		return 1
+	}
+	return 0
+}
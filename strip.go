@@ -0,0 +1,298 @@
+package main
+
+import (
+	"debug/elf"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DebugInfo tells which symbol and debugging sections an ELF file still has
+type DebugInfo struct {
+	Symtab        bool     // .symtab is present
+	DebugSections []string // .debug_* and .zdebug_* sections
+}
+
+// Stripped reports whether neither a symbol table nor debug info is present
+func (d DebugInfo) Stripped() bool {
+	return !d.Symtab && len(d.DebugSections) == 0
+}
+
+// Sections returns the names of the sections that strip would remove
+func (d DebugInfo) Sections() []string {
+	var names []string
+	if d.Symtab {
+		names = append(names, ".symtab")
+	}
+	return append(names, d.DebugSections...)
+}
+
+// GetDebugInfo returns the DebugInfo of an ELF file
+func GetDebugInfo(filepath string) (DebugInfo, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return DebugInfo{}, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return DebugInfo{}, err
+	}
+	return elfDebugInfo(f), nil
+}
+
+// elfDebugInfo returns the DebugInfo of f
+func elfDebugInfo(f *elf.File) DebugInfo {
+	var d DebugInfo
+	for _, s := range f.Sections {
+		switch {
+		case s.Name == ".symtab":
+			d.Symtab = true
+		case strings.HasPrefix(s.Name, ".debug_"), strings.HasPrefix(s.Name, ".zdebug_"):
+			d.DebugSections = append(d.DebugSections, s.Name)
+		}
+	}
+	return d
+}
+
+// StripSavings is how many bytes of an ELF file strip would remove
+type StripSavings struct {
+	Debug    int64   `json:"debug"`  // .debug_* and .zdebug_* sections
+	Symtab   int64   `json:"symtab"` // .symtab
+	Strtab   int64   `json:"strtab"` // .strtab, the names in .symtab
+	Total    int64   `json:"total"`
+	FileSize int64   `json:"file_size"`
+	Percent  float64 `json:"percent"` // of the file size
+}
+
+// GetStripSavings returns how many bytes of an ELF file are symbol table
+// and debug info, to decide which packages are worth splitting the debug
+// info off. Their section headers, names and alignment padding are not
+// counted, so strip usually saves a little more
+func GetStripSavings(filepath string) (StripSavings, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return StripSavings{}, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return StripSavings{}, err
+	}
+	stat, err := r.Stat()
+	if err != nil {
+		return StripSavings{}, err
+	}
+	return elfStripSavings(f, stat.Size()), nil
+}
+
+// elfStripSavings returns the StripSavings of f
+func elfStripSavings(f *elf.File, fileSize int64) StripSavings {
+	s := StripSavings{FileSize: fileSize}
+	for _, section := range f.Sections {
+		if section.Type == elf.SHT_NOBITS {
+			continue
+		}
+		size := int64(section.FileSize)
+		switch {
+		case section.Name == ".symtab":
+			s.Symtab += size
+		case section.Name == ".strtab":
+			s.Strtab += size
+		case strings.HasPrefix(section.Name, ".debug_"), strings.HasPrefix(section.Name, ".zdebug_"):
+			s.Debug += size
+		default:
+			continue
+		}
+		s.Total += size
+	}
+	if fileSize > 0 {
+		s.Percent = float64(s.Total) * 100 / float64(fileSize)
+	}
+	return s
+}
+
+// RemoveSections drops the named sections from an ELF file and returns err.
+// Relocation sections for them go as well, and the section header table is
+// compacted, with section indices renumbered in the symbol tables. Contents
+// outside of segments are dropped; sections inside segments only lose their
+// header, since the program still maps the bytes. The result is written to
+// output, or to the file itself if output is empty
+func RemoveSections(filepath string, names []string, output string) error {
+	img, err := loadElfImage(filepath)
+	if err != nil {
+		return err
+	}
+	if err := img.checkNoOverlay(); err != nil {
+		return err
+	}
+	h, err := img.header()
+	if err != nil {
+		return err
+	}
+	sections, err := img.sections()
+	if err != nil {
+		return err
+	}
+	if h.Shoff == 0 || int(h.Shstrndx) >= len(sections) {
+		return errors.New(Tr(msgNoSectionHeaders, filepath))
+	}
+	for i, s := range sections {
+		if int(s.Link) >= len(sections) {
+			return &FileError{filepath, errors.New(Tr(msgBadSectionLink, i, s.Link, len(sections)))}
+		}
+		if (s.Type == elf.SHT_REL || s.Type == elf.SHT_RELA || s.Flags&elf.SHF_INFO_LINK != 0) && int(s.Info) >= len(sections) {
+			return &FileError{filepath, errors.New(Tr(msgBadSectionLink, i, s.Info, len(sections)))}
+		}
+	}
+	nameOf := func(i uint32) string {
+		return img.cString(sections[h.Shstrndx].Off + uint64(sections[i].Name))
+	}
+
+	remove := map[uint32]bool{}
+	for _, name := range names {
+		found := false
+		for i := range sections[1:] {
+			if nameOf(uint32(i+1)) == name {
+				remove[uint32(i+1)], found = true, true
+			}
+		}
+		if !found {
+			return sectionNotFound(filepath, name)
+		}
+	}
+	if remove[uint32(h.Shstrndx)] {
+		return errors.New(Tr(msgSectionInUse, nameOf(uint32(h.Shstrndx)), "ELF header"))
+	}
+	for changed := true; changed; {
+		changed = false
+		for i, s := range sections {
+			if !remove[uint32(i)] && (s.Type == elf.SHT_REL || s.Type == elf.SHT_RELA) && s.Info != 0 && remove[s.Info] {
+				remove[uint32(i)], changed = true, true
+			}
+		}
+	}
+	for i, s := range sections {
+		if !remove[uint32(i)] && s.Link != 0 && remove[s.Link] {
+			return errors.New(Tr(msgSectionInUse, nameOf(s.Link), nameOf(uint32(i))))
+		}
+	}
+
+	newIndex := make([]uint32, len(sections))
+	var kept []sectionHeader
+	for i, s := range sections {
+		if !remove[uint32(i)] {
+			newIndex[i] = uint32(len(kept))
+			kept = append(kept, s)
+		}
+	}
+	for i := range sections {
+		if remove[uint32(i)] {
+			continue
+		}
+		s := &kept[newIndex[i]]
+		s.Link = newIndex[s.Link]
+		if s.Type == elf.SHT_REL || s.Type == elf.SHT_RELA || s.Flags&elf.SHF_INFO_LINK != 0 {
+			s.Info = newIndex[s.Info]
+		}
+		switch s.Type {
+		case elf.SHT_SYMTAB, elf.SHT_DYNSYM:
+			if err := img.renumberSymbols(*s, nameOf(uint32(i)), h.Type != elf.ET_REL, newIndex, remove, nameOf); err != nil {
+				return err
+			}
+		case elf.SHT_GROUP:
+			// A flag word followed by the indices of the members
+			for off := s.Off + 4; off+4 <= s.Off+s.Size; off += 4 {
+				var member uint32
+				if err := img.read(off, &member); err != nil {
+					return err
+				}
+				if int(member) < len(newIndex) {
+					img.write(off, newIndex[member])
+				}
+			}
+		}
+	}
+
+	if err := img.writeSections(kept, h.Shoff); err != nil {
+		return err
+	}
+	if h, err = img.header(); err != nil {
+		return err
+	}
+	h.Shstrndx = uint16(newIndex[h.Shstrndx])
+	if err := img.setHeader(h); err != nil {
+		return err
+	}
+	out, err := img.pack()
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		output = filepath
+	}
+	return writeFileAtomic(output, out.data, out.mode)
+}
+
+// renumberSymbols rewrites the section indices of the symbol table s.
+// Symbols of removed sections become absolute. Their values are addresses in
+// linked files, but offsets into the section in object files, where only
+// section symbols can go
+func (img *elfImage) renumberSymbols(s sectionHeader, name string, linked bool, newIndex []uint32, removed map[uint32]bool, nameOf func(uint32) string) error {
+	size, shndxOff := uint64(16), uint64(14)
+	if img.class == elf.ELFCLASS64 {
+		size, shndxOff = 24, 6
+	}
+	infoOff := shndxOff - 2
+	for off := s.Off; off+size <= s.Off+s.Size; off += size {
+		var shndx uint16
+		if err := img.read(off+shndxOff, &shndx); err != nil {
+			return err
+		}
+		if shndx == uint16(elf.SHN_UNDEF) || shndx >= uint16(elf.SHN_LORESERVE) || int(shndx) >= len(newIndex) {
+			continue
+		}
+		if removed[uint32(shndx)] {
+			if !linked && elf.ST_TYPE(img.data[off+infoOff]) != elf.STT_SECTION {
+				return errors.New(Tr(msgSectionInUse, nameOf(uint32(shndx)), name))
+			}
+			img.write(off+shndxOff, uint16(elf.SHN_ABS))
+			continue
+		}
+		img.write(off+shndxOff, uint16(newIndex[shndx]))
+	}
+	return nil
+}
+
+// removeSectionCommand implements "elfsize remove-section <file> <section>..."
+func removeSectionCommand(args []string) int {
+	fs := flag.NewFlagSet("remove-section", flag.ContinueOnError)
+	output := fs.String("o", "", "write the result to this new file, required")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s remove-section <file> <section>... -o output\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Write a copy of an ELF file without sections such as .comment to\n")
+		fmt.Fprintf(os.Stderr, "    output; the file itself is left as it is\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) < 2 {
+		fs.Usage()
+		return 2
+	}
+	if *output == "" {
+		PrintError("remove-section", errors.New(Tr(msgOutputRequired)))
+		return 2
+	}
+
+	if err := RemoveSections(positional[0], positional[1:], *output); err != nil {
+		PrintError("remove-section", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"debug/elf"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// GetSymbols returns the dynamic symbols of an ELF file, or the full static
+// symbol table if symtab is set
+func GetSymbols(filepath string, symtab bool) ([]elf.Symbol, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return nil, err
+	}
+	var symbols []elf.Symbol
+	if symtab {
+		symbols, err = f.Symbols()
+	} else {
+		symbols, err = f.DynamicSymbols()
+	}
+	if err == elf.ErrNoSymbols {
+		return nil, nil
+	}
+	return symbols, err
+}
+
+// symbolDefined reports whether s is defined in the file rather than imported
+func symbolDefined(s elf.Symbol) bool {
+	return s.Section != elf.SHN_UNDEF
+}
+
+// symbolExported reports whether s is a defined symbol other objects can
+// link against
+func symbolExported(s elf.Symbol) bool {
+	bind := elf.ST_BIND(s.Info)
+	visibility := elf.ST_VISIBILITY(s.Other)
+	return symbolDefined(s) && (bind == elf.STB_GLOBAL || bind == elf.STB_WEAK) &&
+		(visibility == elf.STV_DEFAULT || visibility == elf.STV_PROTECTED)
+}
+
+// symbolKindName returns "func", "object" and so on for the type of s
+func symbolKindName(s elf.Symbol) string {
+	name := strings.TrimPrefix(elf.ST_TYPE(s.Info).String(), "STT_")
+	return strings.ToLower(name)
+}
+
+// symbolsCommand implements "elfsize symbols <file>"
+func symbolsCommand(args []string) int {
+	fs := flag.NewFlagSet("symbols", flag.ContinueOnError)
+	symtab := fs.Bool("symtab", false, "list the full static symbol table instead of the dynamic symbols")
+	defined := fs.Bool("defined", false, "only list symbols the file exports")
+	undefined := fs.Bool("undefined", false, "only list symbols the file imports")
+	count := fs.Bool("count", false, "only print the number of matching symbols")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s symbols [--symtab] [--defined|--undefined] [--count] <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    List the symbols of an ELF file with their type, binding and version\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 || (*defined && *undefined) {
+		fs.Usage()
+		return 2
+	}
+
+	symbols, err := GetSymbols(positional[0], *symtab)
+	if err != nil {
+		PrintError("symbols", err)
+		return 1
+	}
+	n := 0
+	for _, s := range symbols {
+		if s.Name == "" || (*defined && !symbolExported(s)) || (*undefined && symbolDefined(s)) {
+			continue
+		}
+		n++
+		if *count {
+			continue
+		}
+		name := s.Name
+		if s.Version != "" {
+			name += "@" + s.Version
+		}
+		section := "UND"
+		if symbolDefined(s) {
+			section = "DEF"
+		}
+		bind := strings.ToLower(strings.TrimPrefix(elf.ST_BIND(s.Info).String(), "STB_"))
+		fmt.Printf("%s\t%s\t%s\t%s\n", section, symbolKindName(s), bind, name)
+	}
+	if *count {
+		fmt.Println(n)
+	}
+	return 0
+}
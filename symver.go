@@ -0,0 +1,302 @@
+package main
+
+import (
+	"debug/elf"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// symbolVersionFamilies are the version name prefixes whose highest
+// requirement decides which distributions a binary runs on
+var symbolVersionFamilies = []string{"GLIBC", "GLIBCXX", "CXXABI"}
+
+// GetMaxSymbolVersions returns the highest version an ELF file requires of
+// each of GLIBC, GLIBCXX and CXXABI, e.g. "GLIBC_2.34", in that order.
+// Families the file does not use are left out
+func GetMaxSymbolVersions(filepath string) ([]string, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return nil, err
+	}
+	return maxSymbolVersions(f)
+}
+
+// maxSymbolVersions does the work of GetMaxSymbolVersions
+func maxSymbolVersions(f *elf.File) ([]string, error) {
+	symbols, err := f.ImportedSymbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return nil, err
+	}
+	highest := map[string]string{}
+	for _, sym := range symbols {
+		family, version, ok := strings.Cut(sym.Version, "_")
+		if !ok || !slices.Contains(symbolVersionFamilies, family) {
+			continue
+		}
+		if old, ok := highest[family]; !ok || compareVersions(version, old) > 0 {
+			highest[family] = version
+		}
+	}
+	var result []string
+	for _, family := range symbolVersionFamilies {
+		if version, ok := highest[family]; ok {
+			result = append(result, family+"_"+version)
+		}
+	}
+	return result, nil
+}
+
+// compareVersions compares dotted version numbers such as "2.34" and "2.4"
+// numerically, component by component
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// VersionRequirement is a symbol version an ELF file needs from a library,
+// from .gnu.version_r, with the symbols bound to it
+type VersionRequirement struct {
+	Library string   `json:"library"`
+	Version string   `json:"version"`
+	Weak    bool     `json:"weak,omitempty"` // the file runs without it
+	Symbols []string `json:"symbols"`
+}
+
+// VersionDefinition is a symbol version an ELF file provides, from
+// .gnu.version_d, with the symbols it defines in it
+type VersionDefinition struct {
+	Version string   `json:"version"`
+	Base    bool     `json:"base,omitempty"` // the version of the file itself, named after its SONAME
+	Symbols []string `json:"symbols"`
+}
+
+// SymbolVersions is what GetSymbolVersions reports
+type SymbolVersions struct {
+	Required []VersionRequirement `json:"required"`
+	Provided []VersionDefinition  `json:"provided"`
+}
+
+// Flags of version requirements and definitions
+const (
+	verFlagBase = 0x1
+	verFlagWeak = 0x2
+)
+
+// GetSymbolVersions decodes the symbol versions an ELF file requires of
+// the libraries it links against and those it provides, and which dynamic
+// symbols use them
+func GetSymbolVersions(filepath string) (*SymbolVersions, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return nil, err
+	}
+	return elfSymbolVersions(f)
+}
+
+// elfSymbolVersions does the work of GetSymbolVersions
+func elfSymbolVersions(f *elf.File) (*SymbolVersions, error) {
+	result := &SymbolVersions{Required: []VersionRequirement{}, Provided: []VersionDefinition{}}
+	// Version indices of the definitions and requirements, as .gnu.version
+	// uses them
+	required := map[uint16]int{}
+	provided := map[uint16]int{}
+
+	if s := f.SectionByType(elf.SHT_GNU_VERNEED); s != nil {
+		data, strs, err := versionSection(f, s)
+		if err != nil {
+			return nil, err
+		}
+		// Verneed: version, count, file, aux, next; Vernaux: hash, flags,
+		// other, name, next
+		for off := uint32(0); int(off)+16 <= len(data); {
+			count, file := f.ByteOrder.Uint16(data[off+2:]), f.ByteOrder.Uint32(data[off+4:])
+			aux, next := off+f.ByteOrder.Uint32(data[off+8:]), f.ByteOrder.Uint32(data[off+12:])
+			for i := uint16(0); i < count && int(aux)+16 <= len(data); i++ {
+				flags, index := f.ByteOrder.Uint16(data[aux+4:]), f.ByteOrder.Uint16(data[aux+6:])
+				required[index] = len(result.Required)
+				result.Required = append(result.Required, VersionRequirement{
+					Library: dynString(strs, file),
+					Version: dynString(strs, f.ByteOrder.Uint32(data[aux+8:])),
+					Weak:    flags&verFlagWeak != 0,
+					Symbols: []string{},
+				})
+				auxNext := f.ByteOrder.Uint32(data[aux+12:])
+				if auxNext == 0 {
+					break
+				}
+				aux += auxNext
+			}
+			if next == 0 {
+				break
+			}
+			off += next
+		}
+	}
+
+	if s := f.SectionByType(elf.SHT_GNU_VERDEF); s != nil {
+		data, strs, err := versionSection(f, s)
+		if err != nil {
+			return nil, err
+		}
+		// Verdef: version, flags, index, count, hash, aux, next; Verdaux:
+		// name, next. The first name is the version, the others its parents
+		for off := uint32(0); int(off)+20 <= len(data); {
+			flags, index := f.ByteOrder.Uint16(data[off+2:]), f.ByteOrder.Uint16(data[off+4:])
+			aux, next := off+f.ByteOrder.Uint32(data[off+12:]), f.ByteOrder.Uint32(data[off+16:])
+			if int(aux)+8 <= len(data) {
+				provided[index] = len(result.Provided)
+				result.Provided = append(result.Provided, VersionDefinition{
+					Version: dynString(strs, f.ByteOrder.Uint32(data[aux:])),
+					Base:    flags&verFlagBase != 0,
+					Symbols: []string{},
+				})
+			}
+			if next == 0 {
+				break
+			}
+			off += next
+		}
+	}
+
+	versym := f.SectionByType(elf.SHT_GNU_VERSYM)
+	if versym == nil {
+		return result, nil
+	}
+	indices, err := versym.Data()
+	if err != nil {
+		return nil, err
+	}
+	symbols, err := f.DynamicSymbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return nil, err
+	}
+	// DynamicSymbols leaves out the null symbol at index 0
+	for i, sym := range symbols {
+		if 2*(i+2) > len(indices) {
+			break
+		}
+		index := f.ByteOrder.Uint16(indices[2*(i+1):]) &^ 0x8000 // the hidden bit
+		if sym.Section == elf.SHN_UNDEF {
+			if j, ok := required[index]; ok {
+				result.Required[j].Symbols = append(result.Required[j].Symbols, sym.Name)
+			}
+		} else if j, ok := provided[index]; ok {
+			result.Provided[j].Symbols = append(result.Provided[j].Symbols, sym.Name)
+		}
+	}
+	return result, nil
+}
+
+// versionSection returns the contents of a version section of f and of
+// the string table it links to
+func versionSection(f *elf.File, s *elf.Section) ([]byte, []byte, error) {
+	data, err := s.Data()
+	if err != nil {
+		return nil, nil, err
+	}
+	if int(s.Link) >= len(f.Sections) {
+		return nil, nil, errors.New(Tr(msgLintSectionLink, s.Name, s.Link, len(f.Sections)))
+	}
+	strs, err := f.Sections[s.Link].Data()
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, strs, nil
+}
+
+// dynString returns the string at off in a string table, or "" if off is
+// out of range
+func dynString(strs []byte, off uint32) string {
+	if uint64(off) >= uint64(len(strs)) {
+		return ""
+	}
+	return cString(strs[off:])
+}
+
+// versionsCommand implements "elfsize versions [--symbols] [--json] <file>"
+func versionsCommand(args []string) int {
+	fs := flag.NewFlagSet("versions", flag.ContinueOnError)
+	showSymbols := fs.Bool("symbols", false, "list the symbols of each version under it")
+	asJSON := fs.Bool("json", false, "print the versions and their symbols as JSON")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s versions [--symbols] [--json] <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the symbol versions an ELF file needs, with the library and the\n")
+		fmt.Fprintf(os.Stderr, "    number of symbols bound to each, and the versions it provides\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	versions, err := GetSymbolVersions(positional[0])
+	if err != nil {
+		PrintError("versions", err)
+		return 1
+	}
+	if *asJSON {
+		out, _ := json.MarshalIndent(versions, "", "  ")
+		fmt.Println(string(out))
+		return 0
+	}
+	printSymbols := func(symbols []string) {
+		if *showSymbols {
+			for _, sym := range symbols {
+				fmt.Printf("\t%s\n", sym)
+			}
+		}
+	}
+	for _, v := range versions.Required {
+		weak := ""
+		if v.Weak {
+			weak = "\tweak"
+		}
+		fmt.Printf("needs\t%s\t%s\t%d%s\n", v.Library, v.Version, len(v.Symbols), weak)
+		printSymbols(v.Symbols)
+	}
+	for _, v := range versions.Provided {
+		base := ""
+		if v.Base {
+			base = "\tbase"
+		}
+		fmt.Printf("provides\t%s\t%d%s\n", v.Version, len(v.Symbols), base)
+		printSymbols(v.Symbols)
+	}
+	return 0
+}
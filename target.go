@@ -0,0 +1,383 @@
+package main
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// targetArch is what an architecture name of a target stands for
+type targetArch struct {
+	machine elf.Machine
+	class   elf.Class
+	order   binary.ByteOrder
+}
+
+// targetArchs are the architecture names a target may start with: those
+// GetElfArchitecture returns, and the names FreeBSD, Debian and Go use
+var targetArchs = map[string]targetArch{
+	"x86_64":      {elf.EM_X86_64, elf.ELFCLASS64, binary.LittleEndian},
+	"amd64":       {elf.EM_X86_64, elf.ELFCLASS64, binary.LittleEndian},
+	"i386":        {elf.EM_386, elf.ELFCLASS32, binary.LittleEndian},
+	"i486":        {elf.EM_386, elf.ELFCLASS32, binary.LittleEndian},
+	"i586":        {elf.EM_386, elf.ELFCLASS32, binary.LittleEndian},
+	"i686":        {elf.EM_386, elf.ELFCLASS32, binary.LittleEndian},
+	"aarch64":     {elf.EM_AARCH64, elf.ELFCLASS64, binary.LittleEndian},
+	"arm64":       {elf.EM_AARCH64, elf.ELFCLASS64, binary.LittleEndian},
+	"armhf":       {elf.EM_ARM, elf.ELFCLASS32, binary.LittleEndian},
+	"armel":       {elf.EM_ARM, elf.ELFCLASS32, binary.LittleEndian},
+	"arm":         {elf.EM_ARM, elf.ELFCLASS32, binary.LittleEndian},
+	"armv6":       {elf.EM_ARM, elf.ELFCLASS32, binary.LittleEndian},
+	"armv7":       {elf.EM_ARM, elf.ELFCLASS32, binary.LittleEndian},
+	"riscv64":     {elf.EM_RISCV, elf.ELFCLASS64, binary.LittleEndian},
+	"riscv32":     {elf.EM_RISCV, elf.ELFCLASS32, binary.LittleEndian},
+	"powerpc":     {elf.EM_PPC, elf.ELFCLASS32, binary.BigEndian},
+	"ppc64":       {elf.EM_PPC64, elf.ELFCLASS64, binary.BigEndian},
+	"powerpc64":   {elf.EM_PPC64, elf.ELFCLASS64, binary.BigEndian},
+	"ppc64le":     {elf.EM_PPC64, elf.ELFCLASS64, binary.LittleEndian},
+	"powerpc64le": {elf.EM_PPC64, elf.ELFCLASS64, binary.LittleEndian},
+	"s390x":       {elf.EM_S390, elf.ELFCLASS64, binary.BigEndian},
+	"mips":        {elf.EM_MIPS, elf.ELFCLASS32, binary.BigEndian},
+	"mipsel":      {elf.EM_MIPS, elf.ELFCLASS32, binary.LittleEndian},
+	"mips64":      {elf.EM_MIPS, elf.ELFCLASS64, binary.BigEndian},
+	"mips64el":    {elf.EM_MIPS, elf.ELFCLASS64, binary.LittleEndian},
+	"loongarch64": {elf.EM_LOONGARCH, elf.ELFCLASS64, binary.LittleEndian},
+	"sparc64":     {elf.EM_SPARCV9, elf.ELFCLASS64, binary.BigEndian},
+}
+
+// targetOSes are the operating systems a target may name, with the EI_OSABI
+// brand of their binaries and the OS of their NT_GNU_ABI_TAG notes
+var targetOSes = map[string]struct {
+	osabi elf.OSABI
+	gnuOS string
+}{
+	"linux":   {elf.ELFOSABI_LINUX, "Linux"},
+	"freebsd": {elf.ELFOSABI_FREEBSD, "FreeBSD"},
+	"netbsd":  {elf.ELFOSABI_NETBSD, ""},
+	"openbsd": {elf.ELFOSABI_OPENBSD, ""},
+	"solaris": {elf.ELFOSABI_SOLARIS, "Solaris"},
+	"hurd":    {elf.ELFOSABI_HURD, "Hurd"},
+}
+
+// ARM EABI floating point flags of e_flags
+const (
+	efARMABIFloatSoft = 0x200
+	efARMABIFloatHard = 0x400
+)
+
+// elfHeaderFlags returns the e_flags field of the ELF header, which
+// debug/elf does not keep
+func elfHeaderFlags(f *elf.File, r io.ReaderAt) (uint32, error) {
+	off := int64(36)
+	if f.Class == elf.ELFCLASS64 {
+		off = 48
+	}
+	var b [4]byte
+	if _, err := r.ReadAt(b[:], off); err != nil {
+		return 0, err
+	}
+	return f.ByteOrder.Uint32(b[:]), nil
+}
+
+// Target is a platform binaries are checked against, such as
+// aarch64-freebsd14 or x86_64-linux
+type Target struct {
+	Arch    string // as it was named, e.g. "amd64"
+	OS      string // one of targetOSes
+	Version string // of the OS, e.g. "14" or "5.10", "" for any
+	arch    targetArch
+}
+
+func (t *Target) String() string {
+	return t.Arch + "-" + t.OS + t.Version
+}
+
+// ParseTarget parses a target of the form <arch>-<os>[<version>], e.g.
+// "aarch64-freebsd14", "x86_64-linux" or "armhf-linux5.10". Triples such as
+// "x86_64-unknown-freebsd14.1" are accepted as well
+func ParseTarget(name string) (*Target, error) {
+	parts := strings.Split(strings.ToLower(name), "-")
+	arch, ok := targetArchs[parts[0]]
+	if !ok || len(parts) < 2 {
+		return nil, errors.New(Tr(msgBadTarget, name))
+	}
+	for _, part := range parts[1:] {
+		for osName := range targetOSes {
+			if version, found := strings.CutPrefix(part, osName); found {
+				if strings.Trim(version, "0123456789.") != "" {
+					continue
+				}
+				return &Target{parts[0], osName, version, arch}, nil
+			}
+		}
+	}
+	return nil, errors.New(Tr(msgBadTarget, name))
+}
+
+// CheckTarget returns the reasons why an ELF file cannot run on a target,
+// checking its machine, class, byte order, OS ABI brand and ABI notes. There
+// are none if it can, as far as can be told without running it
+func CheckTarget(filepath string, target *Target) ([]string, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return nil, err
+	}
+	return elfCheckTarget(f, r, target)
+}
+
+// elfCheckTarget does the work of CheckTarget
+func elfCheckTarget(f *elf.File, r io.ReaderAt, target *Target) ([]string, error) {
+	problems := []string{}
+	if f.Machine != target.arch.machine {
+		problems = append(problems, Tr(msgTargetMachine, elfArchitecture(f), target.Arch))
+	}
+	if f.Class != target.arch.class {
+		problems = append(problems, Tr(msgTargetClass, elfClassBits(f.Class), elfClassBits(target.arch.class)))
+	}
+	if f.ByteOrder != target.arch.order {
+		problems = append(problems, Tr(msgTargetByteOrder, byteOrderName(f.ByteOrder), byteOrderName(target.arch.order)))
+	}
+	if f.Machine == elf.EM_ARM {
+		flags, err := elfHeaderFlags(f, r)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case target.Arch == "armhf" && flags&efARMABIFloatSoft != 0:
+			problems = append(problems, Tr(msgTargetFloatABI, "soft", "hard"))
+		case target.Arch == "armel" && flags&efARMABIFloatHard != 0:
+			problems = append(problems, Tr(msgTargetFloatABI, "hard", "soft"))
+		}
+	}
+
+	targetOS := targetOSes[target.OS]
+	if f.OSABI != elf.ELFOSABI_NONE && f.OSABI != targetOS.osabi {
+		problems = append(problems, Tr(msgTargetOSABI, osabiName(f.OSABI), target.OS))
+	}
+	notes, err := elfNotes(f)
+	if err != nil {
+		return nil, err
+	}
+	order := f.ByteOrder
+	for _, note := range notes {
+		switch {
+		case note.Name == "FreeBSD" && note.Type == ntFreeBSDABITag && len(note.Desc) >= 4:
+			release := freeBSDRelease(order.Uint32(note.Desc))
+			if target.OS != "freebsd" {
+				problems = append(problems, Tr(msgTargetBuiltFor, "FreeBSD "+release, target.OS))
+			} else if major, _, _ := strings.Cut(release, "."); target.Version != "" && compareVersions(major, target.Version) > 0 {
+				// Binaries run on every release of the major version they
+				// were built on, and later ones
+				problems = append(problems, Tr(msgTargetTooOld, "FreeBSD "+release, target.String()))
+			}
+		case note.Name == "GNU" && note.Type == ntGNUABITag && len(note.Desc) >= 16:
+			n := order.Uint32(note.Desc)
+			noteOS := fmt.Sprint(n)
+			if n < uint32(len(gnuABIOS)) {
+				noteOS = gnuABIOS[n]
+			}
+			kernel := fmt.Sprintf("%d.%d.%d", order.Uint32(note.Desc[4:]), order.Uint32(note.Desc[8:]), order.Uint32(note.Desc[12:]))
+			if noteOS != targetOS.gnuOS {
+				problems = append(problems, Tr(msgTargetBuiltFor, noteOS, target.OS))
+			} else if target.Version != "" && compareVersions(kernel, target.Version) > 0 {
+				problems = append(problems, Tr(msgTargetTooOld, noteOS+" "+kernel, target.String()))
+			}
+		}
+	}
+	return problems, nil
+}
+
+// hostArchs name the architectures of runtime.GOARCH as targets do
+var hostArchs = map[string]string{
+	"amd64": "x86_64", "386": "i686", "arm64": "aarch64", "arm": "arm",
+	"riscv64": "riscv64", "ppc64": "ppc64", "ppc64le": "ppc64le", "s390x": "s390x",
+	"mips": "mips", "mipsle": "mipsel", "mips64": "mips64", "mips64le": "mips64el",
+	"loong64": "loongarch64",
+}
+
+// hostCompatArchs are the architectures a host runs besides its own
+var hostCompatArchs = map[string][]string{
+	"x86_64": {"i686"},
+}
+
+// hostTargets returns the targets this system runs binaries for, its own
+// first
+func hostTargets() ([]*Target, error) {
+	goos := runtime.GOOS
+	if goos == "illumos" {
+		goos = "solaris"
+	}
+	arch, ok := hostArchs[runtime.GOARCH]
+	if _, known := targetOSes[goos]; !ok || !known {
+		return nil, errors.New(Tr(msgHostNoELF, runtime.GOOS, runtime.GOARCH))
+	}
+	release := hostOSRelease()
+	var targets []*Target
+	for _, name := range append([]string{arch}, hostCompatArchs[arch]...) {
+		targets = append(targets, &Target{name, goos, release, targetArchs[name]})
+	}
+	return targets, nil
+}
+
+// CheckRunnableHere returns the reasons why an ELF file cannot run on this
+// system, without running it: those of CheckTarget, and a missing
+// interpreter or shared libraries that do not resolve, as ResolveDependencies
+// finds them. There are none if it can
+func CheckRunnableHere(filepath string) ([]string, error) {
+	_, problems, err := checkRunnableHere(filepath)
+	return problems, err
+}
+
+// checkRunnableHere does the work of CheckRunnableHere, and returns the
+// target the file was checked against
+func checkRunnableHere(filepath string) (*Target, []string, error) {
+	targets, err := hostTargets()
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	target := targets[0]
+	for _, t := range targets {
+		if t.arch.machine == f.Machine && t.arch.class == f.Class {
+			target = t
+			break
+		}
+	}
+	problems, err := elfCheckTarget(f, r, target)
+	if err != nil || len(problems) > 0 {
+		// Libraries for the wrong platform would not resolve either
+		return target, problems, err
+	}
+
+	interp, err := elfInterpreter(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	if interp != "" {
+		if _, err := os.Stat(interp); err != nil {
+			problems = append(problems, Tr(msgHereNoInterpreter, interp))
+		}
+	}
+	if hasProg(f, elf.PT_DYNAMIC) {
+		libs, err := ResolveDependencies(filepath)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, lib := range libs {
+			if lib.Path == "" {
+				problems = append(problems, Tr(msgHereMissingLibrary, lib.Name, lib.NeededBy))
+			}
+		}
+	}
+	return target, problems, nil
+}
+
+// canRunCommand implements "elfsize can-run --target <target> <file>"
+func canRunCommand(args []string) int {
+	fs := flag.NewFlagSet("can-run", flag.ContinueOnError)
+	targetName := fs.String("target", "", "the platform to check against, e.g. aarch64-freebsd14 or x86_64-linux")
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s can-run --target <arch>-<os>[version] [--json] <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Check the machine, class, byte order, OS ABI and ABI notes of an ELF\n")
+		fmt.Fprintf(os.Stderr, "    file against a platform, and print why it cannot run there\n")
+		fmt.Fprintf(os.Stderr, "    Exits with 1 if it cannot\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 || *targetName == "" {
+		fs.Usage()
+		return 2
+	}
+	target, err := ParseTarget(*targetName)
+	if err != nil {
+		PrintError("can-run", err)
+		return 2
+	}
+
+	problems, err := CheckTarget(positional[0], target)
+	if err != nil {
+		PrintError("can-run", err)
+		return 1
+	}
+	return printTargetCheck(positional[0], target.String(), problems, *asJSON)
+}
+
+// printTargetCheck prints the result of can-run and can-run-here and returns
+// the exit status
+func printTargetCheck(path, target string, problems []string, asJSON bool) int {
+	status := 0
+	if len(problems) > 0 {
+		status = 1
+	}
+	if asJSON {
+		out, _ := json.MarshalIndent(struct {
+			Path     string   `json:"path"`
+			Target   string   `json:"target"`
+			CanRun   bool     `json:"can_run"`
+			Problems []string `json:"problems"`
+		}{path, target, status == 0, problems}, "", "  ")
+		fmt.Println(string(out))
+		return status
+	}
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if status == 0 {
+		fmt.Fprintln(os.Stderr, Tr(msgTargetCanRun, path, target))
+	}
+	return status
+}
+
+// canRunHereCommand implements "elfsize can-run-here <file>"
+func canRunHereCommand(args []string) int {
+	fs := flag.NewFlagSet("can-run-here", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s can-run-here [--json] <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Check an ELF file like can-run does against this system, and that its\n")
+		fmt.Fprintf(os.Stderr, "    interpreter exists and all shared libraries it needs are found, without\n")
+		fmt.Fprintf(os.Stderr, "    running it. Print what is missing, and exit with 1 if anything is\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	target, problems, err := checkRunnableHere(positional[0])
+	if err != nil {
+		PrintError("can-run-here", err)
+		return 1
+	}
+	return printTargetCheck(positional[0], target.String(), problems, *asJSON)
+}
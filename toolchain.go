@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"debug/buildinfo"
+	"debug/elf"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Toolchain is a compiler or linker that left its mark in an ELF file
+type Toolchain struct {
+	Name    string `json:"name"`            // "go", "rustc", "gcc", "clang", "lld", "gold" or "mold"
+	Kind    string `json:"kind"`            // "compiler" or "linker"
+	Version string `json:"version"`         // empty if not recorded
+	Source  string `json:"source"`          // where it was found, a section name or "symbols"
+	Ident   string `json:"ident,omitempty"` // the string it was found in, if any
+}
+
+// commentToolchains recognize the identification strings compilers and
+// linkers put in .comment, with the version as the first subexpression
+var commentToolchains = []struct {
+	name, kind string
+	re         *regexp.Regexp
+}{
+	{"rustc", "compiler", regexp.MustCompile(`^rustc version (\S+)`)},
+	{"clang", "compiler", regexp.MustCompile(`clang version (\S+)`)},
+	{"gcc", "compiler", regexp.MustCompile(`^GCC: \(.*\) (\S+)`)},
+	{"lld", "linker", regexp.MustCompile(`^Linker: LLD (\S+)`)},
+	{"mold", "linker", regexp.MustCompile(`^mold (\S+)`)},
+}
+
+// rustSymbol matches symbols mangled by rustc: the v0 scheme, and the legacy
+// one, which is the Itanium scheme with a hash as the last component
+var rustSymbol = regexp.MustCompile(`^_R[a-zA-Z0-9_]|^_ZN.*17h[0-9a-f]{16}E$`)
+
+// GetToolchains returns the compilers and linkers that built an ELF file,
+// as far as they identify themselves: in .comment for GCC, Clang, rustc,
+// LLD and mold, in a note for gold, in the build information for Go, and
+// by the way rustc mangles symbols if it left nothing else. Objects linked
+// from several languages, or with crt files from another compiler, have
+// several
+func GetToolchains(filepath string) ([]Toolchain, error) {
+	r, err := openFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	f, err := parseElf(filepath, r)
+	if err != nil {
+		return nil, err
+	}
+
+	toolchains := []Toolchain{}
+	if bi, err := buildinfo.Read(r); err == nil {
+		toolchains = append(toolchains, Toolchain{"go", "compiler", bi.GoVersion, ".go.buildinfo", ""})
+	} else if f.Section(".note.go.buildid") != nil || f.Section(".gopclntab") != nil {
+		toolchains = append(toolchains, Toolchain{"go", "compiler", "", ".gopclntab", ""})
+	}
+
+	if s := f.Section(".comment"); s != nil && s.Type != elf.SHT_NOBITS {
+		data, err := s.Data()
+		if err != nil {
+			return nil, err
+		}
+		seen := map[string]bool{}
+		for _, ident := range bytes.Split(data, []byte{0}) {
+			text := strings.TrimSpace(string(ident))
+			if text == "" || seen[text] {
+				continue
+			}
+			seen[text] = true
+			for _, t := range commentToolchains {
+				if m := t.re.FindStringSubmatch(text); m != nil {
+					toolchains = append(toolchains, Toolchain{t.name, t.kind, m[1], ".comment", text})
+					break
+				}
+			}
+		}
+	}
+
+	notes, err := elfNotes(f)
+	if err != nil {
+		return nil, err
+	}
+	for _, note := range notes {
+		if note.Name == "GNU" && note.Type == ntGNUGoldVersion {
+			text := strings.TrimRight(string(note.Desc), "\x00")
+			version := strings.TrimPrefix(text, "gold ")
+			toolchains = append(toolchains, Toolchain{"gold", "linker", version, ".note.gnu.gold-version", text})
+		}
+	}
+
+	if !hasToolchain(toolchains, "rustc") && elfHasRustSymbols(f) {
+		toolchains = append(toolchains, Toolchain{"rustc", "compiler", "", "symbols", ""})
+	}
+	return toolchains, nil
+}
+
+// hasToolchain reports whether a toolchain of a name is among toolchains
+func hasToolchain(toolchains []Toolchain, name string) bool {
+	for _, t := range toolchains {
+		if t.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// elfHasRustSymbols reports whether the symbol table, or the dynamic one
+// of stripped files, has symbols mangled by rustc or from its runtime
+func elfHasRustSymbols(f *elf.File) bool {
+	symbols, err := f.Symbols()
+	if err != nil || len(symbols) == 0 {
+		symbols, _ = f.DynamicSymbols()
+	}
+	for _, sym := range symbols {
+		if rustSymbol.MatchString(sym.Name) || strings.HasPrefix(sym.Name, "__rust_") || sym.Name == "rust_begin_unwind" {
+			return true
+		}
+	}
+	return false
+}
+
+// toolchainCommand implements "elfsize toolchain <file>..."
+func toolchainCommand(args []string) int {
+	fs := flag.NewFlagSet("toolchain", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the toolchains as JSON, by file")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s toolchain [--json] <file>...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the compilers and linkers that built each file, Go, rustc, GCC,\n")
+		fmt.Fprintf(os.Stderr, "    Clang, LLD, gold and mold, with their versions as far as recorded\n")
+		fmt.Fprintf(os.Stderr, "    Exits with 1 if none is found for a file\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	status := 0
+	byFile := map[string][]Toolchain{}
+	for _, path := range positional {
+		toolchains, err := GetToolchains(path)
+		if err != nil {
+			PrintError("toolchain", err)
+			status = 1
+			continue
+		}
+		if len(toolchains) == 0 {
+			printWarning("toolchain", errors.New(Tr(msgNoToolchain, path)))
+			status = 1
+		}
+		byFile[path] = toolchains
+		if *asJSON {
+			continue
+		}
+		for _, t := range toolchains {
+			version := t.Version
+			if version == "" {
+				version = "-"
+			}
+			if len(positional) > 1 {
+				fmt.Printf("%s\t", path)
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\n", t.Kind, t.Name, version, t.Source)
+		}
+	}
+	if *asJSON {
+		out, _ := json.MarshalIndent(byFile, "", "  ")
+		fmt.Println(string(out))
+	}
+	return status
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bufio"
+	"debug/elf"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// tuiRow is a line of the region table of the tui subcommand
+type tuiRow struct {
+	name   string
+	kind   string
+	offset int64
+	size   int64
+}
+
+// tuiSortKeys are the orders the region table cycles through
+var tuiSortKeys = []string{"offset", "size", "name"}
+
+// tuiView is the state of the tui subcommand
+type tuiView struct {
+	info     *ElfInfo
+	rows     []tuiRow
+	top      int // first visible row
+	selected int
+	sortKey  int
+	reverse  bool
+	width    int
+	height   int
+}
+
+// newTUIView collects the summary, the sections and the overlay of a file
+func newTUIView(path string) (*tuiView, error) {
+	r, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	info, err := newElfInfo(path, r)
+	if err != nil {
+		return nil, err
+	}
+	f, err := parseElf(path, r)
+	if err != nil {
+		return nil, err
+	}
+	v := &tuiView{info: info, width: 80, height: 24}
+	for _, s := range f.Sections {
+		if s.Type == elf.SHT_NULL {
+			continue
+		}
+		size := int64(s.Size)
+		if s.Type == elf.SHT_NOBITS {
+			size = 0
+		}
+		v.rows = append(v.rows, tuiRow{s.Name, strings.TrimPrefix(s.Type.String(), "SHT_"), int64(s.Offset), size})
+	}
+	if info.Overlay > 0 {
+		v.rows = append(v.rows, tuiRow{"[overlay]", "APPENDED", info.Size, info.Overlay})
+	}
+	v.sort()
+	return v, nil
+}
+
+// sort orders the rows by the current key
+func (v *tuiView) sort() {
+	less := map[string]func(a, b tuiRow) bool{
+		"offset": func(a, b tuiRow) bool { return a.offset < b.offset },
+		"size":   func(a, b tuiRow) bool { return a.size > b.size },
+		"name":   func(a, b tuiRow) bool { return a.name < b.name },
+	}[tuiSortKeys[v.sortKey]]
+	sort.SliceStable(v.rows, func(i, j int) bool {
+		if v.reverse {
+			return less(v.rows[j], v.rows[i])
+		}
+		return less(v.rows[i], v.rows[j])
+	})
+}
+
+// summaryLines are shown above the table
+func (v *tuiView) summaryLines() []string {
+	i := v.info
+	lines := []string{
+		fmt.Sprintf("%s  %s %s %d-bit %s-endian, %s", i.Path, i.Arch, i.Type, i.Class, i.Endianness, i.OSABI),
+		fmt.Sprintf("ELF size %d of %d bytes, overlay %d bytes", i.Size, i.FileSize, i.Overlay),
+	}
+	if i.Interpreter != "" {
+		lines = append(lines, "interpreter "+i.Interpreter)
+	}
+	return lines
+}
+
+// tableHeight is how many rows fit on the screen
+func (v *tuiView) tableHeight() int {
+	return max(v.height-len(v.summaryLines())-3, 1)
+}
+
+// render draws the whole screen; highlight marks the selected row, which is
+// left out when printing to a file
+func (v *tuiView) render(w io.Writer, highlight bool) {
+	var b strings.Builder
+	for _, line := range v.summaryLines() {
+		b.WriteString(v.clip(line) + "\r\n")
+	}
+	order := tuiSortKeys[v.sortKey]
+	if v.reverse {
+		order += " reversed"
+	}
+	b.WriteString(v.clip(fmt.Sprintf("%-24s %-14s %10s %10s  sorted by %s", "REGION", "TYPE", "OFFSET", "SIZE", order)) + "\r\n")
+	rows := v.rows
+	if highlight {
+		rows = rows[v.top:min(v.top+v.tableHeight(), len(rows))]
+	}
+	for n, row := range rows {
+		line := v.clip(fmt.Sprintf("%-24s %-14s %10d %10d", row.name, row.kind, row.offset, row.size))
+		if highlight && v.top+n == v.selected {
+			line = "\x1b[7m" + line + "\x1b[0m"
+		}
+		b.WriteString(line + "\r\n")
+	}
+	if highlight {
+		b.WriteString(v.clip("j/k, arrows, PgUp/PgDn scroll  s sort  r reverse  q quit"))
+	}
+	text := b.String()
+	if highlight {
+		text = "\x1b[H\x1b[2J" + text
+	} else {
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+	}
+	io.WriteString(w, text)
+}
+
+// clip cuts a line to the terminal width
+func (v *tuiView) clip(line string) string {
+	if len(line) > v.width {
+		return line[:v.width]
+	}
+	return line
+}
+
+// move scrolls the selection by delta rows
+func (v *tuiView) move(delta int) {
+	v.selected = min(max(v.selected+delta, 0), max(len(v.rows)-1, 0))
+	if v.selected < v.top {
+		v.top = v.selected
+	}
+	if v.selected >= v.top+v.tableHeight() {
+		v.top = v.selected - v.tableHeight() + 1
+	}
+}
+
+// stty runs stty on the terminal and returns its output
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// isTerminal reports whether f is a character device
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// tuiCommand implements "elfsize tui <file>"
+func tuiCommand(args []string) int {
+	fs := flag.NewFlagSet("tui", flag.ContinueOnError)
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s tui <file>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Browse the header summary, sections and overlay of an ELF file in the terminal\n")
+		fmt.Fprintf(os.Stderr, "    Prints the table once if not run in a terminal\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	v, err := newTUIView(positional[0])
+	if err != nil {
+		PrintError("tui", err)
+		return 1
+	}
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		v.render(os.Stdout, false)
+		return 0
+	}
+	saved, err := stty("-g")
+	if err != nil {
+		v.render(os.Stdout, false)
+		return 0
+	}
+	if size, err := stty("size"); err == nil {
+		if rows, cols, ok := strings.Cut(size, " "); ok {
+			v.height, _ = strconv.Atoi(rows)
+			v.width, _ = strconv.Atoi(cols)
+		}
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		PrintError("tui", err)
+		return 1
+	}
+	defer func() {
+		stty(saved)
+		fmt.Print("\x1b[H\x1b[2J")
+	}()
+
+	in := bufio.NewReader(os.Stdin)
+	for {
+		v.render(os.Stdout, true)
+		key, err := in.ReadByte()
+		if err != nil {
+			return 0
+		}
+		if key == 0x1b {
+			// Escape sequences of the cursor and paging keys
+			seq := make([]byte, 2)
+			if _, err := io.ReadFull(in, seq); err != nil || seq[0] != '[' {
+				continue
+			}
+			switch seq[1] {
+			case 'A':
+				key = 'k'
+			case 'B':
+				key = 'j'
+			case '5', '6':
+				in.ReadByte() // the trailing '~'
+				key = map[byte]byte{'5': 'u', '6': 'd'}[seq[1]]
+			}
+		}
+		switch key {
+		case 'q', 3: // q or ^C
+			return 0
+		case 'j':
+			v.move(1)
+		case 'k':
+			v.move(-1)
+		case 'd', ' ':
+			v.move(v.tableHeight())
+		case 'u':
+			v.move(-v.tableHeight())
+		case 's':
+			v.sortKey = (v.sortKey + 1) % len(tuiSortKeys)
+			v.sort()
+		case 'r':
+			v.reverse = !v.reverse
+			v.sort()
+		}
+	}
+}
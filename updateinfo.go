@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// updateInfoSection holds the update information of a type-2 AppImage
+const updateInfoSection = ".upd_info"
+
+// updateInfoTransports are the update information formats of the AppImage
+// specification, identified by their first |-separated field
+var updateInfoTransports = []string{"zsync", "gh-releases-zsync", "pling-v1-zsync"}
+
+// GetUpdateInfo returns the update information embedded in an AppImage,
+// such as "gh-releases-zsync|user|repo|latest|App-*x86_64.AppImage.zsync",
+// or "" if none was embedded
+func GetUpdateInfo(filepath string) (string, error) {
+	data, err := GetSectionData(filepath, updateInfoSection)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.TrimRight(data, "\x00")), nil
+}
+
+// SetUpdateInfo embeds update information into the .upd_info section of an
+// AppImage, in place, and returns err. An empty info clears it
+func SetUpdateInfo(filepath string, info string) error {
+	if info != "" {
+		transport, _, _ := strings.Cut(info, "|")
+		if !slices.Contains(updateInfoTransports, transport) {
+			return errors.New(Tr(msgBadUpdateInfo, transport, strings.Join(updateInfoTransports, ", ")))
+		}
+	}
+	return SetSectionData(filepath, updateInfoSection, []byte(info))
+}
+
+// getUpdateInfoCommand implements "elfsize get-updateinfo <appimage>"
+func getUpdateInfoCommand(args []string) int {
+	fs := flag.NewFlagSet("get-updateinfo", flag.ContinueOnError)
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s get-updateinfo <appimage>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Print the update information embedded in an AppImage\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	info, err := GetUpdateInfo(positional[0])
+	if err != nil {
+		PrintError("get-updateinfo", err)
+		return 1
+	}
+	fmt.Println(info)
+	return 0
+}
+
+// setUpdateInfoCommand implements "elfsize set-updateinfo <appimage> <info>"
+func setUpdateInfoCommand(args []string) int {
+	fs := flag.NewFlagSet("set-updateinfo", flag.ContinueOnError)
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s set-updateinfo <appimage> <info>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Embed update information, e.g. 'gh-releases-zsync|user|repo|latest|App-*.zsync'\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	if err := SetUpdateInfo(positional[0], positional[1]); err != nil {
+		PrintError("set-updateinfo", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gpgProgram verifies OpenPGP signatures. There is no OpenPGP implementation
+// in the standard library
+var gpgProgram = "gpg"
+
+// ErrSelfSigned is returned, wrapped in a FileError, by VerifySignature for
+// AppImages whose signature is valid for the key embedded in them. That only
+// shows that the file is consistent: anyone can sign a modified AppImage and
+// embed their own key
+var ErrSelfSigned = errors.New(Tr(msgSelfSigned))
+
+// VerifySignature checks the signature embedded in an AppImage against its
+// digest and returns nil if it is valid for key. The signature covers the hex
+// encoded digest, like appimagetool signs it. OpenPGP signatures are checked
+// with gpg; minisign signatures with the legacy, not prehashed, Ed25519
+// algorithm are checked directly. If key is nil, the key embedded in the
+// AppImage is used, and a valid signature yields ErrSelfSigned, since only a
+// key the caller trusts makes the file trusted
+func VerifySignature(filepath string, key []byte) error {
+	sig, embeddedKey, err := GetSignature(filepath)
+	if err != nil {
+		return err
+	}
+	if len(sig) == 0 {
+		return errors.New(Tr(msgNoSignature, filepath))
+	}
+	if key == nil {
+		if len(embeddedKey) == 0 {
+			return errors.New(Tr(msgNoSignatureKey, filepath))
+		}
+		if err := verifySignatureData(filepath, sig, embeddedKey); err != nil {
+			return err
+		}
+		return &FileError{filepath, ErrSelfSigned}
+	}
+	return verifySignatureData(filepath, sig, key)
+}
+
+// VerifySignatureKeyring is VerifySignature with every file in the directory
+// keyring as a trusted key, and returns the name of the one the AppImage is
+// signed with
+func VerifySignatureKeyring(filepath string, keyring string) (string, error) {
+	keys, err := keyringFiles(keyring)
+	if err != nil {
+		return "", err
+	}
+	sig, _, err := GetSignature(filepath)
+	if err != nil {
+		return "", err
+	}
+	if len(sig) == 0 {
+		return "", errors.New(Tr(msgNoSignature, filepath))
+	}
+	for _, name := range keys {
+		key, err := os.ReadFile(name)
+		if err != nil {
+			return "", err
+		}
+		if verifySignatureData(filepath, sig, key) == nil {
+			return name, nil
+		}
+	}
+	return "", errors.New(Tr(msgNoTrustedKey, filepath, keyring))
+}
+
+// keyringFiles returns the paths of the regular files in a keyring directory
+func keyringFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return files, nil
+}
+
+// verifySignatureData checks the signature sig of an AppImage with key
+func verifySignatureData(filepath string, sig, key []byte) error {
+	digest, err := GetDigest(filepath)
+	if err != nil {
+		return err
+	}
+	message := []byte(hex.EncodeToString(digest))
+
+	switch {
+	case bytes.HasPrefix(sig, []byte("-----BEGIN PGP SIGNATURE-----")):
+		return verifyOpenPGP(sig, key, message)
+	case bytes.HasPrefix(sig, []byte("untrusted comment:")):
+		return verifyMinisign(sig, key, message)
+	}
+	return errors.New(Tr(msgUnsupportedSignature))
+}
+
+// verifyOpenPGP runs gpg with a throwaway keyring holding only key
+func verifyOpenPGP(sig, key, message []byte) error {
+	home, err := os.MkdirTemp("", "elfsize-gpg")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(home)
+	files := map[string][]byte{"key.asc": key, "sig.asc": sig, "digest": message}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(home, name), data, 0600); err != nil {
+			return err
+		}
+	}
+	gpg := func(args ...string) ([]byte, error) {
+		cmd := exec.Command(gpgProgram, append([]string{"--homedir", home, "--batch", "--no-tty"}, args...)...)
+		return cmd.CombinedOutput()
+	}
+	if out, err := gpg("--import", filepath.Join(home, "key.asc")); err != nil {
+		return fmt.Errorf("%s: %s", err, bytes.TrimSpace(out))
+	}
+	out, err := gpg("--status-fd", "1", "--verify", filepath.Join(home, "sig.asc"), filepath.Join(home, "digest"))
+	if err != nil || !bytes.Contains(out, []byte("[GNUPG:] VALIDSIG")) {
+		return errors.New(Tr(msgBadSignature))
+	}
+	return nil
+}
+
+// minisignData decodes the base64 line following the untrusted comment of a
+// minisign key or signature file
+func minisignData(file []byte, size int) ([]byte, []string, error) {
+	lines := strings.Split(strings.TrimSpace(string(file)), "\n")
+	idx := 0
+	if strings.HasPrefix(lines[0], "untrusted comment:") {
+		idx = 1
+	}
+	if idx >= len(lines) {
+		return nil, nil, errors.New(Tr(msgUnsupportedSignature))
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[idx]))
+	if err != nil || len(data) != size {
+		return nil, nil, errors.New(Tr(msgUnsupportedSignature))
+	}
+	return data, lines[idx+1:], nil
+}
+
+// verifyMinisign checks a minisign signature: the algorithm ("Ed") and key
+// ID, the signature of the message and the signature of the trusted comment
+func verifyMinisign(sig, key, message []byte) error {
+	pub, _, err := minisignData(key, 2+8+ed25519.PublicKeySize)
+	if err != nil {
+		return err
+	}
+	s, rest, err := minisignData(sig, 2+8+ed25519.SignatureSize)
+	if err != nil {
+		return err
+	}
+	if string(s[:2]) != "Ed" || string(pub[:2]) != "Ed" {
+		// "ED" signs a BLAKE2b hash, which needs more than the standard library
+		return errors.New(Tr(msgUnsupportedSignature))
+	}
+	if !bytes.Equal(s[2:10], pub[2:10]) {
+		return errors.New(Tr(msgSignatureKeyMismatch))
+	}
+	pk := ed25519.PublicKey(pub[10:])
+	if !ed25519.Verify(pk, message, s[10:]) {
+		return errors.New(Tr(msgBadSignature))
+	}
+	if len(rest) >= 2 && strings.HasPrefix(rest[0], "trusted comment: ") {
+		global, err := base64.StdEncoding.DecodeString(strings.TrimSpace(rest[1]))
+		comment := strings.TrimPrefix(rest[0], "trusted comment: ")
+		if err != nil || !ed25519.Verify(pk, append(s[10:], comment...), global) {
+			return errors.New(Tr(msgBadSignature))
+		}
+	}
+	return nil
+}
+
+// verifySignatureCommand implements "elfsize verify-signature <appimage> [--key file | --keyring dir]"
+func verifySignatureCommand(args []string) int {
+	fs := flag.NewFlagSet("verify-signature", flag.ContinueOnError)
+	keyFile := fs.String("key", "", "trust this public key")
+	keyring := fs.String("keyring", os.Getenv("ELFSIZE_KEYRING"), "trust the public keys in this directory (default $ELFSIZE_KEYRING)")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s verify-signature <appimage> [--key file | --keyring dir]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Check the embedded gpg or minisign signature of an AppImage against a\n")
+		fmt.Fprintf(os.Stderr, "    trusted key and print \"trusted\" if it is valid for it. Without --key\n")
+		fmt.Fprintf(os.Stderr, "    or --keyring only the key embedded in the AppImage can be used, which\n")
+		fmt.Fprintf(os.Stderr, "    anyone who modifies the file can replace with their own: a valid\n")
+		fmt.Fprintf(os.Stderr, "    signature is then reported as self-signed, unverified. Exit with 0 if\n")
+		fmt.Fprintf(os.Stderr, "    trusted and 1 otherwise, self-signed included\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+	path := positional[0]
+
+	switch {
+	case *keyFile != "":
+		key, err := os.ReadFile(*keyFile)
+		if err != nil {
+			PrintError("verify-signature", err)
+			return 1
+		}
+		if err := VerifySignature(path, key); err != nil {
+			PrintError("verify-signature", err)
+			return 1
+		}
+		fmt.Println(Tr(msgSignatureTrusted, path, *keyFile))
+	case *keyring != "":
+		name, err := VerifySignatureKeyring(path, *keyring)
+		if err != nil {
+			PrintError("verify-signature", err)
+			return 1
+		}
+		fmt.Println(Tr(msgSignatureTrusted, path, name))
+	default:
+		err := VerifySignature(path, nil)
+		if errors.Is(err, ErrSelfSigned) {
+			fmt.Println(Tr(msgSignatureUnverified, path))
+			return 1
+		}
+		PrintError("verify-signature", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// watchDebounce is how long the watch loop waits for a build to settle
+// after the first change before it checks the files
+const watchDebounce = 200 * time.Millisecond
+
+// changeNotifier wakes up the watch loop when something below the watched
+// paths may have changed. It is implemented with inotify on Linux, kqueue
+// on FreeBSD and macOS, and by polling elsewhere
+type changeNotifier interface {
+	// watch replaces the watched files and directories
+	watch(files, dirs []string) error
+	// changes delivers a value after something changed
+	changes() <-chan struct{}
+	close() error
+}
+
+// watchedFile is what the watch loop remembers about a file
+type watchedFile struct {
+	modTime  time.Time
+	fileSize int64
+	elfSize  int64 // -1 if not an ELF file
+}
+
+// watchCommand implements "elfsize --watch <file or directory>..."
+func watchCommand(roots []string) int {
+	if len(roots) == 0 {
+		fmt.Fprintf(os.Stderr, "USAGE: %s --watch <file or directory>...\n", os.Args[0])
+		return 2
+	}
+	notifier, err := newChangeNotifier()
+	if err != nil {
+		PrintError("watch", err)
+		return 1
+	}
+	defer notifier.close()
+
+	known := map[string]watchedFile{}
+	first := true
+	for {
+		files, dirs := watchWalk(roots)
+		seen := map[string]bool{}
+		for _, path := range files {
+			seen[path] = true
+			stat, err := os.Stat(path)
+			if err != nil || !stat.Mode().IsRegular() {
+				continue
+			}
+			old, ok := known[path]
+			if ok && old.modTime.Equal(stat.ModTime()) && old.fileSize == stat.Size() {
+				continue
+			}
+			w := watchedFile{modTime: stat.ModTime(), fileSize: stat.Size(), elfSize: -1}
+			if size, err := CalculateElfSizeWith(path, HeaderEnd); err == nil {
+				w.elfSize = size
+			}
+			known[path] = w
+			switch {
+			case w.elfSize < 0:
+			case !ok || old.elfSize < 0:
+				fmt.Printf("%d\t%s\n", w.elfSize, path)
+			case old.elfSize != w.elfSize:
+				fmt.Printf("%d\t%s\t%+d\n", w.elfSize, path, w.elfSize-old.elfSize)
+			}
+		}
+		for path, w := range known {
+			if !seen[path] {
+				if w.elfSize >= 0 && !first {
+					fmt.Printf("-\t%s\n", path)
+				}
+				delete(known, path)
+			}
+		}
+		first = false
+
+		if err := notifier.watch(files, dirs); err != nil {
+			PrintError("watch", err)
+			return 1
+		}
+		<-notifier.changes()
+		// Let the build finish writing, then take all pending changes at once
+		time.Sleep(watchDebounce)
+		select {
+		case <-notifier.changes():
+		default:
+		}
+	}
+}
+
+// watchWalk lists the files and directories below roots, in a stable order
+func watchWalk(roots []string) (files, dirs []string) {
+	for _, root := range roots {
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				dirs = append(dirs, path)
+			} else {
+				files = append(files, path)
+			}
+			return nil
+		})
+	}
+	sort.Strings(files)
+	return files, dirs
+}
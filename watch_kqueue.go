@@ -0,0 +1,96 @@
+//go:build freebsd || darwin
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// kqueueNotifier watches every file and directory with an EVFILT_VNODE
+// filter, which needs an open descriptor for each
+type kqueueNotifier struct {
+	kq  int
+	fds map[string]kqueueWatch
+	ch  chan struct{}
+}
+
+// kqueueWatch is an open descriptor and the inode it refers to
+type kqueueWatch struct {
+	fd  int
+	ino uint64
+}
+
+func newChangeNotifier() (changeNotifier, error) {
+	kq, err := syscall.Kqueue()
+	if err != nil {
+		return nil, err
+	}
+	n := &kqueueNotifier{kq: kq, fds: map[string]kqueueWatch{}, ch: make(chan struct{}, 1)}
+	go n.read()
+	return n, nil
+}
+
+// read signals every batch of events until the queue is closed
+func (n *kqueueNotifier) read() {
+	events := make([]syscall.Kevent_t, 64)
+	for {
+		if _, err := syscall.Kevent(n.kq, nil, events, nil); err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			return
+		}
+		select {
+		case n.ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// watch opens descriptors for new paths and closes those of paths that are
+// gone or now refer to another file, as after a linker replaced a binary
+func (n *kqueueNotifier) watch(files, dirs []string) error {
+	wanted := map[string]uint64{}
+	for _, path := range append(files, dirs...) {
+		var stat syscall.Stat_t
+		if err := syscall.Stat(path, &stat); err == nil {
+			wanted[path] = uint64(stat.Ino)
+		}
+	}
+	for path, w := range n.fds {
+		if ino, ok := wanted[path]; !ok || ino != w.ino {
+			syscall.Close(w.fd)
+			delete(n.fds, path)
+		}
+	}
+	for path, ino := range wanted {
+		if _, ok := n.fds[path]; ok {
+			continue
+		}
+		fd, err := syscall.Open(path, syscall.O_RDONLY|syscall.O_CLOEXEC|syscall.O_NONBLOCK, 0)
+		if err != nil {
+			continue
+		}
+		var ev syscall.Kevent_t
+		syscall.SetKevent(&ev, fd, syscall.EVFILT_VNODE, syscall.EV_ADD|syscall.EV_CLEAR)
+		ev.Fflags = syscall.NOTE_WRITE | syscall.NOTE_EXTEND | syscall.NOTE_ATTRIB | syscall.NOTE_DELETE | syscall.NOTE_RENAME
+		if _, err := syscall.Kevent(n.kq, []syscall.Kevent_t{ev}, nil, nil); err != nil {
+			syscall.Close(fd)
+			return &os.PathError{Op: "kevent", Path: path, Err: err}
+		}
+		n.fds[path] = kqueueWatch{fd, ino}
+	}
+	return nil
+}
+
+func (n *kqueueNotifier) changes() <-chan struct{} {
+	return n.ch
+}
+
+func (n *kqueueNotifier) close() error {
+	for _, w := range n.fds {
+		syscall.Close(w.fd)
+	}
+	return syscall.Close(n.kq)
+}
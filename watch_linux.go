@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// inotifyNotifier watches directories with inotify; events for the files in
+// them arrive through their directory, even if the files are replaced
+type inotifyNotifier struct {
+	fd int
+	ch chan struct{}
+}
+
+func newChangeNotifier() (changeNotifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	n := &inotifyNotifier{fd: fd, ch: make(chan struct{}, 1)}
+	go n.read()
+	return n, nil
+}
+
+// read signals every batch of events until the descriptor is closed
+func (n *inotifyNotifier) read() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		if _, err := syscall.Read(n.fd, buf); err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			return
+		}
+		select {
+		case n.ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// watch adds the directories and the parents of the files; adding a watch
+// twice keeps the existing one, and the kernel drops those of removed
+// directories by itself
+func (n *inotifyNotifier) watch(files, dirs []string) error {
+	const mask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_MOVED_FROM |
+		syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_ATTRIB
+	paths := map[string]bool{}
+	for _, dir := range dirs {
+		paths[dir] = true
+	}
+	for _, file := range files {
+		paths[filepath.Dir(file)] = true
+	}
+	for path := range paths {
+		if _, err := syscall.InotifyAddWatch(n.fd, path, mask); err != nil && err != syscall.ENOENT {
+			return &os.PathError{Op: "inotify_add_watch", Path: path, Err: err}
+		}
+	}
+	return nil
+}
+
+func (n *inotifyNotifier) changes() <-chan struct{} {
+	return n.ch
+}
+
+func (n *inotifyNotifier) close() error {
+	return syscall.Close(n.fd)
+}
@@ -0,0 +1,41 @@
+//go:build !linux && !freebsd && !darwin
+
+package main
+
+import "time"
+
+// watchPollInterval is how often files are checked without a notification
+// mechanism
+const watchPollInterval = time.Second
+
+// pollNotifier reports a possible change every watchPollInterval
+type pollNotifier struct {
+	ticker *time.Ticker
+	ch     chan struct{}
+}
+
+func newChangeNotifier() (changeNotifier, error) {
+	n := &pollNotifier{ticker: time.NewTicker(watchPollInterval), ch: make(chan struct{}, 1)}
+	go func() {
+		for range n.ticker.C {
+			select {
+			case n.ch <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return n, nil
+}
+
+func (n *pollNotifier) watch(files, dirs []string) error {
+	return nil
+}
+
+func (n *pollNotifier) changes() <-chan struct{} {
+	return n.ch
+}
+
+func (n *pollNotifier) close() error {
+	n.ticker.Stop()
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// extattrNamespaceUser is EXTATTR_NAMESPACE_USER from <sys/extattr.h>
+const extattrNamespaceUser = 1
+
+// setXattr sets an extended attribute of a file in the user namespace with
+// extattr_set_file(2), which the syscall package has no wrapper for
+func setXattr(path, name, value string) error {
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+	n, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return err
+	}
+	data := []byte(value)
+	var ptr unsafe.Pointer
+	if len(data) > 0 {
+		ptr = unsafe.Pointer(&data[0])
+	}
+	_, _, errno := syscall.Syscall6(syscall.SYS_EXTATTR_SET_FILE, uintptr(unsafe.Pointer(p)), extattrNamespaceUser, uintptr(unsafe.Pointer(n)), uintptr(ptr), uintptr(len(data)), 0)
+	if errno != 0 {
+		return &os.PathError{Op: "extattr_set_file", Path: path, Err: errno}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// setXattr sets an extended attribute of a file in the user namespace
+func setXattr(path, name, value string) error {
+	if err := syscall.Setxattr(path, "user."+name, []byte(value), 0); err != nil {
+		return &os.PathError{Op: "setxattr", Path: path, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !freebsd
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// setXattr is not implemented on this system
+func setXattr(path, name, value string) error {
+	return &os.PathError{Op: "setxattr", Path: path, Err: errors.New(Tr(msgNoXattr))}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"archive/zip"
+	"io"
+	iofs "io/fs"
+	"path"
+	"slices"
+	"strings"
+)
+
+// zipFS reads the files of a zip archive, which may follow an ELF image as
+// in zip-based type-1 AppImages
+type zipFS struct {
+	files map[string]*zip.File // by cleaned name, without a trailing slash
+	dirs  map[string]bool      // also those only implied by the names of files
+}
+
+// openZip reads the central directory of a zip archive at the end of r,
+// which is size bytes long
+func openZip(r io.ReaderAt, size int64) (*zipFS, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	fs := &zipFS{files: map[string]*zip.File{}, dirs: map[string]bool{}}
+	for _, f := range zr.File {
+		name := path.Clean("/" + f.Name)[1:]
+		if name == "" {
+			continue
+		}
+		if f.FileInfo().IsDir() {
+			fs.dirs[name] = true
+		} else {
+			fs.files[name] = f
+		}
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			fs.dirs[dir] = true
+		}
+	}
+	return fs, nil
+}
+
+// read returns the contents of a file, or the target of a symbolic link
+func (fs *zipFS) read(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, int64(f.UncompressedSize64)))
+}
+
+// lookupPath finds a file by its path from the root of the archive,
+// following symbolic links within it; absolute ones start at its root
+func (fs *zipFS) lookupPath(name string) (*zip.File, bool, error) {
+	var dirs []string
+	parts := imagePathComponents(name)
+	for hops := 0; len(parts) > 0; {
+		part := parts[0]
+		parts = parts[1:]
+		if part == ".." {
+			if len(dirs) > 0 {
+				dirs = dirs[:len(dirs)-1]
+			}
+			continue
+		}
+		name := strings.Join(append(dirs, part), "/")
+		f := fs.files[name]
+		switch {
+		case f != nil && f.Mode()&iofs.ModeSymlink != 0:
+			if hops++; hops > maxImageLinkHops {
+				return nil, false, nil
+			}
+			target, err := fs.read(f)
+			if err != nil {
+				return nil, false, err
+			}
+			if strings.HasPrefix(string(target), "/") {
+				dirs = nil
+			}
+			parts = append(imagePathComponents(string(target)), parts...)
+		case f == nil && fs.dirs[name]:
+			dirs = append(dirs, part)
+		case f == nil || len(parts) > 0:
+			return nil, false, nil
+		default:
+			return f, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// readPath returns the contents of a regular file found by lookupPath
+func (fs *zipFS) readPath(name string) ([]byte, bool, error) {
+	f, ok, err := fs.lookupPath(name)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	data, err := fs.read(f)
+	return data, err == nil, err
+}
+
+// rootNames lists the root directory
+func (fs *zipFS) rootNames() ([]string, error) {
+	var names []string
+	for name := range fs.files {
+		if !strings.Contains(name, "/") {
+			names = append(names, name)
+		}
+	}
+	for name := range fs.dirs {
+		if !strings.Contains(name, "/") {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// readRootFile returns the contents of a file in the root directory
+func (fs *zipFS) readRootFile(name string) ([]byte, bool, error) {
+	if strings.Contains(name, "/") {
+		return nil, false, nil
+	}
+	return fs.readPath(name)
+}
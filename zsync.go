@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ZsyncOptions controls the control file written by WriteZsync
+type ZsyncOptions struct {
+	URL       string // URL of the file, relative to the control file; defaults to its name
+	BlockSize int64  // 0 picks 2048, or 4096 for files of 100 MB and more, like zsyncmake
+	Payload   bool   // describe only the payload of an AppImage instead of the whole file
+}
+
+// WriteZsync writes a zsync 0.6.2 control file for a file, which zsync uses
+// to download only the blocks that changed since a previous version
+func WriteZsync(path string, w io.Writer, opts ZsyncOptions) error {
+	return WriteZsyncContext(context.Background(), path, w, opts)
+}
+
+// WriteZsyncContext is WriteZsync, stopping with ctx.Err() when ctx is done
+func WriteZsyncContext(ctx context.Context, path string, w io.Writer, opts ZsyncOptions) error {
+	f, err := openFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	var start int64
+	if opts.Payload {
+		payload, err := GetPayload(path)
+		if err != nil {
+			return err
+		}
+		if payload == nil {
+			return errors.New(Tr(msgNoPayload, path))
+		}
+		start = payload.Offset
+	}
+	length := stat.Size() - start
+	blockSize := opts.BlockSize
+	if blockSize == 0 {
+		blockSize = 2048
+		if length >= 100_000_000 {
+			blockSize = 4096
+		}
+	}
+	if blockSize <= 0 || blockSize&(blockSize-1) != 0 {
+		return errors.New(Tr(msgBadBlockSize, blockSize))
+	}
+	seqMatches, rsumLen, checksumLen := zsyncHashLengths(length, blockSize)
+
+	// The block checksums follow the header, which ends with the SHA-1 of
+	// the whole file, so hash everything first
+	sum := sha1.New()
+	var checksums []byte
+	block := make([]byte, blockSize)
+	r := io.NewSectionReader(f, start, length)
+	p := startProgress(ctx, length)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := io.ReadFull(r, block)
+		if n == 0 {
+			break
+		}
+		sum.Write(block[:n])
+		p.add(int64(n))
+		clear(block[n:])
+		var rsum [4]byte
+		a, b := zsyncRsum(block)
+		binary.BigEndian.PutUint16(rsum[0:], a)
+		binary.BigEndian.PutUint16(rsum[2:], b)
+		md4 := md4Sum(block)
+		checksums = append(checksums, rsum[4-rsumLen:]...)
+		checksums = append(checksums, md4[:checksumLen]...)
+		if err != nil {
+			break
+		}
+	}
+
+	url := opts.URL
+	if url == "" {
+		url = filepath.Base(path)
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "zsync: 0.6.2\n")
+	fmt.Fprintf(bw, "Filename: %s\n", filepath.Base(path))
+	fmt.Fprintf(bw, "MTime: %s\n", stat.ModTime().UTC().Format(time.RFC1123Z))
+	fmt.Fprintf(bw, "Blocksize: %d\n", blockSize)
+	fmt.Fprintf(bw, "Length: %d\n", length)
+	fmt.Fprintf(bw, "Hash-Lengths: %d,%d,%d\n", seqMatches, rsumLen, checksumLen)
+	fmt.Fprintf(bw, "URL: %s\n", url)
+	fmt.Fprintf(bw, "SHA-1: %s\n\n", hex.EncodeToString(sum.Sum(nil)))
+	bw.Write(checksums)
+	return bw.Flush()
+}
+
+// zsyncHashLengths returns how many consecutive blocks must match and how
+// many bytes of the rolling and strong checksums to store, computed like
+// zsyncmake does to keep false positives unlikely
+func zsyncHashLengths(length, blockSize int64) (seqMatches, rsumLen, checksumLen int) {
+	seqMatches = 1
+	if length > blockSize {
+		seqMatches = 2
+	}
+	l, bs := math.Log(float64(length)), math.Log(float64(blockSize))
+	blocks := math.Log(float64(1 + length/blockSize))
+	rsumLen = int(math.Ceil(((l+bs)/math.Ln2 - 8.6) / float64(seqMatches) / 8))
+	rsumLen = min(max(rsumLen, 2), 4)
+	checksumLen = int(math.Ceil((20 + (l+blocks)/math.Ln2) / float64(seqMatches) / 8))
+	checksumLen = min(max(checksumLen, int((7.9+(20+blocks/math.Ln2))/8)), 16)
+	return seqMatches, rsumLen, checksumLen
+}
+
+// zsyncRsum is the rolling checksum of a block
+func zsyncRsum(block []byte) (a, b uint16) {
+	n := len(block)
+	for i, c := range block {
+		a += uint16(c)
+		b += uint16(n-i) * uint16(c)
+	}
+	return a, b
+}
+
+// md4Sum returns the MD4 digest of data (RFC 1320), the strong checksum of
+// zsync, which the standard library does not provide
+func md4Sum(data []byte) [16]byte {
+	msg := append([]byte{}, data...)
+	msg = append(msg, 0x80)
+	for len(msg)%64 != 56 {
+		msg = append(msg, 0)
+	}
+	msg = binary.LittleEndian.AppendUint64(msg, uint64(len(data))*8)
+
+	h := [4]uint32{0x67452301, 0xefcdab89, 0x98badcfe, 0x10325476}
+	var x [16]uint32
+	for ; len(msg) > 0; msg = msg[64:] {
+		for i := range x {
+			x[i] = binary.LittleEndian.Uint32(msg[i*4:])
+		}
+		a, b, c, d := h[0], h[1], h[2], h[3]
+		for i := 0; i < 16; i++ {
+			s := [4]int{3, 7, 11, 19}[i%4]
+			a = bits.RotateLeft32(a+(b&c|^b&d)+x[i], s)
+			a, b, c, d = d, a, b, c
+		}
+		for i := 0; i < 16; i++ {
+			s := [4]int{3, 5, 9, 13}[i%4]
+			a = bits.RotateLeft32(a+(b&c|b&d|c&d)+x[i%4*4+i/4]+0x5a827999, s)
+			a, b, c, d = d, a, b, c
+		}
+		for i := 0; i < 16; i++ {
+			s := [4]int{3, 9, 11, 15}[i%4]
+			k := [16]int{0, 8, 4, 12, 2, 10, 6, 14, 1, 9, 5, 13, 3, 11, 7, 15}[i]
+			a = bits.RotateLeft32(a+(b^c^d)+x[k]+0x6ed9eba1, s)
+			a, b, c, d = d, a, b, c
+		}
+		h[0], h[1], h[2], h[3] = h[0]+a, h[1]+b, h[2]+c, h[3]+d
+	}
+	var sum [16]byte
+	for i, v := range h {
+		binary.LittleEndian.PutUint32(sum[i*4:], v)
+	}
+	return sum
+}
+
+// zsyncCommand implements "elfsize zsync <file> [-o file.zsync] [-u url]"
+func zsyncCommand(args []string) int {
+	fs := flag.NewFlagSet("zsync", flag.ContinueOnError)
+	output := fs.String("o", "", "write the control file here instead of <file>.zsync, or to stdout if it is '-'")
+	var opts ZsyncOptions
+	fs.StringVar(&opts.URL, "u", "", "URL of the file, relative to the control file (default: its name)")
+	fs.Int64Var(&opts.BlockSize, "b", 0, "block size, a power of two (default: 2048, or 4096 for files of 100 MB and more)")
+	fs.BoolVar(&opts.Payload, "payload", false, "describe only the filesystem image an AppImage carries")
+	fs.BoolVar(&SafeOpen, "safe-open", false, "refuse to open symbolic links and special files")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "USAGE: %s zsync <file> [-o file.zsync] [-u url]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "    Write a zsync control file for delta updates of a file\n")
+		fs.PrintDefaults()
+	}
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	if *output == "-" {
+		if err := WriteZsync(positional[0], os.Stdout, opts); err != nil {
+			PrintError("zsync", err)
+			return 1
+		}
+		return 0
+	}
+	if *output == "" {
+		*output = positional[0] + ".zsync"
+	}
+	out, err := os.Create(*output)
+	if err != nil {
+		PrintError("zsync", err)
+		return 1
+	}
+	if err := WriteZsync(positional[0], out, opts); err != nil {
+		out.Close()
+		os.Remove(*output)
+		PrintError("zsync", err)
+		return 1
+	}
+	if err := out.Close(); err != nil {
+		PrintError("zsync", err)
+		return 1
+	}
+	return 0
+}